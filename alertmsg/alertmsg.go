@@ -0,0 +1,427 @@
+// Package alertmsg renders alert messages from templates, which can be
+// changed per alert type and channel: Go text/template templates for plain
+// text channels such as email, and html/template templates for Telegram,
+// whose messages are HTML.
+package alertmsg
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"price-watcher/digest"
+	"price-watcher/money"
+)
+
+// Channels whose alerts can have their own templates. Telegram templates
+// are HTML; the others, and the message stored with an alert, plain text.
+const (
+	ChannelTelegram = "telegram"
+	ChannelEmail    = "email"
+)
+
+// Types lists the alert types templates can be given for.
+var Types = []string{digest.AlertLow, digest.AlertTarget, digest.AlertGroup, digest.AlertIncrease, digest.AlertVolatile, digest.AlertNormal}
+
+// Channels lists the channels templates can be given for.
+var Channels = []string{ChannelTelegram, ChannelEmail}
+
+// Data is what an alert template is rendered with.
+type Data struct {
+	// Type is the alert type: "low" (lowest price in LowestDays), "target"
+	// (the target price reached), "group" (a group's best price dropped),
+	// or one of the opt-in "increase" (the price rose), "volatile" (the
+	// price moved much more than usual) and "normal" (the price is back to
+	// normal after a sale).
+	Type string
+	// Rule says what fired the alert, e.g. "lowest in 30 days".
+	Rule string
+	// Product is the product alerted about or, on group alerts, the
+	// listing now offering the group's best price.
+	Product Product
+	// Group is set on group alerts.
+	Group *Group
+	// Location is the delivery location the price was seen at, "" for the
+	// shop's default.
+	Location string
+	// Seen is when the price was seen, on the user's clock.
+	Seen string
+
+	// Previous and Current are the price before and now, and Savings the
+	// difference; on effective price alerts they are after offers, and on
+	// group alerts in the group's currency.
+	Previous money.Money
+	Current  money.Money
+	Savings  money.Money
+	// PreviousConverted and CurrentConverted are the prices in the display
+	// currency, such as "$12.34", or "" without one.
+	PreviousConverted string
+	CurrentConverted  string
+	// ListedPrice is, on effective price alerts, the price before offers
+	// and, on group alerts, the listing's price in its own currency when
+	// that is not the group's; nil otherwise.
+	ListedPrice *money.Money
+	// Offers are the offers that make up the effective price.
+	Offers []string
+	// PreviousUnit and CurrentUnit are unit prices, such as "₹120.00/kg",
+	// when the alert compared them; on group alerts CurrentUnit is the
+	// listing's.
+	PreviousUnit string
+	CurrentUnit  string
+
+	// Lowest is the lowest price, or unit price, in LowestDays, and
+	// AtLowest whether Current is it.
+	LowestDays int
+	Lowest     string
+	AtLowest   bool
+	// Target is the target price, and ReachedTarget whether the price
+	// just reached it.
+	Target        *money.Money
+	ReachedTarget bool
+
+	// ChangePercent is the change from Previous to Current, in percent.
+	ChangePercent float64
+	// Usual is, on back-to-normal alerts, the usual price before the sale.
+	Usual *money.Money
+	// Volatility and UsualVolatility are, on volatility alerts, how much
+	// the price moved over the last week and usually, in percent a day.
+	Volatility      float64
+	UsualVolatility float64
+
+	// Stats and Verdict summarise the price history and whether to buy
+	// now, and Warning says why a drop may not be a real discount; each
+	// is "" if unknown.
+	Stats   string
+	Verdict string
+	Warning string
+
+	Links Links
+}
+
+// Product is the product in Data.
+type Product struct {
+	ID       string
+	Name     string
+	Platform string
+	URL      string
+}
+
+// Group is the group in Data.
+type Group struct {
+	ID   string
+	Name string
+}
+
+// Links are the links in Data.
+type Links struct {
+	// Listing is the product's page on the shop.
+	Listing string
+	// Page is the product's, or group's, page in Price Watcher, "" unless
+	// PUBLIC_URL is set.
+	Page string
+}
+
+// Defaults are the built-in templates, by name.
+var Defaults = map[string]string{
+	digest.AlertLow:                            lowText,
+	digest.AlertLow + "." + ChannelTelegram:    lowTelegram,
+	digest.AlertTarget:                         lowText,
+	digest.AlertTarget + "." + ChannelTelegram: lowTelegram,
+	digest.AlertGroup:                          groupText,
+	digest.AlertGroup + "." + ChannelTelegram:  groupTelegram,
+
+	digest.AlertIncrease:                         movementText,
+	digest.AlertIncrease + "." + ChannelTelegram: movementTelegram,
+	digest.AlertVolatile:                         movementText,
+	digest.AlertVolatile + "." + ChannelTelegram: movementTelegram,
+	digest.AlertNormal:                           movementText,
+	digest.AlertNormal + "." + ChannelTelegram:   movementTelegram,
+}
+
+const lowText = `🚨 PRICE DROP ALERT! 🚨
+
+Product: {{.Product.Name}}
+Platform: {{.Product.Platform}}
+Seen: {{.Seen}}
+{{with .Location}}Location: {{.}}
+{{end}}{{with .ListedPrice}}Listed Price: {{.Format}}
+{{end}}{{range .Offers}}Offer: {{.}}
+{{end}}Previous Price: {{.Previous.Format}}{{with .PreviousConverted}} (≈ {{.}}){{end}}
+Current Price: {{.Current.Format}}{{with .CurrentConverted}} (≈ {{.}}){{end}}
+{{if .CurrentUnit}}Unit Price: {{.PreviousUnit}} → {{.CurrentUnit}}
+{{end}}Savings: {{.Savings.Format}}
+Lowest in {{.LowestDays}} days: {{if .AtLowest}}YES! 🎉{{else}}{{.Lowest}}{{end}}
+{{with .Stats}}{{.}}
+{{end}}{{with .Verdict}}{{.}}
+{{end}}{{with .Warning}}{{.}}
+{{end}}{{if .ReachedTarget}}🎯 Target price {{.Target.Format}} reached!
+{{end}}
+🔗 {{.Links.Listing}}{{with .Links.Page}}
+📈 {{.}}{{end}}`
+
+const lowTelegram = `🚨 <b>PRICE DROP ALERT!</b> 🚨
+
+📦 <b>Product:</b> {{.Product.Name}}
+🏪 <b>Platform:</b> {{.Product.Platform}}
+🕒 <b>Seen:</b> {{.Seen}}
+{{with .Location}}📍 <b>Location:</b> {{.}}
+{{end}}{{with .ListedPrice}}🏷 <b>Listed Price:</b> {{.Format}}
+{{end}}{{range .Offers}}🎟 <b>Offer:</b> {{.}}
+{{end}}💰 <b>Previous Price:</b> {{.Previous.Format}}{{with .PreviousConverted}} (≈ {{.}}){{end}}
+💸 <b>Current Price:</b> {{.Current.Format}}{{with .CurrentConverted}} (≈ {{.}}){{end}}
+{{if .CurrentUnit}}⚖️ <b>Unit Price:</b> {{.PreviousUnit}} → {{.CurrentUnit}}
+{{end}}💵 <b>Savings:</b> {{.Savings.Format}}
+📉 <b>Lowest in {{.LowestDays}} days:</b> {{if .AtLowest}}YES! 🎉{{else}}{{.Lowest}}{{end}}
+{{with .Stats}}{{.}}
+{{end}}{{with .Verdict}}{{.}}
+{{end}}{{with .Warning}}⚠️ {{.}}
+{{end}}{{if .ReachedTarget}}🎯 <b>Target price {{.Target.Format}} reached!</b>
+{{end}}
+🔗 <a href="{{.Links.Listing}}">View Product</a>{{with .Links.Page}} · <a href="{{.}}">Price history</a>{{end}}`
+
+const groupText = `📉 GROUP BEST PRICE DROP! 📉
+
+Group: {{.Group.Name}}
+Seen: {{.Seen}}
+Previous Best: {{.Previous.Format}}
+Best Now: {{with .ListedPrice}}{{.Format}} (≈ {{$.Current.Format}}){{else}}{{.Current.Format}}{{end}}{{with .CurrentUnit}}, {{.}}{{end}} on {{.Product.Platform}} ({{.Product.Name}})
+Savings: {{.Savings.Format}}
+{{if .ReachedTarget}}🎯 Target price {{.Target.Format}} reached!
+{{end}}
+🔗 {{.Links.Listing}}{{with .Links.Page}}
+📈 {{.}}{{end}}`
+
+const groupTelegram = `📉 <b>GROUP BEST PRICE DROP!</b> 📉
+
+🗂 <b>Group:</b> {{.Group.Name}}
+🕒 <b>Seen:</b> {{.Seen}}
+💰 <b>Previous Best:</b> {{.Previous.Format}}
+💸 <b>Best Now:</b> {{with .ListedPrice}}{{.Format}} (≈ {{$.Current.Format}}){{else}}{{.Current.Format}}{{end}}{{with .CurrentUnit}}, {{.}}{{end}} on {{.Product.Platform}} ({{.Product.Name}})
+💵 <b>Savings:</b> {{.Savings.Format}}
+{{if .ReachedTarget}}🎯 <b>Target price {{.Target.Format}} reached!</b>
+{{end}}
+🔗 <a href="{{.Links.Listing}}">View Product</a>{{with .Links.Page}} · <a href="{{.}}">Group</a>{{end}}`
+
+const movementText = `{{if eq .Type "increase"}}📈 PRICE INCREASE ALERT! 📈{{else if eq .Type "volatile"}}🎢 PRICE VOLATILITY ALERT! 🎢{{else}}↩️ PRICE BACK TO NORMAL ↩️{{end}}
+
+Product: {{.Product.Name}}
+Platform: {{.Product.Platform}}
+Seen: {{.Seen}}
+{{with .Location}}Location: {{.}}
+{{end}}Previous Price: {{.Previous.Format}}{{with .PreviousConverted}} (≈ {{.}}){{end}}
+Current Price: {{.Current.Format}}{{with .CurrentConverted}} (≈ {{.}}){{end}}
+Change: {{printf "%+.1f%%" .ChangePercent}}
+{{with .Usual}}Usual Price: {{.Format}}
+{{end}}{{if .Volatility}}Volatility: {{printf "%.1f%%" .Volatility}} a day this week, {{printf "%.1f%%" .UsualVolatility}} usually
+{{end}}Why: {{.Rule}}
+{{with .Stats}}{{.}}
+{{end}}
+🔗 {{.Links.Listing}}{{with .Links.Page}}
+📈 {{.}}{{end}}`
+
+const movementTelegram = `{{if eq .Type "increase"}}📈 <b>PRICE INCREASE ALERT!</b> 📈{{else if eq .Type "volatile"}}🎢 <b>PRICE VOLATILITY ALERT!</b> 🎢{{else}}↩️ <b>PRICE BACK TO NORMAL</b> ↩️{{end}}
+
+📦 <b>Product:</b> {{.Product.Name}}
+🏪 <b>Platform:</b> {{.Product.Platform}}
+🕒 <b>Seen:</b> {{.Seen}}
+{{with .Location}}📍 <b>Location:</b> {{.}}
+{{end}}💰 <b>Previous Price:</b> {{.Previous.Format}}{{with .PreviousConverted}} (≈ {{.}}){{end}}
+💸 <b>Current Price:</b> {{.Current.Format}}{{with .CurrentConverted}} (≈ {{.}}){{end}}
+📊 <b>Change:</b> {{printf "%+.1f%%" .ChangePercent}}
+{{with .Usual}}🏷 <b>Usual Price:</b> {{.Format}}
+{{end}}{{if .Volatility}}🎢 <b>Volatility:</b> {{printf "%.1f%%" .Volatility}} a day this week, {{printf "%.1f%%" .UsualVolatility}} usually
+{{end}}ℹ️ <b>Why:</b> {{.Rule}}
+{{with .Stats}}{{.}}
+{{end}}
+🔗 <a href="{{.Links.Listing}}">View Product</a>{{with .Links.Page}} · <a href="{{.}}">Price history</a>{{end}}`
+
+// ParseName splits a template name, such as "low" or "group.telegram",
+// into its alert type and channel, "" if it is for every channel.
+func ParseName(name string) (alertType, channel string, err error) {
+	alertType, channel, _ = strings.Cut(name, ".")
+	if !slices.Contains(Types, alertType) {
+		return "", "", fmt.Errorf("invalid template name %q: must start with %s", name, strings.Join(Types, ", "))
+	}
+	if channel != "" && !slices.Contains(Channels, channel) {
+		return "", "", fmt.Errorf("invalid template name %q: channel must be %s", name, strings.Join(Channels, " or "))
+	}
+	return alertType, channel, nil
+}
+
+// Name returns the name of the template of an alert type on a channel, or
+// on every channel if channel is "".
+func Name(alertType, channel string) string {
+	if channel == "" {
+		return alertType
+	}
+	return alertType + "." + channel
+}
+
+// Set is the templates in use: those stored, then those in files, then
+// the defaults.
+type Set struct {
+	sources []map[string]string
+}
+
+// New returns the templates of sources, each mapping template names to
+// templates, earlier sources taking precedence, over the defaults.
+func New(sources ...map[string]string) Set {
+	return Set{sources: append(slices.Clone(sources), Defaults)}
+}
+
+// Lookup returns the template of an alert type on a channel: the first
+// source's template for the channel or else for every channel, and so on.
+func (s Set) Lookup(alertType, channel string) (name, body string) {
+	names := []string{alertType}
+	if channel != "" {
+		names = []string{Name(alertType, channel), alertType}
+	}
+	for _, source := range s.sources {
+		for _, name := range names {
+			if body, ok := source[name]; ok {
+				return name, body
+			}
+		}
+	}
+	return alertType, ""
+}
+
+// Render renders the template of data's alert type on a channel. If a
+// template that is not a default fails, the default is rendered instead
+// and the failure returned along with it.
+func (s Set) Render(channel string, data Data) (string, error) {
+	name, body := s.Lookup(data.Type, channel)
+	message, err := Render(name, body, channel, data)
+	if err == nil {
+		return message, nil
+	}
+	name, body = New().Lookup(data.Type, channel)
+	message, defaultErr := Render(name, body, channel, data)
+	if defaultErr != nil {
+		return "", defaultErr
+	}
+	return message, err
+}
+
+// Render renders a template for a channel: with html/template for
+// Telegram, and text/template otherwise.
+func Render(name, body, channel string, data Data) (string, error) {
+	var buf bytes.Buffer
+	if channel == ChannelTelegram {
+		tmpl, err := htmltemplate.New(name).Parse(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+		}
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render template %s: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	tmpl, err := template.New(name).Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// Check reports whether a template named name parses and renders against
+// Example data of its alert type.
+func Check(name, body string) error {
+	alertType, channel, err := ParseName(name)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("template %s is empty", name)
+	}
+	channels := []string{channel}
+	if channel == "" {
+		// A template for every channel is also rendered as Telegram HTML.
+		channels = append(channels, ChannelTelegram)
+	}
+	for _, ch := range channels {
+		if _, err := Render(name, body, ch, Example(alertType)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadDir reads the templates in the *.tmpl files of dir, named after the
+// file, such as low.telegram.tmpl. An empty dir has none.
+func ReadDir(dir string) (map[string]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert templates: %w", err)
+	}
+	templates := make(map[string]string, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		if _, _, err := ParseName(name); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read alert template: %w", err)
+		}
+		templates[name] = string(body)
+	}
+	return templates, nil
+}
+
+// Example returns made-up data of an alert type, to try templates on.
+func Example(alertType string) Data {
+	previous, current := money.New(129900, "INR"), money.New(99900, "INR")
+	target := money.New(100000, "INR")
+	data := Data{
+		Type:              alertType,
+		Rule:              "lowest in 30 days",
+		Product:           Product{ID: "example", Name: "Example Phone", Platform: "amazon", URL: "https://www.amazon.in/dp/EXAMPLE"},
+		Seen:              time.Date(2024, 10, 18, 9, 30, 0, 0, time.UTC).Format("Jan 02, 15:04 MST"),
+		Previous:          previous,
+		Current:           current,
+		Savings:           previous.Sub(current),
+		PreviousConverted: "$15.48",
+		CurrentConverted:  "$11.90",
+		LowestDays:        30,
+		Lowest:            current.Format(),
+		AtLowest:          true,
+		Target:            &target,
+		Stats:             "Lowest in 90 days · 12% below the 30-day average",
+		Verdict:           "Good deal (score 82/100): a further drop in 14 days is unlikely (20%)",
+		Links:             Links{Listing: "https://www.amazon.in/dp/EXAMPLE"},
+	}
+	switch alertType {
+	case digest.AlertTarget:
+		data.Rule, data.ReachedTarget = "target price ₹1000.00 reached", true
+	case digest.AlertGroup:
+		data.Rule, data.Group = "new best price of Example Phones", &Group{ID: "example", Name: "Example Phones"}
+	case digest.AlertIncrease, digest.AlertVolatile, digest.AlertNormal:
+		data.Previous, data.Current = current, previous
+		data.Savings, data.ChangePercent = current.Sub(previous), previous.Sub(current).PercentOf(current)
+		data.PreviousConverted, data.CurrentConverted = "$11.90", "$15.48"
+		data.AtLowest = false
+		switch alertType {
+		case digest.AlertIncrease:
+			data.Rule = "up 30.0% from ₹999.00"
+		case digest.AlertVolatile:
+			data.Rule, data.Volatility, data.UsualVolatility = "moving 6.2% a day over 7 days, against 0.8% usually", 6.2, 0.8
+		case digest.AlertNormal:
+			data.Rule, data.Usual = "back to the usual ₹1299.00 after a sale at ₹999.00", &previous
+		}
+	}
+	return data
+}
@@ -0,0 +1,129 @@
+package alertmsg
+
+import (
+	"strings"
+	"testing"
+
+	"price-watcher/digest"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name        string
+		wantType    string
+		wantChannel string
+		wantErr     bool
+	}{
+		{"low", digest.AlertLow, "", false},
+		{"group.telegram", digest.AlertGroup, ChannelTelegram, false},
+		{"target.email", digest.AlertTarget, ChannelEmail, false},
+		{"normal.telegram", digest.AlertNormal, ChannelTelegram, false},
+		{"drop", "", "", true},
+		{"low.sms", "", "", true},
+	}
+
+	for _, tt := range tests {
+		alertType, channel, err := ParseName(tt.name)
+		if (err != nil) != tt.wantErr || alertType != tt.wantType || channel != tt.wantChannel {
+			t.Errorf("ParseName(%q) = %q, %q, %v; want %q, %q, error %v", tt.name, alertType, channel, err, tt.wantType, tt.wantChannel, tt.wantErr)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	stored := map[string]string{"low": "stored low"}
+	files := map[string]string{"low.email": "file low email", "group": "file group"}
+	set := New(stored, files)
+
+	tests := []struct {
+		alertType, channel string
+		wantName, wantBody string
+	}{
+		{digest.AlertLow, ChannelEmail, "low", "stored low"},
+		{digest.AlertLow, ChannelTelegram, "low", "stored low"},
+		{digest.AlertGroup, ChannelEmail, "group", "file group"},
+		{digest.AlertGroup, ChannelTelegram, "group", "file group"},
+		{digest.AlertTarget, ChannelTelegram, "target.telegram", Defaults["target.telegram"]},
+		{digest.AlertTarget, "", "target", Defaults["target"]},
+	}
+
+	for _, tt := range tests {
+		name, body := set.Lookup(tt.alertType, tt.channel)
+		if name != tt.wantName || body != tt.wantBody {
+			t.Errorf("Lookup(%q, %q) = %q, %q; want %q, %q", tt.alertType, tt.channel, name, body, tt.wantName, tt.wantBody)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := Example(digest.AlertTarget)
+	data.Product.Name = "Tom & Jerry <DVD>"
+
+	text, err := New().Render("", data)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, want := range []string{"Product: Tom & Jerry <DVD>\n", "Current Price: ₹999.00 (≈ $11.90)\n", "Lowest in 30 days: YES! 🎉\n",
+		"🎯 Target price ₹1000.00 reached!\n\n🔗 https://www.amazon.in/dp/EXAMPLE"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Render() = %q, want it to contain %q", text, want)
+		}
+	}
+
+	html, err := New().Render(ChannelTelegram, data)
+	if err != nil {
+		t.Fatalf("Render(telegram) error = %v", err)
+	}
+	if !strings.Contains(html, "<b>Product:</b> Tom &amp; Jerry &lt;DVD&gt;") {
+		t.Errorf("Render(telegram) = %q, want the product name escaped", html)
+	}
+
+	broken := New(map[string]string{"target": "{{.Nope}}"})
+	message, err := broken.Render(ChannelEmail, data)
+	if err == nil || message != text {
+		t.Errorf("Render() of a broken template = %q, %v; want the default and an error", message, err)
+	}
+}
+
+func TestRenderMovement(t *testing.T) {
+	tests := []struct {
+		alertType string
+		want      []string
+	}{
+		{digest.AlertIncrease, []string{"📈 PRICE INCREASE ALERT! 📈\n", "Change: +30.0%\n", "Why: up 30.0% from ₹999.00\n"}},
+		{digest.AlertVolatile, []string{"🎢 PRICE VOLATILITY ALERT! 🎢\n", "Volatility: 6.2% a day this week, 0.8% usually\n"}},
+		{digest.AlertNormal, []string{"↩️ PRICE BACK TO NORMAL ↩️\n", "Usual Price: ₹1299.00\n"}},
+	}
+
+	for _, tt := range tests {
+		text, err := New().Render(ChannelEmail, Example(tt.alertType))
+		if err != nil {
+			t.Fatalf("Render(%s) error = %v", tt.alertType, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("Render(%s) = %q, want it to contain %q", tt.alertType, text, want)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name, body string
+		wantErr    bool
+	}{
+		{"low", "{{.Product.Name}} is now {{.Current.Format}}", false},
+		{"group.telegram", "<b>{{.Group.Name}}</b>", false},
+		{"low", "{{.Product.Name", true},
+		{"low", "{{.Discount}}", true},
+		{"low", "  ", true},
+		{"sale", "{{.Product.Name}}", true},
+	}
+
+	for _, tt := range tests {
+		if err := Check(tt.name, tt.body); (err != nil) != tt.wantErr {
+			t.Errorf("Check(%q, %q) error = %v, want error %v", tt.name, tt.body, err, tt.wantErr)
+		}
+	}
+}
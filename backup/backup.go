@@ -0,0 +1,221 @@
+// Package backup writes and restores whole-dataset archives.
+//
+// An archive is a gzip-compressed stream of JSON lines: a header describing
+// the format, schema version and the columns of each table, one line per row
+// holding the row's values as a JSON array, and a trailer with per-table row
+// counts so truncated archives are detected. Values are plain JSON strings,
+// numbers, booleans and nulls, so archives do not depend on the database
+// they were taken from.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"price-watcher/database"
+)
+
+const (
+	FormatName    = "price-watcher-backup"
+	FormatVersion = 1
+
+	// MinSchemaVersion is the oldest schema version Restore accepts.
+	MinSchemaVersion = 1
+)
+
+type Header struct {
+	Format        string        `json:"format"`
+	FormatVersion int           `json:"format_version"`
+	SchemaVersion int           `json:"schema_version"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Tables        []TableHeader `json:"tables"`
+}
+
+type TableHeader struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+// record is one archive line after the header: either a row or the trailer.
+type record struct {
+	Table  string           `json:"t,omitempty"`
+	Row    []interface{}    `json:"r,omitempty"`
+	End    bool             `json:"end,omitempty"`
+	Counts map[string]int64 `json:"counts,omitempty"`
+}
+
+// Summary reports how many rows of each table were written or restored.
+type Summary struct {
+	SchemaVersion int
+	Counts        map[string]int64
+}
+
+// Write dumps every backed-up table of db to w, all from one snapshot.
+func Write(w io.Writer, db *database.DB) (*Summary, error) {
+	tx, err := db.BeginDump(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	header := Header{
+		Format:        FormatName,
+		FormatVersion: FormatVersion,
+		SchemaVersion: database.SchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+	}
+	for _, table := range database.BackupTables {
+		header.Tables = append(header.Tables, TableHeader{Name: table.Name, Columns: table.Columns})
+	}
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write backup header: %w", err)
+	}
+
+	summary := &Summary{SchemaVersion: database.SchemaVersion, Counts: make(map[string]int64)}
+	for _, table := range database.BackupTables {
+		err := database.DumpTable(tx, table, func(row []interface{}) error {
+			summary.Counts[table.Name]++
+			return enc.Encode(record{Table: table.Name, Row: row})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Encode(record{End: true, Counts: summary.Counts}); err != nil {
+		return nil, fmt.Errorf("failed to write backup trailer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish backup: %w", err)
+	}
+
+	return summary, nil
+}
+
+// Restore loads an archive into db, which must be empty. Nothing is written
+// unless the whole archive is read and verified.
+func Restore(r io.Reader, db *database.DB) (*Summary, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read backup header: %w", err)
+	}
+	columns, err := checkHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	empty, err := db.IsEmpty()
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, errors.New("target database is not empty; restore only into a fresh database")
+	}
+
+	loader, err := db.NewLoader()
+	if err != nil {
+		return nil, err
+	}
+	defer loader.Rollback()
+
+	summary := &Summary{SchemaVersion: header.SchemaVersion, Counts: make(map[string]int64)}
+	for {
+		var rec record
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("backup archive is truncated: missing trailer")
+			}
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		if rec.End {
+			if err := checkCounts(rec.Counts, summary.Counts); err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		cols, ok := columns[rec.Table]
+		if !ok {
+			return nil, fmt.Errorf("backup row for undeclared table %q", rec.Table)
+		}
+		if len(rec.Row) != len(cols) {
+			return nil, fmt.Errorf("backup row for %s has %d values, want %d", rec.Table, len(rec.Row), len(cols))
+		}
+		if err := loader.Insert(rec.Table, cols, rec.Row); err != nil {
+			return nil, err
+		}
+		summary.Counts[rec.Table]++
+	}
+
+	if err := loader.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	return summary, nil
+}
+
+// checkHeader verifies the archive can be restored by this build and returns
+// the archived columns of each table.
+func checkHeader(h Header) (map[string][]string, error) {
+	if h.Format != FormatName {
+		return nil, fmt.Errorf("not a price-watcher backup (format %q)", h.Format)
+	}
+	if h.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("backup format version %d is newer than supported version %d", h.FormatVersion, FormatVersion)
+	}
+	if h.SchemaVersion > database.SchemaVersion {
+		return nil, fmt.Errorf("backup schema version %d is newer than this build's schema version %d; upgrade before restoring",
+			h.SchemaVersion, database.SchemaVersion)
+	}
+	if h.SchemaVersion < MinSchemaVersion {
+		return nil, fmt.Errorf("backup schema version %d is older than the oldest supported version %d",
+			h.SchemaVersion, MinSchemaVersion)
+	}
+
+	columns := make(map[string][]string)
+	for _, t := range h.Tables {
+		table, ok := database.LookupTable(t.Name)
+		if !ok {
+			return nil, fmt.Errorf("backup contains unknown table %q", t.Name)
+		}
+		known := make(map[string]bool)
+		for _, c := range table.Columns {
+			known[c] = true
+		}
+		for _, c := range t.Columns {
+			if !known[c] {
+				return nil, fmt.Errorf("backup contains unknown column %s.%s", t.Name, c)
+			}
+		}
+		columns[t.Name] = t.Columns
+	}
+
+	return columns, nil
+}
+
+func checkCounts(want, got map[string]int64) error {
+	for table, n := range want {
+		if got[table] != n {
+			return fmt.Errorf("backup archive is incomplete: %s has %d rows, trailer says %d", table, got[table], n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"testing"
+
+	"price-watcher/database"
+)
+
+func TestCheckHeader(t *testing.T) {
+	valid := func() Header {
+		return Header{
+			Format:        FormatName,
+			FormatVersion: FormatVersion,
+			SchemaVersion: database.SchemaVersion,
+			Tables:        []TableHeader{{Name: "products", Columns: []string{"id", "name", "url", "platform"}}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(h *Header)
+		wantErr bool
+	}{
+		{name: "Current version", modify: func(h *Header) {}},
+		{name: "Wrong format", modify: func(h *Header) { h.Format = "pg_dump" }, wantErr: true},
+		{name: "Newer format", modify: func(h *Header) { h.FormatVersion = FormatVersion + 1 }, wantErr: true},
+		{name: "Newer schema", modify: func(h *Header) { h.SchemaVersion = database.SchemaVersion + 1 }, wantErr: true},
+		{name: "Too old schema", modify: func(h *Header) { h.SchemaVersion = MinSchemaVersion - 1 }, wantErr: true},
+		{name: "Unknown table", modify: func(h *Header) { h.Tables[0].Name = "users" }, wantErr: true},
+		{name: "Retired table", modify: func(h *Header) {
+			h.SchemaVersion = 16
+			h.Tables = append(h.Tables, TableHeader{Name: "queued_alerts", Columns: []string{"id", "channel", "product_id", "subject", "message", "created_at"}})
+		}},
+		{name: "Unknown column", modify: func(h *Header) { h.Tables[0].Columns = append(h.Tables[0].Columns, "color") }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := valid()
+			tt.modify(&h)
+
+			columns, err := checkHeader(h)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("checkHeader() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkHeader() unexpected error: %v", err)
+			}
+			if len(columns["products"]) != 4 {
+				t.Errorf("checkHeader() columns = %v", columns)
+			}
+		})
+	}
+}
+
+func TestCheckCounts(t *testing.T) {
+	if err := checkCounts(map[string]int64{"products": 2}, map[string]int64{"products": 2}); err != nil {
+		t.Errorf("checkCounts() unexpected error: %v", err)
+	}
+	if err := checkCounts(map[string]int64{"products": 2}, map[string]int64{"products": 1}); err == nil {
+		t.Errorf("checkCounts() expected error for missing rows")
+	}
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"price-watcher/throttle"
+)
+
+// alertColumns lists the alerts columns read by scanAlert, in order.
+const alertColumns = `id, product_id, group_id, old_price, new_price, currency, message, sent_at, suppressed_reason, status, status_at, alert_type`
+
+// Alert statuses, set by acknowledging, dismissing or buying on an alert.
+const (
+	AlertNew          = "new"
+	AlertAcknowledged = "acknowledged"
+	AlertDismissed    = "dismissed"
+	AlertBought       = "bought"
+)
+
+// AlertStatuses lists the alert statuses in the order they are offered.
+var AlertStatuses = []string{AlertNew, AlertAcknowledged, AlertDismissed, AlertBought}
+
+func scanAlert(row rowScanner) (Alert, error) {
+	var a Alert
+	var groupID sql.NullString
+	var statusAt sql.NullTime
+	var oldPrice, newPrice string
+	if err := row.Scan(&a.ID, &a.ProductID, &groupID, &oldPrice, &newPrice, &a.Currency, &a.Message, &a.SentAt, &a.SuppressedReason,
+		&a.Status, &statusAt, &a.Type); err != nil {
+		return a, fmt.Errorf("failed to scan alert: %w", err)
+	}
+	if groupID.Valid {
+		a.GroupID = &groupID.String
+	}
+	if statusAt.Valid {
+		a.StatusAt = &statusAt.Time
+	}
+	if err := parseAmounts(a.Currency, []string{oldPrice, newPrice}, &a.OldPrice, &a.NewPrice); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// AlertFilter selects alerts for ListAlerts; zero fields match every alert.
+type AlertFilter struct {
+	ProductID string
+	GroupID   string
+	// Suppressed selects only suppressed alerts if true, or only sent ones
+	// if false.
+	Suppressed *bool
+	// From and To select alerts raised in [From, To).
+	From *time.Time
+	To   *time.Time
+	// Channel selects alerts delivered, or to be delivered, on a channel.
+	Channel string
+	// Status selects alerts with an alert status such as AlertBought.
+	Status string
+	// Type selects alerts of a type such as digest.AlertIncrease.
+	Type  string
+	Limit int
+}
+
+// DefaultAlertLimit is how many alerts ListAlerts returns without a limit.
+const DefaultAlertLimit = 50
+
+// ListAlerts returns the matching alerts, latest first.
+func (db *DB) ListAlerts(filter AlertFilter) ([]Alert, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.ProductID != "" {
+		args = append(args, filter.ProductID)
+		conditions = append(conditions, fmt.Sprintf("product_id = $%d", len(args)))
+	}
+	if filter.GroupID != "" {
+		args = append(args, filter.GroupID)
+		conditions = append(conditions, fmt.Sprintf("group_id = $%d", len(args)))
+	}
+	if filter.Suppressed != nil {
+		if *filter.Suppressed {
+			conditions = append(conditions, "suppressed_reason <> ''")
+		} else {
+			conditions = append(conditions, "suppressed_reason = ''")
+		}
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("sent_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("sent_at < $%d", len(args)))
+	}
+	if filter.Channel != "" {
+		args = append(args, filter.Channel)
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM alert_deliveries d WHERE d.alert_id = alerts.id AND d.channel = $%d)", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		conditions = append(conditions, fmt.Sprintf("alert_type = $%d", len(args)))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultAlertLimit
+	}
+	args = append(args, limit)
+
+	query := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(` ORDER BY sent_at DESC LIMIT $%d`, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, db.attachDeliveries(alerts)
+}
+
+// SetAlertStatus records what became of an alert, e.g. AlertBought, and
+// returns it.
+func (db *DB) SetAlertStatus(id, status string) (*Alert, error) {
+	query := `
+		UPDATE alerts SET status = $2, status_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + alertColumns
+	a, err := scanAlert(db.QueryRow(query, id, status))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("alert not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set alert status: %w", err)
+	}
+	return &a, nil
+}
+
+// GetSentAlerts returns the alerts sent about a product's own price
+// dropping since the given time, latest first, for throttling its next
+// alert.
+func (db *DB) GetSentAlerts(productID string, since time.Time) ([]throttle.Sent, error) {
+	return db.sentAlerts(`product_id = $2 AND group_id IS NULL AND alert_type IN ('low', 'target')`, since, productID)
+}
+
+// GetSentAlertsOfType returns the alerts of one type, such as
+// digest.AlertIncrease, sent about a product since the given time, latest
+// first.
+func (db *DB) GetSentAlertsOfType(productID, alertType string, since time.Time) ([]throttle.Sent, error) {
+	return db.sentAlerts(`product_id = $2 AND group_id IS NULL AND alert_type = $3`, since, productID, alertType)
+}
+
+// GetSentGroupAlerts returns the alerts sent about a group's best price
+// since the given time, latest first.
+func (db *DB) GetSentGroupAlerts(groupID string, since time.Time) ([]throttle.Sent, error) {
+	return db.sentAlerts(`group_id = $2`, since, groupID)
+}
+
+// sentAlerts returns the sent alerts matching condition, whose parameters
+// follow since as $2 onwards.
+func (db *DB) sentAlerts(condition string, since time.Time, args ...interface{}) ([]throttle.Sent, error) {
+	query := `
+		SELECT sent_at, new_price, currency FROM alerts
+		WHERE ` + condition + ` AND suppressed_reason = '' AND sent_at >= $1
+		ORDER BY sent_at DESC
+	`
+
+	rows, err := db.Query(query, append([]interface{}{since}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sent alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var sent []throttle.Sent
+	for rows.Next() {
+		var s throttle.Sent
+		var price, currency string
+		if err := rows.Scan(&s.At, &price, &currency); err != nil {
+			return nil, fmt.Errorf("failed to scan sent alert: %w", err)
+		}
+		if s.Price, err = parseAmount(price, currency); err != nil {
+			return nil, err
+		}
+		sent = append(sent, s)
+	}
+
+	return sent, rows.Err()
+}
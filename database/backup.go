@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Table describes a table included in backups.
+type Table struct {
+	Name    string
+	Columns []string
+}
+
+// BackupTables lists every table holding user data, parents before children
+// so rows can be restored in order.
+var BackupTables = []Table{
+	{Name: "product_groups", Columns: []string{"id", "name", "currency", "target_price", "best_price", "created_at", "updated_at"}},
+	{Name: "products", Columns: []string{"id", "name", "scraped_title", "url", "platform", "folder", "group_id", "currency", "target_price", "pack_size", "pack_unit", "location", "alert_on", "alert_cooldown_minutes",
+		"alert_increase_percent", "alert_volatility", "alert_back_to_normal", "in_stock",
+		"last_scraped_at", "last_scrape_status", "last_scrape_error", "created_at", "updated_at"}},
+	{Name: "product_tags", Columns: []string{"product_id", "tag"}},
+	{Name: "product_offers", Columns: []string{"product_id", "position", "text"}},
+	{Name: "price_history", Columns: []string{"id", "product_id", "price", "delta", "currency", "timestamp",
+		"last_seen", "observations", "unit_price", "price_unit", "location", "effective_price"}},
+	{Name: "price_history_daily", Columns: []string{"product_id", "location", "day", "min_price", "max_price", "avg_price",
+		"close_price", "samples", "currency", "min_unit_price", "price_unit", "min_effective_price"}},
+	{Name: "alerts", Columns: []string{"id", "product_id", "group_id", "old_price", "new_price", "currency", "message", "sent_at", "suppressed_reason",
+		"status", "status_at", "alert_type"}},
+	{Name: "digest_entries", Columns: []string{"id", "kind", "product_id", "old_price", "new_price", "currency", "detail", "created_at"}},
+	{Name: "alert_deliveries", Columns: []string{"id", "alert_id", "channel", "subject", "message", "quiet", "status", "attempts",
+		"next_attempt_at", "last_error", "created_at", "delivered_at"}},
+	{Name: "baskets", Columns: []string{"id", "name", "currency", "cheapest", "created_at", "updated_at"}},
+	{Name: "basket_items", Columns: []string{"basket_id", "product_id", "quantity"}},
+	{Name: "basket_costs", Columns: []string{"basket_id", "day", "cost", "cheapest_cost", "currency", "items", "priced"}},
+	{Name: "basket_item_costs", Columns: []string{"basket_id", "day", "product_id", "cost", "cheapest_cost", "currency"}},
+	{Name: "match_dismissals", Columns: []string{"product_a", "product_b", "dismissed_at"}},
+	{Name: "sale_events", Columns: []string{"id", "name", "platform", "starts_on", "ends_on", "created_at", "updated_at"}},
+	{Name: "settings", Columns: []string{"key", "value", "updated_at"}},
+	{Name: "alert_templates", Columns: []string{"name", "body", "updated_at"}},
+	{Name: "exchange_rates", Columns: []string{"base", "quote", "rate", "effective_date", "updated_at"}},
+}
+
+// RetiredTables lists tables that older backups hold but are no longer
+// created; Loader.Insert restores their rows into the tables replacing them.
+var RetiredTables = []Table{
+	// Alerts held during quiet hours, up to schema version 16; they are
+	// now outbox deliveries.
+	{Name: "queued_alerts", Columns: []string{"id", "channel", "product_id", "subject", "message", "created_at"}},
+}
+
+// LookupTable returns the backup description of the named table, which may
+// be a retired one.
+func LookupTable(name string) (Table, bool) {
+	for _, tables := range [][]Table{BackupTables, RetiredTables} {
+		for _, t := range tables {
+			if t.Name == name {
+				return t, true
+			}
+		}
+	}
+	return Table{}, false
+}
+
+// BeginDump starts the read-only, repeatable-read transaction a backup is
+// taken in, so every table is dumped from the same snapshot and child rows
+// always come with their parents.
+func (db *DB) BeginDump(ctx context.Context) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin backup: %w", err)
+	}
+	return tx, nil
+}
+
+// DumpTable streams every row of table, as seen by tx, to fn as
+// driver-neutral values: strings, int64, float64, bool, time.Time or nil.
+func DumpTable(tx *sql.Tx, table Table, fn func(row []interface{}) error) error {
+	query := fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(table.Columns, ", "), table.Name)
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table.Name, err)
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(table.Columns))
+	dest := make([]interface{}, len(table.Columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", table.Name, err)
+		}
+		row := make([]interface{}, len(values))
+		for i, v := range values {
+			// DECIMAL and some text columns come back as raw bytes.
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			if t, ok := v.(time.Time); ok {
+				v = t.UTC()
+			}
+			row[i] = v
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// IsEmpty reports whether no backed-up table holds any rows.
+func (db *DB) IsEmpty() (bool, error) {
+	for _, table := range BackupTables {
+		var exists bool
+		if err := db.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, table.Name)).Scan(&exists); err != nil {
+			return false, fmt.Errorf("failed to check %s: %w", table.Name, err)
+		}
+		if exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Loader inserts restored rows inside a single transaction.
+type Loader struct {
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+}
+
+// NewLoader starts a restore transaction.
+func (db *DB) NewLoader() (*Loader, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin restore: %w", err)
+	}
+	return &Loader{tx: tx, stmts: make(map[string]*sql.Stmt)}, nil
+}
+
+// Insert adds one row to table; columns must be a subset of the table's
+// backup columns, and missing columns take their defaults.
+func (l *Loader) Insert(table string, columns []string, values []interface{}) error {
+	if table == "queued_alerts" {
+		return l.insertQueuedAlert(columns, values)
+	}
+
+	key := table + "(" + strings.Join(columns, ",") + ")"
+	stmt, ok := l.stmts[key]
+	if !ok {
+		placeholders := make([]string, len(columns))
+		for i := range columns {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		var err error
+		stmt, err = l.tx.Prepare(fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+			table, strings.Join(columns, ", "), strings.Join(placeholders, ", ")))
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert into %s: %w", table, err)
+		}
+		l.stmts[key] = stmt
+	}
+
+	if _, err := stmt.Exec(values...); err != nil {
+		return fmt.Errorf("failed to insert into %s: %w", table, err)
+	}
+	return nil
+}
+
+// insertQueuedAlert restores a queued_alerts row as an alert, priced at the
+// product's latest restored price, with a quiet delivery due now on its
+// channel.
+func (l *Loader) insertQueuedAlert(columns []string, values []interface{}) error {
+	row := make(map[string]interface{}, len(columns))
+	for i, c := range columns {
+		row[c] = values[i]
+	}
+	query := `
+		WITH alert AS (
+			INSERT INTO alerts (id, product_id, old_price, new_price, currency, message, sent_at)
+			SELECT COALESCE($1::UUID, gen_random_uuid()), p.id, COALESCE(latest.price, 0), COALESCE(latest.price, 0), p.currency, $5,
+				COALESCE($6::TIMESTAMP, CURRENT_TIMESTAMP)
+			FROM products p
+			LEFT JOIN LATERAL (
+				SELECT h.price FROM price_history h
+				WHERE h.product_id = p.id
+				ORDER BY h.timestamp DESC
+				LIMIT 1
+			) latest ON TRUE
+			WHERE p.id = $2
+			RETURNING id, sent_at
+		)
+		INSERT INTO alert_deliveries (alert_id, channel, subject, message, quiet, created_at)
+		SELECT id, $3, COALESCE($4, ''), $5, TRUE, sent_at FROM alert
+	`
+	if _, err := l.tx.Exec(query, row["id"], row["product_id"], row["channel"], row["subject"], row["message"], row["created_at"]); err != nil {
+		return fmt.Errorf("failed to restore queued alert: %w", err)
+	}
+	return nil
+}
+
+func (l *Loader) Commit() error {
+	return l.tx.Commit()
+}
+
+func (l *Loader) Rollback() error {
+	return l.tx.Rollback()
+}
@@ -0,0 +1,570 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"price-watcher/money"
+)
+
+// Basket is a named list of products bought together, such as a household's
+// weekly staples, whose total cost is tracked day by day in its currency.
+type Basket struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	// Cheapest prices each item in a group at the group's cheapest in-stock
+	// listing instead of the listing added to the basket.
+	Cheapest  bool      `json:"cheapest"`
+	ItemCount int       `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// basketColumns lists the baskets columns read by scanBasket, in order.
+const basketColumns = `b.id, b.name, b.currency, b.cheapest,
+	(SELECT COUNT(*) FROM basket_items i WHERE i.basket_id = b.id), b.created_at, b.updated_at`
+
+func scanBasket(row rowScanner) (Basket, error) {
+	var basket Basket
+	err := row.Scan(&basket.ID, &basket.Name, &basket.Currency, &basket.Cheapest, &basket.ItemCount,
+		&basket.CreatedAt, &basket.UpdatedAt)
+	return basket, err
+}
+
+// CreateBasket adds an empty basket costed in currency.
+func (db *DB) CreateBasket(name, currency string, cheapest bool) (*Basket, error) {
+	query := `INSERT INTO baskets (name, currency, cheapest) VALUES ($1, $2, $3) RETURNING id`
+
+	var id string
+	if err := db.QueryRow(query, name, currency, cheapest).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create basket: %w", err)
+	}
+
+	return db.GetBasket(id)
+}
+
+func (db *DB) GetBasket(basketID string) (*Basket, error) {
+	query := `SELECT ` + basketColumns + ` FROM baskets b WHERE b.id = $1`
+
+	basket, err := scanBasket(db.QueryRow(query, basketID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("basket not found: %s", basketID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get basket: %w", err)
+	}
+
+	return &basket, nil
+}
+
+// GetBaskets returns every basket, by name.
+func (db *DB) GetBaskets() ([]Basket, error) {
+	query := `SELECT ` + basketColumns + ` FROM baskets b ORDER BY LOWER(b.name), b.created_at`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query baskets: %w", err)
+	}
+	defer rows.Close()
+
+	baskets := []Basket{}
+	for rows.Next() {
+		basket, err := scanBasket(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan basket: %w", err)
+		}
+		baskets = append(baskets, basket)
+	}
+
+	return baskets, rows.Err()
+}
+
+// BasketUpdate holds the editable basket fields; nil fields are left unchanged.
+type BasketUpdate struct {
+	Name     *string
+	Currency *string
+	Cheapest *bool
+}
+
+func (db *DB) UpdateBasket(basketID string, update BasketUpdate) (*Basket, error) {
+	query := `
+		UPDATE baskets
+		SET name = COALESCE($2, name), currency = COALESCE($3, currency), cheapest = COALESCE($4, cheapest),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	result, err := db.Exec(query, basketID, update.Name, update.Currency, update.Cheapest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update basket: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("basket not found: %s", basketID)
+	}
+
+	return db.GetBasket(basketID)
+}
+
+// DeleteBasket removes a basket and its cost history; its products stay tracked.
+func (db *DB) DeleteBasket(basketID string) error {
+	result, err := db.Exec(`DELETE FROM baskets WHERE id = $1`, basketID)
+	if err != nil {
+		return fmt.Errorf("failed to delete basket: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("basket not found: %s", basketID)
+	}
+	return nil
+}
+
+// SetBasketItem puts quantity packs of a product in a basket, replacing the
+// quantity if it is already there.
+func (db *DB) SetBasketItem(basketID, productID string, quantity int) error {
+	query := `
+		INSERT INTO basket_items (basket_id, product_id, quantity) VALUES ($1, $2, $3)
+		ON CONFLICT (basket_id, product_id) DO UPDATE SET quantity = EXCLUDED.quantity
+	`
+	if _, err := db.Exec(query, basketID, productID, quantity); err != nil {
+		return fmt.Errorf("failed to set basket item: %w", err)
+	}
+	return nil
+}
+
+// RemoveBasketItem takes a product out of a basket.
+func (db *DB) RemoveBasketItem(basketID, productID string) error {
+	result, err := db.Exec(`DELETE FROM basket_items WHERE basket_id = $1 AND product_id = $2`, basketID, productID)
+	if err != nil {
+		return fmt.Errorf("failed to remove basket item: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("basket item not found: %s", productID)
+	}
+	return nil
+}
+
+// BasketItem is a product in a basket with its current price.
+type BasketItem struct {
+	Product  Product `json:"product"`
+	Quantity int     `json:"quantity"`
+}
+
+// GetBasketItems returns a basket's products with their current prices, by name.
+func (db *DB) GetBasketItems(basketID string) ([]BasketItem, error) {
+	rows, err := db.Query(`SELECT product_id, quantity FROM basket_items WHERE basket_id = $1`, basketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query basket items: %w", err)
+	}
+	defer rows.Close()
+
+	quantities := make(map[string]int)
+	for rows.Next() {
+		var productID string
+		var quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan basket item: %w", err)
+		}
+		quantities[productID] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page, err := db.ListProducts(ProductFilter{Basket: basketID, Sort: SortName, PageSize: MaxPageSize})
+	if err != nil {
+		return nil, err
+	}
+	items := make([]BasketItem, 0, len(page.Products))
+	for _, p := range page.Products {
+		items = append(items, BasketItem{Product: p, Quantity: quantities[p.ID]})
+	}
+	return items, nil
+}
+
+// BasketLine is one item of a priced basket.
+type BasketLine struct {
+	Product  Product `json:"product"`
+	Quantity int     `json:"quantity"`
+	// Source is the listing the item is priced at: the product itself, or
+	// in cheapest mode its group's cheapest in-stock listing.
+	Source *Product `json:"source,omitempty"`
+	// Cost is Quantity packs at Source's price in the basket's currency, or
+	// nil if Source has no price or no exchange rate covers it.
+	Cost *money.Money `json:"cost,omitempty"`
+}
+
+// BasketCost is a basket priced at current prices.
+type BasketCost struct {
+	Total money.Money  `json:"total"`
+	Lines []BasketLine `json:"lines"`
+	// Missing counts the lines left out of Total for lack of a price.
+	Missing int `json:"missing"`
+}
+
+// PriceBasket prices items in currency. In cheapest mode an item whose
+// product is in a group is priced at the group's cheapest in-stock listing
+// (groups maps group IDs to their listings); when both packs have sizes in
+// the same unit the cheaper listing is priced for the item's pack size, so a
+// 1 kg pack standing in for a 500 g one counts half.
+func PriceBasket(items []BasketItem, groups map[string][]Product, currency string, cheapest bool, rates *money.Rates, on time.Time) BasketCost {
+	cost := BasketCost{Total: money.New(0, currency), Lines: make([]BasketLine, 0, len(items))}
+
+	for _, item := range items {
+		line := BasketLine{Product: item.Product, Quantity: item.Quantity}
+		source := item.Product
+		if cheapest && item.Product.GroupID != nil {
+			listings := append([]Product(nil), groups[*item.Product.GroupID]...)
+			if i := CheapestListing(listings, currency, rates, on); i >= 0 {
+				source = listings[i]
+			}
+		}
+		line.Source = &source
+
+		if price, ok := packPrice(item.Product, source, currency, rates, on); ok {
+			if total, err := price.Convert(big.NewRat(int64(item.Quantity), 1), currency); err == nil {
+				line.Cost = &total
+				cost.Total = cost.Total.Add(total)
+			}
+		}
+		if line.Cost == nil {
+			cost.Missing++
+		}
+		cost.Lines = append(cost.Lines, line)
+	}
+
+	return cost
+}
+
+// CostBasket prices a basket at current prices, both at its listed products
+// and at the cheapest listing of each item's group.
+func (db *DB) CostBasket(basket *Basket, on time.Time) (listed, cheapest BasketCost, err error) {
+	items, err := db.GetBasketItems(basket.ID)
+	if err != nil {
+		return listed, cheapest, err
+	}
+	rates, err := db.LoadRates()
+	if err != nil {
+		return listed, cheapest, err
+	}
+
+	groups := make(map[string][]Product)
+	for _, item := range items {
+		groupID := item.Product.GroupID
+		if groupID == nil {
+			continue
+		}
+		if _, ok := groups[*groupID]; ok {
+			continue
+		}
+		if groups[*groupID], err = db.GetGroupListings(*groupID); err != nil {
+			return listed, cheapest, err
+		}
+	}
+
+	listed = PriceBasket(items, groups, basket.Currency, false, rates, on)
+	cheapest = PriceBasket(items, groups, basket.Currency, true, rates, on)
+	return listed, cheapest, nil
+}
+
+// packPrice returns the price in currency of one pack of product bought as
+// source, which may be a differently sized listing of the same item.
+func packPrice(product, source Product, currency string, rates *money.Rates, on time.Time) (money.Money, bool) {
+	if source.ID != product.ID && source.UnitPrice != nil && product.PackSize != nil {
+		if price, err := source.UnitPrice.For(*product.PackSize); err == nil {
+			if converted, err := rates.Convert(price, currency, on); err == nil {
+				return converted, true
+			}
+		}
+	}
+	if source.CurrentPrice == nil {
+		return money.Money{}, false
+	}
+	converted, err := rates.Convert(*source.CurrentPrice, currency, on)
+	return converted, err == nil
+}
+
+// BasketCostPoint is a basket's cost on one day: at the listed products'
+// prices and at the cheapest listings', with how many items had a price.
+type BasketCostPoint struct {
+	Day          time.Time   `json:"day"`
+	Cost         money.Money `json:"cost"`
+	CheapestCost money.Money `json:"cheapest_cost"`
+	Items        int         `json:"items"`
+	Priced       int         `json:"priced"`
+	// ItemCosts are the costs of the day's items by product ID, or nil for
+	// days recorded before item costs were kept.
+	ItemCosts map[string]BasketItemCost `json:"-"`
+}
+
+// BasketItemCost is one item's cost on a day, at the listed product and at
+// the cheapest listing; either is nil when that listing had no price.
+type BasketItemCost struct {
+	Cost         *money.Money
+	CheapestCost *money.Money
+}
+
+// ItemCosts returns the cost of each item of a basket priced both ways, by
+// product ID.
+func ItemCosts(listed, cheapest BasketCost) map[string]BasketItemCost {
+	costs := make(map[string]BasketItemCost, len(listed.Lines))
+	for _, line := range listed.Lines {
+		costs[line.Product.ID] = BasketItemCost{Cost: line.Cost}
+	}
+	for _, line := range cheapest.Lines {
+		c := costs[line.Product.ID]
+		c.CheapestCost = line.Cost
+		costs[line.Product.ID] = c
+	}
+	return costs
+}
+
+// RecordBasketCost stores today's cost of a basket and of each of its
+// items, replacing earlier figures for the same day. Both costs must be in
+// the same currency.
+func (db *DB) RecordBasketCost(basketID string, listed, cheapest BasketCost) error {
+	if err := checkStorable(listed.Total); err != nil {
+		return err
+	}
+	if err := checkStorable(cheapest.Total); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO basket_costs (basket_id, day, cost, cheapest_cost, currency, items, priced)
+		VALUES ($1, CURRENT_DATE, $2, $3, $4, $5, $6)
+		ON CONFLICT (basket_id, day) DO UPDATE SET
+			cost = EXCLUDED.cost, cheapest_cost = EXCLUDED.cheapest_cost, currency = EXCLUDED.currency,
+			items = EXCLUDED.items, priced = EXCLUDED.priced
+	`
+	items := len(listed.Lines)
+	_, err = tx.Exec(query, basketID, listed.Total, cheapest.Total, listed.Total.Currency, items, items-listed.Missing)
+	if err != nil {
+		return fmt.Errorf("failed to record basket cost: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM basket_item_costs WHERE basket_id = $1 AND day = CURRENT_DATE`, basketID); err != nil {
+		return fmt.Errorf("failed to clear basket item costs: %w", err)
+	}
+	query = `
+		INSERT INTO basket_item_costs (basket_id, day, product_id, cost, cheapest_cost, currency)
+		VALUES ($1, CURRENT_DATE, $2, $3, $4, $5)
+	`
+	for productID, c := range ItemCosts(listed, cheapest) {
+		if _, err := tx.Exec(query, basketID, productID, c.Cost, c.CheapestCost, listed.Total.Currency); err != nil {
+			return fmt.Errorf("failed to record basket item cost: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit basket cost: %w", err)
+	}
+	return nil
+}
+
+// GetBasketCosts returns a basket's daily costs since the given time, oldest
+// first, converted to currency at each day's rate. Days no rate covers are
+// left out.
+func (db *DB) GetBasketCosts(basketID string, since time.Time, currency string, rates *money.Rates) ([]BasketCostPoint, error) {
+	query := `
+		SELECT CAST(day AS TIMESTAMP), cost, cheapest_cost, currency, items, priced
+		FROM basket_costs
+		WHERE basket_id = $1 AND day >= CAST($2::TIMESTAMP AS DATE)
+		ORDER BY day
+	`
+
+	rows, err := db.Query(query, basketID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query basket costs: %w", err)
+	}
+	defer rows.Close()
+
+	points := []BasketCostPoint{}
+	for rows.Next() {
+		var p BasketCostPoint
+		var cost, cheapestCost, storedCurrency string
+		if err := rows.Scan(&p.Day, &cost, &cheapestCost, &storedCurrency, &p.Items, &p.Priced); err != nil {
+			return nil, fmt.Errorf("failed to scan basket cost: %w", err)
+		}
+		if err := parseAmounts(storedCurrency, []string{cost, cheapestCost}, &p.Cost, &p.CheapestCost); err != nil {
+			return nil, err
+		}
+		if p.Cost, err = rates.Convert(p.Cost, currency, p.Day); err != nil {
+			continue
+		}
+		if p.CheapestCost, err = rates.Convert(p.CheapestCost, currency, p.Day); err != nil {
+			continue
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemCosts, err := db.getBasketItemCosts(basketID, since, currency, rates)
+	if err != nil {
+		return nil, err
+	}
+	for i := range points {
+		points[i].ItemCosts = itemCosts[points[i].Day.Format("2006-01-02")]
+	}
+	return points, nil
+}
+
+// getBasketItemCosts returns the item costs of a basket's days since the
+// given time, by day as YYYY-MM-DD, converted to currency at each day's rate. An item
+// cost no rate covers counts as having no price.
+func (db *DB) getBasketItemCosts(basketID string, since time.Time, currency string, rates *money.Rates) (map[string]map[string]BasketItemCost, error) {
+	query := `
+		SELECT CAST(day AS TIMESTAMP), product_id, cost, cheapest_cost, currency
+		FROM basket_item_costs
+		WHERE basket_id = $1 AND day >= CAST($2::TIMESTAMP AS DATE)
+	`
+
+	rows, err := db.Query(query, basketID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query basket item costs: %w", err)
+	}
+	defer rows.Close()
+
+	days := make(map[string]map[string]BasketItemCost)
+	for rows.Next() {
+		var day time.Time
+		var productID, storedCurrency string
+		var cost, cheapestCost sql.NullString
+		if err := rows.Scan(&day, &productID, &cost, &cheapestCost, &storedCurrency); err != nil {
+			return nil, fmt.Errorf("failed to scan basket item cost: %w", err)
+		}
+		convert := func(amount sql.NullString) (*money.Money, error) {
+			if !amount.Valid {
+				return nil, nil
+			}
+			m, err := parseAmount(amount.String, storedCurrency)
+			if err != nil {
+				return nil, err
+			}
+			if m, err = rates.Convert(m, currency, day); err != nil {
+				return nil, nil
+			}
+			return &m, nil
+		}
+		var c BasketItemCost
+		if c.Cost, err = convert(cost); err != nil {
+			return nil, err
+		}
+		if c.CheapestCost, err = convert(cheapestCost); err != nil {
+			return nil, err
+		}
+		key := day.Format("2006-01-02")
+		if days[key] == nil {
+			days[key] = make(map[string]BasketItemCost)
+		}
+		days[key][productID] = c
+	}
+
+	return days, rows.Err()
+}
+
+// InflationPeriods are the periods, in days, the inflation index covers.
+var InflationPeriods = []int{30, 90, 365}
+
+// Inflation compares a basket's cost now with its cost Days days before,
+// over the items priced on both days.
+type Inflation struct {
+	Days int `json:"days"`
+	// Since is the day of the earlier cost: the latest on or before the
+	// start of the period.
+	Since  time.Time   `json:"since"`
+	Then   money.Money `json:"then"`
+	Now    money.Money `json:"now"`
+	Change float64     `json:"change_percent"`
+	// Index is the cost now with the earlier cost as 100.
+	Index float64 `json:"index"`
+	// Items is how many items were compared.
+	Items int `json:"items"`
+	// Complete is false when items of either day were left out, for being
+	// added or removed in between or having no price on one of the days.
+	Complete bool `json:"complete"`
+}
+
+// InflationIndex compares the latest point of history, which must be in
+// one currency and oldest first, with the cost at the start of each period.
+// Only the items priced on both days are compared, so adding an item to the
+// basket is not taken for inflation. In cheapest mode the cheapest costs
+// are compared. A period is left out when history does not reach back to
+// its start or the two days have no item in common.
+func InflationIndex(history []BasketCostPoint, periods []int, cheapest bool) []Inflation {
+	if len(history) == 0 {
+		return []Inflation{}
+	}
+
+	latest := history[len(history)-1]
+	index := []Inflation{}
+	for _, days := range periods {
+		start := latest.Day.AddDate(0, 0, -days)
+		// The latest point on or before the start of the period.
+		i := sort.Search(len(history), func(i int) bool { return history[i].Day.After(start) }) - 1
+		if i < 0 {
+			continue
+		}
+		then, now, items, complete, ok := commonCosts(history[i], latest, cheapest)
+		if !ok || then.Amount <= 0 {
+			continue
+		}
+		ratio := now.Float() / then.Float()
+		index = append(index, Inflation{
+			Days:     days,
+			Since:    history[i].Day,
+			Then:     then,
+			Now:      now,
+			Change:   (ratio - 1) * 100,
+			Index:    ratio * 100,
+			Items:    items,
+			Complete: complete,
+		})
+	}
+	return index
+}
+
+// commonCosts returns the costs on two days of the items priced on both,
+// how many there are and whether they are all the items of both days. Days
+// recorded before item costs were kept compare their totals instead, but
+// only when both had as many items and as many with a price; ok is false
+// when the days cannot be compared.
+func commonCosts(a, b BasketCostPoint, cheapest bool) (then, now money.Money, items int, complete, ok bool) {
+	if a.ItemCosts == nil || b.ItemCosts == nil {
+		if a.Items != b.Items || a.Priced != b.Priced {
+			return money.Money{}, money.Money{}, 0, false, false
+		}
+		then, now = a.Cost, b.Cost
+		if cheapest {
+			then, now = a.CheapestCost, b.CheapestCost
+		}
+		return then, now, a.Priced, a.Priced == a.Items, true
+	}
+
+	then, now = money.New(0, a.Cost.Currency), money.New(0, b.Cost.Currency)
+	for productID, x := range a.ItemCosts {
+		y, found := b.ItemCosts[productID]
+		if !found {
+			continue
+		}
+		costThen, costNow := x.Cost, y.Cost
+		if cheapest {
+			costThen, costNow = x.CheapestCost, y.CheapestCost
+		}
+		if costThen == nil || costNow == nil {
+			continue
+		}
+		then, now = then.Add(*costThen), now.Add(*costNow)
+		items++
+	}
+	return then, now, items, items == len(a.ItemCosts) && items == len(b.ItemCosts), items > 0
+}
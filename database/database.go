@@ -3,40 +3,149 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/offers"
+	"price-watcher/packsize"
+
+	"github.com/lib/pq"
 )
 
+// SchemaVersion identifies the table layout created by initTables. Bump it
+// whenever a table or column is added so backups can be checked on restore.
+const SchemaVersion = 21
+
 type DB struct {
 	*sql.DB
 }
 
 type Product struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	URL       string    `json:"url"`
-	Platform  string    `json:"platform"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	ScrapedTitle string       `json:"scraped_title,omitempty"`
+	URL          string       `json:"url"`
+	Platform     string       `json:"platform"`
+	Folder       string       `json:"folder"`
+	GroupID      *string      `json:"group_id,omitempty"`
+	Currency     string       `json:"currency"`
+	Tags         []string     `json:"tags"`
+	TargetPrice  *money.Money `json:"target_price,omitempty"`
+	// PackSize is the weight, volume or count sold, for unit prices.
+	PackSize *packsize.Size `json:"pack_size,omitempty"`
+	// Location is the delivery location the product is scraped for, on
+	// shops that price by location; nil means the default location setting.
+	Location *location.Location `json:"location,omitempty"`
+	// Offers are the coupons and bank offers seen on the latest scrape.
+	Offers []offers.Offer `json:"offers"`
+	// AlertOn is the price alerts compare: AlertOnPrice or
+	// AlertOnEffectivePrice.
+	AlertOn string `json:"alert_on"`
+	// AlertCooldownMinutes overrides the ALERT_COOLDOWN between two of the
+	// product's alerts; nil uses it.
+	AlertCooldownMinutes *int `json:"alert_cooldown_minutes,omitempty"`
+	// AlertIncreasePercent opts in to an alert when the price rises by at
+	// least this percentage; nil means no increase alerts.
+	AlertIncreasePercent *float64 `json:"alert_increase_percent,omitempty"`
+	// AlertVolatility opts in to an alert when the price moves much more
+	// than usual, and AlertBackToNormal to one when it returns to its usual
+	// level after a sale.
+	AlertVolatility   bool       `json:"alert_volatility"`
+	AlertBackToNormal bool       `json:"alert_back_to_normal"`
+	InStock           bool       `json:"in_stock"`
+	LastScrapedAt     *time.Time `json:"last_scraped_at,omitempty"`
+	LastScrapeStatus  string     `json:"last_scrape_status"`
+	LastScrapeError   string     `json:"last_scrape_error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// Populated by ListProducts from the latest price_history row.
+	CurrentPrice  *money.Money `json:"current_price,omitempty"`
+	ChangePercent *float64     `json:"change_percent,omitempty"`
+	LastChangeAt  *time.Time   `json:"last_change_at,omitempty"`
+	// UnitPrice is CurrentPrice per kilogram, litre or piece, if the pack
+	// size was known when it was recorded.
+	UnitPrice *packsize.UnitPrice `json:"unit_price,omitempty"`
+	// EffectivePrice is CurrentPrice after the offers usable with the
+	// cards setting, if they lowered it.
+	EffectivePrice *money.Money `json:"effective_price,omitempty"`
+
+	// CurrentPrice converted to the display currency, set by the server.
+	DisplayPrice *money.Money `json:"display_price,omitempty"`
 }
 
+// Prices a product's alerts can compare, stored in products.alert_on.
+const (
+	AlertOnPrice          = "price"
+	AlertOnEffectivePrice = "effective_price"
+)
+
+// Scrape statuses recorded on products by UpdateScrapeStatus.
+const (
+	ScrapeStatusSuccess = "success"
+	ScrapeStatusFailed  = "failed"
+)
+
+// PriceHistory is one price_history row. In change-point storage a row
+// covers every consecutive scrape that saw the same price: Timestamp is the
+// first time it was seen, LastSeen the latest, and Observations the number
+// of scrapes in between.
 type PriceHistory struct {
-	ID        string    `json:"id"`
-	ProductID string    `json:"product_id"`
-	Price     float64   `json:"price"`
-	Currency  string    `json:"currency"`
-	Timestamp time.Time `json:"timestamp"`
+	ID           string      `json:"id"`
+	ProductID    string      `json:"product_id"`
+	Price        money.Money `json:"price"`
+	Delta        money.Money `json:"delta"`
+	Currency     string      `json:"currency"`
+	Timestamp    time.Time   `json:"timestamp"`
+	LastSeen     time.Time   `json:"last_seen"`
+	Observations int         `json:"observations"`
+	// UnitPrice is Price per kilogram, litre or piece, if known.
+	UnitPrice *packsize.UnitPrice `json:"unit_price,omitempty"`
+	// Location is the delivery location the price was seen at, "" for
+	// the shop's default.
+	Location string `json:"location,omitempty"`
+	// EffectivePrice is Price after the usable coupons and bank offers,
+	// if they lowered it.
+	EffectivePrice *money.Money `json:"effective_price,omitempty"`
 }
 
+// Price history storage modes.
+const (
+	// StorageSamples stores one row per scrape.
+	StorageSamples = "samples"
+	// StorageChanges stores one row per price change and extends it while
+	// the price stays the same.
+	StorageChanges = "changes"
+)
+
+// lastSeenColumn is when a price_history row was last observed; rows written
+// one per scrape leave last_seen unset.
+const lastSeenColumn = `COALESCE(last_seen, timestamp)`
+
 type Alert struct {
-	ID        string    `json:"id"`
-	ProductID string    `json:"product_id"`
-	OldPrice  float64   `json:"old_price"`
-	NewPrice  float64   `json:"new_price"`
-	Currency  string    `json:"currency"`
-	Message   string    `json:"message"`
-	SentAt    time.Time `json:"sent_at"`
+	ID        string      `json:"id"`
+	ProductID string      `json:"product_id"`
+	GroupID   *string     `json:"group_id,omitempty"`
+	OldPrice  money.Money `json:"old_price"`
+	NewPrice  money.Money `json:"new_price"`
+	Currency  string      `json:"currency"`
+	Message   string      `json:"message"`
+	SentAt    time.Time   `json:"sent_at"`
+	// SuppressedReason says why the alert was recorded but not sent, e.g.
+	// a cooldown; it is empty for sent alerts.
+	SuppressedReason string `json:"suppressed_reason,omitempty"`
+	// Status is what became of the alert: AlertNew until it is
+	// acknowledged, dismissed or led to a purchase.
+	Status   string     `json:"status"`
+	StatusAt *time.Time `json:"status_at,omitempty"`
+	// Type is the alert type, such as digest.AlertLow or
+	// digest.AlertIncrease.
+	Type string `json:"type"`
+	// Deliveries are the alert's deliveries on each channel, filled in by
+	// ListAlerts.
+	Deliveries []Delivery `json:"deliveries,omitempty"`
 }
 
 func NewConnection(databaseURL string) (*DB, error) {
@@ -75,23 +184,291 @@ func initTables(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS price_history (
 			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
-			price DECIMAL(10,2) NOT NULL,
-			delta DECIMAL(10,2) DEFAULT 0,
+			price NUMERIC(19,4) NOT NULL,
+			delta NUMERIC(19,4) DEFAULT 0,
 			currency VARCHAR(3) DEFAULT 'INR',
 			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 		`CREATE TABLE IF NOT EXISTS alerts (
 			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
-			old_price DECIMAL(10,2) NOT NULL,
-			new_price DECIMAL(10,2) NOT NULL,
+			old_price NUMERIC(19,4) NOT NULL,
+			new_price NUMERIC(19,4) NOT NULL,
 			currency VARCHAR(3) DEFAULT 'INR',
 			message TEXT NOT NULL,
 			sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS folder VARCHAR(200) NOT NULL DEFAULT ''`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS in_stock BOOLEAN NOT NULL DEFAULT TRUE`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS last_scraped_at TIMESTAMP`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS last_scrape_status VARCHAR(20) NOT NULL DEFAULT ''`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS last_scrape_error TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS target_price NUMERIC(19,4)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'INR'`,
+		`ALTER TABLE price_history ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP`,
+		`ALTER TABLE price_history ADD COLUMN IF NOT EXISTS observations INTEGER NOT NULL DEFAULT 1`,
+		`CREATE TABLE IF NOT EXISTS product_tags (
+			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			tag VARCHAR(100) NOT NULL,
+			PRIMARY KEY (product_id, tag)
+		)`,
+		`CREATE TABLE IF NOT EXISTS price_history_daily (
+			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			min_price NUMERIC(19,4) NOT NULL,
+			max_price NUMERIC(19,4) NOT NULL,
+			avg_price NUMERIC(19,4) NOT NULL,
+			close_price NUMERIC(19,4) NOT NULL,
+			samples INTEGER NOT NULL,
+			currency VARCHAR(3) DEFAULT 'INR',
+			PRIMARY KEY (product_id, day)
+		)`,
+		`CREATE TABLE IF NOT EXISTS settings (
+			key VARCHAR(100) PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS exchange_rates (
+			base VARCHAR(3) NOT NULL,
+			quote VARCHAR(3) NOT NULL,
+			rate NUMERIC(24,10) NOT NULL,
+			effective_date DATE NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (base, quote, effective_date)
+		)`,
+		`CREATE TABLE IF NOT EXISTS product_groups (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			name VARCHAR(500) NOT NULL,
+			currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+			target_price NUMERIC(19,4),
+			best_price NUMERIC(19,4),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS group_id UUID REFERENCES product_groups(id) ON DELETE SET NULL`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS group_id UUID REFERENCES product_groups(id) ON DELETE SET NULL`,
+		// Amounts used to be DECIMAL(10,2), which capped prices and rounded
+		// currencies with three decimal places; widen existing columns.
+		`DO $$
+		DECLARE col RECORD;
+		BEGIN
+			FOR col IN
+				SELECT table_name, column_name FROM information_schema.columns
+				WHERE table_schema = current_schema() AND data_type = 'numeric' AND numeric_scale = 2
+					AND table_name IN ('products', 'price_history', 'price_history_daily', 'alerts')
+			LOOP
+				EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE NUMERIC(19,4)', col.table_name, col.column_name);
+			END LOOP;
+		END $$`,
 		`CREATE INDEX IF NOT EXISTS idx_price_history_product_timestamp ON price_history(product_id, timestamp DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_price_history_timestamp ON price_history(timestamp DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_products_platform ON products(platform)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_folder ON products(folder)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_name_fts ON products USING GIN (to_tsvector('simple', name))`,
+		`CREATE INDEX IF NOT EXISTS idx_product_tags_tag ON product_tags(tag)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS scraped_title TEXT NOT NULL DEFAULT ''`,
+		`CREATE TABLE IF NOT EXISTS match_dismissals (
+			product_a UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			product_b UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			dismissed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (product_a, product_b)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_group ON products(group_id)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS pack_size NUMERIC(16,3)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS pack_unit VARCHAR(3)`,
+		`ALTER TABLE price_history ADD COLUMN IF NOT EXISTS unit_price NUMERIC(19,4)`,
+		`ALTER TABLE price_history ADD COLUMN IF NOT EXISTS price_unit VARCHAR(3)`,
+		`ALTER TABLE price_history_daily ADD COLUMN IF NOT EXISTS min_unit_price NUMERIC(19,4)`,
+		`ALTER TABLE price_history_daily ADD COLUMN IF NOT EXISTS price_unit VARCHAR(3)`,
+		`CREATE TABLE IF NOT EXISTS baskets (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			name VARCHAR(500) NOT NULL,
+			currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+			cheapest BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS basket_items (
+			basket_id UUID NOT NULL REFERENCES baskets(id) ON DELETE CASCADE,
+			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+			PRIMARY KEY (basket_id, product_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS basket_costs (
+			basket_id UUID NOT NULL REFERENCES baskets(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			cost NUMERIC(19,4) NOT NULL,
+			cheapest_cost NUMERIC(19,4) NOT NULL,
+			currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+			items INTEGER NOT NULL,
+			priced INTEGER NOT NULL,
+			PRIMARY KEY (basket_id, day)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_basket_items_product ON basket_items(product_id)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS location VARCHAR(100) NOT NULL DEFAULT ''`,
+		`ALTER TABLE price_history ADD COLUMN IF NOT EXISTS location VARCHAR(100) NOT NULL DEFAULT ''`,
+		// Rollups are kept per location, so the location joins their key.
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'price_history_daily' AND column_name = 'location'
+			) THEN
+				ALTER TABLE price_history_daily ADD COLUMN location VARCHAR(100) NOT NULL DEFAULT '';
+				ALTER TABLE price_history_daily DROP CONSTRAINT price_history_daily_pkey;
+				ALTER TABLE price_history_daily ADD PRIMARY KEY (product_id, location, day);
+			END IF;
+		END $$`,
+		`CREATE INDEX IF NOT EXISTS idx_price_history_product_location ON price_history(product_id, location, timestamp DESC)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS alert_on VARCHAR(20) NOT NULL DEFAULT 'price'`,
+		`CREATE TABLE IF NOT EXISTS product_offers (
+			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			PRIMARY KEY (product_id, position)
+		)`,
+		`ALTER TABLE price_history ADD COLUMN IF NOT EXISTS effective_price NUMERIC(19,4)`,
+		`ALTER TABLE price_history_daily ADD COLUMN IF NOT EXISTS min_effective_price NUMERIC(19,4)`,
+		`CREATE TABLE IF NOT EXISTS sale_events (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			name VARCHAR(255) NOT NULL,
+			platform VARCHAR(50) NOT NULL DEFAULT '',
+			starts_on DATE NOT NULL,
+			ends_on DATE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (name, platform, starts_on)
+		)`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS suppressed_reason TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_product_sent_at ON alerts(product_id, sent_at DESC)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS alert_cooldown_minutes INTEGER`,
+		`CREATE TABLE IF NOT EXISTS digest_entries (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			kind VARCHAR(20) NOT NULL,
+			product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			old_price NUMERIC(19,4),
+			new_price NUMERIC(19,4),
+			currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_digest_entries_created_at ON digest_entries(created_at)`,
+		`CREATE TABLE IF NOT EXISTS alert_deliveries (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+			channel VARCHAR(20) NOT NULL,
+			subject TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL,
+			quiet BOOLEAN NOT NULL DEFAULT FALSE,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_deliveries_due ON alert_deliveries(status, next_attempt_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_deliveries_alert ON alert_deliveries(alert_id)`,
+		// Alerts queued during quiet hours are now deliveries due when the
+		// quiet hours end: move the ones still queued to the outbox, keeping
+		// the queued row's id as the alert's, before dropping the table.
+		`DO $$
+		DECLARE
+			hours TEXT;
+			zone TEXT;
+			local_now TIMESTAMP;
+			quiet_start TIME;
+			quiet_end TIME;
+			quiet_ends TIMESTAMP;
+			delay INTERVAL := INTERVAL '0';
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.tables
+				WHERE table_schema = current_schema() AND table_name = 'queued_alerts'
+			) THEN
+				RETURN;
+			END IF;
+
+			SELECT value INTO hours FROM settings WHERE key = 'quiet_hours';
+			SELECT value INTO zone FROM settings WHERE key = 'timezone';
+			IF hours IS NOT NULL AND btrim(hours) <> '' AND lower(btrim(hours)) <> 'off' THEN
+				BEGIN
+					local_now := now() AT TIME ZONE COALESCE(NULLIF(zone, ''), current_setting('TimeZone'));
+					quiet_start := btrim(split_part(hours, '-', 1))::TIME;
+					quiet_end := btrim(split_part(hours, '-', 2))::TIME;
+					IF (quiet_start < quiet_end AND local_now::TIME >= quiet_start AND local_now::TIME < quiet_end)
+						OR (quiet_start > quiet_end AND (local_now::TIME >= quiet_start OR local_now::TIME < quiet_end)) THEN
+						quiet_ends := local_now::DATE + quiet_end;
+						IF quiet_ends <= local_now THEN
+							quiet_ends := quiet_ends + INTERVAL '1 day';
+						END IF;
+						delay := quiet_ends - local_now;
+					END IF;
+				EXCEPTION WHEN OTHERS THEN
+					-- Quiet hours or a timezone that do not parse hold nothing back.
+					delay := INTERVAL '0';
+				END;
+			END IF;
+
+			INSERT INTO alerts (id, product_id, old_price, new_price, currency, message, sent_at)
+			SELECT q.id, q.product_id, COALESCE(latest.price, 0), COALESCE(latest.price, 0), p.currency, q.message, q.created_at
+			FROM queued_alerts q
+			JOIN products p ON p.id = q.product_id
+			LEFT JOIN LATERAL (
+				SELECT h.price FROM price_history h
+				WHERE h.product_id = q.product_id
+				ORDER BY h.timestamp DESC
+				LIMIT 1
+			) latest ON TRUE
+			ON CONFLICT (id) DO NOTHING;
+
+			INSERT INTO alert_deliveries (alert_id, channel, subject, message, quiet, next_attempt_at, created_at)
+			SELECT q.id, q.channel, q.subject, q.message, TRUE, LOCALTIMESTAMP + delay, q.created_at
+			FROM queued_alerts q
+			JOIN alerts a ON a.id = q.id
+			WHERE NOT EXISTS (SELECT 1 FROM alert_deliveries d WHERE d.alert_id = q.id);
+
+			DROP TABLE queued_alerts;
+		END $$`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'new'`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS status_at TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_sent_at ON alerts(sent_at DESC)`,
+		`CREATE TABLE IF NOT EXISTS alert_templates (
+			name VARCHAR(40) PRIMARY KEY,
+			body TEXT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS alert_increase_percent NUMERIC(6,2)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS alert_volatility BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS alert_back_to_normal BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS alert_type VARCHAR(20) NOT NULL DEFAULT 'low'`,
+		`UPDATE alerts SET alert_type = 'group' WHERE group_id IS NOT NULL AND alert_type = 'low'`,
+		// Rollups are kept per currency too, so a day on which a product's
+		// shop switched currency does not mix the two.
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.key_column_usage
+				WHERE table_schema = current_schema() AND table_name = 'price_history_daily'
+					AND constraint_name = 'price_history_daily_pkey' AND column_name = 'currency'
+			) THEN
+				UPDATE price_history_daily SET currency = 'INR' WHERE currency IS NULL;
+				ALTER TABLE price_history_daily ALTER COLUMN currency SET NOT NULL;
+				ALTER TABLE price_history_daily DROP CONSTRAINT price_history_daily_pkey;
+				ALTER TABLE price_history_daily ADD PRIMARY KEY (product_id, location, day, currency);
+			END IF;
+		END $$`,
+		// Each item's cost, so inflation compares the items priced on both days.
+		`CREATE TABLE IF NOT EXISTS basket_item_costs (
+			basket_id UUID NOT NULL,
+			day DATE NOT NULL,
+			product_id UUID NOT NULL,
+			cost NUMERIC(19,4),
+			cheapest_cost NUMERIC(19,4),
+			currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+			PRIMARY KEY (basket_id, day, product_id),
+			FOREIGN KEY (basket_id, day) REFERENCES basket_costs(basket_id, day) ON DELETE CASCADE
+		)`,
 	}
 
 	for _, query := range queries {
@@ -103,27 +480,157 @@ func initTables(db *sql.DB) error {
 	return nil
 }
 
-func (db *DB) CreateProduct(name, url, platform string) (*Product, error) {
+// productColumns lists the products columns read by scanProduct, in order.
+const productColumns = `p.id, p.name, p.scraped_title, p.url, p.platform, p.folder, p.group_id, p.currency,
+	ARRAY(SELECT t.tag FROM product_tags t WHERE t.product_id = p.id ORDER BY t.tag), p.target_price,
+	p.pack_size, p.pack_unit, p.location,
+	ARRAY(SELECT o.text FROM product_offers o WHERE o.product_id = p.id ORDER BY o.position), p.alert_on, p.alert_cooldown_minutes,
+	p.alert_increase_percent, p.alert_volatility, p.alert_back_to_normal, p.in_stock, p.last_scraped_at, p.last_scrape_status, p.last_scrape_error,
+	p.created_at, p.updated_at`
+
+// execer runs statements on the database or in a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(row rowScanner, extra ...interface{}) (Product, error) {
+	var product Product
+	var lastScrapedAt sql.NullTime
+	var cooldown sql.NullInt64
+	var increase sql.NullFloat64
+	var groupID, targetPrice, packSize, packUnit sql.NullString
+	var loc string
+	var offerTexts []string
+	dest := []interface{}{
+		&product.ID, &product.Name, &product.ScrapedTitle, &product.URL, &product.Platform, &product.Folder, &groupID, &product.Currency,
+		pq.Array(&product.Tags), &targetPrice, &packSize, &packUnit, &loc, pq.Array(&offerTexts), &product.AlertOn, &cooldown,
+		&increase, &product.AlertVolatility, &product.AlertBackToNormal, &product.InStock, &lastScrapedAt, &product.LastScrapeStatus,
+		&product.LastScrapeError, &product.CreatedAt, &product.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return product, err
+	}
+	if lastScrapedAt.Valid {
+		product.LastScrapedAt = &lastScrapedAt.Time
+	}
+	if groupID.Valid {
+		product.GroupID = &groupID.String
+	}
+	if cooldown.Valid {
+		minutes := int(cooldown.Int64)
+		product.AlertCooldownMinutes = &minutes
+	}
+	if increase.Valid {
+		product.AlertIncreasePercent = &increase.Float64
+	}
+	if targetPrice.Valid {
+		target, err := parseAmount(targetPrice.String, product.Currency)
+		if err != nil {
+			return product, err
+		}
+		product.TargetPrice = &target
+	}
+	if packSize.Valid && packUnit.Valid {
+		size, err := packsize.NewSize(packSize.String, packUnit.String)
+		if err != nil {
+			return product, err
+		}
+		product.PackSize = &size
+	}
+	if loc != "" {
+		l, err := location.Parse(loc)
+		if err != nil {
+			return product, err
+		}
+		product.Location = &l
+	}
+	product.Offers = offers.ParseAll(offerTexts, product.Currency)
+	if product.Tags == nil {
+		product.Tags = []string{}
+	}
+	return product, nil
+}
+
+// CreateProduct adds a product whose prices are expected in currency.
+func (db *DB) CreateProduct(name, url, platform, currency string) (*Product, error) {
 	query := `
-		INSERT INTO products (name, url, platform)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, url, platform, created_at, updated_at
+		INSERT INTO products (name, url, platform, currency)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
 	`
 
-	var product Product
-	err := db.QueryRow(query, name, url, platform).Scan(
-		&product.ID, &product.Name, &product.URL, &product.Platform, &product.CreatedAt, &product.UpdatedAt,
-	)
+	var id string
+	if err := db.QueryRow(query, name, url, platform, currency).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create product: %w", err)
+	}
 
+	return db.GetProduct(id)
+}
+
+// CreateProductWith creates a product with update applied, in one
+// transaction so the product is not left behind without the update.
+func (db *DB) CreateProductWith(name, url, platform, currency string, update ProductUpdate) (*Product, error) {
+	tx, err := db.Begin()
 	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO products (name, url, platform, currency)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	var id string
+	if err := tx.QueryRow(query, name, url, platform, currency).Scan(&id); err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
+	if err := updateProduct(tx, id, update); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product: %w", err)
+	}
+
+	return db.GetProduct(id)
+}
+
+func (db *DB) GetProduct(productID string) (*Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products p WHERE p.id = $1`
+
+	product, err := scanProduct(db.QueryRow(query, productID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("product not found: %s", productID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return &product, nil
+}
+
+// FindProductByURL returns the product tracking url, or nil if there is none.
+func (db *DB) FindProductByURL(url string) (*Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products p WHERE p.url = $1`
+
+	product, err := scanProduct(db.QueryRow(query, url))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find product: %w", err)
+	}
 
 	return &product, nil
 }
 
 func (db *DB) GetProducts() ([]Product, error) {
-	query := `SELECT id, name, url, platform, created_at, updated_at FROM products ORDER BY created_at DESC`
+	query := `SELECT ` + productColumns + ` FROM products p ORDER BY p.created_at DESC`
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -133,8 +640,8 @@ func (db *DB) GetProducts() ([]Product, error) {
 
 	var products []Product
 	for rows.Next() {
-		var product Product
-		if err := rows.Scan(&product.ID, &product.Name, &product.URL, &product.Platform, &product.CreatedAt, &product.UpdatedAt); err != nil {
+		product, err := scanProduct(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
 		products = append(products, product)
@@ -143,62 +650,425 @@ func (db *DB) GetProducts() ([]Product, error) {
 	return products, nil
 }
 
-func (db *DB) AddPriceHistory(productID string, price float64, delta float64, currency string) error {
-	query := `INSERT INTO price_history (product_id, price, delta, currency) VALUES ($1, $2, $3, $4)`
-	_, err := db.Exec(query, productID, price, delta, currency)
+// ProductUpdate holds the editable product fields; nil fields are left unchanged.
+// A zero TargetPrice clears the target, as does changing Currency without
+// giving a new TargetPrice. TargetPrice is in the product's (new) currency.
+// A zero PackSize clears the pack size, and a zero Location the location.
+// AlertOn must be AlertOnPrice or AlertOnEffectivePrice. A negative
+// AlertCooldownMinutes clears the product's cooldown, and a zero or negative
+// AlertIncreasePercent turns increase alerts off.
+type ProductUpdate struct {
+	Name        *string
+	Folder      *string
+	Tags        []string
+	TargetPrice *money.Money
+	Currency    *string
+	PackSize    *packsize.Size
+	Location    *location.Location
+	AlertOn     *string
+
+	AlertCooldownMinutes *int
+	AlertIncreasePercent *float64
+	AlertVolatility      *bool
+	AlertBackToNormal    *bool
+}
+
+func (db *DB) UpdateProduct(productID string, update ProductUpdate) (*Product, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := updateProduct(tx, productID, update); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product update: %w", err)
+	}
+
+	return db.GetProduct(productID)
+}
+
+func updateProduct(tx *sql.Tx, productID string, update ProductUpdate) error {
+	query := `
+		UPDATE products
+		SET name = COALESCE($2, name), folder = COALESCE($3, folder),
+			target_price = CASE
+				WHEN $4::NUMERIC IS NOT NULL THEN NULLIF($4::NUMERIC, 0)
+				WHEN $5::VARCHAR <> currency THEN NULL
+				ELSE target_price
+			END,
+			currency = COALESCE($5, currency),
+			pack_size = CASE WHEN $6::VARCHAR IS NOT NULL THEN NULLIF($6::VARCHAR, '')::NUMERIC ELSE pack_size END,
+			pack_unit = CASE WHEN $6::VARCHAR IS NOT NULL THEN NULLIF($7::VARCHAR, '') ELSE pack_unit END,
+			location = COALESCE($8, location),
+			alert_on = COALESCE($9, alert_on),
+			alert_cooldown_minutes = CASE
+				WHEN $10::INTEGER IS NOT NULL THEN NULLIF(GREATEST($10::INTEGER, -1), -1)
+				ELSE alert_cooldown_minutes
+			END,
+			alert_increase_percent = CASE
+				WHEN $11::NUMERIC IS NOT NULL THEN NULLIF(GREATEST($11::NUMERIC, 0), 0)
+				ELSE alert_increase_percent
+			END,
+			alert_volatility = COALESCE($12, alert_volatility),
+			alert_back_to_normal = COALESCE($13, alert_back_to_normal),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	var packSize, packUnit interface{}
+	if update.PackSize != nil {
+		packSize, packUnit = "", ""
+		if update.PackSize.Amount > 0 {
+			packSize, packUnit = update.PackSize.Quantity(), update.PackSize.Unit
+		}
+	}
+	var loc interface{}
+	if update.Location != nil {
+		loc = update.Location.String()
+	}
+	result, err := tx.Exec(query, productID, update.Name, update.Folder, update.TargetPrice, update.Currency, packSize, packUnit, loc, update.AlertOn, update.AlertCooldownMinutes,
+		update.AlertIncreasePercent, update.AlertVolatility, update.AlertBackToNormal)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("product not found: %s", productID)
+	}
+
+	if update.Tags != nil {
+		return setProductTags(tx, productID, update.Tags)
+	}
+	return nil
+}
+
+func setProductTags(tx *sql.Tx, productID string, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM product_tags WHERE product_id = $1`, productID); err != nil {
+		return fmt.Errorf("failed to clear product tags: %w", err)
+	}
+
+	for _, tag := range NormalizeTags(tags) {
+		if _, err := tx.Exec(`INSERT INTO product_tags (product_id, tag) VALUES ($1, $2)`, productID, tag); err != nil {
+			return fmt.Errorf("failed to add product tag: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// NormalizeTags lower-cases and trims tags, dropping blanks and duplicates.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// SetProductCurrency records that a product is now priced in currency, e.g.
+// after its shop switched currency. A target price in the old currency no
+// longer applies and is cleared.
+func (db *DB) SetProductCurrency(productID, currency string) error {
+	query := `
+		UPDATE products
+		SET currency = $2, target_price = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND currency <> $2
+	`
+	if _, err := db.Exec(query, productID, currency); err != nil {
+		return fmt.Errorf("failed to set product currency: %w", err)
+	}
+	return nil
+}
+
+// SetScrapedTitle stores the product title last found on the product's page.
+func (db *DB) SetScrapedTitle(productID, title string) error {
+	query := `UPDATE products SET scraped_title = $2 WHERE id = $1 AND scraped_title <> $2`
+	if _, err := db.Exec(query, productID, title); err != nil {
+		return fmt.Errorf("failed to set scraped title: %w", err)
+	}
+	return nil
+}
+
+// SetPackSize stores a product's pack size; nil clears it.
+func (db *DB) SetPackSize(productID string, size *packsize.Size) error {
+	var quantity, unit interface{}
+	if size != nil {
+		quantity, unit = size.Quantity(), size.Unit
+	}
+	query := `UPDATE products SET pack_size = $2, pack_unit = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	result, err := db.Exec(query, productID, quantity, unit)
+	if err != nil {
+		return fmt.Errorf("failed to set pack size: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("product not found: %s", productID)
+	}
+	return nil
+}
+
+// UnitPriceOf returns price per kilogram, litre or piece for the product's
+// pack size, or nil if its pack size is unknown.
+func UnitPriceOf(product Product, price money.Money) *packsize.UnitPrice {
+	if product.PackSize == nil {
+		return nil
+	}
+	unit, err := product.PackSize.UnitPrice(price)
+	if err != nil {
+		return nil
+	}
+	return &unit
+}
+
+// parseUnitPrice converts a stored unit price and its unit into a
+// UnitPrice, or nil if none was stored.
+func parseUnitPrice(amount, per sql.NullString, currency string) (*packsize.UnitPrice, error) {
+	if !amount.Valid || !per.Valid {
+		return nil, nil
+	}
+	price, err := parseAmount(amount.String, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &packsize.UnitPrice{Price: price, Per: per.String}, nil
+}
+
+// UpdateScrapeStatus records the outcome of the latest scrape of a product.
+func (db *DB) UpdateScrapeStatus(productID, status, scrapeError string, inStock bool) error {
+	query := `
+		UPDATE products
+		SET last_scraped_at = CURRENT_TIMESTAMP, last_scrape_status = $2, last_scrape_error = $3, in_stock = $4
+		WHERE id = $1
+	`
+	_, err := db.Exec(query, productID, status, scrapeError, inStock)
 	return err
 }
 
-func (db *DB) GetLowestPriceInPeriod(productID string, days int) (float64, error) {
+// amountLimit is the first whole-unit amount NUMERIC(19,4) columns cannot hold.
+const amountLimit = 1_000_000_000_000_000
+
+// checkStorable rejects amounts too large for the NUMERIC amount columns.
+func checkStorable(m money.Money) error {
+	whole := m.Amount
+	for i := 0; i < money.MinorDigits(m.Currency); i++ {
+		whole /= 10
+	}
+	if whole >= amountLimit || whole <= -amountLimit {
+		return fmt.Errorf("amount %s: %w", m, money.ErrOverflow)
+	}
+	return nil
+}
+
+// parseAmount converts a NUMERIC amount read as text into Money. Computed
+// values such as averages are rounded to the currency's minor unit.
+func parseAmount(amount, currency string) (money.Money, error) {
+	m, err := money.ParseRounded(amount, currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("invalid stored amount: %w", err)
+	}
+	return m, nil
+}
+
+// AddPriceHistory stores one price row at the default location; delta must
+// be in price's currency.
+func (db *DB) AddPriceHistory(productID string, price, delta money.Money) error {
+	return addPriceHistory(db, productID, location.Location{}, price, delta, nil, nil)
+}
+
+func addPriceHistory(q execer, productID string, at location.Location, price, delta money.Money, unit *packsize.UnitPrice, effective *money.Money) error {
+	if err := checkStorable(price); err != nil {
+		return err
+	}
+	unitPrice, priceUnit := unitColumns(unit)
+	query := `INSERT INTO price_history (product_id, price, delta, currency, unit_price, price_unit, location, effective_price)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := q.Exec(query, productID, price, delta, price.Currency, unitPrice, priceUnit, at.String(), effectiveColumn(effective))
+	return err
+}
+
+// effectiveColumn returns the effective_price value for effective.
+func effectiveColumn(effective *money.Money) interface{} {
+	if effective == nil {
+		return nil
+	}
+	return *effective
+}
+
+// unitColumns returns the unit_price and price_unit values for unit.
+func unitColumns(unit *packsize.UnitPrice) (interface{}, interface{}) {
+	if unit == nil {
+		return nil, nil
+	}
+	return unit.Price, unit.Per
+}
+
+// RecordPrice stores a price scraped at a location, its unit price if the
+// pack size is known and its effective price if offers lowered it, using
+// the given storage mode. In StorageChanges mode a price equal to the latest
+// one at the same location only extends that row's last_seen and
+// observation count.
+func (db *DB) RecordPrice(productID string, at location.Location, price, delta money.Money, unit *packsize.UnitPrice, effective *money.Money, mode string) error {
+	return recordPrice(db, productID, at, price, delta, unit, effective, mode)
+}
+
+func recordPrice(q execer, productID string, at location.Location, price, delta money.Money, unit *packsize.UnitPrice, effective *money.Money, mode string) error {
+	if mode == StorageChanges {
+		unitPrice, priceUnit := unitColumns(unit)
+		query := `
+			UPDATE price_history
+			SET last_seen = CURRENT_TIMESTAMP, observations = observations + 1
+			WHERE id = (
+				SELECT id FROM price_history WHERE product_id = $1 AND location = $6 ORDER BY timestamp DESC LIMIT 1
+			) AND price = $2 AND currency = $3
+				AND unit_price IS NOT DISTINCT FROM $4::NUMERIC AND price_unit IS NOT DISTINCT FROM $5::VARCHAR
+				AND effective_price IS NOT DISTINCT FROM $7::NUMERIC
+		`
+		result, err := q.Exec(query, productID, price, price.Currency, unitPrice, priceUnit, at.String(), effectiveColumn(effective))
+		if err != nil {
+			return fmt.Errorf("failed to extend price history: %w", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			return nil
+		}
+	}
+
+	return addPriceHistory(q, productID, at, price, delta, unit, effective)
+}
+
+// GetLowestPriceInPeriod returns the lowest price seen at a location in the
+// last days days, reading daily rollups for periods whose raw samples were
+// compacted. Only prices in the currency of the latest price there are
+// considered; the result is zero if there are none.
+func (db *DB) GetLowestPriceInPeriod(productID string, at location.Location, days int) (money.Money, error) {
+	return db.lowestInPeriod(productID, at, days, "price", "min_price")
+}
+
+// lowestInPeriod is GetLowestPriceInPeriod for the price in column of raw
+// rows and dailyColumn of daily rollups.
+func (db *DB) lowestInPeriod(productID string, at location.Location, days int, column, dailyColumn string) (money.Money, error) {
 	query := `
-		SELECT MIN(price) 
-		FROM price_history 
-		WHERE product_id = $1 AND timestamp >= NOW() - INTERVAL '1 day' * $2
+		WITH latest AS (
+			SELECT currency FROM price_history WHERE product_id = $1 AND location = $3 ORDER BY timestamp DESC LIMIT 1
+		)
+		SELECT MIN(low), (SELECT currency FROM latest) FROM (
+			SELECT MIN(` + column + `) AS low
+			FROM price_history
+			WHERE product_id = $1 AND location = $3 AND ` + lastSeenColumn + ` >= NOW() - INTERVAL '1 day' * $2
+				AND currency = (SELECT currency FROM latest)
+			UNION ALL
+			SELECT MIN(` + dailyColumn + `)
+			FROM price_history_daily
+			WHERE product_id = $1 AND location = $3 AND day >= CAST(NOW() - INTERVAL '1 day' * $2 AS DATE)
+				AND currency = (SELECT currency FROM latest)
+		) lows
 	`
 
-	var lowestPrice sql.NullFloat64
-	err := db.QueryRow(query, productID, days).Scan(&lowestPrice)
+	var lowestPrice, currency sql.NullString
+	err := db.QueryRow(query, productID, days, at.String()).Scan(&lowestPrice, &currency)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get lowest price: %w", err)
+		return money.Money{}, fmt.Errorf("failed to get lowest price: %w", err)
 	}
 
 	if !lowestPrice.Valid {
-		return 0, nil
+		return money.New(0, currency.String), nil
 	}
 
-	return lowestPrice.Float64, nil
+	return parseAmount(lowestPrice.String, currency.String)
 }
 
-func (db *DB) GetLatestPrice(productID string) (float64, error) {
+// GetLowestUnitPriceInPeriod is GetLowestPriceInPeriod for unit prices: it
+// considers only unit prices per the same unit and in the same currency as
+// the latest one at the location, and returns nil if the latest price there
+// has no unit price.
+func (db *DB) GetLowestUnitPriceInPeriod(productID string, at location.Location, days int) (*packsize.UnitPrice, error) {
 	query := `
-		SELECT price 
+		WITH latest AS (
+			SELECT currency, price_unit FROM price_history WHERE product_id = $1 AND location = $3 ORDER BY timestamp DESC LIMIT 1
+		)
+		SELECT MIN(low), (SELECT price_unit FROM latest), (SELECT currency FROM latest) FROM (
+			SELECT MIN(unit_price) AS low
+			FROM price_history
+			WHERE product_id = $1 AND location = $3 AND ` + lastSeenColumn + ` >= NOW() - INTERVAL '1 day' * $2
+				AND currency = (SELECT currency FROM latest) AND price_unit = (SELECT price_unit FROM latest)
+			UNION ALL
+			SELECT MIN(min_unit_price)
+			FROM price_history_daily
+			WHERE product_id = $1 AND location = $3 AND day >= CAST(NOW() - INTERVAL '1 day' * $2 AS DATE)
+				AND currency = (SELECT currency FROM latest) AND price_unit = (SELECT price_unit FROM latest)
+		) lows
+	`
+
+	var lowest, per, currency sql.NullString
+	if err := db.QueryRow(query, productID, days, at.String()).Scan(&lowest, &per, &currency); err != nil {
+		return nil, fmt.Errorf("failed to get lowest unit price: %w", err)
+	}
+
+	return parseUnitPrice(lowest, per, currency.String)
+}
+
+// GetLatestPrice returns the latest price seen at a location.
+func (db *DB) GetLatestPrice(productID string, at location.Location) (money.Money, error) {
+	return db.latestPrice(productID, at, "price")
+}
+
+// latestPrice is GetLatestPrice for the price in column.
+func (db *DB) latestPrice(productID string, at location.Location, column string) (money.Money, error) {
+	query := `
+		SELECT ` + column + `, currency
 		FROM price_history 
-		WHERE product_id = $1 
+		WHERE product_id = $1 AND location = $2
 		ORDER BY timestamp DESC 
 		LIMIT 1
 	`
 
-	var price sql.NullFloat64
-	err := db.QueryRow(query, productID).Scan(&price)
+	var price, currency sql.NullString
+	err := db.QueryRow(query, productID, at.String()).Scan(&price, &currency)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get latest price: %w", err)
+		return money.Money{}, fmt.Errorf("failed to get latest price: %w", err)
 	}
 
 	if !price.Valid {
-		return 0, nil
+		return money.New(0, currency.String), nil
+	}
+
+	return parseAmount(price.String, currency.String)
+}
+
+// GetLatestUnitPrice returns the unit price stored with the latest price at
+// a location, or nil if it has none.
+func (db *DB) GetLatestUnitPrice(productID string, at location.Location) (*packsize.UnitPrice, error) {
+	query := `SELECT unit_price, price_unit, currency FROM price_history WHERE product_id = $1 AND location = $2 ORDER BY timestamp DESC LIMIT 1`
+
+	var unitPrice, priceUnit sql.NullString
+	var currency string
+	err := db.QueryRow(query, productID, at.String()).Scan(&unitPrice, &priceUnit, &currency)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest unit price: %w", err)
 	}
 
-	return price.Float64, nil
+	return parseUnitPrice(unitPrice, priceUnit, currency)
 }
 
-func (db *DB) CreateAlert(productID string, oldPrice, newPrice float64, currency, message string) error {
-	query := `INSERT INTO alerts (product_id, old_price, new_price, currency, message) VALUES ($1, $2, $3, $4, $5)`
-	_, err := db.Exec(query, productID, oldPrice, newPrice, currency, message)
+// CreateAlert records an alert, sent unless suppressedReason says why it
+// was not; both prices must be in the same currency.
+func (db *DB) CreateAlert(productID string, oldPrice, newPrice money.Money, message, suppressedReason string) error {
+	query := `INSERT INTO alerts (product_id, old_price, new_price, currency, message, suppressed_reason) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := db.Exec(query, productID, oldPrice, newPrice, newPrice.Currency, message, suppressedReason)
 	return err
 }
 
 func (db *DB) GetProductsByPlatform(platform string) ([]Product, error) {
-	query := `SELECT id, name, url, platform, created_at, updated_at FROM products WHERE platform = $1`
+	query := `SELECT ` + productColumns + ` FROM products p WHERE p.platform = $1`
 
 	rows, err := db.Query(query, platform)
 	if err != nil {
@@ -208,8 +1078,8 @@ func (db *DB) GetProductsByPlatform(platform string) ([]Product, error) {
 
 	var products []Product
 	for rows.Next() {
-		var product Product
-		if err := rows.Scan(&product.ID, &product.Name, &product.URL, &product.Platform, &product.CreatedAt, &product.UpdatedAt); err != nil {
+		product, err := scanProduct(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
 		products = append(products, product)
@@ -1,8 +1,17 @@
 package database
 
 import (
+	"math"
 	"os"
 	"testing"
+	"time"
+
+	"price-watcher/digest"
+	"price-watcher/events"
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/offers"
+	"price-watcher/packsize"
 )
 
 // Note: These tests require a running PostgreSQL database.
@@ -28,7 +37,7 @@ func TestDeleteProduct_Success(t *testing.T) {
 	defer db.Close()
 
 	// Create a test product
-	product, err := db.CreateProduct("Test Product for Deletion", "https://www.amazon.in/test-delete", "amazon")
+	product, err := db.CreateProduct("Test Product for Deletion", "https://www.amazon.in/test-delete", "amazon", "INR")
 	if err != nil {
 		t.Fatalf("Failed to create test product: %v", err)
 	}
@@ -93,7 +102,7 @@ func TestCreateAndGetProduct(t *testing.T) {
 	productURL := "https://www.flipkart.com/test-product"
 	platform := "flipkart"
 
-	product, err := db.CreateProduct(productName, productURL, platform)
+	product, err := db.CreateProduct(productName, productURL, platform, "INR")
 	if err != nil {
 		t.Fatalf("CreateProduct() error = %v", err)
 	}
@@ -131,21 +140,53 @@ func TestCreateAndGetProduct(t *testing.T) {
 	}
 }
 
+func TestCreateProductWith(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	folder, target := "Kitchen", inr(899)
+	update := ProductUpdate{Folder: &folder, Tags: []string{"Gift", "sale"}, TargetPrice: &target}
+	product, err := db.CreateProductWith("Kettle", "https://www.amazon.in/test-create-with", "amazon", "INR", update)
+	if err != nil {
+		t.Fatalf("CreateProductWith() error = %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	if product.Folder != folder || len(product.Tags) != 2 || product.TargetPrice == nil || !product.TargetPrice.Equal(target) {
+		t.Errorf("CreateProductWith() = %+v, want the folder, tags and target", product)
+	}
+
+	// A failing update leaves no product behind.
+	currency := "RUPEES"
+	url := "https://www.amazon.in/test-create-with-failed"
+	if _, err := db.CreateProductWith("Kettle", url, "amazon", "INR", ProductUpdate{Currency: &currency}); err == nil {
+		t.Fatal("CreateProductWith() with a bad update succeeded, want an error")
+	}
+	if existing, err := db.FindProductByURL(url); err != nil || existing != nil {
+		t.Errorf("FindProductByURL() = %+v, %v, want no product", existing, err)
+	}
+}
+
+// inr returns a whole rupee amount.
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
 func TestAddPriceHistory(t *testing.T) {
 	db := getTestDB(t)
 	defer db.Close()
 
 	// Create a test product
-	product, err := db.CreateProduct("Price History Test Product", "https://www.amazon.in/test-price-history", "amazon")
+	product, err := db.CreateProduct("Price History Test Product", "https://www.amazon.in/test-price-history", "amazon", "INR")
 	if err != nil {
 		t.Fatalf("Failed to create test product: %v", err)
 	}
 	defer db.DeleteProduct(product.ID)
 
 	// Add price history with delta
-	price := 1000.00
-	delta := -50.00
-	err = db.AddPriceHistory(product.ID, price, delta, "INR")
+	price := money.New(99999, "INR")
+	delta := money.New(-5001, "INR")
+	err = db.AddPriceHistory(product.ID, price, delta)
 	if err != nil {
 		t.Fatalf("AddPriceHistory() error = %v", err)
 	}
@@ -153,16 +194,343 @@ func TestAddPriceHistory(t *testing.T) {
 	// Verify the price history was added
 	// We need to query the database directly or add a GetPriceHistory method to DB for testing
 	// For now, let's use GetLatestPrice to verify at least the price
-	latestPrice, err := db.GetLatestPrice(product.ID)
+	latestPrice, err := db.GetLatestPrice(product.ID, location.Location{})
 	if err != nil {
 		t.Fatalf("GetLatestPrice() error = %v", err)
 	}
 
-	if latestPrice != price {
+	if !latestPrice.Equal(price) {
 		t.Errorf("GetLatestPrice() = %v, want %v", latestPrice, price)
 	}
 }
 
+func TestListProducts_FilterAndPaginate(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	cheap, err := db.CreateProduct("Filter Test Cheap Phone", "https://www.amazon.in/test-filter-cheap", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(cheap.ID)
+
+	pricey, err := db.CreateProduct("Filter Test Pricey Phone", "https://www.flipkart.com/test-filter-pricey", "flipkart", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(pricey.ID)
+
+	folder := "filter-test"
+	for _, p := range []*Product{cheap, pricey} {
+		if _, err := db.UpdateProduct(p.ID, ProductUpdate{Folder: &folder, Tags: []string{"Phones", " phones "}}); err != nil {
+			t.Fatalf("UpdateProduct() error = %v", err)
+		}
+	}
+	db.AddPriceHistory(cheap.ID, inr(500), inr(0))
+	db.AddPriceHistory(pricey.ID, inr(5000), inr(0))
+
+	minPrice := inr(1000)
+	page, err := db.ListProducts(ProductFilter{Folder: folder, Tag: "phones", MinPrice: &minPrice})
+	if err != nil {
+		t.Fatalf("ListProducts() error = %v", err)
+	}
+	if page.Total != 1 || len(page.Products) != 1 || page.Products[0].ID != pricey.ID {
+		t.Fatalf("ListProducts() = %+v, want only %s", page, pricey.ID)
+	}
+	if tags := page.Products[0].Tags; len(tags) != 1 || tags[0] != "phones" {
+		t.Errorf("ListProducts() tags = %v, want [phones]", tags)
+	}
+
+	// Bounds only match prices in their own currency.
+	maxPrice := money.New(100000, "USD")
+	page, err = db.ListProducts(ProductFilter{Folder: folder, MaxPrice: &maxPrice})
+	if err != nil {
+		t.Fatalf("ListProducts() error = %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("ListProducts() max $1000 = %+v, want no rupee prices", page)
+	}
+	page, err = db.ListProducts(ProductFilter{Folder: folder, Currency: "INR"})
+	if err != nil {
+		t.Fatalf("ListProducts() error = %v", err)
+	}
+	if page.Total != 2 {
+		t.Errorf("ListProducts() in INR = %+v, want both products", page)
+	}
+
+	page, err = db.ListProducts(ProductFilter{Folder: folder, Sort: SortPrice, PageSize: 1, Page: 2})
+	if err != nil {
+		t.Fatalf("ListProducts() error = %v", err)
+	}
+	if page.Total != 2 || len(page.Products) != 1 || page.Products[0].ID != pricey.ID {
+		t.Errorf("ListProducts() page 2 = %+v, want %s", page, pricey.ID)
+	}
+}
+
+func TestCompactPriceHistory(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Compaction Test Product", "https://www.amazon.in/test-compaction", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	// Three samples on one old day, one in another currency that day, plus
+	// a recent one.
+	for i, sample := range []money.Money{inr(300), inr(100), inr(200), money.New(500, "USD")} {
+		_, err := db.Exec(`INSERT INTO price_history (product_id, price, currency, timestamp, last_seen)
+			VALUES ($1, $2, $3, DATE_TRUNC('day', NOW()) - INTERVAL '200 days' + INTERVAL '1 hour' * $4,
+				DATE_TRUNC('day', NOW()) - INTERVAL '200 days' + INTERVAL '1 hour' * $4)`,
+			product.ID, sample, sample.Currency, i)
+		if err != nil {
+			t.Fatalf("Failed to insert old sample: %v", err)
+		}
+	}
+	// A price seen 6 times over three days in changes mode.
+	_, err = db.Exec(`INSERT INTO price_history (product_id, price, currency, timestamp, last_seen, observations)
+		VALUES ($1, 400, 'INR', DATE_TRUNC('day', NOW()) - INTERVAL '250 days', DATE_TRUNC('day', NOW()) - INTERVAL '248 days', 6)`,
+		product.ID)
+	if err != nil {
+		t.Fatalf("Failed to insert old interval: %v", err)
+	}
+	if err := db.AddPriceHistory(product.ID, inr(250), inr(50)); err != nil {
+		t.Fatalf("AddPriceHistory() error = %v", err)
+	}
+
+	if _, err := db.CompactPriceHistory(90, 0); err != nil {
+		t.Fatalf("CompactPriceHistory() error = %v", err)
+	}
+
+	history, err := db.GetPriceHistory(product.ID, location.Location{}, time.Now().AddDate(0, 0, -365))
+	if err != nil {
+		t.Fatalf("GetPriceHistory() error = %v", err)
+	}
+	if len(history) != 6 {
+		t.Fatalf("GetPriceHistory() returned %d points, want 6: %+v", len(history), history)
+	}
+
+	for _, day := range history[:3] {
+		if day.Resolution != ResolutionDaily || !day.Price.Equal(inr(400)) || day.Samples != 2 {
+			t.Errorf("interval rollup = %+v, want close 400 from 2 samples on each day", day)
+		}
+	}
+	daily, other := history[3], history[4]
+	if daily.Currency != "INR" {
+		daily, other = other, daily
+	}
+	if other.Resolution != ResolutionDaily || !other.Price.Equal(money.New(500, "USD")) || other.Samples != 1 {
+		t.Errorf("daily rollup in USD = %+v, want close $5.00 from 1 sample", other)
+	}
+	if daily.Resolution != ResolutionDaily || !daily.Min.Equal(inr(100)) || !daily.Max.Equal(inr(300)) ||
+		!daily.Avg.Equal(inr(200)) || !daily.Price.Equal(inr(200)) || daily.Samples != 3 {
+		t.Errorf("daily rollup = %+v, want min 100 max 300 avg 200 close 200 samples 3", daily)
+	}
+	if history[5].Resolution != ResolutionRaw || !history[5].Price.Equal(inr(250)) {
+		t.Errorf("raw point = %+v, want raw 250", history[5])
+	}
+
+	lowest, err := db.GetLowestPriceInPeriod(product.ID, location.Location{}, 365)
+	if err != nil {
+		t.Fatalf("GetLowestPriceInPeriod() error = %v", err)
+	}
+	if !lowest.Equal(inr(100)) {
+		t.Errorf("GetLowestPriceInPeriod() = %v, want 100 from the rollup", lowest)
+	}
+}
+
+func TestRecordPrice_ChangePoints(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Change Point Test Product", "https://www.amazon.in/test-change-points", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	for _, price := range []int64{100, 100, 100, 90, 90} {
+		if err := db.RecordPrice(product.ID, location.Location{}, inr(price), inr(0), nil, nil, StorageChanges); err != nil {
+			t.Fatalf("RecordPrice() error = %v", err)
+		}
+	}
+
+	history, err := db.GetPriceHistory(product.ID, location.Location{}, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("GetPriceHistory() error = %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("GetPriceHistory() returned %d rows, want 2 change points: %+v", len(history), history)
+	}
+	if !history[0].Price.Equal(inr(100)) || history[0].Samples != 3 || !history[1].Price.Equal(inr(90)) || history[1].Samples != 2 {
+		t.Errorf("GetPriceHistory() = %+v, want 100 x3 then 90 x2", history)
+	}
+
+	latest, err := db.GetLatestPrice(product.ID, location.Location{})
+	if err != nil || !latest.Equal(inr(90)) {
+		t.Errorf("GetLatestPrice() = %v, %v, want 90", latest, err)
+	}
+
+	// A price held since before the period still counts towards its lowest.
+	if _, err := db.Exec(`UPDATE price_history SET timestamp = timestamp - INTERVAL '60 days' WHERE product_id = $1`, product.ID); err != nil {
+		t.Fatalf("Failed to backdate history: %v", err)
+	}
+	lowest, err := db.GetLowestPriceInPeriod(product.ID, location.Location{}, 30)
+	if err != nil || !lowest.Equal(inr(90)) {
+		t.Errorf("GetLowestPriceInPeriod() = %v, %v, want 90", lowest, err)
+	}
+}
+
+func TestRecordPrice_EffectivePrice(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Offer Test Product", "https://www.amazon.in/test-offers", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	coupon := inr(900)
+	for _, p := range []struct {
+		price     int64
+		effective *money.Money
+	}{{1000, nil}, {1000, &coupon}, {1000, &coupon}} {
+		if err := db.RecordPrice(product.ID, location.Location{}, inr(p.price), inr(0), nil, p.effective, StorageChanges); err != nil {
+			t.Fatalf("RecordPrice() error = %v", err)
+		}
+	}
+
+	history, err := db.GetPriceHistory(product.ID, location.Location{}, time.Now().AddDate(0, 0, -1))
+	if err != nil || len(history) != 2 {
+		t.Fatalf("GetPriceHistory() = %+v, %v, want a row per effective price", history, err)
+	}
+	if history[0].EffectivePrice != nil || history[1].EffectivePrice == nil || !history[1].EffectivePrice.Equal(coupon) {
+		t.Errorf("GetPriceHistory() effective prices = %v, %v, want none then 900", history[0].EffectivePrice, history[1].EffectivePrice)
+	}
+	if latest, err := db.GetLatestEffectivePrice(product.ID, location.Location{}); err != nil || !latest.Equal(coupon) {
+		t.Errorf("GetLatestEffectivePrice() = %v, %v, want 900", latest, err)
+	}
+	if lowest, err := db.GetLowestPriceInPeriod(product.ID, location.Location{}, 30); err != nil || !lowest.Equal(inr(1000)) {
+		t.Errorf("GetLowestPriceInPeriod() = %v, %v, want 1000", lowest, err)
+	}
+
+	available := offers.ParseAll([]string{"Apply ₹100 coupon", "10% off on HDFC Bank Credit Card"}, "INR")
+	if err := db.SetProductOffers(product.ID, available); err != nil {
+		t.Fatalf("SetProductOffers() error = %v", err)
+	}
+	if err := db.SetSetting(SettingCards, "HDFC Credit"); err != nil {
+		t.Fatalf("SetSetting() error = %v", err)
+	}
+	defer db.DeleteSetting(SettingCards)
+
+	stored, err := db.GetProduct(product.ID)
+	if err != nil || len(stored.Offers) != 2 {
+		t.Fatalf("GetProduct() offers = %+v, %v, want 2", stored, err)
+	}
+	effective, applied, err := db.EffectivePrice(inr(1000), stored.Offers)
+	if err != nil || effective == nil || !effective.Equal(inr(810)) || len(applied) != 2 {
+		t.Errorf("EffectivePrice() = %v, %v, %v, want 810 after both offers", effective, applied, err)
+	}
+}
+
+func TestGetPricePoints(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Discount Test Product", "https://www.amazon.in/test-discount", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	coupon := inr(950)
+	for _, p := range []struct {
+		price     int64
+		effective *money.Money
+	}{{999, nil}, {1299, nil}, {1000, &coupon}} {
+		if err := db.RecordPrice(product.ID, location.Location{}, inr(p.price), inr(0), nil, p.effective, StorageChanges); err != nil {
+			t.Fatalf("RecordPrice() error = %v", err)
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -90)
+	for _, tt := range []struct {
+		effective bool
+		want      []int64
+	}{{false, []int64{999, 1299, 1000}}, {true, []int64{999, 1299, 950}}} {
+		points, err := db.GetPricePoints(product.ID, location.Location{}, since, tt.effective)
+		if err != nil || len(points) != len(tt.want) {
+			t.Fatalf("GetPricePoints(%v) = %+v, %v", tt.effective, points, err)
+		}
+		for i, want := range tt.want {
+			if !points[i].Price.Equal(inr(want)) {
+				t.Errorf("GetPricePoints(%v)[%d] = %s, want %d", tt.effective, i, points[i].Price, want)
+			}
+		}
+	}
+}
+
+func TestRecordPrice_Locations(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Location Test Product", "https://blinkit.com/prn/test-locations", "blinkit", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	bangalore, _ := location.Parse("560001 12.9716,77.5946")
+	mumbai, _ := location.Parse("400001 18.9388,72.8354")
+	for _, p := range []struct {
+		at    location.Location
+		price int64
+	}{{bangalore, 100}, {mumbai, 80}, {bangalore, 95}} {
+		if err := db.RecordPrice(product.ID, p.at, inr(p.price), inr(0), nil, nil, StorageChanges); err != nil {
+			t.Fatalf("RecordPrice() error = %v", err)
+		}
+	}
+
+	if latest, err := db.GetLatestPrice(product.ID, mumbai); err != nil || !latest.Equal(inr(80)) {
+		t.Errorf("GetLatestPrice(mumbai) = %v, %v, want 80", latest, err)
+	}
+	if lowest, err := db.GetLowestPriceInPeriod(product.ID, bangalore, 30); err != nil || !lowest.Equal(inr(95)) {
+		t.Errorf("GetLowestPriceInPeriod(bangalore) = %v, %v, want 95", lowest, err)
+	}
+	history, err := db.GetPriceHistory(product.ID, bangalore, time.Now().AddDate(0, 0, -1))
+	if err != nil || len(history) != 2 {
+		t.Errorf("GetPriceHistory(bangalore) = %+v, %v, want 2 rows", history, err)
+	}
+	locations, err := db.GetPriceLocations(product.ID)
+	if err != nil || len(locations) != 2 || locations[0] != bangalore.String() {
+		t.Errorf("GetPriceLocations() = %v, %v, want bangalore then mumbai", locations, err)
+	}
+
+	updated, err := db.UpdateProduct(product.ID, ProductUpdate{Location: &mumbai})
+	if err != nil || updated.Location == nil || *updated.Location != mumbai {
+		t.Errorf("UpdateProduct() location = %v, %v, want %v", updated, err, mumbai)
+	}
+	if at, err := db.ProductLocation(*updated); err != nil || at != mumbai {
+		t.Errorf("ProductLocation() = %v, %v, want %v", at, err, mumbai)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" Phones", "phones", "", "Gift "})
+	want := []string{"phones", "gift"}
+
+	if len(got) != len(want) {
+		t.Fatalf("NormalizeTags() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("NormalizeTags()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
@@ -177,3 +545,755 @@ func indexOf(s, substr string) int {
 	}
 	return -1
 }
+
+func TestCheckStorable(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  money.Money
+		wantErr bool
+	}{
+		{"Ordinary price", inr(129999), false},
+		{"Largest storable", money.New(99999999999999999, "INR"), false},
+		{"Too large for NUMERIC(19,4)", money.New(100000000000000000, "INR"), true},
+		{"Too negative", money.New(-100000000000000000, "INR"), true},
+		{"Zero decimal currency", money.New(999999999999999, "JPY"), false},
+		{"Zero decimal currency overflow", money.New(1000000000000000, "JPY"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStorable(tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkStorable(%v) error = %v, wantErr %v", tt.amount, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupProducts(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Group Products Listing", "https://www.amazon.in/test-group-products", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	// A missing product leaves neither the new group nor the other product's
+	// group behind.
+	missing := "00000000-0000-0000-0000-000000000000"
+	if _, err := db.GroupProducts("", "Group Products Test", "INR", []string{product.ID, missing}); err == nil {
+		t.Fatal("GroupProducts() with a missing product should fail")
+	}
+	groups, err := db.GetGroups()
+	if err != nil {
+		t.Fatalf("GetGroups() error = %v", err)
+	}
+	for _, g := range groups {
+		if g.Name == "Group Products Test" {
+			db.DeleteGroup(g.ID)
+			t.Error("GroupProducts() left the new group behind")
+		}
+	}
+	if got, _ := db.GetProduct(product.ID); got == nil || got.GroupID != nil {
+		t.Errorf("GroupProducts() left the product in a group: %+v", got)
+	}
+
+	group, err := db.GroupProducts("", "Group Products Test", "INR", []string{product.ID})
+	if err != nil {
+		t.Fatalf("GroupProducts() error = %v", err)
+	}
+	defer db.DeleteGroup(group.ID)
+	if got, _ := db.GetProduct(product.ID); got == nil || got.GroupID == nil || *got.GroupID != group.ID {
+		t.Errorf("GroupProducts() product group = %+v, want %s", got, group.ID)
+	}
+}
+
+func TestGroupBestPrice(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	group, err := db.CreateGroup("Group Test", "INR", nil)
+	if err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	defer db.DeleteGroup(group.ID)
+
+	product, err := db.CreateProduct("Group Test Listing", "https://www.amazon.in/test-group", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+	if err := db.SetProductGroup(product.ID, group.ID); err != nil {
+		t.Fatalf("SetProductGroup() error = %v", err)
+	}
+	if err := db.AddPriceHistory(product.ID, inr(100), inr(0)); err != nil {
+		t.Fatalf("AddPriceHistory() error = %v", err)
+	}
+
+	listings, err := db.GetGroupListings(group.ID)
+	if err != nil || len(listings) != 1 || listings[0].GroupID == nil || *listings[0].GroupID != group.ID {
+		t.Fatalf("GetGroupListings() = %+v, %v", listings, err)
+	}
+
+	// Only the first of two updates from the same previous best wins.
+	if ok, err := db.UpdateGroupBestPrice(group.ID, nil, inr(100)); err != nil || !ok {
+		t.Errorf("UpdateGroupBestPrice() = %v, %v, want true", ok, err)
+	}
+	if ok, err := db.UpdateGroupBestPrice(group.ID, nil, inr(90)); err != nil || ok {
+		t.Errorf("UpdateGroupBestPrice() from stale best = %v, %v, want false", ok, err)
+	}
+	best := inr(100)
+	if ok, err := db.UpdateGroupBestPrice(group.ID, &best, inr(90)); err != nil || !ok {
+		t.Errorf("UpdateGroupBestPrice() = %v, %v, want true", ok, err)
+	}
+
+	// Changing the group's currency forgets the best price.
+	usd := "USD"
+	updated, err := db.UpdateGroup(group.ID, GroupUpdate{Currency: &usd})
+	if err != nil || updated.BestPrice != nil || updated.ListingCount != 1 {
+		t.Errorf("UpdateGroup() = %+v, %v, want no best price and one listing", updated, err)
+	}
+}
+
+func TestCheapestListing(t *testing.T) {
+	price := func(amount int64, currency string) *money.Money {
+		m := money.New(amount, currency)
+		return &m
+	}
+	unit := func(amount int64, currency, per string) *packsize.UnitPrice {
+		return &packsize.UnitPrice{Price: money.New(amount, currency), Per: per}
+	}
+	usdINR, err := money.NewExchangeRate("USD", "INR", "80", "2024-01-01")
+	if err != nil {
+		t.Fatalf("NewExchangeRate() error = %v", err)
+	}
+	rates := money.NewRates([]money.ExchangeRate{usdINR})
+	on := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		listings []Product
+		want     int
+	}{
+		{
+			name: "Cheapest in stock",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(50000, "INR")},
+				{InStock: true, CurrentPrice: price(45000, "INR")},
+			},
+			want: 1,
+		},
+		{
+			name: "Out of stock skipped",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(50000, "INR")},
+				{InStock: false, CurrentPrice: price(100, "INR")},
+			},
+			want: 0,
+		},
+		{
+			name: "Converted before comparing",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(50000, "INR")},
+				{InStock: true, CurrentPrice: price(500, "USD")},
+			},
+			want: 1,
+		},
+		{
+			name: "No rate or no price",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(100, "EUR")},
+				{InStock: true},
+			},
+			want: -1,
+		},
+		{
+			name: "Unit prices compared when all known",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(6500, "INR"), UnitPrice: unit(13000, "INR", packsize.PerKilogram)},
+				{InStock: true, CurrentPrice: price(12000, "INR"), UnitPrice: unit(12000, "INR", packsize.PerKilogram)},
+			},
+			want: 1,
+		},
+		{
+			name: "Pack prices compared when a unit is missing",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(6500, "INR"), UnitPrice: unit(13000, "INR", packsize.PerKilogram)},
+				{InStock: true, CurrentPrice: price(12000, "INR")},
+			},
+			want: 0,
+		},
+		{
+			name: "Pack prices compared across units",
+			listings: []Product{
+				{InStock: true, CurrentPrice: price(6500, "INR"), UnitPrice: unit(13000, "INR", packsize.PerKilogram)},
+				{InStock: true, CurrentPrice: price(12000, "INR"), UnitPrice: unit(2000, "INR", packsize.PerPiece)},
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheapestListing(tt.listings, "INR", rates, on); got != tt.want {
+				t.Errorf("CheapestListing() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDismissMatchAndScrapedTitle(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	a, err := db.CreateProduct("Match Test A", "https://blinkit.com/prn/test-match-a", "blinkit", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(a.ID)
+	b, err := db.CreateProduct("Match Test B", "https://www.zeptonow.com/pn/test-match-b", "zepto", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(b.ID)
+
+	if err := db.SetScrapedTitle(a.ID, "Amul Taaza Toned Milk 500 ml"); err != nil {
+		t.Fatalf("SetScrapedTitle() error = %v", err)
+	}
+	if got, err := db.GetProduct(a.ID); err != nil || got.ScrapedTitle != "Amul Taaza Toned Milk 500 ml" {
+		t.Errorf("GetProduct() scraped title = %q, %v", got.ScrapedTitle, err)
+	}
+
+	// Dismissing twice, in either order, is fine.
+	if err := db.DismissMatch(b.ID, a.ID); err != nil {
+		t.Fatalf("DismissMatch() error = %v", err)
+	}
+	if err := db.DismissMatch(a.ID, b.ID); err != nil {
+		t.Fatalf("DismissMatch() again error = %v", err)
+	}
+	dismissed, err := db.DismissedMatches()
+	if err != nil {
+		t.Fatalf("DismissedMatches() error = %v", err)
+	}
+	if !dismissed(a.ID, b.ID) || !dismissed(b.ID, a.ID) || dismissed(a.ID, a.ID) {
+		t.Errorf("DismissedMatches() does not report the dismissed pair")
+	}
+}
+
+func TestUnitPrices(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	small, err := db.CreateProduct("Unit Price Small Pack", "https://blinkit.com/prn/test-unit-small", "blinkit", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(small.ID)
+	large, err := db.CreateProduct("Unit Price Large Pack", "https://blinkit.com/prn/test-unit-large", "blinkit", "INR")
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	defer db.DeleteProduct(large.ID)
+
+	half, _ := packsize.ParseSize("500 g")
+	if err := db.SetPackSize(small.ID, &half); err != nil {
+		t.Fatalf("SetPackSize() error = %v", err)
+	}
+	kilo := packsize.Size{Amount: 1000000, Unit: packsize.Grams}
+	if _, err := db.UpdateProduct(large.ID, ProductUpdate{PackSize: &kilo}); err != nil {
+		t.Fatalf("UpdateProduct() error = %v", err)
+	}
+
+	for _, p := range []struct {
+		id    string
+		price int64
+	}{{small.ID, 7000}, {small.ID, 6500}, {large.ID, 12000}} {
+		product, err := db.GetProduct(p.id)
+		if err != nil || product.PackSize == nil {
+			t.Fatalf("GetProduct() = %+v, %v, want a pack size", product, err)
+		}
+		if err := db.RecordPrice(p.id, location.Location{}, inr(p.price), inr(0), UnitPriceOf(*product, inr(p.price)), nil, StorageChanges); err != nil {
+			t.Fatalf("RecordPrice() error = %v", err)
+		}
+	}
+
+	lowest, err := db.GetLowestUnitPriceInPeriod(small.ID, location.Location{}, 30)
+	if err != nil || lowest == nil || lowest.String() != "₹130.00/kg" {
+		t.Errorf("GetLowestUnitPriceInPeriod() = %v, %v, want ₹130.00/kg", lowest, err)
+	}
+
+	// The larger pack costs more but less per kilogram.
+	page, err := db.ListProducts(ProductFilter{Search: "Unit Price", Sort: SortUnitPrice})
+	if err != nil {
+		t.Fatalf("ListProducts() error = %v", err)
+	}
+	if len(page.Products) != 2 || page.Products[0].ID != large.ID || page.Products[0].UnitPrice == nil ||
+		page.Products[0].UnitPrice.String() != "₹120.00/kg" {
+		t.Errorf("ListProducts() by unit price = %+v, want the 1 kg pack first at ₹120.00/kg", page.Products)
+	}
+
+	if _, err := db.UpdateProduct(small.ID, ProductUpdate{PackSize: &packsize.Size{}}); err != nil {
+		t.Fatalf("UpdateProduct() error = %v", err)
+	}
+	if product, _ := db.GetProduct(small.ID); product.PackSize != nil {
+		t.Errorf("PackSize = %v after clearing, want none", product.PackSize)
+	}
+}
+
+func TestPriceBasket(t *testing.T) {
+	price := func(amount int64) *money.Money {
+		m := money.New(amount, "INR")
+		return &m
+	}
+	size := func(s string) *packsize.Size {
+		size, err := packsize.ParseSize(s)
+		if err != nil {
+			t.Fatalf("ParseSize(%q) error = %v", s, err)
+		}
+		return &size
+	}
+	groupID := "g1"
+	rates := money.NewRates(nil)
+	on := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// 500 g of rice at ₹65, and a 1 kg pack of it elsewhere at ₹120.
+	rice := Product{ID: "rice", InStock: true, CurrentPrice: price(6500), PackSize: size("500g"), GroupID: &groupID}
+	bigRice := Product{ID: "big-rice", InStock: true, CurrentPrice: price(12000), PackSize: size("1kg"), GroupID: &groupID}
+	for _, p := range []*Product{&rice, &bigRice} {
+		unit, err := p.PackSize.UnitPrice(*p.CurrentPrice)
+		if err != nil {
+			t.Fatalf("UnitPrice() error = %v", err)
+		}
+		p.UnitPrice = &unit
+	}
+	milk := Product{ID: "milk", InStock: true, CurrentPrice: price(3000)}
+	unpriced := Product{ID: "unpriced", InStock: true}
+	groups := map[string][]Product{groupID: {rice, bigRice}}
+
+	tests := []struct {
+		name        string
+		items       []BasketItem
+		cheapest    bool
+		wantTotal   int64
+		wantMissing int
+	}{
+		{
+			name:      "Quantities multiply",
+			items:     []BasketItem{{Product: rice, Quantity: 2}, {Product: milk, Quantity: 3}},
+			wantTotal: 2*6500 + 3*3000,
+		},
+		{
+			name:      "Cheapest listing priced for the item's pack size",
+			items:     []BasketItem{{Product: rice, Quantity: 2}, {Product: milk, Quantity: 1}},
+			cheapest:  true,
+			wantTotal: 2*6000 + 3000,
+		},
+		{
+			name:        "Items without a price are counted as missing",
+			items:       []BasketItem{{Product: milk, Quantity: 1}, {Product: unpriced, Quantity: 1}},
+			wantTotal:   3000,
+			wantMissing: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost := PriceBasket(tt.items, groups, "INR", tt.cheapest, rates, on)
+			if cost.Total.Amount != tt.wantTotal {
+				t.Errorf("Total = %s, want %d", cost.Total.Format(), tt.wantTotal)
+			}
+			if cost.Missing != tt.wantMissing {
+				t.Errorf("Missing = %d, want %d", cost.Missing, tt.wantMissing)
+			}
+			if len(cost.Lines) != len(tt.items) {
+				t.Errorf("got %d lines, want %d", len(cost.Lines), len(tt.items))
+			}
+		})
+	}
+}
+
+func TestInflationIndex(t *testing.T) {
+	day := func(daysAgo int) time.Time {
+		return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -daysAgo)
+	}
+	// point builds a day's cost from its items' listed and cheapest costs;
+	// a cost of 0 is no price.
+	point := func(daysAgo int, items map[string][2]int64) BasketCostPoint {
+		p := BasketCostPoint{
+			Day:          day(daysAgo),
+			Cost:         money.New(0, "INR"),
+			CheapestCost: money.New(0, "INR"),
+			Items:        len(items),
+			ItemCosts:    make(map[string]BasketItemCost),
+		}
+		for id, costs := range items {
+			var c BasketItemCost
+			if costs[0] != 0 {
+				cost := money.New(costs[0], "INR")
+				c.Cost, p.Cost = &cost, p.Cost.Add(cost)
+				p.Priced++
+			}
+			if costs[1] != 0 {
+				cheapest := money.New(costs[1], "INR")
+				c.CheapestCost, p.CheapestCost = &cheapest, p.CheapestCost.Add(cheapest)
+			}
+			p.ItemCosts[id] = c
+		}
+		return p
+	}
+	// legacy builds a day recorded before item costs were kept.
+	legacy := func(daysAgo int, cost, cheapest int64, priced int) BasketCostPoint {
+		return BasketCostPoint{
+			Day:          day(daysAgo),
+			Cost:         money.New(cost, "INR"),
+			CheapestCost: money.New(cheapest, "INR"),
+			Items:        3,
+			Priced:       priced,
+		}
+	}
+	// Item c is added after the earlier days, and b has no listed price 35
+	// days ago.
+	history := []BasketCostPoint{
+		point(100, map[string][2]int64{"a": {30000, 25000}, "b": {50000, 45000}}),
+		point(35, map[string][2]int64{"a": {33000, 25000}, "b": {0, 45000}}),
+		point(0, map[string][2]int64{"a": {33000, 27500}, "b": {55000, 45000}, "c": {100000, 90000}}),
+	}
+	legacyHistory := []BasketCostPoint{
+		legacy(100, 80000, 70000, 3),
+		legacy(35, 100000, 90000, 2),
+		legacy(0, 110000, 90000, 3),
+	}
+
+	tests := []struct {
+		name     string
+		history  []BasketCostPoint
+		cheapest bool
+		want     map[int]float64
+		complete map[int]bool
+	}{
+		{
+			name:     "Listed costs of the common items",
+			history:  history,
+			want:     map[int]float64{30: 100, 90: 110},
+			complete: map[int]bool{30: false, 90: false},
+		},
+		{
+			name:     "Cheapest costs of the common items",
+			history:  history,
+			cheapest: true,
+			want:     map[int]float64{30: 103.57142857142857, 90: 103.57142857142857},
+			complete: map[int]bool{30: false, 90: false},
+		},
+		{
+			name:     "Totals of days without item costs",
+			history:  legacyHistory,
+			want:     map[int]float64{90: 137.5},
+			complete: map[int]bool{90: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := InflationIndex(tt.history, InflationPeriods, tt.cheapest)
+			if len(index) != len(tt.want) {
+				t.Fatalf("got %d periods, want %d", len(index), len(tt.want))
+			}
+			for _, got := range index {
+				want, ok := tt.want[got.Days]
+				if !ok {
+					t.Errorf("unexpected period of %d days", got.Days)
+					continue
+				}
+				if math.Abs(got.Index-want) > 1e-9 {
+					t.Errorf("%d days: Index = %v, want %v", got.Days, got.Index, want)
+				}
+				if got.Complete != tt.complete[got.Days] {
+					t.Errorf("%d days: Complete = %v, want %v", got.Days, got.Complete, tt.complete[got.Days])
+				}
+			}
+		})
+	}
+}
+
+func TestSaveEvents(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	bbd, _ := events.New("Test Big Billion Days", "flipkart", "2024-09-27", "2024-10-05")
+	if err := db.SaveEvents([]events.Event{bbd}); err != nil {
+		t.Fatalf("SaveEvents() error = %v", err)
+	}
+	// Seeding again with a new end day updates the event.
+	bbd.End = bbd.End.AddDate(0, 0, 1)
+	if err := db.SaveEvents([]events.Event{bbd}); err != nil {
+		t.Fatalf("SaveEvents() again error = %v", err)
+	}
+
+	all, err := db.GetEvents()
+	if err != nil {
+		t.Fatalf("GetEvents() error = %v", err)
+	}
+	var saved *events.Event
+	for i := range all {
+		if all[i].Name == bbd.Name {
+			if saved != nil {
+				t.Fatalf("GetEvents() returned %q twice", bbd.Name)
+			}
+			saved = &all[i]
+		}
+	}
+	if saved == nil || !saved.End.Equal(bbd.End) {
+		t.Fatalf("GetEvents() = %+v, want %q ending %s", saved, bbd.Name, bbd.End)
+	}
+	defer db.DeleteEvent(saved.ID)
+
+	active, err := db.GetActiveEvents(time.Date(2024, 10, 6, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetActiveEvents() error = %v", err)
+	}
+	found := false
+	for _, e := range active {
+		found = found || e.ID == saved.ID
+	}
+	if !found {
+		t.Errorf("GetActiveEvents() = %+v, want %q", active, bbd.Name)
+	}
+}
+
+func TestAlertsAndCooldown(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Alert Throttling Test Product", "https://www.amazon.in/dp/THROTTLE", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("CreateProduct() error = %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	cooldown := 90
+	updated, err := db.UpdateProduct(product.ID, ProductUpdate{AlertCooldownMinutes: &cooldown})
+	if err != nil || updated.AlertCooldownMinutes == nil || *updated.AlertCooldownMinutes != 90 {
+		t.Fatalf("UpdateProduct() cooldown = %v, %v, want 90", updated, err)
+	}
+	reset := -1
+	if updated, err = db.UpdateProduct(product.ID, ProductUpdate{AlertCooldownMinutes: &reset}); err != nil || updated.AlertCooldownMinutes != nil {
+		t.Fatalf("UpdateProduct() cleared cooldown = %v, %v, want nil", updated, err)
+	}
+	increase, on := 15.0, true
+	updated, err = db.UpdateProduct(product.ID, ProductUpdate{AlertIncreasePercent: &increase, AlertVolatility: &on})
+	if err != nil || updated.AlertIncreasePercent == nil || *updated.AlertIncreasePercent != 15 || !updated.AlertVolatility || updated.AlertBackToNormal {
+		t.Fatalf("UpdateProduct() movement alerts = %+v, %v, want increase 15%% and volatility", updated, err)
+	}
+	off := 0.0
+	if updated, err = db.UpdateProduct(product.ID, ProductUpdate{AlertIncreasePercent: &off}); err != nil || updated.AlertIncreasePercent != nil || !updated.AlertVolatility {
+		t.Fatalf("UpdateProduct() increase off = %+v, %v, want nil and volatility kept", updated, err)
+	}
+
+	before := time.Now().Add(-time.Minute)
+	old, sent, again := money.New(104900, "INR"), money.New(99900, "INR"), money.New(99900, "INR")
+	if err := db.CreateAlert(product.ID, old, sent, "sent", ""); err != nil {
+		t.Fatalf("CreateAlert() error = %v", err)
+	}
+	if err := db.CreateAlert(product.ID, old, again, "held back", "duplicate: ₹999.00 was alerted on 1h ago"); err != nil {
+		t.Fatalf("CreateAlert() suppressed error = %v", err)
+	}
+
+	recent, err := db.GetSentAlerts(product.ID, before)
+	if err != nil {
+		t.Fatalf("GetSentAlerts() error = %v", err)
+	}
+	if len(recent) != 1 || !recent[0].Price.Equal(sent) {
+		t.Errorf("GetSentAlerts() = %+v, want the sent alert only", recent)
+	}
+	for alertType, want := range map[string]int{digest.AlertLow: 1, digest.AlertIncrease: 0} {
+		if ofType, err := db.GetSentAlertsOfType(product.ID, alertType, before); err != nil || len(ofType) != want {
+			t.Errorf("GetSentAlertsOfType(%s) = %+v, %v, want %d alerts", alertType, ofType, err, want)
+		}
+	}
+
+	suppressed := true
+	alerts, err := db.ListAlerts(AlertFilter{ProductID: product.ID, Suppressed: &suppressed})
+	if err != nil {
+		t.Fatalf("ListAlerts() error = %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Message != "held back" || alerts[0].SuppressedReason == "" {
+		t.Errorf("ListAlerts(suppressed) = %+v, want the held back alert", alerts)
+	}
+	if alerts, err = db.ListAlerts(AlertFilter{ProductID: product.ID}); err != nil || len(alerts) != 2 {
+		t.Fatalf("ListAlerts() = %d alerts, %v, want 2", len(alerts), err)
+	}
+	if alerts[0].Status != AlertNew || alerts[0].StatusAt != nil {
+		t.Errorf("ListAlerts() status = %q, want %q", alerts[0].Status, AlertNew)
+	}
+
+	bought, err := db.SetAlertStatus(alerts[0].ID, AlertBought)
+	if err != nil || bought.Status != AlertBought || bought.StatusAt == nil {
+		t.Fatalf("SetAlertStatus() = %+v, %v, want bought", bought, err)
+	}
+	if alerts, err = db.ListAlerts(AlertFilter{ProductID: product.ID, Status: AlertBought}); err != nil || len(alerts) != 1 || alerts[0].ID != bought.ID {
+		t.Errorf("ListAlerts(bought) = %+v, %v, want the bought alert", alerts, err)
+	}
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(-30*time.Minute)
+	if alerts, err = db.ListAlerts(AlertFilter{ProductID: product.ID, From: &from, To: &to}); err != nil || len(alerts) != 0 {
+		t.Errorf("ListAlerts(an hour ago) = %+v, %v, want none", alerts, err)
+	}
+	if alerts, err = db.ListAlerts(AlertFilter{ProductID: product.ID, Channel: "telegram"}); err != nil || len(alerts) != 0 {
+		t.Errorf("ListAlerts(telegram) = %+v, %v, want none without deliveries", alerts, err)
+	}
+}
+
+func TestDigestEntries(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Digest Test Product", "https://www.amazon.in/dp/DIGEST", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("CreateProduct() error = %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	since := time.Now().Add(-time.Minute)
+	old, now := money.New(104900, "INR"), money.New(99900, "INR")
+	if err := db.AddDigestEntry(digest.KindDrop, product.ID, &old, &now, ""); err != nil {
+		t.Fatalf("AddDigestEntry() error = %v", err)
+	}
+	if err := db.AddDigestEntry(digest.KindScrapeFailed, product.ID, nil, nil, "timeout"); err != nil {
+		t.Fatalf("AddDigestEntry() failure error = %v", err)
+	}
+
+	entries, err := db.GetDigestEntries(since)
+	if err != nil {
+		t.Fatalf("GetDigestEntries() error = %v", err)
+	}
+	var mine []digest.Entry
+	for _, e := range entries {
+		if e.ProductID == product.ID {
+			mine = append(mine, e)
+		}
+	}
+	if len(mine) != 2 || mine[0].Kind != digest.KindDrop || mine[0].Product != product.Name ||
+		mine[0].NewPrice == nil || !mine[0].NewPrice.Equal(now) || mine[1].OldPrice != nil || mine[1].Detail != "timeout" {
+		t.Errorf("GetDigestEntries() = %+v", mine)
+	}
+}
+
+func TestAlertOutbox(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	product, err := db.CreateProduct("Outbox Test Product", "https://www.amazon.in/dp/OUTBOX", "amazon", "INR")
+	if err != nil {
+		t.Fatalf("CreateProduct() error = %v", err)
+	}
+	defer db.DeleteProduct(product.ID)
+
+	old, now := money.New(104900, "INR"), money.New(99900, "INR")
+	alert := OutboxAlert{
+		ProductID: product.ID,
+		OldPrice:  old,
+		NewPrice:  now,
+		Message:   "dropped",
+		Deliveries: []OutboxDelivery{
+			{Channel: "telegram", Subject: "Price drop", Message: "dropped"},
+			{Channel: "email", Subject: "Price drop", Message: "dropped", Delay: time.Hour, Quiet: true},
+		},
+	}
+	if err := db.RecordScrapedPrice(product.ID, location.Location{}, now, money.New(-5000, "INR"), nil, nil, StorageChanges, &alert); err != nil {
+		t.Fatalf("RecordScrapedPrice() error = %v", err)
+	}
+
+	entries, err := db.GetDigestEntries(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetDigestEntries() error = %v", err)
+	}
+	var drop *digest.Entry
+	for i, e := range entries {
+		if e.ProductID == product.ID && e.Kind == digest.KindDrop {
+			drop = &entries[i]
+		}
+	}
+	if drop == nil || drop.OldPrice == nil || !drop.OldPrice.Equal(old) || !drop.NewPrice.Equal(now) {
+		t.Errorf("GetDigestEntries() = %+v, want the drop from %v to %v", entries, old, now)
+	}
+
+	claimed, err := db.ClaimDeliveries(1000, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDeliveries() error = %v", err)
+	}
+	var mine []Delivery
+	for _, d := range claimed {
+		if d.ProductID == product.ID {
+			mine = append(mine, d)
+		}
+	}
+	if len(mine) != 1 || mine[0].Channel != "telegram" || mine[0].Attempts != 1 || mine[0].Product != product.Name {
+		t.Fatalf("ClaimDeliveries() = %+v, want the telegram delivery only", mine)
+	}
+	if again, err := db.ClaimDeliveries(1000, time.Minute); err != nil || containsDelivery(again, mine[0].ID) {
+		t.Errorf("ClaimDeliveries() again = %+v, %v, want the leased delivery held back", again, err)
+	}
+
+	if err := db.MarkDeliveryFailed(mine[0].ID, "bot blocked", 0, true); err != nil {
+		t.Fatalf("MarkDeliveryFailed() error = %v", err)
+	}
+	dead, err := db.ListDeliveries(DeliveryDead, 0)
+	if err != nil || !containsDelivery(dead, mine[0].ID) {
+		t.Fatalf("ListDeliveries(dead) = %+v, %v, want the failed delivery", dead, err)
+	}
+
+	if err := db.RetryDelivery(mine[0].ID); err != nil {
+		t.Fatalf("RetryDelivery() error = %v", err)
+	}
+	if err := db.RetryDelivery(mine[0].ID); err == nil {
+		t.Error("RetryDelivery() of a pending delivery succeeded, want an error")
+	}
+	if err := db.MarkDeliveriesSent(mine[0].ID); err != nil {
+		t.Fatalf("MarkDeliveriesSent() error = %v", err)
+	}
+
+	alerts, err := db.ListAlerts(AlertFilter{ProductID: product.ID})
+	if err != nil || len(alerts) != 1 {
+		t.Fatalf("ListAlerts() = %+v, %v, want 1 alert", alerts, err)
+	}
+	deliveries := alerts[0].Deliveries
+	if len(deliveries) != 2 || deliveries[0].Channel != "email" || deliveries[0].Status != DeliveryPending || !deliveries[0].Quiet ||
+		deliveries[1].Status != DeliverySent || deliveries[1].DeliveredAt == nil || deliveries[1].LastError != "" {
+		t.Errorf("ListAlerts() deliveries = %+v", deliveries)
+	}
+}
+
+func containsDelivery(deliveries []Delivery, id string) bool {
+	for _, d := range deliveries {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAlertTemplates(t *testing.T) {
+	db := getTestDB(t)
+	defer db.Close()
+
+	if err := db.SaveAlertTemplate("low.email", "{{.Product.Name}}"); err != nil {
+		t.Fatalf("SaveAlertTemplate() error = %v", err)
+	}
+	defer db.DeleteAlertTemplate("low.email")
+	if err := db.SaveAlertTemplate("low.email", "{{.Product.Name}} is {{.Current.Format}}"); err != nil {
+		t.Fatalf("SaveAlertTemplate() replacing error = %v", err)
+	}
+
+	templates, err := db.GetAlertTemplates()
+	if err != nil || templates["low.email"] != "{{.Product.Name}} is {{.Current.Format}}" {
+		t.Fatalf("GetAlertTemplates() = %v, %v, want the replaced template", templates, err)
+	}
+
+	if err := db.DeleteAlertTemplate("low.email"); err != nil {
+		t.Fatalf("DeleteAlertTemplate() error = %v", err)
+	}
+	if err := db.DeleteAlertTemplate("low.email"); err == nil {
+		t.Error("DeleteAlertTemplate() of a missing template succeeded, want an error")
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"price-watcher/digest"
+	"price-watcher/money"
+)
+
+// AddDigestEntry records something that happened to a product for the
+// digests; its prices, if any, must be in the same currency.
+func (db *DB) AddDigestEntry(kind, productID string, oldPrice, newPrice *money.Money, detail string) error {
+	return addDigestEntry(db, kind, productID, oldPrice, newPrice, detail)
+}
+
+func addDigestEntry(q execer, kind, productID string, oldPrice, newPrice *money.Money, detail string) error {
+	currency := "INR"
+	if newPrice != nil {
+		currency = newPrice.Currency
+	}
+	query := `INSERT INTO digest_entries (kind, product_id, old_price, new_price, currency, detail) VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := q.Exec(query, kind, productID, oldPrice, newPrice, currency, detail); err != nil {
+		return fmt.Errorf("failed to add digest entry: %w", err)
+	}
+	return nil
+}
+
+// GetDigestEntries returns the entries recorded since the given time,
+// oldest first, with their product's name, platform and URL.
+func (db *DB) GetDigestEntries(since time.Time) ([]digest.Entry, error) {
+	query := `
+		SELECT e.kind, e.product_id, p.name, p.platform, p.url, e.old_price, e.new_price, e.currency, e.detail, e.created_at
+		FROM digest_entries e
+		JOIN products p ON p.id = e.product_id
+		WHERE e.created_at >= $1
+		ORDER BY e.created_at
+	`
+
+	rows, err := db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []digest.Entry
+	for rows.Next() {
+		var e digest.Entry
+		var oldPrice, newPrice sql.NullString
+		var currency string
+		if err := rows.Scan(&e.Kind, &e.ProductID, &e.Product, &e.Platform, &e.URL, &oldPrice, &newPrice, &currency, &e.Detail, &e.At); err != nil {
+			return nil, fmt.Errorf("failed to scan digest entry: %w", err)
+		}
+		for _, price := range []struct {
+			value sql.NullString
+			dest  **money.Money
+		}{{oldPrice, &e.OldPrice}, {newPrice, &e.NewPrice}} {
+			if !price.value.Valid {
+				continue
+			}
+			m, err := parseAmount(price.value.String, currency)
+			if err != nil {
+				return nil, err
+			}
+			*price.dest = &m
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// PruneDigestEntries deletes the entries recorded before the given time,
+// returning how many were deleted.
+func (db *DB) PruneDigestEntries(before time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM digest_entries WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune digest entries: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"price-watcher/events"
+)
+
+// eventColumns lists the sale_events columns read by scanEvent, in order.
+const eventColumns = `id, name, platform, starts_on, ends_on`
+
+func scanEvent(row rowScanner) (events.Event, error) {
+	var e events.Event
+	if err := row.Scan(&e.ID, &e.Name, &e.Platform, &e.Start, &e.End); err != nil {
+		return e, err
+	}
+	e.Start, e.End = events.Day(e.Start), events.Day(e.End)
+	return e, nil
+}
+
+// CreateEvent adds a sale event.
+func (db *DB) CreateEvent(e events.Event) (*events.Event, error) {
+	query := `INSERT INTO sale_events (name, platform, starts_on, ends_on) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	var id string
+	if err := db.QueryRow(query, e.Name, e.Platform, e.Start, e.End).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create sale event: %w", err)
+	}
+
+	return db.GetEvent(id)
+}
+
+// SaveEvents adds sale events, updating the end day of events with the
+// same name, platform and start day, so seeding from a file can be
+// repeated.
+func (db *DB) SaveEvents(list []events.Event) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sale_events (name, platform, starts_on, ends_on) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, platform, starts_on) DO UPDATE SET ends_on = EXCLUDED.ends_on, updated_at = CURRENT_TIMESTAMP
+	`
+	for _, e := range list {
+		if _, err := tx.Exec(query, e.Name, e.Platform, e.Start, e.End); err != nil {
+			return fmt.Errorf("failed to save sale event %s: %w", e.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sale events: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetEvent(eventID string) (*events.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM sale_events WHERE id = $1`
+
+	e, err := scanEvent(db.QueryRow(query, eventID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("sale event not found: %s", eventID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sale event: %w", err)
+	}
+
+	return &e, nil
+}
+
+// GetEvents returns every sale event, latest first.
+func (db *DB) GetEvents() ([]events.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM sale_events ORDER BY starts_on DESC, name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sale events: %w", err)
+	}
+	defer rows.Close()
+
+	list := []events.Event{}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sale event: %w", err)
+		}
+		list = append(list, e)
+	}
+
+	return list, rows.Err()
+}
+
+// GetActiveEvents returns the sale events running at t on any platform.
+func (db *DB) GetActiveEvents(t time.Time) ([]events.Event, error) {
+	all, err := db.GetEvents()
+	if err != nil {
+		return nil, err
+	}
+	return events.Active(all, "", t), nil
+}
+
+// UpdateEvent replaces a sale event's name, platform and days.
+func (db *DB) UpdateEvent(eventID string, e events.Event) (*events.Event, error) {
+	query := `
+		UPDATE sale_events
+		SET name = $2, platform = $3, starts_on = $4, ends_on = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	result, err := db.Exec(query, eventID, e.Name, e.Platform, e.Start, e.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update sale event: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("sale event not found: %s", eventID)
+	}
+
+	return db.GetEvent(eventID)
+}
+
+func (db *DB) DeleteEvent(eventID string) error {
+	result, err := db.Exec(`DELETE FROM sale_events WHERE id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sale event: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("sale event not found: %s", eventID)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"price-watcher/money"
+)
+
+// ExportFilter restricts exported history and alerts to one product and/or
+// a time range. Zero values mean "no constraint".
+type ExportFilter struct {
+	ProductID string
+	From      *time.Time
+	To        *time.Time
+}
+
+// where builds a WHERE clause matching rows of the filtered product whose
+// [fromColumn, toColumn] time span overlaps the filter's range.
+func (f ExportFilter) where(fromColumn, toColumn string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.ProductID != "" {
+		args = append(args, f.ProductID)
+		conditions = append(conditions, fmt.Sprintf("product_id = $%d", len(args)))
+	}
+	if f.From != nil {
+		args = append(args, *f.From)
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", toColumn, len(args)))
+	}
+	if f.To != nil {
+		args = append(args, *f.To)
+		conditions = append(conditions, fmt.Sprintf("%s < $%d", fromColumn, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ExportPriceHistory streams matching price history rows, oldest first, to fn.
+func (db *DB) ExportPriceHistory(filter ExportFilter, fn func(PriceHistory) error) error {
+	where, args := filter.where("timestamp", lastSeenColumn)
+	query := `SELECT id, product_id, price, delta, currency, timestamp, ` + lastSeenColumn + `, observations,
+		unit_price, price_unit, location, effective_price
+		FROM price_history ` + where + ` ORDER BY product_id, timestamp`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query price history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h PriceHistory
+		var price, delta string
+		var unitPrice, priceUnit, effective sql.NullString
+		if err := rows.Scan(&h.ID, &h.ProductID, &price, &delta, &h.Currency, &h.Timestamp, &h.LastSeen, &h.Observations,
+			&unitPrice, &priceUnit, &h.Location, &effective); err != nil {
+			return fmt.Errorf("failed to scan price history: %w", err)
+		}
+		if err := parseAmounts(h.Currency, []string{price, delta}, &h.Price, &h.Delta); err != nil {
+			return err
+		}
+		unit, err := parseUnitPrice(unitPrice, priceUnit, h.Currency)
+		if err != nil {
+			return err
+		}
+		h.UnitPrice = unit
+		if effective.Valid {
+			e, err := parseAmount(effective.String, h.Currency)
+			if err != nil {
+				return err
+			}
+			h.EffectivePrice = &e
+		}
+		if err := fn(h); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportAlerts streams matching alerts, oldest first, to fn.
+func (db *DB) ExportAlerts(filter ExportFilter, fn func(Alert) error) error {
+	where, args := filter.where("sent_at", "sent_at")
+	query := `SELECT ` + alertColumns + ` FROM alerts ` + where + ` ORDER BY sent_at`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// DailyPrice is one row of the daily rollup table.
+type DailyPrice struct {
+	ProductID string      `json:"product_id"`
+	Day       time.Time   `json:"day"`
+	Min       money.Money `json:"min"`
+	Max       money.Money `json:"max"`
+	Avg       money.Money `json:"avg"`
+	Close     money.Money `json:"close"`
+	Samples   int         `json:"samples"`
+	Currency  string      `json:"currency"`
+	Location  string      `json:"location,omitempty"`
+}
+
+// ExportDailyPrices streams matching daily rollups, oldest first, to fn.
+func (db *DB) ExportDailyPrices(filter ExportFilter, fn func(DailyPrice) error) error {
+	where, args := filter.where("day", "day")
+	query := `SELECT product_id, day, min_price, max_price, avg_price, close_price, samples, currency, location
+		FROM price_history_daily ` + where + ` ORDER BY product_id, location, day`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query daily prices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d DailyPrice
+		var minPrice, maxPrice, avgPrice, closePrice string
+		if err := rows.Scan(&d.ProductID, &d.Day, &minPrice, &maxPrice, &avgPrice, &closePrice, &d.Samples, &d.Currency, &d.Location); err != nil {
+			return fmt.Errorf("failed to scan daily price: %w", err)
+		}
+		if err := parseAmounts(d.Currency, []string{minPrice, maxPrice, avgPrice, closePrice}, &d.Min, &d.Max, &d.Avg, &d.Close); err != nil {
+			return err
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// parseAmounts converts NUMERIC amounts read as text into dest, in order.
+func parseAmounts(currency string, amounts []string, dest ...*money.Money) error {
+	for i, amount := range amounts {
+		m, err := parseAmount(amount, currency)
+		if err != nil {
+			return err
+		}
+		*dest[i] = m
+	}
+	return nil
+}
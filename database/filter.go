@@ -0,0 +1,228 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"price-watcher/money"
+)
+
+// Sort keys accepted by ListProducts.
+const (
+	SortCreated = "created"
+	SortName    = "name"
+	SortPrice   = "price"
+	SortDrop    = "drop"
+	SortChanged = "changed"
+	// SortUnitPrice orders by price per kilogram, litre or piece, keeping
+	// each unit together; products without a pack size come last.
+	SortUnitPrice = "unit_price"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 200
+)
+
+// ProductFilter narrows, orders and paginates ListProducts results.
+// Zero values mean "no constraint". Currency keeps products whose current
+// price is in it; MinPrice and MaxPrice only match prices in their own
+// currency.
+type ProductFilter struct {
+	Search       string
+	Platform     string
+	Tag          string
+	Folder       string
+	Group        string
+	Basket       string
+	Currency     string
+	MinPrice     *money.Money
+	MaxPrice     *money.Money
+	InStock      *bool
+	ScrapeStatus string
+	Sort         string
+	Descending   bool
+	Page         int
+	PageSize     int
+}
+
+// ProductPage is one page of ListProducts results.
+type ProductPage struct {
+	Products []Product `json:"products"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
+
+// TotalPages returns the number of pages needed to show every matching product.
+func (p ProductPage) TotalPages() int {
+	if p.PageSize <= 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+// listProductsFrom joins each product with its latest price and its latest
+// actual price change so they can be filtered and sorted on.
+const listProductsFrom = `
+	FROM products p
+	LEFT JOIN LATERAL (
+		SELECT ph.price, ph.delta, ph.currency, ph.unit_price, ph.price_unit, ph.effective_price
+		FROM price_history ph
+		WHERE ph.product_id = p.id
+		ORDER BY ph.timestamp DESC
+		LIMIT 1
+	) lp ON TRUE
+	LEFT JOIN LATERAL (
+		SELECT ph.timestamp
+		FROM price_history ph
+		WHERE ph.product_id = p.id AND ph.delta <> 0
+		ORDER BY ph.timestamp DESC
+		LIMIT 1
+	) lc ON TRUE
+`
+
+// changePercentExpr is the latest change relative to the previous price;
+// negative values are drops.
+const changePercentExpr = `CASE WHEN lp.price - lp.delta > 0 THEN lp.delta * 100 / (lp.price - lp.delta) END`
+
+var sortColumns = map[string]string{
+	SortCreated:   "p.created_at",
+	SortName:      "LOWER(p.name)",
+	SortPrice:     "lp.price",
+	SortDrop:      changePercentExpr,
+	SortChanged:   "lc.timestamp",
+	SortUnitPrice: "lp.price_unit, lp.unit_price",
+}
+
+// normalize fills in defaults and clamps the pagination settings.
+func (f *ProductFilter) normalize() {
+	if _, ok := sortColumns[f.Sort]; !ok {
+		f.Sort = SortCreated
+		f.Descending = true
+	}
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 {
+		f.PageSize = DefaultPageSize
+	}
+	if f.PageSize > MaxPageSize {
+		f.PageSize = MaxPageSize
+	}
+}
+
+// where builds the WHERE clause and its positional arguments.
+func (f *ProductFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if search := strings.TrimSpace(f.Search); search != "" {
+		n := arg(search)
+		conditions = append(conditions, fmt.Sprintf(
+			"(to_tsvector('simple', p.name) @@ plainto_tsquery('simple', %s) OR p.name ILIKE '%%' || %s || '%%')", n, n))
+	}
+	if f.Platform != "" {
+		conditions = append(conditions, "p.platform = "+arg(strings.ToLower(f.Platform)))
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM product_tags t WHERE t.product_id = p.id AND t.tag = "+arg(strings.ToLower(strings.TrimSpace(f.Tag)))+")")
+	}
+	if f.Folder != "" {
+		conditions = append(conditions, "p.folder = "+arg(f.Folder))
+	}
+	if f.Group != "" {
+		conditions = append(conditions, "p.group_id = "+arg(f.Group))
+	}
+	if f.Basket != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM basket_items i WHERE i.product_id = p.id AND i.basket_id = "+arg(f.Basket)+")")
+	}
+	if f.Currency != "" {
+		conditions = append(conditions, "lp.currency = "+arg(strings.ToUpper(f.Currency)))
+	}
+	if f.MinPrice != nil {
+		conditions = append(conditions, "lp.currency = "+arg(f.MinPrice.Currency)+" AND lp.price >= "+arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		conditions = append(conditions, "lp.currency = "+arg(f.MaxPrice.Currency)+" AND lp.price <= "+arg(*f.MaxPrice))
+	}
+	if f.InStock != nil {
+		conditions = append(conditions, "p.in_stock = "+arg(*f.InStock))
+	}
+	if f.ScrapeStatus != "" {
+		conditions = append(conditions, "p.last_scrape_status = "+arg(f.ScrapeStatus))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListProducts returns one page of products matching the filter, each
+// annotated with its current price and latest change.
+func (db *DB) ListProducts(filter ProductFilter) (*ProductPage, error) {
+	filter.normalize()
+	where, args := filter.where()
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) `+listProductsFrom+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+	query := fmt.Sprintf(`SELECT %s, lp.price, lp.currency, %s, lc.timestamp, lp.unit_price, lp.price_unit, lp.effective_price %s %s ORDER BY %s %s NULLS LAST, p.created_at DESC LIMIT %d OFFSET %d`,
+		productColumns, changePercentExpr, listProductsFrom, where,
+		sortColumns[filter.Sort], direction, filter.PageSize, (filter.Page-1)*filter.PageSize)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	page := &ProductPage{Products: []Product{}, Total: total, Page: filter.Page, PageSize: filter.PageSize}
+	for rows.Next() {
+		var price, currency, unitPrice, priceUnit, effective sql.NullString
+		var changePercent sql.NullFloat64
+		var lastChange sql.NullTime
+		product, err := scanProduct(rows, &price, &currency, &changePercent, &lastChange, &unitPrice, &priceUnit, &effective)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		if price.Valid {
+			current, err := parseAmount(price.String, currency.String)
+			if err != nil {
+				return nil, err
+			}
+			product.CurrentPrice = &current
+			if product.UnitPrice, err = parseUnitPrice(unitPrice, priceUnit, currency.String); err != nil {
+				return nil, err
+			}
+			if effective.Valid {
+				e, err := parseAmount(effective.String, currency.String)
+				if err != nil {
+					return nil, err
+				}
+				product.EffectivePrice = &e
+			}
+		}
+		if changePercent.Valid {
+			product.ChangePercent = &changePercent.Float64
+		}
+		if lastChange.Valid {
+			product.LastChangeAt = &lastChange.Time
+		}
+		page.Products = append(page.Products, product)
+	}
+
+	return page, rows.Err()
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"price-watcher/money"
+)
+
+// ProductGroup links listings of the same item on different platforms so
+// their prices can be compared and alerted on together. Prices are compared
+// in the group's currency.
+type ProductGroup struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Currency    string       `json:"currency"`
+	TargetPrice *money.Money `json:"target_price,omitempty"`
+	// BestPrice is the cheapest listing price last seen by the scheduler.
+	BestPrice    *money.Money `json:"best_price,omitempty"`
+	ListingCount int          `json:"listing_count"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// groupColumns lists the product_groups columns read by scanGroup, in order.
+const groupColumns = `g.id, g.name, g.currency, g.target_price, g.best_price,
+	(SELECT COUNT(*) FROM products p WHERE p.group_id = g.id), g.created_at, g.updated_at`
+
+func scanGroup(row rowScanner) (ProductGroup, error) {
+	var group ProductGroup
+	var targetPrice, bestPrice sql.NullString
+	if err := row.Scan(&group.ID, &group.Name, &group.Currency, &targetPrice, &bestPrice,
+		&group.ListingCount, &group.CreatedAt, &group.UpdatedAt); err != nil {
+		return group, err
+	}
+	if targetPrice.Valid {
+		target, err := parseAmount(targetPrice.String, group.Currency)
+		if err != nil {
+			return group, err
+		}
+		group.TargetPrice = &target
+	}
+	if bestPrice.Valid {
+		best, err := parseAmount(bestPrice.String, group.Currency)
+		if err != nil {
+			return group, err
+		}
+		group.BestPrice = &best
+	}
+	return group, nil
+}
+
+// CreateGroup adds an empty group comparing prices in currency.
+func (db *DB) CreateGroup(name, currency string, targetPrice *money.Money) (*ProductGroup, error) {
+	query := `INSERT INTO product_groups (name, currency, target_price) VALUES ($1, $2, $3) RETURNING id`
+
+	var id string
+	if err := db.QueryRow(query, name, currency, targetPrice).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	return db.GetGroup(id)
+}
+
+func (db *DB) GetGroup(groupID string) (*ProductGroup, error) {
+	query := `SELECT ` + groupColumns + ` FROM product_groups g WHERE g.id = $1`
+
+	group, err := scanGroup(db.QueryRow(query, groupID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("group not found: %s", groupID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	return &group, nil
+}
+
+// GetGroups returns every group, by name.
+func (db *DB) GetGroups() ([]ProductGroup, error) {
+	query := `SELECT ` + groupColumns + ` FROM product_groups g ORDER BY LOWER(g.name), g.created_at`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []ProductGroup{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// GroupUpdate holds the editable group fields; nil fields are left unchanged.
+// A zero TargetPrice clears the target, as does changing Currency without
+// giving a new TargetPrice. Changing Currency also forgets the best price.
+type GroupUpdate struct {
+	Name        *string
+	TargetPrice *money.Money
+	Currency    *string
+}
+
+func (db *DB) UpdateGroup(groupID string, update GroupUpdate) (*ProductGroup, error) {
+	query := `
+		UPDATE product_groups
+		SET name = COALESCE($2, name),
+			target_price = CASE
+				WHEN $3::NUMERIC IS NOT NULL THEN NULLIF($3::NUMERIC, 0)
+				WHEN $4::VARCHAR <> currency THEN NULL
+				ELSE target_price
+			END,
+			best_price = CASE WHEN $4::VARCHAR <> currency THEN NULL ELSE best_price END,
+			currency = COALESCE($4, currency),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	result, err := db.Exec(query, groupID, update.Name, update.TargetPrice, update.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, fmt.Errorf("group not found: %s", groupID)
+	}
+
+	return db.GetGroup(groupID)
+}
+
+// DeleteGroup removes a group; its listings stay tracked on their own.
+func (db *DB) DeleteGroup(groupID string) error {
+	result, err := db.Exec(`DELETE FROM product_groups WHERE id = $1`, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("group not found: %s", groupID)
+	}
+	return nil
+}
+
+// SetProductGroup moves a product into a group, or out of any group when
+// groupID is empty.
+func (db *DB) SetProductGroup(productID, groupID string) error {
+	return setProductGroup(db, productID, groupID)
+}
+
+// GroupProducts moves products into a group in one transaction, so a failure
+// leaves no group half made: into groupID, or when it is empty a new group
+// named name in currency. It returns the group.
+func (db *DB) GroupProducts(groupID, name, currency string, productIDs []string) (*ProductGroup, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if groupID == "" {
+		query := `INSERT INTO product_groups (name, currency) VALUES ($1, $2) RETURNING id`
+		if err := tx.QueryRow(query, name, currency).Scan(&groupID); err != nil {
+			return nil, fmt.Errorf("failed to create group: %w", err)
+		}
+	}
+	for _, productID := range productIDs {
+		if err := setProductGroup(tx, productID, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit group: %w", err)
+	}
+	return db.GetGroup(groupID)
+}
+
+func setProductGroup(ex execer, productID, groupID string) error {
+	var group interface{}
+	if groupID != "" {
+		group = groupID
+	}
+
+	result, err := ex.Exec(`UPDATE products SET group_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, productID, group)
+	if err != nil {
+		return fmt.Errorf("failed to set product group: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("product not found: %s", productID)
+	}
+	return nil
+}
+
+// GetGroupListings returns a group's products with their current prices,
+// cheapest first within each currency.
+func (db *DB) GetGroupListings(groupID string) ([]Product, error) {
+	page, err := db.ListProducts(ProductFilter{Group: groupID, Sort: SortPrice, PageSize: MaxPageSize})
+	if err != nil {
+		return nil, err
+	}
+	return page.Products, nil
+}
+
+// UpdateGroupBestPrice records a group's new best price if the stored one is
+// still previous (nil meaning none). It reports false when another scrape
+// changed the best price first, so only one of them alerts.
+func (db *DB) UpdateGroupBestPrice(groupID string, previous *money.Money, best money.Money) (bool, error) {
+	return updateGroupBestPrice(db, groupID, previous, best)
+}
+
+func updateGroupBestPrice(q execer, groupID string, previous *money.Money, best money.Money) (bool, error) {
+	if err := checkStorable(best); err != nil {
+		return false, err
+	}
+	query := `
+		UPDATE product_groups SET best_price = $3
+		WHERE id = $1 AND currency = $4 AND best_price IS NOT DISTINCT FROM $2::NUMERIC
+	`
+	result, err := q.Exec(query, groupID, previous, best, best.Currency)
+	if err != nil {
+		return false, fmt.Errorf("failed to update group best price: %w", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// CheapestListing converts each listing's current price to currency, storing
+// it in DisplayPrice, and returns the index of the cheapest in-stock listing,
+// or -1 if none has a price that can be converted. When every such listing
+// has a unit price per the same unit, listings are compared on unit price so
+// differently sized packs compare fairly.
+func CheapestListing(listings []Product, currency string, rates *money.Rates, on time.Time) int {
+	units := make([]*money.Money, len(listings))
+	byUnit, per := true, ""
+	for i := range listings {
+		listing := &listings[i]
+		listing.DisplayPrice = nil
+		if listing.CurrentPrice == nil {
+			continue
+		}
+		converted, err := rates.Convert(*listing.CurrentPrice, currency, on)
+		if err != nil {
+			continue
+		}
+		listing.DisplayPrice = &converted
+		if !listing.InStock {
+			continue
+		}
+		if listing.UnitPrice == nil || (per != "" && listing.UnitPrice.Per != per) {
+			byUnit = false
+			continue
+		}
+		per = listing.UnitPrice.Per
+		if unit, err := rates.Convert(listing.UnitPrice.Price, currency, on); err == nil {
+			units[i] = &unit
+		} else {
+			byUnit = false
+		}
+	}
+
+	cheapest := -1
+	for i, listing := range listings {
+		if !listing.InStock || listing.DisplayPrice == nil {
+			continue
+		}
+		if cheapest < 0 {
+			cheapest = i
+			continue
+		}
+		if (byUnit && units[i].Cmp(*units[cheapest]) < 0) || (!byUnit && listing.DisplayPrice.Cmp(*listings[cheapest].DisplayPrice) < 0) {
+			cheapest = i
+		}
+	}
+	return cheapest
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/packsize"
+	"price-watcher/stats"
+)
+
+// Resolutions of the points returned by GetPriceHistory.
+const (
+	ResolutionRaw   = "raw"
+	ResolutionDaily = "daily"
+)
+
+// PricePoint is one point of a product's price history: either a raw
+// price_history row or a daily rollup of compacted rows. For raw points Min,
+// Max and Avg equal Price, the price held from Timestamp to LastSeen and
+// Samples counts the scrapes that saw it; for daily points Price is the
+// day's closing price.
+type PricePoint struct {
+	Timestamp  time.Time   `json:"timestamp"`
+	LastSeen   time.Time   `json:"last_seen"`
+	Price      money.Money `json:"price"`
+	Min        money.Money `json:"min"`
+	Max        money.Money `json:"max"`
+	Avg        money.Money `json:"avg"`
+	Samples    int         `json:"samples"`
+	Currency   string      `json:"currency"`
+	Resolution string      `json:"resolution"`
+	// UnitPrice is Price per kilogram, litre or piece if the pack size was
+	// known; for daily points it is the day's lowest unit price.
+	UnitPrice *packsize.UnitPrice `json:"unit_price,omitempty"`
+	// EffectivePrice is Price after the usable offers if they lowered it;
+	// for daily points it is the day's lowest effective price, if below Min.
+	EffectivePrice *money.Money `json:"effective_price,omitempty"`
+}
+
+// GetPriceHistory returns a product's history at a location since the given
+// time, oldest first, combining raw samples with daily rollups of compacted
+// periods.
+func (db *DB) GetPriceHistory(productID string, at location.Location, since time.Time) ([]PricePoint, error) {
+	query := `
+		SELECT timestamp, ` + lastSeenColumn + `, price, price, price, price, observations, currency, 'raw',
+			unit_price, price_unit, effective_price
+		FROM price_history
+		WHERE product_id = $1 AND location = $3 AND ` + lastSeenColumn + ` >= $2::TIMESTAMP
+		UNION ALL
+		SELECT CAST(day AS TIMESTAMP), CAST(day AS TIMESTAMP), close_price, min_price, max_price, avg_price, samples, currency, 'daily',
+			min_unit_price, price_unit, min_effective_price
+		FROM price_history_daily
+		WHERE product_id = $1 AND location = $3 AND day >= CAST($2::TIMESTAMP AS DATE)
+		ORDER BY 1
+	`
+
+	rows, err := db.Query(query, productID, since, at.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query price history: %w", err)
+	}
+	defer rows.Close()
+
+	points := []PricePoint{}
+	for rows.Next() {
+		var p PricePoint
+		var price, minPrice, maxPrice, avgPrice string
+		var unitPrice, priceUnit, effective sql.NullString
+		if err := rows.Scan(&p.Timestamp, &p.LastSeen, &price, &minPrice, &maxPrice, &avgPrice, &p.Samples, &p.Currency, &p.Resolution,
+			&unitPrice, &priceUnit, &effective); err != nil {
+			return nil, fmt.Errorf("failed to scan price history: %w", err)
+		}
+		if err := parseAmounts(p.Currency, []string{price, minPrice, maxPrice, avgPrice}, &p.Price, &p.Min, &p.Max, &p.Avg); err != nil {
+			return nil, err
+		}
+		unit, err := parseUnitPrice(unitPrice, priceUnit, p.Currency)
+		if err != nil {
+			return nil, err
+		}
+		p.UnitPrice = unit
+		if effective.Valid {
+			e, err := parseAmount(effective.String, p.Currency)
+			if err != nil {
+				return nil, err
+			}
+			if e.Cmp(p.Min) < 0 {
+				p.EffectivePrice = &e
+			}
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// GetPricePoints returns a product's prices at a location since the given
+// time, oldest first, for statistics and judging discounts: listed prices,
+// or effective prices after offers if effective. Daily rollups count with
+// their closing price.
+func (db *DB) GetPricePoints(productID string, at location.Location, since time.Time, effective bool) ([]stats.Point, error) {
+	history, err := db.GetPriceHistory(productID, at, since)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]stats.Point, len(history))
+	for i, p := range history {
+		points[i] = stats.Point{At: p.Timestamp, Price: p.Price}
+		if effective && p.EffectivePrice != nil {
+			points[i].Price = *p.EffectivePrice
+		}
+	}
+	return points, nil
+}
+
+// GetPriceLocations returns the locations a product has price history at,
+// most recently seen first; "" is the shop's default location.
+func (db *DB) GetPriceLocations(productID string) ([]string, error) {
+	query := `
+		SELECT location FROM (
+			SELECT location, MAX(` + lastSeenColumn + `) AS seen FROM price_history WHERE product_id = $1 GROUP BY location
+			UNION ALL
+			SELECT location, MAX(CAST(day AS TIMESTAMP)) FROM price_history_daily WHERE product_id = $1 GROUP BY location
+		) seen
+		GROUP BY location
+		ORDER BY MAX(seen) DESC
+	`
+
+	rows, err := db.Query(query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query price locations: %w", err)
+	}
+	defer rows.Close()
+
+	locations := []string{}
+	for rows.Next() {
+		var loc string
+		if err := rows.Scan(&loc); err != nil {
+			return nil, fmt.Errorf("failed to scan price location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+
+	return locations, rows.Err()
+}
+
+// CompactionResult reports what CompactPriceHistory changed.
+type CompactionResult struct {
+	DaysRolledUp   int64
+	RowsDeleted    int64
+	RollupsDeleted int64
+}
+
+// latestSamples selects the newest raw sample of every product at every
+// location. Those rows are never compacted so the latest price and deltas
+// stay exact.
+const latestSamples = `SELECT DISTINCT ON (product_id, location) id FROM price_history ORDER BY product_id, location, timestamp DESC`
+
+// CompactPriceHistory rolls raw rows last seen before the last rawDays whole
+// days into daily min/max/avg/close rows per currency, weighted by
+// observation count, and deletes them. A row covering several days counts
+// towards each of them, its observations spread evenly. If rollupDays is
+// positive, rollups older than that are deleted too.
+func (db *DB) CompactPriceHistory(rawDays, rollupDays int) (*CompactionResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin compaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &CompactionResult{}
+
+	// Cut on a day boundary so every day is rolled up in one go.
+	const cutoff = `DATE_TRUNC('day', NOW()) - INTERVAL '1 day' * $1`
+
+	rollup := `
+		INSERT INTO price_history_daily (product_id, location, day, min_price, max_price, avg_price, close_price, samples, currency,
+			min_unit_price, price_unit, min_effective_price)
+		SELECT product_id, location, day, MIN(price), MAX(price),
+			SUM(price * weight) / SUM(weight),
+			(ARRAY_AGG(price ORDER BY timestamp DESC))[1], GREATEST(ROUND(SUM(weight)), 1),
+			currency,
+			MIN(unit_price), (ARRAY_AGG(price_unit ORDER BY timestamp DESC))[1], MIN(` + effectivePriceColumn + `)
+		FROM (
+			SELECT ph.*, CAST(d AS DATE) AS day,
+				observations::NUMERIC / (CAST(` + lastSeenColumn + ` AS DATE) - CAST(timestamp AS DATE) + 1) AS weight
+			FROM price_history ph
+			CROSS JOIN LATERAL generate_series(CAST(timestamp AS DATE), CAST(` + lastSeenColumn + ` AS DATE), INTERVAL '1 day') d
+			WHERE ` + lastSeenColumn + ` < ` + cutoff + ` AND id NOT IN (` + latestSamples + `)
+		) days
+		GROUP BY product_id, location, day, currency
+		ON CONFLICT (product_id, location, day, currency) DO UPDATE SET
+			min_price = LEAST(price_history_daily.min_price, EXCLUDED.min_price),
+			max_price = GREATEST(price_history_daily.max_price, EXCLUDED.max_price),
+			avg_price = (price_history_daily.avg_price * price_history_daily.samples + EXCLUDED.avg_price * EXCLUDED.samples)
+				/ (price_history_daily.samples + EXCLUDED.samples),
+			close_price = EXCLUDED.close_price,
+			samples = price_history_daily.samples + EXCLUDED.samples,
+			min_unit_price = LEAST(price_history_daily.min_unit_price, EXCLUDED.min_unit_price),
+			price_unit = COALESCE(EXCLUDED.price_unit, price_history_daily.price_unit),
+			min_effective_price = LEAST(COALESCE(price_history_daily.min_effective_price, price_history_daily.min_price), EXCLUDED.min_effective_price)
+	`
+	res, err := tx.Exec(rollup, rawDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll up price history: %w", err)
+	}
+	result.DaysRolledUp, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`DELETE FROM price_history WHERE `+lastSeenColumn+` < `+cutoff+` AND id NOT IN (`+latestSamples+`)`, rawDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete compacted price history: %w", err)
+	}
+	result.RowsDeleted, _ = res.RowsAffected()
+
+	if rollupDays > 0 {
+		res, err = tx.Exec(`DELETE FROM price_history_daily WHERE day < CURRENT_DATE - $1::INTEGER`, rollupDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete expired rollups: %w", err)
+		}
+		result.RollupsDeleted, _ = res.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit compaction: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"fmt"
+)
+
+// matchPair orders two product IDs the way match_dismissals stores them.
+func matchPair(a, b string) (string, string) {
+	if b < a {
+		return b, a
+	}
+	return a, b
+}
+
+// DismissMatch records that two products are not the same item, so they are
+// no longer suggested as a match.
+func (db *DB) DismissMatch(productA, productB string) error {
+	a, b := matchPair(productA, productB)
+	query := `INSERT INTO match_dismissals (product_a, product_b) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := db.Exec(query, a, b); err != nil {
+		return fmt.Errorf("failed to dismiss match: %w", err)
+	}
+	return nil
+}
+
+// DismissedMatches returns a function reporting whether a pair of products
+// was dismissed, in either order.
+func (db *DB) DismissedMatches() (func(productA, productB string) bool, error) {
+	rows, err := db.Query(`SELECT product_a, product_b FROM match_dismissals`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dismissed matches: %w", err)
+	}
+	defer rows.Close()
+
+	dismissed := make(map[[2]string]bool)
+	for rows.Next() {
+		var a, b string
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, fmt.Errorf("failed to scan dismissed match: %w", err)
+		}
+		dismissed[[2]string{a, b}] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return func(productA, productB string) bool {
+		a, b := matchPair(productA, productB)
+		return dismissed[[2]string{a, b}]
+	}, nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/offers"
+)
+
+// Cards returns the payment cards listed in the cards setting.
+func (db *DB) Cards() ([]offers.Card, error) {
+	value, err := db.GetSetting(SettingCards, "")
+	if err != nil {
+		return nil, err
+	}
+	cards, err := offers.ParseCards(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s setting: %w", SettingCards, err)
+	}
+	return cards, nil
+}
+
+// SetProductOffers replaces the coupons and bank offers stored for a
+// product with those seen on its latest scrape.
+func (db *DB) SetProductOffers(productID string, available []offers.Offer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM product_offers WHERE product_id = $1`, productID); err != nil {
+		return fmt.Errorf("failed to clear product offers: %w", err)
+	}
+	for i, offer := range available {
+		query := `INSERT INTO product_offers (product_id, position, text) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(query, productID, i, offer.Text); err != nil {
+			return fmt.Errorf("failed to add product offer: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit product offers: %w", err)
+	}
+	return nil
+}
+
+// EffectivePrice applies the best usable coupon and bank offer for the
+// cards setting to price. It returns nil if none lowers the price, along
+// with the offers applied.
+func (db *DB) EffectivePrice(price money.Money, available []offers.Offer) (*money.Money, []offers.Offer, error) {
+	cards, err := db.Cards()
+	if err != nil {
+		return nil, nil, err
+	}
+	effective, applied := offers.Effective(price, available, cards)
+	if effective.Equal(price) {
+		return nil, []offers.Offer{}, nil
+	}
+	return &effective, applied, nil
+}
+
+// effectivePriceColumn is a price_history row's price after offers.
+const effectivePriceColumn = `COALESCE(effective_price, price)`
+
+// GetLatestEffectivePrice returns the latest price seen at a location after
+// the offers usable then.
+func (db *DB) GetLatestEffectivePrice(productID string, at location.Location) (money.Money, error) {
+	return db.latestPrice(productID, at, effectivePriceColumn)
+}
+
+// GetLowestEffectivePriceInPeriod is GetLowestPriceInPeriod for prices
+// after the offers usable when they were seen.
+func (db *DB) GetLowestEffectivePriceInPeriod(productID string, at location.Location, days int) (money.Money, error) {
+	return db.lowestInPeriod(productID, at, days, effectivePriceColumn, `COALESCE(min_effective_price, min_price)`)
+}
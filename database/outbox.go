@@ -0,0 +1,342 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"price-watcher/digest"
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/packsize"
+)
+
+// Delivery statuses: pending deliveries are retried until they are sent or
+// run out of attempts and are dead-lettered.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryDead    = "dead"
+)
+
+// Delivery is an alert's delivery on one channel, kept in an outbox until
+// it is sent.
+type Delivery struct {
+	ID        string `json:"id"`
+	AlertID   string `json:"alert_id"`
+	ProductID string `json:"product_id"`
+	Product   string `json:"product"`
+	Channel   string `json:"channel"`
+	Subject   string `json:"subject"`
+	Message   string `json:"message"`
+	// Quiet is set on deliveries held until the quiet hours ended.
+	Quiet         bool       `json:"quiet,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// OutboxAlert is an alert stored in the same transaction as the change that
+// raised it, along with its deliveries, so it is neither lost nor sent
+// twice if the process dies or a channel is down.
+type OutboxAlert struct {
+	// Type is the alert type, such as digest.AlertLow.
+	Type string
+	// ProductID is the product alerted about or, on alerts about a group's
+	// best price, the listing now offering it.
+	ProductID string
+	// GroupID is set on alerts about a group's best price, whose prices
+	// are in the group's currency.
+	GroupID          *string
+	OldPrice         money.Money
+	NewPrice         money.Money
+	Message          string
+	SuppressedReason string
+	Deliveries       []OutboxDelivery
+	// Digest, unless empty, records the alert for the digests with this
+	// detail.
+	Digest string
+}
+
+// OutboxDelivery is a delivery to add to the outbox.
+type OutboxDelivery struct {
+	Channel string
+	Subject string
+	Message string
+	// Delay holds the delivery back, e.g. until the quiet hours end.
+	Delay time.Duration
+	Quiet bool
+}
+
+// RecordScrapedPrice stores a scraped price as RecordPrice does and, in the
+// same transaction, the digest entry for its change by delta, if any, and
+// the alert it raised, if any, so neither outlives a price not stored.
+func (db *DB) RecordScrapedPrice(productID string, at location.Location, price, delta money.Money, unit *packsize.UnitPrice, effective *money.Money, mode string,
+	alert *OutboxAlert) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := recordPrice(tx, productID, at, price, delta, unit, effective, mode); err != nil {
+		return err
+	}
+	if !delta.IsZero() {
+		kind := digest.KindDrop
+		if delta.Amount > 0 {
+			kind = digest.KindIncrease
+		}
+		previous := price.Sub(delta)
+		if err := addDigestEntry(tx, kind, productID, &previous, &price, ""); err != nil {
+			return err
+		}
+	}
+	if alert != nil {
+		if err := insertAlert(tx, *alert); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit price and alert: %w", err)
+	}
+	return nil
+}
+
+// UpdateGroupBestPriceWithAlert records a group's new best price as
+// UpdateGroupBestPrice does and, in the same transaction, the alert about
+// it; neither is stored if another scrape changed the best price first.
+func (db *DB) UpdateGroupBestPriceWithAlert(groupID string, previous *money.Money, best money.Money, alert OutboxAlert) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updated, err := updateGroupBestPrice(tx, groupID, previous, best)
+	if err != nil || !updated {
+		return false, err
+	}
+	if err := insertAlert(tx, alert); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit best price and alert: %w", err)
+	}
+	return true, nil
+}
+
+// insertAlert stores an alert with its deliveries and digest entry.
+func insertAlert(tx *sql.Tx, alert OutboxAlert) error {
+	var alertID string
+	query := `
+		INSERT INTO alerts (alert_type, product_id, group_id, old_price, new_price, currency, message, suppressed_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	err := tx.QueryRow(query, alert.Type, alert.ProductID, alert.GroupID, alert.OldPrice, alert.NewPrice, alert.NewPrice.Currency,
+		alert.Message, alert.SuppressedReason).Scan(&alertID)
+	if err != nil {
+		return fmt.Errorf("failed to create alert: %w", err)
+	}
+
+	for _, d := range alert.Deliveries {
+		query := `
+			INSERT INTO alert_deliveries (alert_id, channel, subject, message, quiet, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + INTERVAL '1 second' * $6)
+		`
+		if _, err := tx.Exec(query, alertID, d.Channel, d.Subject, d.Message, d.Quiet, int64(d.Delay.Seconds())); err != nil {
+			return fmt.Errorf("failed to add alert delivery: %w", err)
+		}
+	}
+
+	if alert.Digest != "" {
+		return addDigestEntry(tx, digest.KindAlert, alert.ProductID, &alert.OldPrice, &alert.NewPrice, alert.Digest)
+	}
+	return nil
+}
+
+// deliveryColumns lists the columns read by scanDelivery from
+// alert_deliveries d joined with alerts a and products p, in order.
+const deliveryColumns = `d.id, d.alert_id, a.product_id, p.name, d.channel, d.subject, d.message, d.quiet, d.status, d.attempts,
+	d.next_attempt_at, d.last_error, d.created_at, d.delivered_at`
+
+const deliveryJoins = ` JOIN alerts a ON a.id = d.alert_id JOIN products p ON p.id = a.product_id`
+
+func scanDelivery(row rowScanner) (Delivery, error) {
+	var d Delivery
+	var deliveredAt sql.NullTime
+	if err := row.Scan(&d.ID, &d.AlertID, &d.ProductID, &d.Product, &d.Channel, &d.Subject, &d.Message, &d.Quiet, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+		return d, fmt.Errorf("failed to scan alert delivery: %w", err)
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]Delivery, error) {
+	defer rows.Close()
+	deliveries := []Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ClaimDeliveries returns up to limit pending deliveries that are due,
+// oldest first, counting an attempt on each and holding them back for the
+// lease so another dispatcher does not send them too. A delivery neither
+// marked sent nor failed within the lease is retried.
+func (db *DB) ClaimDeliveries(limit int, lease time.Duration) ([]Delivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM alert_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at, created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE alert_deliveries SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + INTERVAL '1 second' * $2
+			WHERE id IN (SELECT id FROM due)
+			RETURNING *
+		)
+		SELECT ` + deliveryColumns + ` FROM claimed d` + deliveryJoins + `
+		ORDER BY d.created_at, d.id
+	`
+	rows, err := db.Query(query, limit, int64(lease.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim alert deliveries: %w", err)
+	}
+	return scanDeliveries(rows)
+}
+
+// MarkDeliveriesSent records that deliveries were sent.
+func (db *DB) MarkDeliveriesSent(ids ...string) error {
+	query := `
+		UPDATE alert_deliveries SET status = 'sent', last_error = '', delivered_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1::uuid[])
+	`
+	if _, err := db.Exec(query, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to mark alert deliveries sent: %w", err)
+	}
+	return nil
+}
+
+// MarkDeliveryFailed records why a delivery failed, retrying it after
+// retryIn or, if dead, dead-lettering it.
+func (db *DB) MarkDeliveryFailed(id, reason string, retryIn time.Duration, dead bool) error {
+	status := DeliveryPending
+	if dead {
+		status = DeliveryDead
+	}
+	query := `
+		UPDATE alert_deliveries SET status = $2, last_error = $3, next_attempt_at = CURRENT_TIMESTAMP + INTERVAL '1 second' * $4
+		WHERE id = $1
+	`
+	if _, err := db.Exec(query, id, status, reason, int64(retryIn.Seconds())); err != nil {
+		return fmt.Errorf("failed to mark alert delivery failed: %w", err)
+	}
+	return nil
+}
+
+// RetryDelivery makes a dead-lettered delivery pending again, due now and
+// with its attempts reset.
+func (db *DB) RetryDelivery(id string) error {
+	query := `
+		UPDATE alert_deliveries SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'dead'
+	`
+	result, err := db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to retry alert delivery: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("dead-lettered delivery not found: %s", id)
+	}
+	return nil
+}
+
+// ListDeliveries returns up to limit deliveries with the given status, or
+// of every status if it is empty, latest first.
+func (db *DB) ListDeliveries(status string, limit int) ([]Delivery, error) {
+	if limit <= 0 {
+		limit = DefaultAlertLimit
+	}
+	query := `SELECT ` + deliveryColumns + ` FROM alert_deliveries d` + deliveryJoins + `
+		WHERE $1 = '' OR d.status = $1
+		ORDER BY d.created_at DESC, d.id
+		LIMIT $2
+	`
+	rows, err := db.Query(query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert deliveries: %w", err)
+	}
+	return scanDeliveries(rows)
+}
+
+// CountDeliveries returns how many deliveries have each status.
+func (db *DB) CountDeliveries() (map[string]int, error) {
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM alert_deliveries GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count alert deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan alert delivery count: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// attachDeliveries fills in the deliveries of alerts.
+func (db *DB) attachDeliveries(alerts []Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	ids := make([]string, len(alerts))
+	for i, a := range alerts {
+		ids[i] = a.ID
+	}
+
+	query := `SELECT ` + deliveryColumns + ` FROM alert_deliveries d` + deliveryJoins + `
+		WHERE d.alert_id = ANY($1::uuid[])
+	`
+	rows, err := db.Query(query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query alert deliveries: %w", err)
+	}
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Channel < deliveries[j].Channel })
+
+	byAlert := make(map[string][]Delivery)
+	for _, d := range deliveries {
+		byAlert[d.AlertID] = append(byAlert[d.AlertID], d)
+	}
+	for i := range alerts {
+		alerts[i].Deliveries = byAlert[alerts[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"price-watcher/money"
+)
+
+// GetExchangeRates returns every stored exchange rate, newest first per pair.
+func (db *DB) GetExchangeRates() ([]money.ExchangeRate, error) {
+	rows, err := db.Query(`SELECT base, quote, rate, effective_date FROM exchange_rates
+		ORDER BY base, quote, effective_date DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []money.ExchangeRate{}
+	for rows.Next() {
+		var r money.ExchangeRate
+		var rate string
+		if err := rows.Scan(&r.Base, &r.Quote, &rate, &r.EffectiveDate); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %w", err)
+		}
+		if r.Rate, err = money.ParseRate(rate); err != nil {
+			return nil, fmt.Errorf("invalid stored exchange rate: %w", err)
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+// LoadRates returns all stored exchange rates indexed for conversion.
+func (db *DB) LoadRates() (*money.Rates, error) {
+	rates, err := db.GetExchangeRates()
+	if err != nil {
+		return nil, err
+	}
+	return money.NewRates(rates), nil
+}
+
+// SaveExchangeRates stores rates in one transaction, replacing any rate for
+// the same pair and effective date.
+func (db *DB) SaveExchangeRates(rates []money.ExchangeRate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO exchange_rates (base, quote, rate, effective_date) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (base, quote, effective_date) DO UPDATE SET rate = EXCLUDED.rate, updated_at = CURRENT_TIMESTAMP
+	`
+	for _, r := range rates {
+		if _, err := tx.Exec(query, r.Base, r.Quote, money.FormatRate(r.Rate), r.EffectiveDate); err != nil {
+			return fmt.Errorf("failed to save exchange rate %s/%s: %w", r.Base, r.Quote, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit exchange rates: %w", err)
+	}
+	return nil
+}
+
+// DeleteExchangeRate removes the rate for a pair effective on the given day.
+func (db *DB) DeleteExchangeRate(base, quote string, effectiveDate time.Time) error {
+	result, err := db.Exec(`DELETE FROM exchange_rates WHERE base = $1 AND quote = $2 AND effective_date = $3`,
+		base, quote, effectiveDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete exchange rate: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("exchange rate not found: %s/%s on %s", base, quote, effectiveDate.Format("2006-01-02"))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"price-watcher/location"
+)
+
+// SettingDisplayCurrency names the setting holding the currency prices are
+// also shown in by the UI, API and alerts; unset means no conversion.
+const SettingDisplayCurrency = "display_currency"
+
+// SettingLocation names the setting holding the delivery location products
+// without their own are scraped for, such as "560001 12.9716,77.5946";
+// unset means each shop's default.
+const SettingLocation = "location"
+
+// SettingCards names the setting listing the payment cards held, such as
+// "HDFC Credit, ICICI Debit", whose bank offers count towards effective
+// prices; unset means coupons only.
+const SettingCards = "cards"
+
+// SettingDigestTelegram and SettingDigestEmail name the settings holding
+// how each channel delivers: "instant" (the default), or in a "daily" or
+// "weekly" digest with only urgent alerts sent instantly.
+const (
+	SettingDigestTelegram = "digest_telegram"
+	SettingDigestEmail    = "digest_email"
+)
+
+// SettingUrgentAlerts names the setting listing the alert types sent
+// instantly on channels in digest mode, such as "target, group"; unset
+// means digest.DefaultUrgent.
+const SettingUrgentAlerts = "urgent_alerts"
+
+// SettingTimezone names the setting holding the IANA timezone, such as
+// "Asia/Kolkata", of quiet hours, digest schedules and the times shown in
+// messages and the UI; unset means config.Timezone.
+const SettingTimezone = "timezone"
+
+// SettingQuietHours names the setting holding the quiet hours during which
+// alerts that are not urgent are queued, such as "22:00-07:00"; unset
+// means none.
+const SettingQuietHours = "quiet_hours"
+
+// SettingQuietCollapse names the setting holding whether alerts queued
+// during quiet hours are released collapsed into one message per channel,
+// keeping the latest alert of each product, rather than one by one.
+const SettingQuietCollapse = "quiet_collapse"
+
+// GetSettings returns every stored setting keyed by name.
+func (db *DB) GetSettings() (map[string]string, error) {
+	rows, err := db.Query(`SELECT key, value FROM settings ORDER BY key`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+		settings[key] = value
+	}
+
+	return settings, rows.Err()
+}
+
+// GetSetting returns the value of key, or def if it has not been set.
+func (db *DB) GetSetting(key, def string) (string, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM settings WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return def, nil
+	}
+	if err != nil {
+		return def, fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (db *DB) SetSetting(key, value string) error {
+	query := `
+		INSERT INTO settings (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := db.Exec(query, key, value); err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (db *DB) DeleteSetting(key string) error {
+	if _, err := db.Exec(`DELETE FROM settings WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to delete setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// ProductLocation returns the delivery location a product is scraped for:
+// its own, or else the location setting.
+func (db *DB) ProductLocation(product Product) (location.Location, error) {
+	if product.Location != nil {
+		return *product.Location, nil
+	}
+	value, err := db.GetSetting(SettingLocation, "")
+	if err != nil {
+		return location.Location{}, err
+	}
+	loc, err := location.Parse(value)
+	if err != nil {
+		return location.Location{}, fmt.Errorf("invalid %s setting: %w", SettingLocation, err)
+	}
+	return loc, nil
+}
+
+// TimeZone returns the timezone of the timezone setting, or else of def;
+// it returns time.Local along with an error if the name is unknown.
+func (db *DB) TimeZone(def string) (*time.Location, error) {
+	name, err := db.GetSetting(SettingTimezone, def)
+	if err != nil {
+		return time.Local, err
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import "fmt"
+
+// GetAlertTemplates returns the stored alert templates by name, such as
+// "low" or "group.telegram".
+func (db *DB) GetAlertTemplates() (map[string]string, error) {
+	rows, err := db.Query(`SELECT name, body FROM alert_templates ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := make(map[string]string)
+	for rows.Next() {
+		var name, body string
+		if err := rows.Scan(&name, &body); err != nil {
+			return nil, fmt.Errorf("failed to scan alert template: %w", err)
+		}
+		templates[name] = body
+	}
+
+	return templates, rows.Err()
+}
+
+// SaveAlertTemplate stores an alert template, replacing one of the same
+// name.
+func (db *DB) SaveAlertTemplate(name, body string) error {
+	query := `
+		INSERT INTO alert_templates (name, body) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET body = EXCLUDED.body, updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := db.Exec(query, name, body); err != nil {
+		return fmt.Errorf("failed to save alert template %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteAlertTemplate removes a stored alert template.
+func (db *DB) DeleteAlertTemplate(name string) error {
+	result, err := db.Exec(`DELETE FROM alert_templates WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert template %s: %w", name, err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("alert template not found: %s", name)
+	}
+	return nil
+}
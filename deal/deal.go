@@ -0,0 +1,287 @@
+// Package deal tells whether now is a good time to buy: it scores the
+// current price against the product's history and forecasts the chance of
+// a further drop from a trend and weekly seasonal decomposition of its
+// daily prices.
+package deal
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+// DefaultForecastDays is how many days ahead a further drop is forecast.
+const DefaultForecastDays = 14
+
+// ForecastHistoryDays is how much history the forecast model is fitted on.
+const ForecastHistoryDays = 365
+
+// trendDays is how many recent days the trend line is fitted on.
+const trendDays = 90
+
+// minForecastDays is how many daily prices a forecast needs: two weeks to
+// tell the weekly pattern from the trend.
+const minForecastDays = 14
+
+// Ratings of a Score.
+const (
+	RatingGreat = "great"
+	RatingGood  = "good"
+	RatingFair  = "fair"
+	RatingPoor  = "poor"
+)
+
+// Advice given by Evaluate.
+const (
+	AdviceBuy  = "buy"
+	AdviceWait = "wait"
+)
+
+// Score rates a price against the product's history from 0 (worst) to 100
+// (best).
+type Score struct {
+	Value  int    `json:"value"`
+	Rating string `json:"rating"`
+	// Percentile is the share of the product's history, in percent, the
+	// price was higher than the current one.
+	Percentile float64 `json:"percentile"`
+	// AboveLow is how far the current price is above the all-time low, in
+	// percent.
+	AboveLow float64 `json:"above_low"`
+	Trend    string  `json:"trend,omitempty"`
+}
+
+// Forecast estimates where the price goes in the next Days days.
+type Forecast struct {
+	Days int `json:"days"`
+	// DropChance is the model's chance, in percent, that the price is below
+	// the current one on the day it is most likely to be.
+	DropChance float64 `json:"drop_chance"`
+	// HistoricalDropRate is how often, in percent, the price went lower
+	// within Days days in the past, or nil if the history is too short.
+	HistoricalDropRate *float64 `json:"historical_drop_rate,omitempty"`
+	// TrendPerDay is how much the fitted trend moves the price a day.
+	TrendPerDay money.Money `json:"trend_per_day"`
+	// Expected is the expected price each day.
+	Expected []stats.Point `json:"expected"`
+	// Low is the lowest expected price.
+	Low money.Money `json:"low"`
+}
+
+// Deal is the verdict on buying at the current price.
+type Deal struct {
+	Score    Score     `json:"score"`
+	Forecast *Forecast `json:"forecast,omitempty"`
+	Advice   string    `json:"advice"`
+	Reason   string    `json:"reason"`
+}
+
+// Evaluate scores the current price of s, the statistics of points, and
+// forecasts the next days days. It advises waiting when a further drop is
+// more likely than not or the price is poor, and buying otherwise. points
+// are oldest first and end with the current price.
+func Evaluate(points []stats.Point, s stats.Stats, now time.Time, days int) Deal {
+	d := Deal{Score: Rate(points, s, now)}
+	if f, ok := Predict(points, s.Current, now, days); ok {
+		d.Forecast = &f
+	}
+
+	switch {
+	case d.Forecast != nil && d.Forecast.DropChance >= 50:
+		d.Advice = AdviceWait
+		d.Reason = fmt.Sprintf("a further drop within %d days is likely, to about %s", d.Forecast.Days, d.Forecast.Low.Format())
+	case d.Score.Value < 40:
+		d.Advice = AdviceWait
+		d.Reason = "the price is high for this product"
+	default:
+		d.Advice = AdviceBuy
+		d.Reason = fmt.Sprintf("the price is %s for this product", d.Score.Rating)
+		if d.Forecast != nil {
+			d.Reason += " and a further drop is unlikely"
+		}
+	}
+	return d
+}
+
+// Rate scores the current price of s against points: half on its
+// percentile, 30% on how close it is to the all-time low, full marks at
+// the low and none from 25% above it, and 20% on the trend, a rising price
+// being better bought now than a falling one.
+func Rate(points []stats.Point, s stats.Stats, now time.Time) Score {
+	score := Score{Trend: s.Trend}
+	history := sameCurrency(points, s.Current)
+	score.Percentile, _ = stats.PercentAbove(history, s.Current, s.Since, now)
+	if s.Low.Price.Amount > 0 {
+		score.AboveLow = s.Current.Sub(s.Low.Price).PercentOf(s.Low.Price)
+	}
+
+	closeness := math.Max(0, 1-score.AboveLow/25)
+	trend := 0.5
+	switch s.Trend {
+	case stats.TrendRising:
+		trend = 1
+	case stats.TrendFalling:
+		trend = 0
+	}
+	score.Value = int(math.Round(50*score.Percentile/100 + 30*closeness + 20*trend))
+
+	switch {
+	case score.Value >= 80:
+		score.Rating = RatingGreat
+	case score.Value >= 60:
+		score.Rating = RatingGood
+	case score.Value >= 40:
+		score.Rating = RatingFair
+	default:
+		score.Rating = RatingPoor
+	}
+	return score
+}
+
+// Predict forecasts the next days days from the daily closing prices of
+// the last ForecastHistoryDays days. The closes are split into a linear
+// trend over the last 90 days, a weekly pattern and noise; each day's
+// expected price is the trend plus that weekday's pattern, and the chance
+// of it being below current assumes normally distributed noise. It reports
+// false if there are fewer than two weeks of prices.
+func Predict(points []stats.Point, current money.Money, now time.Time, days int) (Forecast, bool) {
+	if days <= 0 {
+		days = DefaultForecastDays
+	}
+	history := sameCurrency(points, current)
+	closes := stats.DailyCloses(history, now.AddDate(0, 0, -ForecastHistoryDays), now)
+	if len(closes) < minForecastDays {
+		return Forecast{}, false
+	}
+
+	fit := closes
+	if len(fit) > trendDays {
+		fit = fit[len(fit)-trendDays:]
+	}
+	slope, intercept := linearFit(fit)
+
+	// The weekly pattern is the average detrended price of each weekday,
+	// centred on zero.
+	var seasonal [7]float64
+	var counts [7]int
+	residuals := make([]float64, len(fit))
+	for i, c := range fit {
+		residuals[i] = float64(c.Price.Amount) - (intercept + slope*float64(i))
+		seasonal[c.At.Weekday()] += residuals[i]
+		counts[c.At.Weekday()]++
+	}
+	var mean float64
+	for wd := range seasonal {
+		if counts[wd] > 0 {
+			seasonal[wd] /= float64(counts[wd])
+		}
+		mean += seasonal[wd] / 7
+	}
+	for wd := range seasonal {
+		seasonal[wd] -= mean
+	}
+	var variance float64
+	for i, c := range fit {
+		noise := residuals[i] - seasonal[c.At.Weekday()]
+		variance += noise * noise
+	}
+	sigma := math.Sqrt(variance / float64(len(fit)))
+
+	f := Forecast{
+		Days:        days,
+		TrendPerDay: money.New(int64(math.Round(slope)), current.Currency),
+		Expected:    make([]stats.Point, 0, days),
+	}
+	last := fit[len(fit)-1].At
+	for d := 1; d <= days; d++ {
+		at := last.AddDate(0, 0, d)
+		expected := intercept + slope*float64(len(fit)-1+d) + seasonal[at.Weekday()]
+		if expected < 0 {
+			expected = 0
+		}
+		price := money.New(int64(math.Round(expected)), current.Currency)
+		f.Expected = append(f.Expected, stats.Point{At: at, Price: price})
+		if d == 1 || price.Cmp(f.Low) < 0 {
+			f.Low = price
+		}
+
+		var chance float64
+		switch {
+		case sigma > 0:
+			chance = normalCDF((float64(current.Amount) - expected) / sigma)
+		case price.Cmp(current) < 0:
+			chance = 1
+		}
+		f.DropChance = math.Max(f.DropChance, chance*100)
+	}
+
+	if rate, ok := historicalDropRate(closes, days); ok {
+		f.HistoricalDropRate = &rate
+	}
+	return f, true
+}
+
+// historicalDropRate returns how often, in percent, a close was followed by
+// a lower one within days days.
+func historicalDropRate(closes []stats.Point, days int) (float64, bool) {
+	var total, drops int
+	for i := 0; i+days < len(closes); i++ {
+		total++
+		for j := i + 1; j <= i+days; j++ {
+			if closes[j].Price.Cmp(closes[i].Price) < 0 {
+				drops++
+				break
+			}
+		}
+	}
+	if total < days {
+		return 0, false
+	}
+	return float64(drops) * 100 / float64(total), true
+}
+
+// linearFit returns the least-squares line through closes, indexed by day.
+func linearFit(closes []stats.Point) (slope, intercept float64) {
+	n := float64(len(closes))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, c := range closes {
+		x, y := float64(i), float64(c.Price.Amount)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		slope = (n*sumXY - sumX*sumY) / denominator
+	}
+	return slope, (sumY - slope*sumX) / n
+}
+
+// normalCDF is the standard normal cumulative distribution function.
+func normalCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// sameCurrency returns the points in current's currency.
+func sameCurrency(points []stats.Point, current money.Money) []stats.Point {
+	var result []stats.Point
+	for _, p := range points {
+		if p.Price.SameCurrency(current) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Summary describes the deal in one line for alerts, e.g. "🧮 Deal score
+// 82/100 (great) · 23% chance of a further drop in 14 days · buy".
+func (d Deal) Summary() string {
+	summary := fmt.Sprintf("🧮 Deal score %d/100 (%s)", d.Score.Value, d.Score.Rating)
+	if d.Forecast != nil {
+		summary += fmt.Sprintf(" · %.0f%% chance of a further drop in %d days", d.Forecast.DropChance, d.Forecast.Days)
+	}
+	return summary + " · " + d.Advice
+}
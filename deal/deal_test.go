@@ -0,0 +1,121 @@
+package deal
+
+import (
+	"testing"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+// daily returns one point a day for the days up to now, the price changing
+// by step rupees a day from start.
+func daily(now time.Time, days int, start, step int64) []stats.Point {
+	points := make([]stats.Point, 0, days+1)
+	for d := days; d >= 0; d-- {
+		points = append(points, stats.Point{At: now.AddDate(0, 0, -d), Price: inr(start + step*int64(days-d))})
+	}
+	return points
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	tests := []struct {
+		name     string
+		points   []stats.Point
+		rating   string
+		forecast bool
+		drop     func(float64) bool
+		advice   string
+	}{
+		{
+			name:     "Steady decline",
+			points:   daily(now, 60, 1600, -10),
+			rating:   RatingGreat,
+			forecast: true,
+			drop:     func(chance float64) bool { return chance > 90 },
+			advice:   AdviceWait,
+		},
+		{
+			name:     "Steady rise",
+			points:   daily(now, 60, 1000, 10),
+			rating:   RatingPoor,
+			forecast: true,
+			drop:     func(chance float64) bool { return chance < 10 },
+			advice:   AdviceWait,
+		},
+		{
+			name:     "Drop to a long-standing low",
+			points:   []stats.Point{{At: daysAgo(200), Price: inr(999)}, {At: daysAgo(150), Price: inr(1299)}, {At: daysAgo(1), Price: inr(999)}},
+			rating:   RatingGood,
+			forecast: true,
+			drop:     func(chance float64) bool { return chance < 50 },
+			advice:   AdviceBuy,
+		},
+		{
+			name:     "Stable price",
+			points:   []stats.Point{{At: daysAgo(100), Price: inr(500)}},
+			rating:   RatingFair,
+			forecast: true,
+			drop:     func(chance float64) bool { return chance == 0 },
+			advice:   AdviceBuy,
+		},
+		{
+			name:   "Too little history to forecast",
+			points: []stats.Point{{At: daysAgo(5), Price: inr(700)}, {At: daysAgo(2), Price: inr(600)}},
+			rating: RatingGood,
+			advice: AdviceBuy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := stats.Compute(tt.points, now)
+			if !ok {
+				t.Fatal("stats.Compute() = false")
+			}
+			d := Evaluate(tt.points, s, now, DefaultForecastDays)
+			if d.Score.Rating != tt.rating {
+				t.Errorf("Evaluate() score = %+v, want %s", d.Score, tt.rating)
+			}
+			if (d.Forecast != nil) != tt.forecast {
+				t.Fatalf("Evaluate() forecast = %+v, want %v", d.Forecast, tt.forecast)
+			}
+			if d.Forecast != nil {
+				if len(d.Forecast.Expected) != DefaultForecastDays {
+					t.Errorf("Evaluate() expected %d days, want %d", len(d.Forecast.Expected), DefaultForecastDays)
+				}
+				if !tt.drop(d.Forecast.DropChance) {
+					t.Errorf("Evaluate() drop chance = %.1f%%", d.Forecast.DropChance)
+				}
+			}
+			if d.Advice != tt.advice {
+				t.Errorf("Evaluate() advice = %s (%s), want %s", d.Advice, d.Reason, tt.advice)
+			}
+			if d.Summary() == "" {
+				t.Error("Summary() is empty")
+			}
+		})
+	}
+}
+
+func TestHistoricalDropRate(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	closes := stats.DailyCloses(daily(now, 30, 1300, -10), now.AddDate(0, 0, -30), now)
+	if rate, ok := historicalDropRate(closes, 7); !ok || rate != 100 {
+		t.Errorf("historicalDropRate(falling) = %v, %v, want 100", rate, ok)
+	}
+	closes = stats.DailyCloses(daily(now, 30, 1000, 10), now.AddDate(0, 0, -30), now)
+	if rate, ok := historicalDropRate(closes, 7); !ok || rate != 0 {
+		t.Errorf("historicalDropRate(rising) = %v, %v, want 0", rate, ok)
+	}
+	if _, ok := historicalDropRate(closes[:5], 7); ok {
+		t.Error("historicalDropRate(short) = true, want false")
+	}
+}
@@ -0,0 +1,378 @@
+// Package digest gathers what happened to the watched products over a day
+// or a week — price drops and increases, stock changes, scrape failures and
+// alerts held back from instant delivery — into one message per channel.
+package digest
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"price-watcher/money"
+)
+
+// Delivery modes of a channel.
+const (
+	// ModeInstant sends alerts as they happen and no digest.
+	ModeInstant = "instant"
+	ModeDaily   = "daily"
+	ModeWeekly  = "weekly"
+)
+
+// ParseMode reads a channel's delivery mode; "" is ModeInstant.
+func ParseMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", ModeInstant:
+		return ModeInstant, nil
+	case ModeDaily, ModeWeekly:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid digest mode %q: must be %s, %s or %s", value, ModeInstant, ModeDaily, ModeWeekly)
+}
+
+// Period returns how far back a digest of mode reaches.
+func Period(mode string) time.Duration {
+	if mode == ModeWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// RetentionDays is how long entries are kept for digests.
+const RetentionDays = 30
+
+// Kinds of Entry.
+const (
+	KindDrop         = "drop"
+	KindIncrease     = "increase"
+	KindOutOfStock   = "out_of_stock"
+	KindBackInStock  = "back_in_stock"
+	KindScrapeFailed = "scrape_failed"
+	// KindAlert is an alert held back for the digest.
+	KindAlert = "alert"
+)
+
+// Alert types, some of which can be marked urgent to bypass digests.
+const (
+	AlertLow    = "low"
+	AlertTarget = "target"
+	AlertGroup  = "group"
+	// The opt-in alerts on a product's price rising, moving much more than
+	// usual or getting back to normal after a sale.
+	AlertIncrease = "increase"
+	AlertVolatile = "volatile"
+	AlertNormal   = "normal"
+)
+
+// AlertTypes lists the alert types.
+var AlertTypes = []string{AlertLow, AlertTarget, AlertGroup, AlertIncrease, AlertVolatile, AlertNormal}
+
+// DefaultUrgent lists the alert types sent instantly unless the
+// urgent_alerts setting says otherwise.
+const DefaultUrgent = AlertTarget
+
+// ParseUrgent reads a comma-separated list of alert types, such as
+// "target, group"; "none" or "" means no urgent alerts.
+func ParseUrgent(value string) ([]string, error) {
+	var types []string
+	for _, field := range strings.Split(value, ",") {
+		switch t := strings.ToLower(strings.TrimSpace(field)); t {
+		case "", "none":
+		default:
+			if !slices.Contains(AlertTypes, t) {
+				return nil, fmt.Errorf("invalid alert type %q: must be one of %s", t, strings.Join(AlertTypes, ", "))
+			}
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+// Entry is one thing that happened to a product.
+type Entry struct {
+	Kind      string       `json:"kind"`
+	ProductID string       `json:"product_id"`
+	Product   string       `json:"product"`
+	Platform  string       `json:"platform"`
+	URL       string       `json:"url"`
+	OldPrice  *money.Money `json:"old_price,omitempty"`
+	NewPrice  *money.Money `json:"new_price,omitempty"`
+	// Detail is the scrape error of failures and the headline of alerts.
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Item is one line of a digest, summarising a product's entries of a kind.
+type Item struct {
+	ProductID string       `json:"product_id"`
+	Product   string       `json:"product"`
+	Platform  string       `json:"platform"`
+	URL       string       `json:"url"`
+	OldPrice  *money.Money `json:"old_price,omitempty"`
+	NewPrice  *money.Money `json:"new_price,omitempty"`
+	// Change is how much NewPrice differs from OldPrice, in percent.
+	Change *float64 `json:"change,omitempty"`
+	// Count is how many entries the item stands for.
+	Count  int    `json:"count"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Section is a titled list of items.
+type Section struct {
+	Title string `json:"title"`
+	Items []Item `json:"items"`
+}
+
+// Digest is the summary of a period.
+type Digest struct {
+	Mode     string    `json:"mode"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Sections []Section `json:"sections"`
+}
+
+// MaxItems is how many items a section lists before "and N more".
+const MaxItems = 20
+
+// Build summarises entries, oldest first, for the period of mode ending at
+// to. Each product's price changes count once, from the first price of the
+// period to the last, so a price that went down and back up is left out;
+// stock changes likewise count only if the product ended the period in
+// another state than it started. A drop already listed as an alert is not
+// listed again.
+func Build(entries []Entry, mode string, to time.Time) Digest {
+	d := Digest{Mode: mode, From: to.Add(-Period(mode)), To: to, Sections: []Section{}}
+
+	type stockChange struct {
+		first, last string
+		item        Item
+	}
+	prices := make(map[string]*Item)
+	stock := make(map[string]*stockChange)
+	failures := make(map[string]*Item)
+	alerted := make(map[string]money.Money)
+	var order []string
+	seen := make(map[string]bool)
+	var alerts []Item
+
+	for _, e := range entries {
+		if !seen[e.ProductID] {
+			seen[e.ProductID] = true
+			order = append(order, e.ProductID)
+		}
+		item := Item{ProductID: e.ProductID, Product: e.Product, Platform: e.Platform, URL: e.URL, Count: 1, Detail: e.Detail}
+		switch e.Kind {
+		case KindAlert:
+			item.OldPrice, item.NewPrice = e.OldPrice, e.NewPrice
+			item.Change = change(e.OldPrice, e.NewPrice)
+			alerts = append(alerts, item)
+			if e.NewPrice != nil {
+				alerted[e.ProductID] = *e.NewPrice
+			}
+		case KindDrop, KindIncrease:
+			if e.OldPrice == nil || e.NewPrice == nil {
+				continue
+			}
+			p, ok := prices[e.ProductID]
+			if !ok || !p.OldPrice.SameCurrency(*e.NewPrice) {
+				item.OldPrice, item.NewPrice, item.Detail = e.OldPrice, e.NewPrice, ""
+				prices[e.ProductID] = &item
+				continue
+			}
+			p.NewPrice = e.NewPrice
+			p.Count++
+		case KindOutOfStock, KindBackInStock:
+			if c, ok := stock[e.ProductID]; ok {
+				c.last = e.Kind
+				continue
+			}
+			item.Detail = ""
+			stock[e.ProductID] = &stockChange{first: e.Kind, last: e.Kind, item: item}
+		case KindScrapeFailed:
+			if f, ok := failures[e.ProductID]; ok {
+				f.Count++
+				f.Detail = e.Detail
+				continue
+			}
+			failures[e.ProductID] = &item
+		}
+	}
+
+	var drops, increases, outOfStock, backInStock, failed []Item
+	for _, id := range order {
+		if p, ok := prices[id]; ok {
+			p.Change = change(p.OldPrice, p.NewPrice)
+			switch cmp := p.NewPrice.Cmp(*p.OldPrice); {
+			case cmp < 0:
+				if a, ok := alerted[id]; !ok || !a.Equal(*p.NewPrice) {
+					drops = append(drops, *p)
+				}
+			case cmp > 0:
+				increases = append(increases, *p)
+			}
+		}
+		if c, ok := stock[id]; ok && c.first == c.last {
+			// Entries record changes, so a product whose first and last
+			// changes agree ended the period in another state than it
+			// started.
+			if c.last == KindOutOfStock {
+				outOfStock = append(outOfStock, c.item)
+			} else {
+				backInStock = append(backInStock, c.item)
+			}
+		}
+		if f, ok := failures[id]; ok {
+			failed = append(failed, *f)
+		}
+	}
+	sortByChange(drops)
+	sortByChange(increases)
+
+	for _, s := range []Section{
+		{"🚨 Alerts", alerts},
+		{"📉 Price drops", drops},
+		{"📈 Price increases", increases},
+		{"✅ Back in stock", backInStock},
+		{"🚫 Out of stock", outOfStock},
+		{"⚠️ Scrape failures", failed},
+	} {
+		if len(s.Items) > 0 {
+			d.Sections = append(d.Sections, s)
+		}
+	}
+	return d
+}
+
+// sortByChange orders items by the size of their Change, largest first.
+func sortByChange(items []Item) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Change == nil || items[j].Change == nil {
+			return items[j].Change == nil && items[i].Change != nil
+		}
+		return math.Abs(*items[i].Change) > math.Abs(*items[j].Change)
+	})
+}
+
+// change returns how much price differs from base, in percent, or nil if
+// either is missing.
+func change(base, price *money.Money) *float64 {
+	if base == nil || price == nil || base.IsZero() || !base.SameCurrency(*price) {
+		return nil
+	}
+	percent := price.Sub(*base).PercentOf(*base)
+	return &percent
+}
+
+// Empty reports whether nothing happened in the period.
+func (d Digest) Empty() bool {
+	return len(d.Sections) == 0
+}
+
+// Title names the digest, e.g. "Daily digest · Oct 18, 2026".
+func (d Digest) Title() string {
+	name := "Daily digest"
+	if d.Mode == ModeWeekly {
+		name = "Weekly digest"
+	}
+	return fmt.Sprintf("%s · %s", name, d.To.Format("Jan 02, 2006"))
+}
+
+// describe renders what an item says after the product name.
+func (it Item) describe() string {
+	var parts []string
+	if it.OldPrice != nil && it.NewPrice != nil {
+		text := fmt.Sprintf("%s → %s", it.OldPrice.Format(), it.NewPrice.Format())
+		if it.Change != nil {
+			text += fmt.Sprintf(" (%+.1f%%)", *it.Change)
+		}
+		parts = append(parts, text)
+	}
+	if it.Count > 1 {
+		parts = append(parts, fmt.Sprintf("%d times", it.Count))
+	}
+	if it.Detail != "" {
+		parts = append(parts, it.Detail)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// Text renders the digest as plain text.
+func (d Digest) Text() string {
+	var b strings.Builder
+	b.WriteString(d.Title() + "\n")
+	for _, s := range d.Sections {
+		fmt.Fprintf(&b, "\n%s (%d)\n", s.Title, len(s.Items))
+		for i, it := range s.Items {
+			if i == MaxItems {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Items)-MaxItems)
+				break
+			}
+			line := fmt.Sprintf("• %s (%s)", it.Product, it.Platform)
+			if text := it.describe(); text != "" {
+				line += ": " + text
+			}
+			b.WriteString(line + "\n")
+			if it.URL != "" {
+				b.WriteString("  " + it.URL + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// Telegram renders the digest in the HTML subset Telegram messages accept.
+func (d Digest) Telegram() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📰 <b>%s</b>\n", html.EscapeString(d.Title()))
+	for _, s := range d.Sections {
+		fmt.Fprintf(&b, "\n<b>%s (%d)</b>\n", html.EscapeString(s.Title), len(s.Items))
+		for i, it := range s.Items {
+			if i == MaxItems {
+				fmt.Fprintf(&b, "…and %d more\n", len(s.Items)-MaxItems)
+				break
+			}
+			fmt.Fprintf(&b, "• %s (%s)", link(it), html.EscapeString(it.Platform))
+			if text := it.describe(); text != "" {
+				b.WriteString(": " + html.EscapeString(text))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// HTML renders the digest as an HTML email body.
+func (d Digest) HTML() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><body style=\"font-family: sans-serif\">\n<h2>%s</h2>\n", html.EscapeString(d.Title()))
+	for _, s := range d.Sections {
+		fmt.Fprintf(&b, "<h3>%s (%d)</h3>\n<ul>\n", html.EscapeString(s.Title), len(s.Items))
+		for i, it := range s.Items {
+			if i == MaxItems {
+				fmt.Fprintf(&b, "<li>…and %d more</li>\n", len(s.Items)-MaxItems)
+				break
+			}
+			fmt.Fprintf(&b, "<li>%s (%s)", link(it), html.EscapeString(it.Platform))
+			if text := it.describe(); text != "" {
+				b.WriteString(": " + html.EscapeString(text))
+			}
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+// link renders an item's product name, linked to its page if known.
+func link(it Item) string {
+	name := html.EscapeString(it.Product)
+	if it.URL == "" {
+		return name
+	}
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(it.URL), name)
+}
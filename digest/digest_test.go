@@ -0,0 +1,122 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"price-watcher/money"
+)
+
+func inr(rupees int64) *money.Money {
+	m := money.New(rupees*100, "INR")
+	return &m
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", ModeInstant, false},
+		{"Daily", ModeDaily, false},
+		{" weekly ", ModeWeekly, false},
+		{"hourly", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseUrgent(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"none", "", false},
+		{"target, Group", "target,group", false},
+		{"increase,normal", "increase,normal", false},
+		{"target,price", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUrgent(tt.value)
+		if (err != nil) != tt.wantErr || strings.Join(got, ",") != tt.want {
+			t.Errorf("ParseUrgent(%q) = %v, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2024, 10, 20, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return now.Add(time.Duration(-hours) * time.Hour) }
+	phone := Entry{ProductID: "1", Product: "Phone", Platform: "amazon", URL: "https://www.amazon.in/dp/1"}
+	rice := Entry{ProductID: "2", Product: "Rice <5 kg>", Platform: "blinkit"}
+	soap := Entry{ProductID: "3", Product: "Soap", Platform: "zepto"}
+	tv := Entry{ProductID: "4", Product: "TV", Platform: "flipkart"}
+	with := func(e Entry, kind string, hours int, old, new *money.Money, detail string) Entry {
+		e.Kind, e.At, e.OldPrice, e.NewPrice, e.Detail = kind, at(hours), old, new, detail
+		return e
+	}
+
+	entries := []Entry{
+		// The phone drops twice, the second time alerting.
+		with(phone, KindDrop, 20, inr(1099), inr(1049), ""),
+		with(phone, KindDrop, 10, inr(1049), inr(999), ""),
+		with(phone, KindAlert, 10, inr(1049), inr(999), "lowest in 30 days"),
+		// The rice rises, and drops back: left out.
+		with(rice, KindIncrease, 18, inr(100), inr(120), ""),
+		with(rice, KindDrop, 6, inr(120), inr(100), ""),
+		// Soap rises and goes out of stock.
+		with(soap, KindIncrease, 12, inr(40), inr(50), ""),
+		with(soap, KindOutOfStock, 5, nil, nil, ""),
+		// The TV goes out of stock and comes back: left out.
+		with(tv, KindOutOfStock, 16, nil, nil, ""),
+		with(tv, KindBackInStock, 4, nil, nil, ""),
+		with(tv, KindScrapeFailed, 3, nil, nil, "timeout"),
+		with(tv, KindScrapeFailed, 2, nil, nil, "HTTP 503"),
+	}
+
+	d := Build(entries, ModeDaily, now)
+	var titles []string
+	for _, s := range d.Sections {
+		titles = append(titles, s.Title)
+	}
+	if want := "🚨 Alerts,📈 Price increases,🚫 Out of stock,⚠️ Scrape failures"; strings.Join(titles, ",") != want {
+		t.Fatalf("Build() sections = %v, want %s", titles, want)
+	}
+	if item := d.Sections[1].Items[0]; item.Product != "Soap" || item.Change == nil || *item.Change != 25 {
+		t.Errorf("Build() increase = %+v, want Soap +25%%", item)
+	}
+	if item := d.Sections[3].Items[0]; item.Count != 2 || item.Detail != "HTTP 503" {
+		t.Errorf("Build() failure = %+v, want 2 failures, last HTTP 503", item)
+	}
+
+	// Without the alert, the phone's drops count once, from ₹1,099.
+	d = Build(append(entries[:2:2], entries[3:]...), ModeWeekly, now)
+	if s := d.Sections[0]; s.Title != "📉 Price drops" || len(s.Items) != 1 || !s.Items[0].OldPrice.Equal(*inr(1099)) || s.Items[0].Count != 2 {
+		t.Errorf("Build() drops = %+v", s)
+	}
+	if !d.From.Equal(now.AddDate(0, 0, -7)) {
+		t.Errorf("Build() weekly from = %s", d.From)
+	}
+
+	text := Build(entries, ModeDaily, now).Telegram()
+	for _, want := range []string{"<b>Daily digest · Oct 20, 2024</b>", `<a href="https://www.amazon.in/dp/1">Phone</a> (amazon): ₹1049.00 → ₹999.00 (-4.8%) · lowest in 30 days`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Telegram() = %s, want it to contain %s", text, want)
+		}
+	}
+	if html := Build(entries[3:5], ModeDaily, now).HTML(); strings.Contains(html, "Rice") {
+		t.Errorf("HTML() of a round trip = %s", html)
+	}
+
+	if !Build(nil, ModeDaily, now).Empty() {
+		t.Error("Build(nil) is not empty")
+	}
+}
@@ -0,0 +1,170 @@
+// Package discount tells real price drops from fake ones: sellers often
+// raise a price shortly before a sale so that returning to the usual price
+// looks like a discount. A drop is suspicious when the new price is not
+// below the usual (median) price of recent months or only undoes a recent
+// hike.
+package discount
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+// DefaultWindows are the periods, in days, whose median price a real drop
+// must beat.
+var DefaultWindows = []int{30, 60, 90}
+
+// DefaultHikeDays is how far back a hike undone by a drop is looked for.
+const DefaultHikeDays = 30
+
+// Lookback returns how many days of history Analyze needs for windows and
+// hikeDays.
+func Lookback(windows []int, hikeDays int) int {
+	days := hikeDays
+	for _, w := range windows {
+		if w > days {
+			days = w
+		}
+	}
+	return days
+}
+
+// Median is the time-weighted median price of the last Days days.
+type Median struct {
+	Days  int         `json:"days"`
+	Price money.Money `json:"price"`
+}
+
+// Hike is a rise from From to To at At.
+type Hike struct {
+	From money.Money `json:"from"`
+	To   money.Money `json:"to"`
+	At   time.Time   `json:"at"`
+}
+
+// Sighting is the latest earlier time a price at or below the current one
+// was seen.
+type Sighting struct {
+	Price money.Money `json:"price"`
+	At    time.Time   `json:"at"`
+}
+
+// Analysis is the verdict on a price.
+type Analysis struct {
+	Price      money.Money `json:"price"`
+	Suspicious bool        `json:"suspicious"`
+	Reasons    []string    `json:"reasons"`
+	Medians    []Median    `json:"medians"`
+	Hike       *Hike       `json:"hike,omitempty"`
+	LastSeen   *Sighting   `json:"last_seen,omitempty"`
+}
+
+// Analyze judges current, the price seen at now, against history, the
+// earlier prices oldest first. Prices in another currency are ignored.
+// It flags current as suspicious when it is not below the median of one of
+// windows (days), or when it follows a hike within hikeDays and is not
+// below the price before it.
+func Analyze(history []stats.Point, current money.Money, now time.Time, windows []int, hikeDays int) Analysis {
+	points := make([]stats.Point, 0, len(history))
+	for _, p := range history {
+		if p.Price.SameCurrency(current) && p.At.Before(now) {
+			points = append(points, p)
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].At.Before(points[j].At) })
+
+	a := Analysis{Price: current, Reasons: []string{}, Medians: []Median{}}
+	for _, days := range windows {
+		median, ok := stats.WeightedMedian(points, now.AddDate(0, 0, -days), now)
+		if !ok {
+			continue
+		}
+		a.Medians = append(a.Medians, Median{Days: days, Price: median})
+		if current.Cmp(median) >= 0 {
+			a.Suspicious = true
+			a.Reasons = append(a.Reasons, fmt.Sprintf("%s is not below the %d-day median of %s", current.Format(), days, median.Format()))
+		}
+	}
+
+	if hike := recentHike(points, now.AddDate(0, 0, -hikeDays)); hike != nil && current.Cmp(hike.From) >= 0 {
+		a.Hike = hike
+		a.Suspicious = true
+		a.Reasons = append(a.Reasons, fmt.Sprintf("it follows a hike from %s to %s %s", hike.From.Format(), hike.To.Format(), Ago(now.Sub(hike.At))))
+	}
+
+	// The latest price is the one that dropped; look before it.
+	for i := len(points) - 2; i >= 0; i-- {
+		if points[i].Price.Cmp(current) <= 0 {
+			a.LastSeen = &Sighting{Price: points[i].Price, At: points[i+1].At}
+			break
+		}
+	}
+
+	return a
+}
+
+// recentHike returns the rise to the highest price seen since since, or nil
+// if prices have not risen since then.
+func recentHike(points []stats.Point, since time.Time) *Hike {
+	peak := -1
+	for i := 1; i < len(points); i++ {
+		if points[i].At.Before(since) {
+			continue
+		}
+		if peak < 0 || points[i].Price.Cmp(points[peak].Price) > 0 {
+			peak = i
+		}
+	}
+	if peak < 1 {
+		return nil
+	}
+	// The hike starts at the lowest price of the climb to the peak.
+	base := peak - 1
+	for base > 0 && points[base-1].Price.Cmp(points[base].Price) <= 0 && !points[base].At.Before(since) {
+		base--
+	}
+	if points[base].Price.Cmp(points[peak].Price) >= 0 {
+		return nil
+	}
+	return &Hike{From: points[base].Price, To: points[peak].Price, At: points[peak].At}
+}
+
+// Summary describes a suspicious analysis for an alert, such as "⚠️ Possibly
+// a fake discount: it follows a hike from ₹999 to ₹1,299 12 days ago. This
+// price was ₹999 2 weeks ago." It is "" for a real drop.
+func (a Analysis) Summary(now time.Time) string {
+	if !a.Suspicious {
+		return ""
+	}
+	summary := "⚠️ Possibly a fake discount: " + strings.Join(a.Reasons, "; ") + "."
+	if a.LastSeen != nil {
+		summary += fmt.Sprintf(" This price was %s %s.", a.LastSeen.Price.Format(), Ago(now.Sub(a.LastSeen.At)))
+	}
+	return summary
+}
+
+// Ago describes a duration in the past roughly, e.g. "3 days ago" or
+// "2 weeks ago".
+func Ago(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case days < 1:
+		return "today"
+	case days < 14:
+		return plural(days, "day")
+	case days < 60:
+		return plural(days/7, "week")
+	}
+	return plural(days/30, "month")
+}
@@ -0,0 +1,103 @@
+package discount
+
+import (
+	"testing"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	tests := []struct {
+		name       string
+		history    []stats.Point
+		current    money.Money
+		suspicious bool
+		hike       bool
+		lastSeen   int64
+	}{
+		{
+			name:    "Hike before a sale",
+			history: []stats.Point{{At: daysAgo(120), Price: inr(999)}, {At: daysAgo(7), Price: inr(1299)}},
+			current: inr(999), suspicious: true, hike: true, lastSeen: 999,
+		},
+		{
+			name:    "Real drop below the usual price",
+			history: []stats.Point{{At: daysAgo(120), Price: inr(999)}},
+			current: inr(899),
+		},
+		{
+			name:    "Drop below a hiked price but above the old one",
+			history: []stats.Point{{At: daysAgo(120), Price: inr(999)}, {At: daysAgo(20), Price: inr(1099)}, {At: daysAgo(10), Price: inr(1299)}},
+			current: inr(1049), suspicious: true, hike: true, lastSeen: 999,
+		},
+		{
+			name:    "Not below the 90-day median",
+			history: []stats.Point{{At: daysAgo(120), Price: inr(899)}, {At: daysAgo(45), Price: inr(1299)}},
+			current: inr(999), suspicious: true, lastSeen: 899,
+		},
+		{
+			name:    "Long-standing high price",
+			history: []stats.Point{{At: daysAgo(120), Price: inr(1299)}},
+			current: inr(999),
+		},
+		{
+			name:    "Other currencies ignored",
+			history: []stats.Point{{At: daysAgo(120), Price: money.New(999, "USD")}, {At: daysAgo(60), Price: inr(999)}},
+			current: inr(899),
+		},
+		{
+			name:    "No history",
+			current: inr(899),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Analyze(tt.history, tt.current, now, DefaultWindows, DefaultHikeDays)
+			if a.Suspicious != tt.suspicious {
+				t.Errorf("Analyze() suspicious = %v, want %v (%v)", a.Suspicious, tt.suspicious, a.Reasons)
+			}
+			if (a.Hike != nil) != tt.hike {
+				t.Errorf("Analyze() hike = %+v, want %v", a.Hike, tt.hike)
+			}
+			switch {
+			case tt.lastSeen == 0 && a.LastSeen != nil && tt.suspicious:
+				t.Errorf("Analyze() last seen = %+v, want none", a.LastSeen)
+			case tt.lastSeen != 0 && (a.LastSeen == nil || !a.LastSeen.Price.Equal(inr(tt.lastSeen))):
+				t.Errorf("Analyze() last seen = %+v, want ₹%d", a.LastSeen, tt.lastSeen)
+			}
+			if summary := a.Summary(now); (summary != "") != tt.suspicious {
+				t.Errorf("Summary() = %q", summary)
+			}
+		})
+	}
+}
+
+func TestAgo(t *testing.T) {
+	tests := []struct {
+		days int
+		want string
+	}{
+		{0, "today"},
+		{1, "1 day ago"},
+		{5, "5 days ago"},
+		{14, "2 weeks ago"},
+		{45, "6 weeks ago"},
+		{90, "3 months ago"},
+	}
+
+	for _, tt := range tests {
+		if got := Ago(time.Duration(tt.days) * 24 * time.Hour); got != tt.want {
+			t.Errorf("Ago(%d days) = %q, want %q", tt.days, got, tt.want)
+		}
+	}
+}
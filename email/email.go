@@ -0,0 +1,122 @@
+// Package email sends alerts and digests by SMTP.
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type Sender struct {
+	addr    string
+	auth    smtp.Auth
+	from    string
+	to      []string
+	enabled bool
+}
+
+// NewSender returns a sender delivering through the SMTP server at
+// host:port, logging in if username is set, from one address to a
+// comma-separated list. Without a host or recipients it only logs.
+func NewSender(host string, port int, username, password, from, to string) *Sender {
+	var recipients []string
+	for _, address := range strings.Split(to, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	if host == "" || len(recipients) == 0 {
+		log.Println("Email not configured - email alerts disabled")
+		return &Sender{enabled: false}
+	}
+	if from == "" {
+		from = username
+	}
+
+	s := &Sender{
+		addr:    net.JoinHostPort(host, fmt.Sprint(port)),
+		from:    from,
+		to:      recipients,
+		enabled: true,
+	}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+// Send emails subject with text as the body, and htmlBody as an HTML
+// alternative unless it is empty.
+func (s *Sender) Send(subject, text, htmlBody string) error {
+	if !s.enabled {
+		return nil
+	}
+
+	msg, err := s.message(subject, text, htmlBody, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from, s.to, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("Email sent to %s", strings.Join(s.to, ", "))
+	return nil
+}
+
+// message builds the MIME message, multipart/alternative if it has an HTML
+// body.
+func (s *Sender) message(subject, text, htmlBody string, now time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if htmlBody == "" {
+		if err := writePart(&b, "text/plain", text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+	boundary := "price-watcher-" + hex.EncodeToString(random)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{{"text/plain", text}, {"text/html", htmlBody}} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		if err := writePart(&b, part.contentType, part.body); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// writePart writes the headers and quoted-printable body of a UTF-8 part.
+func writePart(b *bytes.Buffer, contentType, body string) error {
+	fmt.Fprintf(b, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(b)
+	if _, err := w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	return w.Close()
+}
+
+func (s *Sender) IsEnabled() bool {
+	return s.enabled
+}
@@ -0,0 +1,56 @@
+package email
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	s := NewSender("smtp.example.com", 587, "watcher@example.com", "secret", "", "me@example.com, you@example.com")
+	if !s.IsEnabled() || s.from != "watcher@example.com" || len(s.to) != 2 {
+		t.Fatalf("NewSender() = %+v", s)
+	}
+
+	now := time.Date(2024, 10, 20, 9, 0, 0, 0, time.UTC)
+	raw, err := s.message("Daily digest · Oct 20", "Phone: ₹1,049.00 → ₹999.00", "<p>Phone</p>", now)
+	if err != nil {
+		t.Fatalf("message() error = %v", err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("message() is not a valid email: %v", err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Daily digest · Oct 20" {
+		t.Errorf("message() subject = %q", subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("message() content type = %q, %v", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("message() part error = %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, string(body))
+	}
+	if len(bodies) != 2 || bodies[0] != "Phone: ₹1,049.00 → ₹999.00" || bodies[1] != "<p>Phone</p>" {
+		t.Errorf("message() parts = %q", bodies)
+	}
+
+	if NewSender("", 587, "", "", "", "me@example.com").IsEnabled() {
+		t.Error("NewSender() without a host is enabled")
+	}
+}
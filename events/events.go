@@ -0,0 +1,299 @@
+// Package events describes sale events such as Flipkart's Big Billion Days
+// or Amazon's Prime Day, which drive Indian e-commerce prices, and compares
+// a product's prices during events with its prices outside them.
+package events
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+// BeforeDays is how many days before an event its prices are compared with.
+const BeforeDays = 30
+
+// Event is a sale on Platform, or on every platform if Platform is "",
+// from the day Start to the day End inclusive. Days are dates at midnight
+// UTC.
+type Event struct {
+	ID       string
+	Name     string
+	Platform string
+	Start    time.Time
+	End      time.Time
+}
+
+type jsonEvent struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Platform string `json:"platform"`
+	StartsOn string `json:"starts_on"`
+	EndsOn   string `json:"ends_on"`
+}
+
+// MarshalJSON encodes the days as YYYY-MM-DD.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonEvent{
+		ID:       e.ID,
+		Name:     e.Name,
+		Platform: e.Platform,
+		StartsOn: e.Start.Format("2006-01-02"),
+		EndsOn:   e.End.Format("2006-01-02"),
+	})
+}
+
+// UnmarshalJSON accepts the form produced by MarshalJSON; the ID is
+// ignored.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var v jsonEvent
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	parsed, err := New(v.Name, v.Platform, v.StartsOn, v.EndsOn)
+	if err != nil {
+		return err
+	}
+	*e = parsed
+	return nil
+}
+
+// New validates and builds an event from text fields; an empty end day
+// means a one-day event.
+func New(name, platform, startsOn, endsOn string) (Event, error) {
+	e := Event{Name: strings.TrimSpace(name), Platform: strings.ToLower(strings.TrimSpace(platform))}
+	if e.Name == "" {
+		return e, fmt.Errorf("event name cannot be empty")
+	}
+	if len(e.Platform) > 50 {
+		return e, fmt.Errorf("invalid platform %q", platform)
+	}
+
+	var err error
+	if e.Start, err = time.Parse("2006-01-02", strings.TrimSpace(startsOn)); err != nil {
+		return e, fmt.Errorf("invalid starts_on %q: use YYYY-MM-DD", startsOn)
+	}
+	e.End = e.Start
+	if endsOn = strings.TrimSpace(endsOn); endsOn != "" {
+		if e.End, err = time.Parse("2006-01-02", endsOn); err != nil {
+			return e, fmt.Errorf("invalid ends_on %q: use YYYY-MM-DD", endsOn)
+		}
+	}
+	if e.End.Before(e.Start) {
+		return e, fmt.Errorf("event %q ends before it starts", e.Name)
+	}
+	return e, nil
+}
+
+// Day returns the date of t, as days are stored.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// AppliesTo reports whether the event covers platform.
+func (e Event) AppliesTo(platform string) bool {
+	return e.Platform == "" || strings.EqualFold(e.Platform, platform)
+}
+
+// Contains reports whether t falls on one of the event's days.
+func (e Event) Contains(t time.Time) bool {
+	day := Day(t)
+	return !day.Before(e.Start) && !day.After(e.End)
+}
+
+// Until returns the end of the event's last day.
+func (e Event) Until() time.Time {
+	return e.End.AddDate(0, 0, 1)
+}
+
+// String describes the event, e.g. "Big Billion Days (flipkart, Sep 27 –
+// Oct 06, 2024)".
+func (e Event) String() string {
+	platform := e.Platform
+	if platform == "" {
+		platform = "all platforms"
+	}
+	return fmt.Sprintf("%s (%s, %s – %s)", e.Name, platform, e.Start.Format("Jan 02"), e.End.Format("Jan 02, 2006"))
+}
+
+// Active returns the events covering platform at t; an empty platform
+// matches every event.
+func Active(events []Event, platform string, t time.Time) []Event {
+	active := []Event{}
+	for _, e := range events {
+		if e.Contains(t) && (platform == "" || e.AppliesTo(platform)) {
+			active = append(active, e)
+		}
+	}
+	return active
+}
+
+// ReadCSV reads events from CSV with a name,platform,starts_on[,ends_on]
+// header, e.g. "Big Billion Days,flipkart,2024-09-27,2024-10-06". An empty
+// platform means every platform.
+func ReadCSV(r io.Reader) ([]Event, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "starts_on"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("events CSV has no %s column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var events []Event
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read events: %w", err)
+		}
+		event, err := New(field(record, "name"), field(record, "platform"), field(record, "starts_on"), field(record, "ends_on"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// EventPrices compares a product's prices during one event with the
+// BeforeDays days before it.
+type EventPrices struct {
+	Event   Event        `json:"event"`
+	Average money.Money  `json:"average"`
+	Low     money.Money  `json:"low"`
+	Before  *money.Money `json:"before,omitempty"`
+	// Change is how much Average differs from Before, in percent.
+	Change *float64 `json:"change,omitempty"`
+}
+
+// Comparison contrasts a product's daily prices on event days with its
+// prices on other days.
+type Comparison struct {
+	EventDays      int          `json:"event_days"`
+	RegularDays    int          `json:"regular_days"`
+	EventAverage   *money.Money `json:"event_average,omitempty"`
+	RegularAverage *money.Money `json:"regular_average,omitempty"`
+	// Difference is how much EventAverage differs from RegularAverage, in
+	// percent.
+	Difference *float64 `json:"difference,omitempty"`
+	// Events holds the events the product has prices for, latest first.
+	Events []EventPrices `json:"events"`
+}
+
+// Compare contrasts the daily closing prices of points, oldest first and
+// ending with the current price, on days of the events covering platform
+// with the other days up to now. Prices in another currency than the
+// current one are ignored.
+func Compare(points []stats.Point, events []Event, platform string, now time.Time) Comparison {
+	comparison := Comparison{Events: []EventPrices{}}
+	if len(points) == 0 {
+		return comparison
+	}
+	current := points[len(points)-1].Price
+	var history []stats.Point
+	for _, p := range points {
+		if p.Price.SameCurrency(current) {
+			history = append(history, p)
+		}
+	}
+	closes := stats.DailyCloses(history, history[0].At, now)
+
+	var applicable []Event
+	for _, e := range events {
+		if e.AppliesTo(platform) {
+			applicable = append(applicable, e)
+		}
+	}
+	sort.SliceStable(applicable, func(i, j int) bool { return applicable[i].Start.After(applicable[j].Start) })
+
+	var eventSum, regularSum int64
+	for _, c := range closes {
+		if len(Active(applicable, "", c.At)) > 0 {
+			eventSum += c.Price.Amount
+			comparison.EventDays++
+		} else {
+			regularSum += c.Price.Amount
+			comparison.RegularDays++
+		}
+	}
+	comparison.EventAverage = average(eventSum, comparison.EventDays, current.Currency)
+	comparison.RegularAverage = average(regularSum, comparison.RegularDays, current.Currency)
+	comparison.Difference = change(comparison.EventAverage, comparison.RegularAverage)
+
+	for _, e := range applicable {
+		prices := EventPrices{Event: e}
+		var sum, beforeSum int64
+		var days, beforeDays int
+		before := e.Start.AddDate(0, 0, -BeforeDays)
+		for _, c := range closes {
+			day := Day(c.At)
+			switch {
+			case e.Contains(c.At):
+				if days == 0 || c.Price.Cmp(prices.Low) < 0 {
+					prices.Low = c.Price
+				}
+				sum += c.Price.Amount
+				days++
+			case !day.Before(before) && day.Before(e.Start):
+				beforeSum += c.Price.Amount
+				beforeDays++
+			}
+		}
+		if days == 0 {
+			continue
+		}
+		prices.Average = *average(sum, days, current.Currency)
+		prices.Before = average(beforeSum, beforeDays, current.Currency)
+		prices.Change = change(&prices.Average, prices.Before)
+		comparison.Events = append(comparison.Events, prices)
+	}
+
+	return comparison
+}
+
+// average returns sum / n in currency, or nil if n is zero.
+func average(sum int64, n int, currency string) *money.Money {
+	if n == 0 {
+		return nil
+	}
+	m := money.New((sum+int64(n)/2)/int64(n), currency)
+	return &m
+}
+
+// change returns how much price differs from base, in percent, or nil if
+// either is missing.
+func change(price, base *money.Money) *float64 {
+	if price == nil || base == nil || base.IsZero() {
+		return nil
+	}
+	percent := price.Sub(*base).PercentOf(*base)
+	return &percent
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name, platform, start, end string
+		wantErr                    bool
+		days                       int
+	}{
+		{"Big Billion Days", "Flipkart", "2024-09-27", "2024-10-06", false, 10},
+		{"Republic Day Sale", "", "2024-01-26", "", false, 1},
+		{"", "amazon", "2024-07-20", "2024-07-21", true, 0},
+		{"Prime Day", "amazon", "20-07-2024", "", true, 0},
+		{"Backwards", "amazon", "2024-07-21", "2024-07-20", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.name, tt.platform, tt.start, tt.end)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New() = %+v, want error", e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			if e.Platform != strings.ToLower(tt.platform) {
+				t.Errorf("New() platform = %q", e.Platform)
+			}
+			if days := int(e.Until().Sub(e.Start).Hours() / 24); days != tt.days {
+				t.Errorf("New() lasts %d days, want %d", days, tt.days)
+			}
+		})
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	e, _ := New("Prime Day", "amazon", "2024-07-20", "2024-07-21")
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"Prime Day","platform":"amazon","starts_on":"2024-07-20","ends_on":"2024-07-21"}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+	var decoded Event
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != e {
+		t.Errorf("Unmarshal() = %+v, %v, want %+v", decoded, err, e)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := `name,platform,starts_on,ends_on
+# Flipkart
+Big Billion Days,flipkart,2024-09-27,2024-10-06
+Prime Day,amazon,2024-07-20,2024-07-21
+Republic Day Sale,,2024-01-26,
+`
+	events, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadCSV() unexpected error: %v", err)
+	}
+	if len(events) != 3 || events[2].Platform != "" || !events[2].End.Equal(date("2024-01-26")) {
+		t.Errorf("ReadCSV() = %+v", events)
+	}
+
+	if _, err := ReadCSV(strings.NewReader("name,platform\nSale,amazon\n")); err == nil {
+		t.Error("ReadCSV() without starts_on = nil error")
+	}
+	if _, err := ReadCSV(strings.NewReader("name,starts_on\nSale,tomorrow\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadCSV() with a bad date = %v, want a line 2 error", err)
+	}
+}
+
+func TestActive(t *testing.T) {
+	bbd, _ := New("Big Billion Days", "flipkart", "2024-09-27", "2024-10-06")
+	all, _ := New("Diwali", "", "2024-10-30", "2024-11-01")
+	events := []Event{bbd, all}
+
+	tests := []struct {
+		platform string
+		at       time.Time
+		want     int
+	}{
+		{"flipkart", time.Date(2024, 10, 6, 23, 59, 0, 0, time.UTC), 1},
+		{"flipkart", time.Date(2024, 10, 7, 0, 0, 0, 0, time.UTC), 0},
+		{"amazon", time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), 0},
+		{"amazon", time.Date(2024, 10, 31, 12, 0, 0, 0, time.UTC), 1},
+		{"", time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), 1},
+	}
+	for _, tt := range tests {
+		if got := Active(events, tt.platform, tt.at); len(got) != tt.want {
+			t.Errorf("Active(%q, %s) = %v, want %d events", tt.platform, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+	bbd, _ := New("Big Billion Days", "flipkart", "2024-09-27", "2024-10-06")
+	prime, _ := New("Prime Day", "amazon", "2024-07-20", "2024-07-21")
+	points := []stats.Point{
+		{At: time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC), Price: inr(1000)},
+		{At: time.Date(2024, 9, 27, 0, 5, 0, 0, time.UTC), Price: inr(800)},
+		{At: time.Date(2024, 10, 7, 0, 5, 0, 0, time.UTC), Price: inr(1000)},
+	}
+
+	c := Compare(points, []Event{prime, bbd}, "flipkart", now)
+	if c.EventDays != 10 {
+		t.Errorf("Compare() event days = %d, want 10", c.EventDays)
+	}
+	if c.EventAverage == nil || !c.EventAverage.Equal(inr(800)) || c.RegularAverage == nil || !c.RegularAverage.Equal(inr(1000)) {
+		t.Errorf("Compare() averages = %v / %v, want ₹800 / ₹1000", c.EventAverage, c.RegularAverage)
+	}
+	if c.Difference == nil || math.Abs(*c.Difference+20) > 0.01 {
+		t.Errorf("Compare() difference = %v, want -20%%", c.Difference)
+	}
+	if len(c.Events) != 1 || c.Events[0].Event.Name != "Big Billion Days" {
+		t.Fatalf("Compare() events = %+v, want Big Billion Days only", c.Events)
+	}
+	e := c.Events[0]
+	if !e.Low.Equal(inr(800)) || e.Before == nil || !e.Before.Equal(inr(1000)) || e.Change == nil || math.Abs(*e.Change+20) > 0.01 {
+		t.Errorf("Compare() Big Billion Days = %+v", e)
+	}
+
+	if c := Compare(nil, []Event{bbd}, "flipkart", now); c.EventDays != 0 || len(c.Events) != 0 {
+		t.Errorf("Compare(nil) = %+v", c)
+	}
+}
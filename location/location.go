@@ -0,0 +1,108 @@
+// Package location describes where prices are checked from. Quick-commerce
+// shops price and stock items per delivery area, so a price is only
+// comparable with earlier prices seen at the same location.
+package location
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Location is a delivery location: an Indian pincode, map coordinates, or
+// both. The zero Location means the shop's default.
+type Location struct {
+	Pincode   string
+	Latitude  float64
+	Longitude float64
+}
+
+// locationRe matches "560001", "12.9716,77.5946" and "560001 12.9716,77.5946"
+// (the pincode may also be followed by "@" or ";").
+var locationRe = regexp.MustCompile(`^(?:([1-9]\d{5}))?\s*[@;]?\s*(?:(-?\d{1,2}(?:\.\d+)?)\s*,\s*(-?\d{1,3}(?:\.\d+)?))?$`)
+
+// Parse reads a location such as "560001", "12.9716,77.5946" or
+// "560001 12.9716,77.5946". Coordinates are rounded to four decimal places
+// (about 11 metres) so the same place always reads the same. An empty
+// string is the zero Location.
+func Parse(s string) (Location, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Location{}, nil
+	}
+	m := locationRe.FindStringSubmatch(s)
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return Location{}, fmt.Errorf("invalid location %q: use a pincode such as 560001, coordinates such as 12.9716,77.5946, or both", s)
+	}
+
+	loc := Location{Pincode: m[1]}
+	if m[2] != "" {
+		lat, _ := strconv.ParseFloat(m[2], 64)
+		lng, _ := strconv.ParseFloat(m[3], 64)
+		if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			return Location{}, fmt.Errorf("invalid location %q: coordinates out of range", s)
+		}
+		loc.Latitude, loc.Longitude = round(lat), round(lng)
+		if !loc.HasCoordinates() {
+			return Location{}, fmt.Errorf("invalid location %q: coordinates 0,0", s)
+		}
+	}
+	return loc, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// IsZero reports whether l is the shop's default location.
+func (l Location) IsZero() bool {
+	return l.Pincode == "" && !l.HasCoordinates()
+}
+
+// HasCoordinates reports whether l has map coordinates.
+func (l Location) HasCoordinates() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+// Coordinates returns the latitude and longitude as decimals, e.g.
+// "12.9716" and "77.5946".
+func (l Location) Coordinates() (string, string) {
+	return strconv.FormatFloat(l.Latitude, 'f', -1, 64), strconv.FormatFloat(l.Longitude, 'f', -1, 64)
+}
+
+// String returns the location in the form Parse reads, e.g. "560001",
+// "12.9716,77.5946" or "560001 12.9716,77.5946", and "" for the zero
+// Location. Price history is keyed by it.
+func (l Location) String() string {
+	parts := []string{}
+	if l.Pincode != "" {
+		parts = append(parts, l.Pincode)
+	}
+	if l.HasCoordinates() {
+		lat, lng := l.Coordinates()
+		parts = append(parts, lat+","+lng)
+	}
+	return strings.Join(parts, " ")
+}
+
+// MarshalJSON encodes the location as a string such as "560001".
+func (l Location) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON accepts the form produced by MarshalJSON.
+func (l *Location) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	loc, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*l = loc
+	return nil
+}
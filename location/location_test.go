@@ -0,0 +1,72 @@
+package location
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"560001", "560001", false},
+		{" 560001 ", "560001", false},
+		{"12.9716,77.5946", "12.9716,77.5946", false},
+		{"12.97163, 77.59456", "12.9716,77.5946", false},
+		{"560001 12.9716,77.5946", "560001 12.9716,77.5946", false},
+		{"560001@12.9716,77.5946", "560001 12.9716,77.5946", false},
+		{"-33.8688,151.2093", "-33.8688,151.2093", false},
+		{"056001", "", true},
+		{"5600011", "", true},
+		{"Bangalore", "", true},
+		{"91.0,77.5", "", true},
+		{"12.97,181", "", true},
+		{"0,0", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.input, got.String(), tt.want)
+			}
+			if again, err := Parse(got.String()); err != nil || again != got {
+				t.Errorf("Parse(%q) = %v, %v, want %v", got.String(), again, err, got)
+			}
+		})
+	}
+}
+
+func TestLocationJSON(t *testing.T) {
+	var v struct {
+		Location Location `json:"location"`
+	}
+	if err := json.Unmarshal([]byte(`{"location": "560001 12.9716,77.5946"}`), &v); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if v.Location.Pincode != "560001" || !v.Location.HasCoordinates() {
+		t.Errorf("Unmarshal() = %+v", v.Location)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"location":"560001 12.9716,77.5946"}` {
+		t.Errorf("Marshal() = %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"location": "nowhere"}`), &v); err == nil {
+		t.Error("Unmarshal() of an invalid location succeeded")
+	}
+}
@@ -2,13 +2,20 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"price-watcher/backup"
 	"price-watcher/config"
 	"price-watcher/database"
+	"price-watcher/email"
+	"price-watcher/events"
+	"price-watcher/money"
 	"price-watcher/scheduler"
 	"price-watcher/server"
 	"price-watcher/telegram"
@@ -28,20 +35,46 @@ func main() {
 	}
 	defer db.Close()
 
+	// Run a maintenance command instead of the server if one was given
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1], os.Args[2:]); err != nil {
+			db.Close()
+			log.Fatalf("%s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	// Load offline exchange rates if a file was configured
+	if cfg.ExchangeRatesFile != "" {
+		if err := loadRatesFile(db, cfg.ExchangeRatesFile); err != nil {
+			log.Printf("Failed to load exchange rates: %v", err)
+		}
+	}
+
+	// Seed sale events if a file was configured
+	if cfg.SaleEventsFile != "" {
+		if err := loadEventsFile(db, cfg.SaleEventsFile); err != nil {
+			log.Printf("Failed to load sale events: %v", err)
+		}
+	}
+
 	// Initialize Telegram bot
 	tgBot, err := telegram.NewBot(cfg.TelegramToken, cfg.TelegramChatID)
 	if err != nil {
 		log.Fatalf("Failed to initialize Telegram bot: %v", err)
 	}
 
+	// Initialize email, used if SMTP is configured
+	mailer := email.NewSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom, cfg.EmailTo)
+
 	// Initialize scheduler
-	sched := scheduler.NewScheduler(db, tgBot, cfg)
+	sched := scheduler.NewScheduler(db, tgBot, mailer, cfg)
 
 	// Start scheduler
 	sched.Start()
 
 	// Initialize and start HTTP server
-	srv := server.NewServer(db, cfg)
+	srv := server.NewServer(db, cfg, sched)
 
 	// Start server in a goroutine
 	go func() {
@@ -68,3 +101,111 @@ func main() {
 	sched.Stop()
 	log.Println("Server exited")
 }
+
+// loadRatesFile saves the rates in a base,quote,rate[,effective_date] CSV,
+// replacing stored rates for the same pairs and dates.
+func loadRatesFile(db *database.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	rates, err := money.ReadRatesCSV(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := db.SaveExchangeRates(rates); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d exchange rates from %s", len(rates), path)
+	return nil
+}
+
+// loadEventsFile saves the sale events in a name,platform,starts_on[,ends_on]
+// CSV, updating events with the same name, platform and start day.
+func loadEventsFile(db *database.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	list, err := events.ReadCSV(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := db.SaveEvents(list); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d sale events from %s", len(list), path)
+	return nil
+}
+
+func runCommand(db *database.DB, command string, args []string) error {
+	switch command {
+	case "backup":
+		return runBackup(db, args)
+	case "restore":
+		return runRestore(db, args)
+	default:
+		return fmt.Errorf("unknown command %q (usage: price-watcher [backup [file] | restore <file>])", command)
+	}
+}
+
+// runBackup writes an archive to the given file, a timestamped file in the
+// current directory, or stdout for "-".
+func runBackup(db *database.DB, args []string) error {
+	path := fmt.Sprintf("price-watcher-%s.pwbak", time.Now().Format("20060102-150405"))
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	summary, err := backup.Write(out, db)
+	if err != nil {
+		if path != "-" {
+			os.Remove(path)
+		}
+		return err
+	}
+
+	log.Printf("Backup written to %s (schema version %d): %v", path, summary.SchemaVersion, summary.Counts)
+	return nil
+}
+
+// runRestore loads an archive from the given file, or stdin for "-".
+func runRestore(db *database.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: price-watcher restore <file>")
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	summary, err := backup.Restore(in, db)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Restored backup from %s (schema version %d): %v", args[0], summary.SchemaVersion, summary.Counts)
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package matcher suggests listings on different platforms that are likely
+// the same item, comparing the brand, model numbers, pack sizes and words of
+// their titles.
+package matcher
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"price-watcher/packsize"
+)
+
+// DefaultMinScore is the lowest confidence worth suggesting.
+const DefaultMinScore = 0.5
+
+// Item is a listing to match.
+type Item struct {
+	ID       string `json:"id"`
+	Platform string `json:"platform"`
+	Title    string `json:"title"`
+	// GroupID is the group the listing already belongs to, if any.
+	GroupID string `json:"group_id,omitempty"`
+}
+
+// Suggestion proposes that A and B are the same item.
+type Suggestion struct {
+	A       Item     `json:"a"`
+	B       Item     `json:"b"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// Score weights. Word overlap carries most of the score; a shared brand,
+// model number or pack size adds to it.
+const (
+	wordWeight  = 0.6
+	brandWeight = 0.15
+	modelWeight = 0.25
+	sizeWeight  = 0.1
+)
+
+// features are the parts of a title that identify an item.
+type features struct {
+	brand  string
+	models map[string]bool
+	// sizes maps a base unit ("ml", "g", "pc", "gb", ...) to the size
+	// given in it.
+	sizes map[string]packsize.Size
+	words map[string]bool
+}
+
+// stopWords carry no information about which item a title describes.
+var stopWords = map[string]bool{
+	"a": true, "and": true, "at": true, "best": true, "buy": true, "by": true, "combo": true,
+	"delivery": true, "for": true, "free": true, "in": true, "new": true, "of": true, "offer": true,
+	"online": true, "pack": true, "pouch": true, "price": true, "set": true, "the": true, "with": true,
+}
+
+var tokenRe = regexp.MustCompile(`[a-z0-9]+(?:-[a-z0-9]+)*`)
+
+func parse(title string) features {
+	f := features{models: map[string]bool{}, sizes: map[string]packsize.Size{}, words: map[string]bool{}}
+	text := strings.ToLower(title)
+
+	for _, size := range packsize.Find(text) {
+		f.sizes[size.Unit] = size
+	}
+	text = packsize.Strip(text)
+
+	for _, token := range tokenRe.FindAllString(text, -1) {
+		// The brand usually leads the title ("Amul Taaza ...", "Buy Apple iPhone 15").
+		if f.brand == "" && !stopWords[token] && !hasDigit(token) {
+			f.brand = strings.Split(token, "-")[0]
+		}
+		switch {
+		case stopWords[token]:
+		case isModel(token):
+			f.models[strings.ReplaceAll(token, "-", "")] = true
+		default:
+			for _, word := range strings.Split(token, "-") {
+				if !stopWords[word] {
+					f.words[word] = true
+				}
+			}
+		}
+	}
+
+	return f
+}
+
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
+
+// isModel reports whether a token looks like a model number: letters and
+// digits together, such as "a2846", "sm-s921b" or "wh-1000xm5".
+func isModel(token string) bool {
+	if len(token) < 3 || !hasDigit(token) {
+		return false
+	}
+	return strings.IndexFunc(token, func(r rune) bool { return r >= 'a' && r <= 'z' }) >= 0
+}
+
+// Score returns the confidence, between 0 and 1, that two titles describe
+// the same item, with the reasons for it.
+func Score(titleA, titleB string) (float64, []string) {
+	a, b := parse(titleA), parse(titleB)
+	var reasons []string
+
+	kinds := make([]string, 0, len(a.sizes))
+	for kind := range a.sizes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	// Different pack sizes are different items however similar the names.
+	for _, kind := range kinds {
+		size, other := float64(a.sizes[kind].Amount), float64(b.sizes[kind].Amount)
+		if _, ok := b.sizes[kind]; ok && math.Abs(size-other) > 0.01*math.Max(size, other) {
+			return 0, []string{fmt.Sprintf("different %s size", kind)}
+		}
+	}
+
+	words := jaccard(a.words, b.words)
+	score := wordWeight * words
+	reasons = append(reasons, fmt.Sprintf("%.0f%% of title words shared", words*100))
+
+	if a.brand != "" && b.brand != "" {
+		if a.brand == b.brand {
+			score += brandWeight
+			reasons = append(reasons, "same brand "+a.brand)
+		} else {
+			score *= 0.5
+			reasons = append(reasons, "different brands")
+		}
+	}
+
+	if len(a.models) > 0 && len(b.models) > 0 {
+		shared := intersection(a.models, b.models)
+		if len(shared) > 0 {
+			score += modelWeight
+			reasons = append(reasons, "same model "+strings.Join(shared, ", "))
+		} else {
+			score *= 0.3
+			reasons = append(reasons, "different model numbers")
+		}
+	}
+
+	for _, kind := range kinds {
+		if _, ok := b.sizes[kind]; ok {
+			score += sizeWeight
+			reasons = append(reasons, "same size "+a.sizes[kind].String())
+			break
+		}
+	}
+
+	return math.Round(math.Min(score, 1)*100) / 100, reasons
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := len(intersection(a, b))
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func intersection(a, b map[string]bool) []string {
+	var shared []string
+	for k := range a {
+		if b[k] {
+			shared = append(shared, k)
+		}
+	}
+	sort.Strings(shared)
+	return shared
+}
+
+// Suggest scores every pair of items on different platforms and returns
+// those scoring at least minScore, best first. Pairs already in the same
+// group, or in two different groups, are left out, as are pairs for which
+// skip returns true.
+func Suggest(items []Item, minScore float64, skip func(a, b Item) bool) []Suggestion {
+	suggestions := []Suggestion{}
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			a, b := items[i], items[j]
+			if a.Platform == b.Platform || (a.GroupID != "" && b.GroupID != "") {
+				continue
+			}
+			if skip != nil && skip(a, b) {
+				continue
+			}
+			score, reasons := Score(a.Title, b.Title)
+			if score < minScore {
+				continue
+			}
+			suggestions = append(suggestions, Suggestion{A: a, B: b, Score: score, Reasons: reasons})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	return suggestions
+}
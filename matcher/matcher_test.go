@@ -0,0 +1,69 @@
+package matcher
+
+import (
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		minScore float64
+		maxScore float64
+	}{
+		{name: "Same item, different wording", a: "Amul Taaza Toned Milk 500 ml", b: "Amul Taaza Homogenised Toned Milk, 500ml Pouch", minScore: 0.6, maxScore: 1},
+		{name: "Same phone", a: "Apple iPhone 15 (128 GB) - Black", b: "APPLE iPhone 15 (Black, 128 GB)", minScore: 0.8, maxScore: 1},
+		{name: "Same model number", a: "Sony WH-1000XM5 Wireless Headphones", b: "Sony WH1000XM5 Noise Cancelling Headphones Black", minScore: 0.5, maxScore: 1},
+		{name: "Multipack equals total volume", a: "Coca-Cola 6 x 300 ml", b: "Coca Cola Soft Drink 1.8 L", minScore: 0.5, maxScore: 1},
+		{name: "Different pack size", a: "Amul Taaza Toned Milk 500 ml", b: "Amul Taaza Toned Milk 1 L", maxScore: 0},
+		{name: "Different storage", a: "Apple iPhone 15 (128 GB) - Black", b: "Apple iPhone 15 (256 GB) - Black", maxScore: 0},
+		{name: "Different model number", a: "Sony WH-1000XM5 Wireless Headphones", b: "Sony WH-1000XM4 Wireless Headphones", maxScore: 0.3},
+		{name: "Different brand and item", a: "Tata Salt 1 kg", b: "Aashirvaad Atta 1 kg", maxScore: 0.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, reasons := Score(tt.a, tt.b)
+			if score < tt.minScore || score > tt.maxScore {
+				t.Errorf("Score() = %.2f %v, want between %.2f and %.2f", score, reasons, tt.minScore, tt.maxScore)
+			}
+			if len(reasons) == 0 {
+				t.Errorf("Score() gave no reasons")
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	items := []Item{
+		{ID: "1", Platform: "blinkit", Title: "Amul Taaza Toned Milk 500 ml"},
+		{ID: "2", Platform: "zepto", Title: "Amul Taaza Toned Milk (500 ml)"},
+		{ID: "3", Platform: "blinkit", Title: "Amul Taaza Toned Milk 500ml Pouch"},
+		{ID: "4", Platform: "instamart", Title: "Amul Taaza Toned Milk 500 ml", GroupID: "g1"},
+		{ID: "5", Platform: "amazon", Title: "Amul Taaza Toned Milk 500 ml", GroupID: "g2"},
+	}
+
+	skip := func(a, b Item) bool { return a.ID == "1" && b.ID == "4" }
+	suggestions := Suggest(items, DefaultMinScore, skip)
+
+	got := map[string]bool{}
+	for _, s := range suggestions {
+		got[s.A.ID+"-"+s.B.ID] = true
+	}
+	for _, pair := range []string{"1-2", "2-3", "2-4", "1-5"} {
+		if !got[pair] {
+			t.Errorf("Suggest() missing pair %s: %+v", pair, suggestions)
+		}
+	}
+	// Same platform, skipped, and already grouped in different groups.
+	for _, pair := range []string{"1-3", "1-4", "4-5"} {
+		if got[pair] {
+			t.Errorf("Suggest() should not pair %s", pair)
+		}
+	}
+	for i := 1; i < len(suggestions); i++ {
+		if suggestions[i].Score > suggestions[i-1].Score {
+			t.Errorf("Suggest() not sorted by score: %+v", suggestions)
+		}
+	}
+}
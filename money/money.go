@@ -0,0 +1,330 @@
+// Package money represents prices exactly as an integer number of minor
+// units (paise, cents) plus an ISO 4217 currency code.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for prices whose currency is not known.
+const DefaultCurrency = "INR"
+
+// ErrOverflow is returned when an amount does not fit in an int64 of minor units.
+var ErrOverflow = errors.New("amount out of range")
+
+// Money is an exact amount of a currency.
+type Money struct {
+	Amount   int64  // minor units, e.g. paise for INR
+	Currency string // ISO 4217 code
+}
+
+// minorDigits lists currencies whose minor unit is not 1/100.
+var minorDigits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+}
+
+// MinorDigits returns the number of decimal places of currency's minor unit.
+func MinorDigits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// New returns an amount given in minor units.
+func New(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: normalizeCurrency(currency)}
+}
+
+// IsCode reports whether s looks like an ISO 4217 code: three upper-case letters.
+func IsCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// Parse reads a plain decimal such as "1999", "-12.5" or "1999.99" exactly.
+// Digits beyond the currency's minor unit are rejected rather than rounded.
+func Parse(s, currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+	digits := MinorDigits(currency)
+
+	s = strings.TrimSpace(s)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	// Trailing zeros beyond the minor unit are harmless (e.g. NUMERIC(19,4)).
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > digits {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", s, digits, currency)
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	if whole == "" {
+		whole = "0"
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return Money{}, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q: %w", s, ErrOverflow)
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// ParseRounded is Parse, but rounds extra decimal places half away from
+// zero instead of rejecting them. It suits computed values such as averages.
+func ParseRounded(s, currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+	digits := MinorDigits(currency)
+
+	trimmed := strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(trimmed, ".")
+	if len(frac) <= digits {
+		return Parse(trimmed, currency)
+	}
+
+	m, err := Parse(whole+"."+frac[:digits], currency)
+	if err != nil {
+		return Money{}, err
+	}
+	if frac[digits] >= '5' && frac[digits] <= '9' {
+		if strings.HasPrefix(whole, "-") {
+			m.Amount--
+		} else {
+			m.Amount++
+		}
+	}
+	return m, nil
+}
+
+// String returns the amount as a plain decimal, e.g. "1999.99".
+func (m Money) String() string {
+	digits := MinorDigits(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	abs := strconv.FormatUint(absUint(amount), 10)
+	if digits == 0 {
+		return sign + abs
+	}
+	if len(abs) <= digits {
+		abs = strings.Repeat("0", digits-len(abs)+1) + abs
+	}
+	return sign + abs[:len(abs)-digits] + "." + abs[len(abs)-digits:]
+}
+
+func absUint(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// symbols maps currencies to the symbol Format prefixes amounts with.
+var symbols = map[string]string{
+	"INR": "₹",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// Format returns the amount with its currency symbol (or code), e.g. "₹1999.99".
+func (m Money) Format() string {
+	s := m.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if symbol, ok := symbols[m.Currency]; ok {
+		return sign + symbol + s
+	}
+	return sign + m.Currency + " " + s
+}
+
+// Float returns an approximate float value for ratios and display only.
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(MinorDigits(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// SameCurrency reports whether m and o can be compared or combined.
+func (m Money) SameCurrency(o Money) bool {
+	return m.Currency == o.Currency
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than o.
+// Both amounts must be in the same currency.
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Equal reports whether m and o are the same amount of the same currency.
+func (m Money) Equal(o Money) bool {
+	return m.Amount == o.Amount && m.Currency == o.Currency
+}
+
+// Add returns m + o, which must be in the same currency.
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+// Sub returns m - o, which must be in the same currency.
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
+
+// In returns m in currency. An amount that was given without a currency (a
+// bare JSON number) is read in currency; one that names a different currency
+// is an error.
+func (m Money) In(currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+	switch m.Currency {
+	case currency:
+		return m, nil
+	case "":
+		return Parse(m.String(), currency)
+	default:
+		return Money{}, fmt.Errorf("amount is in %s, expected %s", m.Currency, currency)
+	}
+}
+
+// Abs returns the absolute amount.
+func (m Money) Abs() Money {
+	if m.Amount < 0 {
+		return Money{Amount: -m.Amount, Currency: m.Currency}
+	}
+	return m
+}
+
+// PercentOf returns m as a percentage of base, e.g. a drop relative to the
+// previous price.
+func (m Money) PercentOf(base Money) float64 {
+	if base.Amount == 0 {
+		return 0
+	}
+	return float64(m.Amount) * 100 / float64(base.Amount)
+}
+
+// Value stores the amount as a decimal string so NUMERIC columns receive it
+// exactly; the currency is stored in its own column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": "1999.99", "currency": "INR"} so no
+// precision is lost in clients.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.String(), Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts the object form produced by MarshalJSON as well as a
+// bare JSON number or string. Bare amounts leave Currency empty; use In to
+// read them in the currency they apply to.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = []byte(strings.TrimSpace(string(data)))
+	if len(data) == 0 {
+		return errors.New("empty money value")
+	}
+
+	switch data[0] {
+	case '{':
+		var v jsonMoney
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		parsed, err := Parse(v.Amount, v.Currency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := parseBare(s)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	default:
+		// Parse the number's literal text so no float rounding happens.
+		parsed, err := parseBare(string(data))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	}
+
+	return nil
+}
+
+// parseBare reads an amount without a currency, with at most two decimal
+// places; currencies with other minor units need the object form.
+func parseBare(s string) (Money, error) {
+	m, err := Parse(s, DefaultCurrency)
+	if err != nil {
+		return Money{}, err
+	}
+	m.Currency = ""
+	return m, nil
+}
@@ -0,0 +1,257 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		currency   string
+		wantAmount int64
+		wantError  bool
+	}{
+		{name: "Whole amount", input: "1999", currency: "INR", wantAmount: 199900},
+		{name: "Two decimals", input: "1999.99", currency: "INR", wantAmount: 199999},
+		{name: "One decimal", input: "12.5", currency: "INR", wantAmount: 1250},
+		{name: "Leading dot", input: ".5", currency: "INR", wantAmount: 50},
+		{name: "Negative", input: "-0.01", currency: "INR", wantAmount: -1},
+		{name: "Stored NUMERIC scale", input: "1999.9900", currency: "INR", wantAmount: 199999},
+		{name: "Zero decimal currency", input: "1500", currency: "JPY", wantAmount: 1500},
+		{name: "Three decimal currency", input: "1.234", currency: "KWD", wantAmount: 1234},
+		{name: "Too many decimals", input: "1.999", currency: "INR", wantError: true},
+		{name: "Decimals for JPY", input: "1500.5", currency: "JPY", wantError: true},
+		{name: "Not a number", input: "12a", currency: "INR", wantError: true},
+		{name: "Empty", input: "", currency: "INR", wantError: true},
+		{name: "Overflow", input: "99999999999999999999", currency: "INR", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.input, tt.currency)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Parse(%q) expected error, got %v", tt.input, m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			if m.Amount != tt.wantAmount || m.Currency != tt.currency {
+				t.Errorf("Parse(%q) = %+v, want %d %s", tt.input, m, tt.wantAmount, tt.currency)
+			}
+		})
+	}
+
+	if _, err := Parse("99999999999999999999", "INR"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Parse() overflow error = %v, want ErrOverflow", err)
+	}
+}
+
+func TestParseRounded(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"199.3333", "199.33"},
+		{"199.335", "199.34"},
+		{"-199.335", "-199.34"},
+		{"199.5", "199.50"},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseRounded(tt.input, "INR")
+		if err != nil {
+			t.Fatalf("ParseRounded(%q) unexpected error: %v", tt.input, err)
+		}
+		if m.String() != tt.want {
+			t.Errorf("ParseRounded(%q) = %s, want %s", tt.input, m, tt.want)
+		}
+	}
+}
+
+func TestStringAndFormat(t *testing.T) {
+	tests := []struct {
+		money      Money
+		wantString string
+		wantFormat string
+	}{
+		{New(199999, "INR"), "1999.99", "₹1999.99"},
+		{New(5, "INR"), "0.05", "₹0.05"},
+		{New(-1250, "USD"), "-12.50", "-$12.50"},
+		{New(1500, "JPY"), "1500", "¥1500"},
+		{New(1234, "KWD"), "1.234", "KWD 1.234"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.wantString {
+			t.Errorf("String() = %q, want %q", got, tt.wantString)
+		}
+		if got := tt.money.Format(); got != tt.wantFormat {
+			t.Errorf("Format() = %q, want %q", got, tt.wantFormat)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := New(199999, "INR"), New(149950, "INR")
+
+	if got := a.Sub(b); got.Amount != 50049 {
+		t.Errorf("Sub() = %v, want 500.49", got)
+	}
+	if got := a.Add(b); got.Amount != 349949 {
+		t.Errorf("Add() = %v, want 3499.49", got)
+	}
+	if a.Cmp(b) != 1 || b.Cmp(a) != -1 || a.Cmp(a) != 0 {
+		t.Errorf("Cmp() ordering is wrong")
+	}
+	if !a.Equal(New(199999, "INR")) || a.Equal(New(199999, "USD")) {
+		t.Errorf("Equal() must compare amount and currency")
+	}
+	if got := b.Sub(a).PercentOf(a); got > -25 || got < -25.1 {
+		t.Errorf("PercentOf() = %v, want about -25.02", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(New(199999, "INR"))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"amount":"1999.99","currency":"INR"}` {
+		t.Errorf("Marshal() = %s", data)
+	}
+
+	tests := []struct {
+		input string
+		want  Money
+	}{
+		{`{"amount":"1999.99","currency":"INR"}`, New(199999, "INR")},
+		{`{"amount":"12.5","currency":"usd"}`, New(1250, "USD")},
+		{`"10.10"`, Money{Amount: 1010}},
+		{`0.29`, Money{Amount: 29}},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.input), &m); err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", tt.input, err)
+		}
+		if !m.Equal(tt.want) {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.input, m, tt.want)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`1.001`), &m); err == nil {
+		t.Errorf("Unmarshal(1.001) expected error for sub-paisa amount")
+	}
+}
+
+func TestIn(t *testing.T) {
+	var bare Money
+	if err := json.Unmarshal([]byte(`1500`), &bare); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	yen, err := bare.In("JPY")
+	if err != nil || !yen.Equal(New(1500, "JPY")) {
+		t.Errorf("In(JPY) = %v, %v, want 1500 JPY", yen, err)
+	}
+	if _, err := (Money{Amount: 1050}).In("JPY"); err == nil {
+		t.Errorf("In(JPY) of 10.50 expected error")
+	}
+	if m, err := New(1050, "USD").In("usd"); err != nil || !m.Equal(New(1050, "USD")) {
+		t.Errorf("In(usd) = %v, %v, want 10.50 USD", m, err)
+	}
+	if _, err := New(1050, "USD").In("INR"); err == nil {
+		t.Errorf("In(INR) of a USD amount expected error")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	rate := func(base, quote, value, date string) ExchangeRate {
+		r, err := NewExchangeRate(base, quote, value, date)
+		if err != nil {
+			t.Fatalf("NewExchangeRate() error = %v", err)
+		}
+		return r
+	}
+	rates := NewRates([]ExchangeRate{
+		rate("USD", "INR", "80", "2024-01-01"),
+		rate("USD", "INR", "83.125", "2024-06-01"),
+		rate("EUR", "USD", "1.08", "2024-06-01"),
+	})
+
+	tests := []struct {
+		name     string
+		money    Money
+		currency string
+		on       string
+		want     string
+		wantErr  bool
+	}{
+		{name: "Direct", money: New(1000, "USD"), currency: "INR", on: "2024-07-01", want: "831.25"},
+		{name: "Older rate", money: New(1000, "USD"), currency: "INR", on: "2024-03-01", want: "800.00"},
+		{name: "Inverse", money: New(100000, "INR"), currency: "USD", on: "2024-07-01", want: "12.03"},
+		{name: "Cross rate", money: New(1000, "EUR"), currency: "INR", on: "2024-07-01", want: "897.75"},
+		{name: "No rate", money: New(1000, "USD"), currency: "JPY", on: "2024-07-01", wantErr: true},
+		{name: "Before any rate", money: New(1000, "USD"), currency: "INR", on: "2023-12-31", wantErr: true},
+		{name: "Same currency", money: New(1000, "USD"), currency: "USD", on: "2020-01-01", want: "10.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rates.Convert(tt.money, tt.currency, day(tt.on))
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoRate) {
+					t.Errorf("Convert() error = %v, want ErrNoRate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert() unexpected error: %v", err)
+			}
+			if got.String() != tt.want || got.Currency != tt.currency {
+				t.Errorf("Convert() = %s %s, want %s %s", got, got.Currency, tt.want, tt.currency)
+			}
+		})
+	}
+
+	if got, err := New(1000, "USD").Convert(big.NewRat(15512, 100), "JPY"); err != nil || !got.Equal(New(1551, "JPY")) {
+		t.Errorf("Convert() to JPY = %v, %v, want 1551 JPY", got, err)
+	}
+}
+
+func TestReadRatesCSV(t *testing.T) {
+	rates, err := ReadRatesCSV(strings.NewReader("base,quote,rate,effective_date\nusd,inr,83.12,2024-06-01\nEUR,INR,90\n"))
+	if err != nil {
+		t.Fatalf("ReadRatesCSV() error = %v", err)
+	}
+	if len(rates) != 2 || rates[0].Base != "USD" || FormatRate(rates[0].Rate) != "83.12" || rates[1].EffectiveDate.IsZero() {
+		t.Errorf("ReadRatesCSV() = %+v", rates)
+	}
+
+	for _, input := range []string{
+		"base,rate\nUSD,83",
+		"base,quote,rate\nUSD,USD,1",
+		"base,quote,rate\nUSD,INR,-1",
+		"base,quote,rate\nUSD,INR,1/3",
+		"base,quote,rate,effective_date\nUSD,INR,83,01/06/2024",
+	} {
+		if _, err := ReadRatesCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("ReadRatesCSV(%q) expected error", input)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package money
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoRate is returned when no exchange rate connects two currencies.
+var ErrNoRate = errors.New("no exchange rate")
+
+// ExchangeRate says one unit of Base is worth Rate units of Quote from
+// EffectiveDate until a later rate for the same pair takes over.
+type ExchangeRate struct {
+	Base          string
+	Quote         string
+	Rate          *big.Rat
+	EffectiveDate time.Time
+}
+
+type jsonRate struct {
+	Base          string `json:"base"`
+	Quote         string `json:"quote"`
+	Rate          string `json:"rate"`
+	EffectiveDate string `json:"effective_date"`
+}
+
+// MarshalJSON encodes the rate as a decimal string and the date as YYYY-MM-DD.
+func (r ExchangeRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRate{
+		Base:          r.Base,
+		Quote:         r.Quote,
+		Rate:          FormatRate(r.Rate),
+		EffectiveDate: r.EffectiveDate.Format("2006-01-02"),
+	})
+}
+
+// UnmarshalJSON accepts the form produced by MarshalJSON; the rate may also
+// be a JSON number and the date may be omitted (today).
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Base          string          `json:"base"`
+		Quote         string          `json:"quote"`
+		Rate          json.RawMessage `json:"rate"`
+		EffectiveDate string          `json:"effective_date"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	parsed, err := NewExchangeRate(v.Base, v.Quote, strings.Trim(string(v.Rate), `"`), v.EffectiveDate)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// NewExchangeRate validates and builds a rate from text fields. An empty
+// date means today.
+func NewExchangeRate(base, quote, rate, effectiveDate string) (ExchangeRate, error) {
+	r := ExchangeRate{
+		Base:  strings.ToUpper(strings.TrimSpace(base)),
+		Quote: strings.ToUpper(strings.TrimSpace(quote)),
+	}
+	if !IsCode(r.Base) || !IsCode(r.Quote) {
+		return r, fmt.Errorf("invalid currency pair %q/%q", base, quote)
+	}
+	if r.Base == r.Quote {
+		return r, fmt.Errorf("rate from %s to itself", r.Base)
+	}
+
+	var err error
+	if r.Rate, err = ParseRate(rate); err != nil {
+		return r, err
+	}
+
+	effectiveDate = strings.TrimSpace(effectiveDate)
+	if effectiveDate == "" {
+		r.EffectiveDate = time.Now().UTC().Truncate(24 * time.Hour)
+	} else if r.EffectiveDate, err = time.Parse("2006-01-02", effectiveDate); err != nil {
+		return r, fmt.Errorf("invalid effective_date %q: use YYYY-MM-DD", effectiveDate)
+	}
+
+	return r, nil
+}
+
+// ParseRate reads a positive decimal exchange rate such as "83.125" exactly.
+func ParseRate(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") {
+		return nil, fmt.Errorf("invalid rate %q", s)
+	}
+	if rate.Sign() <= 0 {
+		return nil, fmt.Errorf("rate %q must be positive", s)
+	}
+	return rate, nil
+}
+
+// FormatRate returns rate as a decimal with up to ten places.
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(10)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// ReadRatesCSV reads rates from CSV with a base,quote,rate[,effective_date]
+// header, e.g. "USD,INR,83.12,2024-06-01".
+func ReadRatesCSV(r io.Reader) ([]ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"base", "quote", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("rates CSV has no %s column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var rates []ExchangeRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rates: %w", err)
+		}
+		rate, err := NewExchangeRate(field(record, "base"), field(record, "quote"), field(record, "rate"), field(record, "effective_date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+// Rates looks up exchange rates by pair and date.
+type Rates struct {
+	// pairs holds each pair's rates, newest first, in both directions.
+	pairs map[[2]string][]ExchangeRate
+}
+
+// NewRates indexes rates for lookups. Each rate also serves the inverse
+// pair unless that pair has its own rate for the same day.
+func NewRates(rates []ExchangeRate) *Rates {
+	r := &Rates{pairs: make(map[[2]string][]ExchangeRate)}
+	for _, rate := range rates {
+		r.add(rate.Base, rate.Quote, rate.Rate, rate.EffectiveDate)
+	}
+	for _, rate := range rates {
+		r.add(rate.Quote, rate.Base, new(big.Rat).Inv(rate.Rate), rate.EffectiveDate)
+	}
+	for pair := range r.pairs {
+		list := r.pairs[pair]
+		sort.SliceStable(list, func(i, j int) bool { return list[i].EffectiveDate.After(list[j].EffectiveDate) })
+	}
+	return r
+}
+
+func (r *Rates) add(base, quote string, rate *big.Rat, effective time.Time) {
+	pair := [2]string{base, quote}
+	for _, existing := range r.pairs[pair] {
+		if existing.EffectiveDate.Equal(effective) {
+			return
+		}
+	}
+	r.pairs[pair] = append(r.pairs[pair], ExchangeRate{Base: base, Quote: quote, Rate: rate, EffectiveDate: effective})
+}
+
+// direct returns the newest rate for the pair effective on the given day.
+func (r *Rates) direct(base, quote string, on time.Time) (*big.Rat, bool) {
+	for _, rate := range r.pairs[[2]string{base, quote}] {
+		if !rate.EffectiveDate.After(on) {
+			return rate.Rate, true
+		}
+	}
+	return nil, false
+}
+
+// Rate returns how many units of quote one unit of base was worth on the
+// given day, using the pair directly, its inverse, or a cross rate through
+// one other currency.
+func (r *Rates) Rate(base, quote string, on time.Time) (*big.Rat, bool) {
+	if base == quote {
+		return big.NewRat(1, 1), true
+	}
+	if r == nil {
+		return nil, false
+	}
+	if rate, ok := r.direct(base, quote, on); ok {
+		return rate, true
+	}
+
+	// Try intermediates in a fixed order so results do not depend on map order.
+	var via []string
+	for pair := range r.pairs {
+		if pair[0] == base {
+			via = append(via, pair[1])
+		}
+	}
+	sort.Strings(via)
+	for _, currency := range via {
+		first, ok := r.direct(base, currency, on)
+		if !ok {
+			continue
+		}
+		if second, ok := r.direct(currency, quote, on); ok {
+			return new(big.Rat).Mul(first, second), true
+		}
+	}
+
+	return nil, false
+}
+
+// Convert returns m in currency at the rate effective on the given day,
+// rounded half away from zero to the currency's minor unit.
+func (r *Rates) Convert(m Money, currency string, on time.Time) (Money, error) {
+	currency = normalizeCurrency(currency)
+	rate, ok := r.Rate(m.Currency, currency, on)
+	if !ok {
+		return Money{}, fmt.Errorf("%w from %s to %s", ErrNoRate, m.Currency, currency)
+	}
+	return m.Convert(rate, currency)
+}
+
+// Convert returns m multiplied by rate as an amount of currency, rounded
+// half away from zero to the currency's minor unit.
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+
+	// amount in minor units of currency = m.Amount * rate * 10^(to digits - from digits)
+	value := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate)
+	shift := MinorDigits(currency) - MinorDigits(m.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		value.Mul(value, scale)
+	} else {
+		value.Quo(value, scale)
+	}
+
+	// Round half away from zero: add or subtract 1/2, then truncate.
+	half := big.NewRat(1, 2)
+	if value.Sign() < 0 {
+		value.Sub(value, half)
+	} else {
+		value.Add(value, half)
+	}
+	minor := new(big.Int).Quo(value.Num(), value.Denom())
+	if !minor.IsInt64() {
+		return Money{}, fmt.Errorf("converting %s to %s: %w", m, currency, ErrOverflow)
+	}
+
+	return Money{Amount: minor.Int64(), Currency: currency}, nil
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
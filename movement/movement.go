@@ -0,0 +1,173 @@
+// Package movement decides the opt-in alerts on price movements other than
+// drops, for products already bought or resold: a rise above a threshold,
+// prices moving much more than they usually do, and a price getting back to
+// its usual level after a sale.
+package movement
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"price-watcher/digest"
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+const (
+	// RecentDays is the period whose volatility is compared with the usual.
+	RecentDays = 7
+	// UsualDays is the period the usual price and volatility are taken from.
+	UsualDays = 90
+	// MinVolatility is the least volatility, in percent a day, alerted on
+	// however calm the price usually is.
+	MinVolatility = 1.0
+	// MinMoves is the least number of days in RecentDays the price must
+	// have changed on to count as volatile, so one step is not.
+	MinMoves = 3
+	// NormalTolerance is how far, in percent, a price may stay below the
+	// usual price and still count as back to normal.
+	NormalTolerance = 2.0
+)
+
+// Rules configure the alerts a product opted in to; zero values turn an
+// alert off.
+type Rules struct {
+	// IncreasePercent is the least rise, in percent over the previous
+	// price, alerted on.
+	IncreasePercent float64
+	// Volatility alerts when the price moved at least VolatilityFactor
+	// times as much over RecentDays as it usually does.
+	Volatility       bool
+	VolatilityFactor float64
+	// BackToNormal alerts when the price is back to its usual level after
+	// a sale of at least SalePercent below it.
+	BackToNormal bool
+	SalePercent  float64
+}
+
+// Any reports whether any alert is on.
+func (r Rules) Any() bool {
+	return r.IncreasePercent > 0 || r.Volatility || r.BackToNormal
+}
+
+// Alert is an alert raised by Check.
+type Alert struct {
+	// Type is digest.AlertIncrease, digest.AlertVolatile or
+	// digest.AlertNormal.
+	Type string
+	// Rule says why the alert was raised, e.g. "up 12.5% from ₹999.00".
+	Rule string
+	// ChangePercent is the change from the previous price.
+	ChangePercent float64
+	// Usual is the usual price, on back-to-normal alerts.
+	Usual *money.Money
+	// Volatility and UsualVolatility are the recent and usual volatility,
+	// in percent a day, on volatility alerts.
+	Volatility      float64
+	UsualVolatility float64
+}
+
+// Check returns the alert raised by a change from previous to current at
+// now, if any. history are the prices seen, oldest first, ending with
+// current; prices in another currency are ignored. A price back to normal
+// is alerted on rather than as an increase, and an increase rather than as
+// volatility.
+func (r Rules) Check(history []stats.Point, previous, current money.Money, now time.Time) (Alert, bool) {
+	if !previous.SameCurrency(current) || previous.Equal(current) || previous.Amount == 0 {
+		return Alert{}, false
+	}
+	var points []stats.Point
+	for _, p := range history {
+		if p.Price.SameCurrency(current) && !p.At.After(now) {
+			points = append(points, p)
+		}
+	}
+	change := current.Sub(previous).PercentOf(previous)
+
+	if r.BackToNormal {
+		if alert, ok := r.backToNormal(points, current); ok {
+			alert.ChangePercent = change
+			return alert, true
+		}
+	}
+
+	if r.IncreasePercent > 0 && change >= r.IncreasePercent {
+		return Alert{
+			Type:          digest.AlertIncrease,
+			Rule:          fmt.Sprintf("up %.1f%% from %s", change, previous.Format()),
+			ChangePercent: change,
+		}, true
+	}
+
+	if r.Volatility {
+		closes := stats.DailyCloses(points, now.AddDate(0, 0, -(UsualDays+RecentDays)), now)
+		if len(closes) > 2*RecentDays+1 {
+			recentCloses := closes[len(closes)-RecentDays-1:]
+			recent := stats.Volatility(recentCloses)
+			usual := stats.Volatility(closes[:len(closes)-RecentDays])
+			if moves(recentCloses) >= MinMoves && recent >= MinVolatility && recent >= r.VolatilityFactor*usual {
+				return Alert{
+					Type:            digest.AlertVolatile,
+					Rule:            fmt.Sprintf("moving %.1f%% a day over %d days, against %.1f%% usually", recent, RecentDays, usual),
+					ChangePercent:   change,
+					Volatility:      recent,
+					UsualVolatility: usual,
+				}, true
+			}
+		}
+	}
+
+	return Alert{}, false
+}
+
+// backToNormal checks whether current ends a sale: a run of prices below
+// the usual price, reaching at least SalePercent below it, just before it.
+// The usual price is the time-weighted median of the UsualDays before the
+// sale.
+func (r Rules) backToNormal(points []stats.Point, current money.Money) (Alert, bool) {
+	if len(points) < 2 {
+		return Alert{}, false
+	}
+
+	// The usual price is that before the prices leading up to current
+	// started dropping; walk back over them to find when.
+	start := len(points) - 1
+	low := points[start-1].Price
+	for start > 0 && points[start-1].Price.Cmp(current) < 0 {
+		start--
+		if points[start].Price.Cmp(low) < 0 {
+			low = points[start].Price
+		}
+	}
+	if start == len(points)-1 || start == 0 {
+		return Alert{}, false
+	}
+	saleStart := points[start].At
+	usual, ok := stats.WeightedMedian(points[:start+1], saleStart.AddDate(0, 0, -UsualDays), saleStart)
+	if !ok {
+		return Alert{}, false
+	}
+
+	normal := money.New(int64(math.Round(float64(usual.Amount)*(1-NormalTolerance/100))), usual.Currency)
+	sale := money.New(int64(math.Round(float64(usual.Amount)*(1-r.SalePercent/100))), usual.Currency)
+	if current.Cmp(normal) < 0 || low.Cmp(sale) > 0 || points[len(points)-2].Price.Cmp(normal) >= 0 {
+		return Alert{}, false
+	}
+	return Alert{
+		Type:  digest.AlertNormal,
+		Rule:  fmt.Sprintf("back to the usual %s after a sale at %s", usual.Format(), low.Format()),
+		Usual: &usual,
+	}, true
+}
+
+// moves returns how many of closes differ from the one before.
+func moves(closes []stats.Point) int {
+	n := 0
+	for i := 1; i < len(closes); i++ {
+		if !closes[i].Price.Equal(closes[i-1].Price) {
+			n++
+		}
+	}
+	return n
+}
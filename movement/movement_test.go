@@ -0,0 +1,84 @@
+package movement
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"price-watcher/digest"
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+// daily returns one point a day ending at now with the given prices.
+func daily(now time.Time, prices ...int64) []stats.Point {
+	points := make([]stats.Point, len(prices))
+	for i, price := range prices {
+		points[i] = stats.Point{At: now.AddDate(0, 0, i-len(prices)+1), Price: inr(price)}
+	}
+	return points
+}
+
+// repeat returns price n times.
+func repeat(price int64, n int) []int64 {
+	prices := make([]int64, n)
+	for i := range prices {
+		prices[i] = price
+	}
+	return prices
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+	all := Rules{IncreasePercent: 10, Volatility: true, VolatilityFactor: 2, BackToNormal: true, SalePercent: 10}
+
+	calm := repeat(1000, 60)
+	sale := append(append(repeat(1000, 60), 800, 800, 800), 1000)
+	stepped := append(append(repeat(1000, 60), 800, 950), 995)
+	shallow := append(append(repeat(1000, 60), 950, 950), 1000)
+	swings := append(repeat(1000, 60), 1000, 1100, 950, 1080, 940, 1090, 960, 1000)
+
+	tests := []struct {
+		name     string
+		rules    Rules
+		history  []stats.Point
+		previous int64
+		want     string
+		wantRule string
+	}{
+		{"rise above the threshold", all, daily(now, append(calm, 1150)...), 1000, digest.AlertIncrease, "up 15.0% from ₹1000.00"},
+		{"rise below the threshold", all, daily(now, append(calm, 1050)...), 1000, "", ""},
+		{"increase alerts off", Rules{Volatility: true, VolatilityFactor: 2}, daily(now, append(calm, 1150)...), 1000, "", ""},
+		{"drop", all, daily(now, append(calm, 900)...), 1000, "", ""},
+		{"back to normal after a sale", all, daily(now, sale...), 800, digest.AlertNormal, "back to the usual ₹1000.00 after a sale at ₹800.00"},
+		{"back to normal in steps", all, daily(now, stepped...), 950, digest.AlertNormal, "after a sale at ₹800.00"},
+		{"sale too shallow", Rules{BackToNormal: true, SalePercent: 10}, daily(now, shallow...), 950, "", ""},
+		{"back to normal alerts off", Rules{IncreasePercent: 10}, daily(now, sale...), 800, digest.AlertIncrease, "up 25.0%"},
+		{"volatile week", all, daily(now, swings...), 960, digest.AlertVolatile, "over 7 days, against 0.0% usually"},
+		{"volatility alerts off", Rules{IncreasePercent: 50}, daily(now, swings...), 960, "", ""},
+		{"too little history for volatility", all, daily(now, 1000, 1100, 950, 1080, 940, 1090, 960, 1020), 960, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.history[len(tt.history)-1].Price
+			got, ok := tt.rules.Check(tt.history, inr(tt.previous), current, now)
+			if ok != (tt.want != "") || got.Type != tt.want || !strings.Contains(got.Rule, tt.wantRule) {
+				t.Errorf("Check() = %+v, %v; want %q with rule %q", got, ok, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestCheckIgnoresOtherCurrencies(t *testing.T) {
+	now := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+	rules := Rules{IncreasePercent: 10}
+	history := daily(now, 1000, 1150)
+	if _, ok := rules.Check(history, money.New(1199, "USD"), inr(1150), now); ok {
+		t.Error("Check() alerted on a change from another currency")
+	}
+}
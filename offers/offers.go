@@ -0,0 +1,306 @@
+// Package offers reads the coupons and bank card offers shops show next to
+// a price, such as "Apply ₹500 coupon" or "10% Instant Discount up to ₹1,500
+// on HDFC Bank Credit Card Transactions", and works out the effective price:
+// what a product costs once the offers the buyer can use are applied.
+package offers
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"price-watcher/money"
+)
+
+// Offer kinds.
+const (
+	// Coupon offers can be applied by anyone.
+	Coupon = "coupon"
+	// Bank offers need a card from Bank.
+	Bank = "bank"
+)
+
+// Card types. An offer or card with no type covers both.
+const (
+	Credit = "credit"
+	Debit  = "debit"
+)
+
+// Offer is a coupon or bank offer. It takes Percent off the price, at most
+// Cap, or a flat Flat off, and applies only from MinSpend.
+type Offer struct {
+	Kind     string       `json:"kind"`
+	Text     string       `json:"text"`
+	Percent  float64      `json:"percent,omitempty"`
+	Flat     *money.Money `json:"flat,omitempty"`
+	Cap      *money.Money `json:"cap,omitempty"`
+	MinSpend *money.Money `json:"min_spend,omitempty"`
+	Bank     string       `json:"bank,omitempty"`
+	CardType string       `json:"card_type,omitempty"`
+}
+
+// Card is a payment card the buyer holds.
+type Card struct {
+	Bank string
+	Type string
+}
+
+// banks maps the ways shops name card issuers to one name each, co-branded
+// cards first so "Flipkart Axis Bank" is not read as any Axis card.
+var banks = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"Amazon Pay ICICI", regexp.MustCompile(`(?i)\bamazon\s*pay\s+icici\b`)},
+	{"Flipkart Axis", regexp.MustCompile(`(?i)\bflipkart\s+axis\b`)},
+	{"HDFC", regexp.MustCompile(`(?i)\bhdfc\b`)},
+	{"ICICI", regexp.MustCompile(`(?i)\bicici\b`)},
+	{"SBI", regexp.MustCompile(`(?i)\bsbi\b`)},
+	{"Axis", regexp.MustCompile(`(?i)\baxis\b`)},
+	{"Kotak", regexp.MustCompile(`(?i)\bkotak\b`)},
+	{"IDFC First", regexp.MustCompile(`(?i)\bidfc\b`)},
+	{"IndusInd", regexp.MustCompile(`(?i)\bindusind\b`)},
+	{"Yes Bank", regexp.MustCompile(`(?i)\byes\s+bank\b`)},
+	{"RBL", regexp.MustCompile(`(?i)\brbl\b`)},
+	{"AU", regexp.MustCompile(`(?i)\bau\s+(?:small\s+finance\s+)?bank\b`)},
+	{"Bank of Baroda", regexp.MustCompile(`(?i)\b(?:bank\s+of\s+baroda|bob(?:card)?)\b`)},
+	{"Federal", regexp.MustCompile(`(?i)\bfederal\b`)},
+	{"HSBC", regexp.MustCompile(`(?i)\bhsbc\b`)},
+	{"Citi", regexp.MustCompile(`(?i)\bciti(?:bank)?\b`)},
+	{"Standard Chartered", regexp.MustCompile(`(?i)\bstandard\s+chartered\b`)},
+	{"Amex", regexp.MustCompile(`(?i)\b(?:amex|american\s+express)\b`)},
+	{"OneCard", regexp.MustCompile(`(?i)\bone\s*card\b`)},
+	{"Canara", regexp.MustCompile(`(?i)\bcanara\b`)},
+	{"PNB", regexp.MustCompile(`(?i)\b(?:pnb|punjab\s+national)\b`)},
+}
+
+// findBank returns the card issuer named in text, or "".
+func findBank(text string) string {
+	for _, b := range banks {
+		if b.re.MatchString(text) {
+			return b.name
+		}
+	}
+	return ""
+}
+
+// cardType returns the card type text limits itself to, or "" for both.
+func cardType(text string) string {
+	lower := strings.ToLower(text)
+	credit, debit := strings.Contains(lower, "credit"), strings.Contains(lower, "debit")
+	switch {
+	case credit && !debit:
+		return Credit
+	case debit && !credit:
+		return Debit
+	}
+	return ""
+}
+
+const amountPattern = `(?:₹|rs\.?|inr|€|£|\$)\s*([0-9][0-9,]*(?:\.[0-9]+)?)`
+
+var (
+	percentRe = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+	amountRe  = regexp.MustCompile(`(?i)` + amountPattern)
+	capRe     = regexp.MustCompile(`(?i)up\s*to\s*` + amountPattern)
+	minRe     = regexp.MustCompile(`(?i)(?:min(?:imum)?\.?|above|over)\s*(?:purchase|order|cart|txn|transaction|spend)?\s*(?:value|amount)?\s*(?:of)?[:\s]*` + amountPattern)
+	emiRe     = regexp.MustCompile(`(?i)\bemi\b`)
+	nonEMIRe  = regexp.MustCompile(`(?i)\bnon[\s-]?emi\b`)
+)
+
+// Parse reads an offer from text shown on a product page, with amounts in
+// currency. It reports false for text that is not a coupon or card offer
+// with a discount, and for offers only on EMI purchases.
+func Parse(text, currency string) (Offer, bool) {
+	text = strings.Join(strings.Fields(text), " ")
+	offer := Offer{Text: text}
+	switch bank := findBank(text); {
+	case strings.Contains(strings.ToLower(text), "coupon"):
+		offer.Kind = Coupon
+	case bank != "":
+		if emiRe.MatchString(text) && !nonEMIRe.MatchString(text) {
+			return Offer{}, false
+		}
+		offer.Kind, offer.Bank, offer.CardType = Bank, bank, cardType(text)
+	default:
+		return Offer{}, false
+	}
+
+	amount := func(s string) *money.Money {
+		m, err := money.Parse(strings.ReplaceAll(s, ",", ""), currency)
+		if err != nil || m.Amount <= 0 {
+			return nil
+		}
+		return &m
+	}
+	var skip []int
+	if m := capRe.FindStringSubmatchIndex(text); m != nil {
+		offer.Cap = amount(text[m[2]:m[3]])
+		skip = append(skip, m[2])
+	}
+	if m := minRe.FindStringSubmatchIndex(text); m != nil {
+		offer.MinSpend = amount(text[m[2]:m[3]])
+		skip = append(skip, m[2])
+	}
+
+	if m := percentRe.FindStringSubmatch(text); m != nil {
+		offer.Percent, _ = strconv.ParseFloat(m[1], 64)
+		if offer.Percent <= 0 || offer.Percent > 100 {
+			return Offer{}, false
+		}
+		return offer, true
+	}
+	for _, m := range amountRe.FindAllStringSubmatchIndex(text, -1) {
+		if !contains(skip, m[2]) {
+			offer.Flat, offer.Cap = amount(text[m[2]:m[3]]), nil
+			break
+		}
+	}
+	if offer.Flat == nil {
+		return Offer{}, false
+	}
+	return offer, true
+}
+
+func contains(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAll reads the offers among texts, dropping duplicates and text that
+// is not an offer.
+func ParseAll(texts []string, currency string) []Offer {
+	seen := make(map[string]bool)
+	offers := []Offer{}
+	for _, text := range texts {
+		offer, ok := Parse(text, currency)
+		if !ok || seen[offer.Text] {
+			continue
+		}
+		seen[offer.Text] = true
+		offers = append(offers, offer)
+	}
+	return offers
+}
+
+// Discount returns how much the offer takes off price: zero if price is
+// below its minimum spend or in another currency.
+func (o Offer) Discount(price money.Money) money.Money {
+	zero := money.New(0, price.Currency)
+	for _, m := range []*money.Money{o.Flat, o.Cap, o.MinSpend} {
+		if m != nil && !m.SameCurrency(price) {
+			return zero
+		}
+	}
+	if o.MinSpend != nil && price.Cmp(*o.MinSpend) < 0 {
+		return zero
+	}
+
+	discount := zero
+	switch {
+	case o.Percent > 0:
+		discount = money.New(int64(math.Floor(float64(price.Amount)*o.Percent/100)), price.Currency)
+		if o.Cap != nil && discount.Cmp(*o.Cap) > 0 {
+			discount = *o.Cap
+		}
+	case o.Flat != nil:
+		discount = *o.Flat
+	}
+	if discount.Cmp(price) > 0 {
+		return price
+	}
+	return discount
+}
+
+// Usable reports whether a buyer holding cards can use the offer: coupons
+// always, bank offers with a card from the bank of the right type.
+func (o Offer) Usable(cards []Card) bool {
+	if o.Kind != Bank {
+		return true
+	}
+	for _, card := range cards {
+		if card.Bank == o.Bank && (o.CardType == "" || card.Type == "" || card.Type == o.CardType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Effective returns price after the best coupon and then the best bank
+// offer for cards, which shops let be combined, and the offers applied.
+func Effective(price money.Money, available []Offer, cards []Card) (money.Money, []Offer) {
+	applied := []Offer{}
+	for _, kind := range []string{Coupon, Bank} {
+		best, bestDiscount := -1, money.New(0, price.Currency)
+		for i, offer := range available {
+			if offer.Kind != kind || !offer.Usable(cards) {
+				continue
+			}
+			if discount := offer.Discount(price); discount.Cmp(bestDiscount) > 0 {
+				best, bestDiscount = i, discount
+			}
+		}
+		if best >= 0 {
+			price = price.Sub(bestDiscount)
+			applied = append(applied, available[best])
+		}
+	}
+	return price, applied
+}
+
+// ParseCard reads a card such as "HDFC Credit" or "SBI debit card"; a card
+// given without a type matches offers for either.
+func ParseCard(s string) (Card, error) {
+	bank := findBank(s)
+	if bank == "" {
+		return Card{}, fmt.Errorf("unknown card issuer in %q", strings.TrimSpace(s))
+	}
+	return Card{Bank: bank, Type: cardType(s)}, nil
+}
+
+// ParseCards reads a comma-separated list of cards such as
+// "HDFC Credit, ICICI Debit", dropping duplicates.
+func ParseCards(s string) ([]Card, error) {
+	cards := []Card{}
+	seen := make(map[Card]bool)
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		card, err := ParseCard(part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[card] {
+			seen[card] = true
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+// String returns the card in the form ParseCard reads, e.g. "HDFC Credit".
+func (c Card) String() string {
+	switch c.Type {
+	case Credit:
+		return c.Bank + " Credit"
+	case Debit:
+		return c.Bank + " Debit"
+	}
+	return c.Bank
+}
+
+// FormatCards returns cards in the form ParseCards reads.
+func FormatCards(cards []Card) string {
+	names := make([]string, len(cards))
+	for i, card := range cards {
+		names[i] = card.String()
+	}
+	return strings.Join(names, ", ")
+}
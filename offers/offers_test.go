@@ -0,0 +1,141 @@
+package offers
+
+import (
+	"testing"
+
+	"price-watcher/money"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text     string
+		ok       bool
+		kind     string
+		percent  float64
+		flat     int64
+		cap      int64
+		minSpend int64
+		bank     string
+		cardType string
+	}{
+		{text: "Apply ₹500 coupon", ok: true, kind: Coupon, flat: 500},
+		{text: "Save 5% with coupon", ok: true, kind: Coupon, percent: 5},
+		{text: "Apply ₹150 coupon on orders above ₹999", ok: true, kind: Coupon, flat: 150, minSpend: 999},
+		{text: "10% Instant Discount up to ₹1,500 on HDFC Bank Credit Card Transactions. Min purchase value ₹5,000",
+			ok: true, kind: Bank, percent: 10, cap: 1500, minSpend: 5000, bank: "HDFC", cardType: Credit},
+		{text: "Bank Offer Flat ₹1,000 off on ICICI Bank Credit and Debit Cards", ok: true, kind: Bank, flat: 1000, bank: "ICICI"},
+		{text: "Bank Offer5% Cashback on Flipkart Axis Bank Card", ok: true, kind: Bank, percent: 5, bank: "Flipkart Axis"},
+		{text: "Rs. 750 off on SBI Debit Card, Min Txn Value: Rs. 4,999", ok: true, kind: Bank, flat: 750, minSpend: 4999, bank: "SBI", cardType: Debit},
+		{text: "10% off on HDFC Bank Credit Card EMI Transactions", ok: false},
+		{text: "10% off on HDFC Bank Credit Card Non-EMI Transactions", ok: true, kind: Bank, percent: 10, bank: "HDFC", cardType: Credit},
+		{text: "Special Price Get extra 20% off", ok: false},
+		{text: "Partner Offer: Buy this and get Google Nest Hub for ₹4,999", ok: false},
+		{text: "Coupon available", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := Parse(tt.text, "INR")
+			if ok != tt.ok {
+				t.Fatalf("Parse(%q) ok = %v, want %v (%+v)", tt.text, ok, tt.ok, got)
+			}
+			if !ok {
+				return
+			}
+			if got.Kind != tt.kind || got.Percent != tt.percent || got.Bank != tt.bank || got.CardType != tt.cardType {
+				t.Errorf("Parse(%q) = %+v", tt.text, got)
+			}
+			for _, amount := range []struct {
+				name string
+				got  *money.Money
+				want int64
+			}{{"flat", got.Flat, tt.flat}, {"cap", got.Cap, tt.cap}, {"min spend", got.MinSpend, tt.minSpend}} {
+				switch {
+				case amount.want == 0 && amount.got != nil:
+					t.Errorf("Parse(%q) %s = %s, want none", tt.text, amount.name, amount.got)
+				case amount.want != 0 && (amount.got == nil || !amount.got.Equal(inr(amount.want))):
+					t.Errorf("Parse(%q) %s = %v, want ₹%d", tt.text, amount.name, amount.got, amount.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEffective(t *testing.T) {
+	available := ParseAll([]string{
+		"Apply ₹500 coupon",
+		"Apply ₹200 coupon",
+		"10% Instant Discount up to ₹1,500 on HDFC Bank Credit Card Transactions. Min purchase value ₹5,000",
+		"Flat ₹750 off on SBI Debit Card",
+		"Flat ₹750 off on SBI Debit Card",
+		"Special Price Get extra 20% off",
+	}, "INR")
+	if len(available) != 4 {
+		t.Fatalf("ParseAll() = %d offers, want 4", len(available))
+	}
+
+	tests := []struct {
+		name    string
+		price   money.Money
+		cards   []Card
+		want    money.Money
+		applied int
+	}{
+		{"coupon only", inr(20000), nil, inr(19500), 1},
+		{"coupon and capped bank offer", inr(20000), []Card{{Bank: "HDFC", Type: Credit}}, inr(18000), 2},
+		{"percent bank offer", inr(9000), []Card{{Bank: "HDFC"}}, inr(7650), 2},
+		{"below minimum spend", inr(5400), []Card{{Bank: "HDFC", Type: Credit}}, inr(4900), 1},
+		{"wrong card type", inr(20000), []Card{{Bank: "HDFC", Type: Debit}}, inr(19500), 1},
+		{"best of several cards", inr(6000), []Card{{Bank: "HDFC", Type: Credit}, {Bank: "SBI", Type: Debit}}, inr(4750), 2},
+		{"never below zero", inr(400), nil, inr(0), 1},
+		{"other currency", money.New(20000, "USD"), []Card{{Bank: "HDFC"}}, money.New(20000, "USD"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied := Effective(tt.price, available, tt.cards)
+			if !got.Equal(tt.want) {
+				t.Errorf("Effective(%s) = %s, want %s", tt.price, got, tt.want)
+			}
+			if len(applied) != tt.applied {
+				t.Errorf("Effective(%s) applied %d offers, want %d", tt.price, len(applied), tt.applied)
+			}
+		})
+	}
+}
+
+func TestParseCards(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"hdfc credit card, icici debit", "HDFC Credit, ICICI Debit", false},
+		{"SBI; Amazon Pay ICICI Credit", "SBI, Amazon Pay ICICI Credit", false},
+		{"HDFC Credit, hdfc credit", "HDFC Credit", false},
+		{"Acme Bank Credit", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			cards, err := ParseCards(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseCards(%q) = %v, want error", tt.input, cards)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCards(%q) unexpected error: %v", tt.input, err)
+			}
+			if got := FormatCards(cards); got != tt.want {
+				t.Errorf("ParseCards(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Package outbox decides when a failed alert delivery is retried and when
+// it is given up on and dead-lettered.
+package outbox
+
+import "time"
+
+// MaxBackoff caps the wait between two attempts.
+const MaxBackoff = time.Hour
+
+// Policy configures retries of failed deliveries.
+type Policy struct {
+	// MaxAttempts is how many attempts a delivery gets; fewer than 1 means
+	// one.
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt, doubling after
+	// each further one up to MaxBackoff.
+	Backoff time.Duration
+}
+
+// Retry returns how long to wait before the next attempt at a delivery
+// that failed its attempts-th attempt, or dead if it is out of attempts.
+func (p Policy) Retry(attempts int) (wait time.Duration, dead bool) {
+	if attempts >= p.MaxAttempts {
+		return 0, true
+	}
+	wait = p.Backoff
+	for i := 1; i < attempts && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, MaxBackoff), false
+}
@@ -0,0 +1,34 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	policy := Policy{MaxAttempts: 10, Backoff: time.Minute}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		attempts int
+		wait     time.Duration
+		dead     bool
+	}{
+		{"first failure", policy, 1, time.Minute, false},
+		{"doubles", policy, 2, 2 * time.Minute, false},
+		{"keeps doubling", policy, 4, 8 * time.Minute, false},
+		{"capped", policy, 9, MaxBackoff, false},
+		{"out of attempts", policy, 10, 0, true},
+		{"a single attempt", Policy{Backoff: time.Minute}, 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, dead := tt.policy.Retry(tt.attempts)
+			if wait != tt.wait || dead != tt.dead {
+				t.Errorf("Retry(%d) = %v, %v; want %v, %v", tt.attempts, wait, dead, tt.wait, tt.dead)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package packsize reads pack sizes such as "500 g", "1.5 L" or "6 x 200 ml"
+// from product text and turns prices into prices per kilogram, litre or
+// piece so differently sized packs can be compared.
+package packsize
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"price-watcher/money"
+)
+
+// Base units sizes are kept in.
+const (
+	Grams       = "g"
+	Millilitres = "ml"
+	Pieces      = "pc"
+	// Gigabytes and MilliampHours identify items (storage, battery
+	// capacity) but are not used for unit prices.
+	Gigabytes     = "gb"
+	MilliampHours = "mah"
+)
+
+// Size is a pack size in a base unit, in thousandths of that unit so sizes
+// like 0.75 L are exact.
+type Size struct {
+	Amount int64
+	Unit   string
+}
+
+// units maps a unit as written to its base unit and the factor to it.
+var units = map[string]struct {
+	base   string
+	factor int64
+}{
+	"ml": {Millilitres, 1}, "l": {Millilitres, 1000}, "ltr": {Millilitres, 1000}, "ltrs": {Millilitres, 1000},
+	"litre": {Millilitres, 1000}, "litres": {Millilitres, 1000}, "liter": {Millilitres, 1000}, "liters": {Millilitres, 1000},
+	"g": {Grams, 1}, "gm": {Grams, 1}, "gms": {Grams, 1}, "gram": {Grams, 1}, "grams": {Grams, 1},
+	"kg": {Grams, 1000}, "kgs": {Grams, 1000},
+	"pc": {Pieces, 1}, "pcs": {Pieces, 1}, "piece": {Pieces, 1}, "pieces": {Pieces, 1},
+	"unit": {Pieces, 1}, "units": {Pieces, 1},
+	"gb": {Gigabytes, 1}, "tb": {Gigabytes, 1000},
+	"mah": {MilliampHours, 1},
+}
+
+// sizeRe matches quantities such as "500 ml", "1.5L", "2 x 200 g" or "128GB".
+var sizeRe = regexp.MustCompile(`(?i)(?:\b(\d+)\s*[x×]\s*|\b)(\d+(?:\.\d+)?)\s*(ml|ltrs?|litres?|liters?|l|kgs?|gms?|grams?|g|pcs|pieces?|pc|units?|tb|gb|mah)\b`)
+
+// packRe matches counts such as "pack of 6".
+var packRe = regexp.MustCompile(`(?i)\b(?:pack|set|combo) of (\d+)\b`)
+
+// newSize converts a quantity as written, such as "1.5" and "kg", to a Size.
+func newSize(quantity, unit string, count int64) (Size, bool) {
+	u, ok := units[strings.ToLower(unit)]
+	if !ok {
+		return Size{}, false
+	}
+	q, ok := new(big.Rat).SetString(quantity)
+	if !ok || q.Sign() <= 0 {
+		return Size{}, false
+	}
+	q.Mul(q, big.NewRat(u.factor*1000*count, 1))
+	if !q.IsInt() || !q.Num().IsInt64() {
+		return Size{}, false
+	}
+	return Size{Amount: q.Num().Int64(), Unit: u.base}, true
+}
+
+// Find returns every size mentioned in text, in order.
+func Find(text string) []Size {
+	var sizes []Size
+	for _, m := range sizeRe.FindAllStringSubmatch(text, -1) {
+		count := int64(1)
+		if m[1] != "" {
+			count, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if size, ok := newSize(m[2], m[3], count); ok {
+			sizes = append(sizes, size)
+		}
+	}
+	for _, m := range packRe.FindAllStringSubmatch(text, -1) {
+		if size, ok := newSize(m[1], Pieces, 1); ok {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// Strip returns text with every size removed.
+func Strip(text string) string {
+	return packRe.ReplaceAllString(sizeRe.ReplaceAllString(text, " "), " ")
+}
+
+// Parse returns the first size in text that unit prices can be based on:
+// a weight, a volume or a piece count.
+func Parse(text string) (Size, bool) {
+	for _, size := range Find(text) {
+		if size.Priced() {
+			return size, true
+		}
+	}
+	return Size{}, false
+}
+
+// ParseSize reads a size given on its own, such as "500 g" or "1.5 l".
+func ParseSize(s string) (Size, error) {
+	s = strings.TrimSpace(s)
+	if m := sizeRe.FindStringSubmatchIndex(s); m == nil || m[0] != 0 || m[1] != len(s) {
+		return Size{}, fmt.Errorf("invalid pack size %q: use a quantity and unit such as 500 g, 1.5 l or 6 pcs", s)
+	}
+	sizes := Find(s)
+	if len(sizes) != 1 {
+		return Size{}, fmt.Errorf("invalid pack size %q", s)
+	}
+	return sizes[0], nil
+}
+
+// NewSize builds a size from a stored quantity in the base unit, e.g.
+// "1500.000" and "g".
+func NewSize(quantity, unit string) (Size, error) {
+	size, ok := newSize(quantity, unit, 1)
+	if !ok || size.Unit != unit {
+		return Size{}, fmt.Errorf("invalid pack size %s %s", quantity, unit)
+	}
+	return size, nil
+}
+
+// Priced reports whether unit prices can be based on the size.
+func (s Size) Priced() bool {
+	return s.Amount > 0 && (s.Unit == Grams || s.Unit == Millilitres || s.Unit == Pieces)
+}
+
+// Quantity returns the size in its base unit as a decimal, e.g. "1500" or "0.5".
+func (s Size) Quantity() string {
+	q := new(big.Rat).SetFrac64(s.Amount, 1000).FloatString(3)
+	return strings.TrimSuffix(strings.TrimRight(q, "0"), ".")
+}
+
+// String returns the size in its largest whole unit, e.g. "500 g", "1.5 kg" or "6 pc".
+func (s Size) String() string {
+	switch {
+	case s.Unit == Grams && s.Amount >= 1000*1000 && s.Amount%1000 == 0:
+		return Size{Amount: s.Amount / 1000, Unit: "kg"}.String()
+	case s.Unit == Millilitres && s.Amount >= 1000*1000 && s.Amount%1000 == 0:
+		return Size{Amount: s.Amount / 1000, Unit: "l"}.String()
+	}
+	return s.Quantity() + " " + s.Unit
+}
+
+// MarshalJSON encodes the size as a string such as "500 g".
+func (s Size) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON accepts the form produced by MarshalJSON.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	size, err := ParseSize(text)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
+
+// Units unit prices are quoted per.
+const (
+	PerKilogram = "kg"
+	PerLitre    = "l"
+	PerPiece    = "pc"
+)
+
+// UnitPrice is a price per kilogram, litre or piece.
+type UnitPrice struct {
+	Price money.Money `json:"price"`
+	Per   string      `json:"per"`
+}
+
+// String returns the unit price as e.g. "₹130.00/kg".
+func (u UnitPrice) String() string {
+	return u.Price.Format() + "/" + u.Per
+}
+
+// Comparable reports whether two unit prices are per the same unit and in
+// the same currency.
+func (u UnitPrice) Comparable(other UnitPrice) bool {
+	return u.Per == other.Per && u.Price.SameCurrency(other.Price)
+}
+
+// per returns the unit prices for the size are quoted per, and how many
+// base units that is.
+func (s Size) per() (string, int64) {
+	switch s.Unit {
+	case Grams:
+		return PerKilogram, 1000
+	case Millilitres:
+		return PerLitre, 1000
+	}
+	return PerPiece, 1
+}
+
+// UnitPrice returns price divided by the size, per kilogram, litre or
+// piece, rounded to the currency's minor unit.
+func (s Size) UnitPrice(price money.Money) (UnitPrice, error) {
+	if !s.Priced() {
+		return UnitPrice{}, fmt.Errorf("no unit price for a size in %s", s.Unit)
+	}
+
+	per, perBase := s.per()
+
+	// Amount is in thousandths of the base unit.
+	unitPrice, err := price.Convert(big.NewRat(perBase*1000, s.Amount), price.Currency)
+	if err != nil {
+		return UnitPrice{}, err
+	}
+	return UnitPrice{Price: unitPrice, Per: per}, nil
+}
+
+// For returns the price of size at this unit price, e.g. ₹130.00/kg for
+// 250 g is ₹32.50. The size must be measured in the unit price's unit.
+func (u UnitPrice) For(size Size) (money.Money, error) {
+	per, perBase := size.per()
+	if !size.Priced() || per != u.Per {
+		return money.Money{}, fmt.Errorf("cannot price %s at a price per %s", size, u.Per)
+	}
+	return u.Price.Convert(big.NewRat(size.Amount, perBase*1000), u.Price.Currency)
+}
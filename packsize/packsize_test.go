@@ -0,0 +1,122 @@
+package packsize
+
+import (
+	"encoding/json"
+	"testing"
+
+	"price-watcher/money"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Amul Taaza Toned Milk 500 ml", []string{"500 ml"}},
+		{"Aashirvaad Atta 5Kg", []string{"5 kg"}},
+		{"Tropicana Juice 1.5 L", []string{"1.5 l"}},
+		{"Coca-Cola 6 x 300 ml", []string{"1.8 l"}},
+		{"Coca-Cola 6x300ml", []string{"1.8 l"}},
+		{"Lays Chips 52 g (Pack of 4)", []string{"52 g", "4 pc"}},
+		{"Bananas 6 pcs", []string{"6 pc"}},
+		{"Apple iPhone 15 (128 GB)", []string{"128 gb"}},
+		{"Tata Salt 0.75 kg", []string{"750 g"}},
+		{"Sony WH-1000XM5", nil},
+		{"B0CHX1W1XY", nil},
+	}
+
+	for _, tt := range tests {
+		sizes := Find(tt.text)
+		var got []string
+		for _, s := range sizes {
+			got = append(got, s.String())
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Find(%q) = %v, want %v", tt.text, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Find(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if size, ok := Parse("Apple iPhone 15 (128 GB) 6 pcs"); !ok || size.String() != "6 pc" {
+		t.Errorf("Parse() = %v, %v, want the priced 6 pc", size, ok)
+	}
+	if _, ok := Parse("Apple iPhone 15 (128 GB)"); ok {
+		t.Errorf("Parse() should not base unit prices on storage")
+	}
+
+	if size, err := ParseSize(" 1.5 kg "); err != nil || size != (Size{Amount: 1500000, Unit: Grams}) {
+		t.Errorf("ParseSize() = %+v, %v", size, err)
+	}
+	for _, bad := range []string{"", "500", "about 500 g", "500 g and 1 kg", "0 g"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Errorf("ParseSize(%q) expected error", bad)
+		}
+	}
+
+	size, err := NewSize("1500.000", Grams)
+	if err != nil || size.Quantity() != "1500" || size.String() != "1.5 kg" {
+		t.Errorf("NewSize() = %v (%s), %v", size, size.Quantity(), err)
+	}
+	if _, err := NewSize("1.5", "kg"); err == nil {
+		t.Errorf("NewSize() must take base units")
+	}
+}
+
+func TestUnitPrice(t *testing.T) {
+	tests := []struct {
+		size  string
+		price money.Money
+		want  string
+	}{
+		{"500 g", money.New(6500, "INR"), "₹130.00/kg"},
+		{"1 kg", money.New(12000, "INR"), "₹120.00/kg"},
+		{"200 ml", money.New(2500, "INR"), "₹125.00/l"},
+		{"6 pcs", money.New(10000, "INR"), "₹16.67/pc"},
+		{"0.75 l", money.New(9900, "INR"), "₹132.00/l"},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.size)
+		if err != nil {
+			t.Fatalf("ParseSize(%q) error = %v", tt.size, err)
+		}
+		got, err := size.UnitPrice(tt.price)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("UnitPrice(%s for %s) = %s, %v, want %s", tt.price.Format(), tt.size, got, err, tt.want)
+		}
+	}
+
+	if _, err := (Size{Amount: 128000, Unit: Gigabytes}).UnitPrice(money.New(100, "INR")); err == nil {
+		t.Errorf("UnitPrice() per gigabyte expected error")
+	}
+}
+
+func TestSizeJSON(t *testing.T) {
+	data, err := json.Marshal(Size{Amount: 500000, Unit: Grams})
+	if err != nil || string(data) != `"500 g"` {
+		t.Errorf("Marshal() = %s, %v", data, err)
+	}
+	var size Size
+	if err := json.Unmarshal([]byte(`"2 l"`), &size); err != nil || size != (Size{Amount: 2000000, Unit: Millilitres}) {
+		t.Errorf("Unmarshal() = %+v, %v", size, err)
+	}
+}
+
+func TestUnitPriceFor(t *testing.T) {
+	perKg := UnitPrice{Price: money.New(13000, "INR"), Per: PerKilogram}
+	quarter, _ := ParseSize("250 g")
+	if got, err := perKg.For(quarter); err != nil || !got.Equal(money.New(3250, "INR")) {
+		t.Errorf("For(250 g) = %v, %v, want ₹32.50", got, err)
+	}
+	litre, _ := ParseSize("1 l")
+	if _, err := perKg.For(litre); err == nil {
+		t.Errorf("For(1 l) at a price per kg expected error")
+	}
+}
@@ -0,0 +1,160 @@
+// Package quiet holds notifications back during quiet hours, such as
+// 22:00-07:00 in the user's timezone, and collapses the ones held into a
+// few messages once the quiet hours end.
+package quiet
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Hours is a daily span of quiet hours, which wraps past midnight when it
+// ends before it starts. The zero Hours has no quiet hours.
+type Hours struct {
+	// Start and End are minutes after midnight; End is not quiet.
+	Start, End int
+}
+
+// Parse reads quiet hours such as "22:00-07:00"; "" or "off" means none.
+func Parse(value string) (Hours, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "off") {
+		return Hours{}, nil
+	}
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return Hours{}, fmt.Errorf("invalid quiet hours %q: must be like 22:00-07:00", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return Hours{}, fmt.Errorf("invalid quiet hours %q: %w", value, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Hours{}, fmt.Errorf("invalid quiet hours %q: %w", value, err)
+	}
+	if start == end {
+		return Hours{}, fmt.Errorf("invalid quiet hours %q: start and end are the same", value)
+	}
+	return Hours{Start: start, End: end}, nil
+}
+
+// parseClock reads a time of day such as "7:30" as minutes after midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time such as 07:00", strings.TrimSpace(value))
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsZero reports whether there are no quiet hours.
+func (h Hours) IsZero() bool {
+	return h.Start == h.End
+}
+
+func (h Hours) String() string {
+	if h.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", h.Start/60, h.Start%60, h.End/60, h.End%60)
+}
+
+// Contains reports whether t, on the clock of its location, is in the
+// quiet hours.
+func (h Hours) Contains(t time.Time) bool {
+	if h.IsZero() {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if h.Start < h.End {
+		return m >= h.Start && m < h.End
+	}
+	return m >= h.Start || m < h.End
+}
+
+// Ends returns when the quiet hours t is in end, or t if it is not in them.
+func (h Hours) Ends(t time.Time) time.Time {
+	if !h.Contains(t) {
+		return t
+	}
+	end := time.Date(t.Year(), t.Month(), t.Day(), h.End/60, h.End%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, h.End/60, h.End%60, 0, 0, t.Location())
+	}
+	return end
+}
+
+// Stamp formats a notification timestamp, e.g. "Oct 18, 03:12 IST", on
+// the clock of t's location.
+func Stamp(t time.Time) string {
+	return t.Format("Jan 02, 15:04 MST")
+}
+
+// Held is a notification held back during quiet hours.
+type Held struct {
+	// Key identifies what the notification is about, such as a product;
+	// a later notification with the same key supersedes an earlier one.
+	Key     string
+	Message string
+	At      time.Time
+}
+
+// Release renders a held notification to be sent on its own.
+func Release(h Held) string {
+	return fmt.Sprintf("%s\n\n🌙 Held during quiet hours from %s", h.Message, Stamp(h.At))
+}
+
+// Message is one of the messages Collapse renders.
+type Message struct {
+	Text string
+	// Held are the indexes of the held notifications the message covers,
+	// counting those superseded by a notification in it.
+	Held []int
+}
+
+// Collapse renders notifications held during quiet hours, oldest first,
+// as few messages as possible of at most limit characters each (no limit
+// if 0), keeping only the latest notification of each key.
+func Collapse(held []Held, limit int) []Message {
+	latest := make(map[string]int, len(held))
+	for i, h := range held {
+		latest[h.Key] = i
+	}
+
+	var kept []int
+	for i, h := range held {
+		if latest[h.Key] == i {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+
+	header := fmt.Sprintf("🌙 %d alerts held during quiet hours", len(kept))
+	if superseded := len(held) - len(kept); superseded > 0 {
+		header += fmt.Sprintf(" (%d superseded by later ones left out)", superseded)
+	}
+
+	const separator = "\n\n————————\n\n"
+	var messages []Message
+	current := Message{Text: header}
+	for _, i := range kept {
+		item := fmt.Sprintf("🕒 %s\n%s", Stamp(held[i].At), held[i].Message)
+		if limit > 0 && utf8.RuneCountInString(current.Text+separator+item) > limit {
+			messages = append(messages, current)
+			current = Message{Text: item}
+		} else {
+			current.Text += separator + item
+		}
+		for j, h := range held {
+			if h.Key == held[i].Key {
+				current.Held = append(current.Held, j)
+			}
+		}
+	}
+	return append(messages, current)
+}
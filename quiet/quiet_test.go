@@ -0,0 +1,116 @@
+package quiet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Hours
+		wantErr bool
+	}{
+		{"", Hours{}, false},
+		{"off", Hours{}, false},
+		{"22:00-07:00", Hours{Start: 22 * 60, End: 7 * 60}, false},
+		{" 1:30 - 6:45 ", Hours{Start: 90, End: 6*60 + 45}, false},
+		{"22:00", Hours{}, true},
+		{"22:00-25:00", Hours{}, true},
+		{"07:00-07:00", Hours{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if got := (Hours{Start: 22 * 60, End: 7*60 + 30}).String(); got != "22:00-07:30" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestContainsAndEnds(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*60*60+30*60)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 10, 20, hour, minute, 0, 0, kolkata)
+	}
+	overnight := Hours{Start: 22 * 60, End: 7 * 60}
+	afternoon := Hours{Start: 13 * 60, End: 15 * 60}
+
+	tests := []struct {
+		name  string
+		hours Hours
+		t     time.Time
+		want  bool
+		ends  time.Time
+	}{
+		{"before midnight", overnight, at(23, 10), true, time.Date(2024, 10, 21, 7, 0, 0, 0, kolkata)},
+		{"after midnight", overnight, at(3, 0), true, at(7, 0)},
+		{"at the end", overnight, at(7, 0), false, at(7, 0)},
+		{"daytime", overnight, at(12, 0), false, at(12, 0)},
+		{"within a daytime span", afternoon, at(14, 59), true, at(15, 0)},
+		{"outside a daytime span", afternoon, at(22, 0), false, at(22, 0)},
+		{"no quiet hours", Hours{}, at(3, 0), false, at(3, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hours.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+			if got := tt.hours.Ends(tt.t); !got.Equal(tt.ends) {
+				t.Errorf("Ends() = %v, want %v", got, tt.ends)
+			}
+		})
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	at := time.Date(2024, 10, 20, 2, 0, 0, 0, time.UTC)
+	held := []Held{
+		{Key: "phone", Message: "Phone dropped to ₹999", At: at},
+		{Key: "tv", Message: "TV dropped to ₹29999", At: at.Add(time.Hour)},
+		{Key: "phone", Message: "Phone dropped to ₹949", At: at.Add(2 * time.Hour)},
+	}
+
+	got := Collapse(held, 0)
+	if len(got) != 1 {
+		t.Fatalf("Collapse() = %d messages, want 1", len(got))
+	}
+	msg := got[0].Text
+	if !strings.HasPrefix(msg, "🌙 2 alerts held during quiet hours (1 superseded") {
+		t.Errorf("Collapse() header = %q", msg)
+	}
+	if strings.Contains(msg, "₹999") || !strings.Contains(msg, "🕒 Oct 20, 04:00 UTC\nPhone dropped to ₹949") {
+		t.Errorf("Collapse() kept the wrong alerts: %q", msg)
+	}
+	if strings.Index(msg, "TV") > strings.Index(msg, "Phone") {
+		t.Errorf("Collapse() is not oldest first: %q", msg)
+	}
+	if !reflect.DeepEqual(got[0].Held, []int{1, 0, 2}) {
+		t.Errorf("Collapse() covers %v, want [1 0 2]", got[0].Held)
+	}
+
+	split := Collapse(held, 80)
+	if len(split) != 3 {
+		t.Fatalf("Collapse() with a limit = %+v, want 3 messages", split)
+	}
+	for _, m := range split {
+		if utf8.RuneCountInString(m.Text) > 80 {
+			t.Errorf("Collapse() message %q is over the limit", m.Text)
+		}
+	}
+	if split[0].Held != nil || !reflect.DeepEqual(split[1].Held, []int{1}) || !reflect.DeepEqual(split[2].Held, []int{0, 2}) {
+		t.Errorf("Collapse() with a limit covers %+v, want nothing, [1] and [0 2]", split)
+	}
+
+	if Collapse(nil, 0) != nil {
+		t.Error("Collapse(nil) is not nil")
+	}
+}
@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"price-watcher/alertmsg"
+	"price-watcher/database"
+	"price-watcher/deal"
+	"price-watcher/digest"
+	"price-watcher/discount"
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/movement"
+	"price-watcher/packsize"
+	"price-watcher/quiet"
+	"price-watcher/stats"
+)
+
+var (
+	// ErrNoHistory is returned by PreviewAlert for a product with no
+	// prices yet.
+	ErrNoHistory = errors.New("no price history")
+	// ErrNotInGroup is returned by PreviewAlert for group alerts about a
+	// product in no group.
+	ErrNotInGroup = errors.New("product is not in a group")
+	// ErrNoTarget is returned by PreviewAlert for target alerts about a
+	// product with no target price.
+	ErrNoTarget = errors.New("product has no target price")
+)
+
+// AlertPrices are the prices an alert about a product compares.
+type AlertPrices struct {
+	At       location.Location
+	Previous money.Money
+	Current  money.Money
+	// PreviousUnit and CurrentUnit are the unit prices, set only when they
+	// are comparable; they then decide whether the price dropped.
+	PreviousUnit *packsize.UnitPrice
+	CurrentUnit  *packsize.UnitPrice
+	// Listed and Offers are the listed price and the offers taken off it,
+	// on products alerting on their effective price.
+	Listed *money.Money
+	Offers []string
+}
+
+// lowestInPeriod reports whether prices.Current is the lowest price of the
+// product in the configured period, by unit price if comparable, along with
+// the lowest price before it and whether prices.Current equals it.
+func (s *Scheduler) lowestInPeriod(product database.Product, prices AlertPrices) (bool, string, bool, error) {
+	lowestPriceInPeriod := s.db.GetLowestPriceInPeriod
+	if product.AlertOn == database.AlertOnEffectivePrice {
+		lowestPriceInPeriod = s.db.GetLowestEffectivePriceInPeriod
+	}
+	lowestPrice, err := lowestPriceInPeriod(product.ID, prices.At, s.config.PriceHistoryDays)
+	if err != nil {
+		return false, "", false, err
+	}
+	if prices.CurrentUnit == nil {
+		isLowest := lowestPrice.IsZero() || prices.Current.Cmp(lowestPrice) <= 0
+		return isLowest, lowestPrice.Format(), prices.Current.Equal(lowestPrice), nil
+	}
+
+	lowestUnit, err := s.db.GetLowestUnitPriceInPeriod(product.ID, prices.At, s.config.PriceHistoryDays)
+	if err != nil {
+		return false, "", false, fmt.Errorf("failed to get lowest unit price: %w", err)
+	}
+	if lowestUnit == nil {
+		return true, lowestPrice.Format(), true, nil
+	}
+	return prices.CurrentUnit.Price.Cmp(lowestUnit.Price) <= 0, lowestUnit.String(), prices.CurrentUnit.Price.Equal(lowestUnit.Price), nil
+}
+
+// dropAlertData returns the data of the alert about a product's price
+// dropping to the lowest in the period, or reaching its target, and the
+// analysis of the drop the fake-discount warning comes from.
+func (s *Scheduler) dropAlertData(product database.Product, prices AlertPrices, lowest string, atLowest, reachedTarget bool,
+	now time.Time) (alertmsg.Data, discount.Analysis) {
+	var analysis discount.Analysis
+	warning := ""
+	if prices.Current.Cmp(prices.Previous) < 0 {
+		var err error
+		if analysis, err = s.analyzeDrop(product, prices.At, prices.Current); err != nil {
+			log.Printf("Failed to analyse price drop for %s: %v", product.ID, err)
+		}
+		warning = analysis.Summary(now)
+	}
+
+	// Put the new price in context of the product's history, and say
+	// whether a further drop is worth waiting for.
+	statsText, verdictText := "", ""
+	if points, summary, ok, err := s.priceStats(product, prices.At, prices.Current); err != nil {
+		log.Printf("Failed to compute price statistics for %s: %v", product.ID, err)
+	} else if ok {
+		statsText = summary.Summary()
+		verdictText = deal.Evaluate(points, summary, now, s.config.ForecastDays).Summary()
+	}
+
+	data := s.alertData(product, prices, now)
+	data.Type, data.Rule = digest.AlertLow, fmt.Sprintf("lowest in %d days", s.config.PriceHistoryDays)
+	data.ListedPrice, data.Offers = prices.Listed, prices.Offers
+	if prices.PreviousUnit != nil && prices.CurrentUnit != nil {
+		data.PreviousUnit, data.CurrentUnit = prices.PreviousUnit.String(), prices.CurrentUnit.String()
+	}
+	data.LowestDays, data.Lowest, data.AtLowest = s.config.PriceHistoryDays, lowest, atLowest
+	data.ReachedTarget = reachedTarget
+	data.Stats, data.Verdict, data.Warning = statsText, verdictText, warning
+	if reachedTarget {
+		data.Type, data.Rule = digest.AlertTarget, fmt.Sprintf("target price %s reached", product.TargetPrice.Format())
+	}
+	return data, analysis
+}
+
+// movementAlertData returns the data of the movement alert fired about a
+// product's price.
+func (s *Scheduler) movementAlertData(product database.Product, prices AlertPrices, fired movement.Alert, summary stats.Stats, now time.Time) alertmsg.Data {
+	data := s.alertData(product, prices, now)
+	data.Type, data.Rule = fired.Type, fired.Rule
+	data.ChangePercent, data.Usual = fired.ChangePercent, fired.Usual
+	data.Volatility, data.UsualVolatility = fired.Volatility, fired.UsualVolatility
+	data.Stats = summary.Summary()
+	return data
+}
+
+// alertData returns the data every alert about a product's price has.
+func (s *Scheduler) alertData(product database.Product, prices AlertPrices, now time.Time) alertmsg.Data {
+	display := s.displayConverter()
+	return alertmsg.Data{
+		Product:           alertmsg.Product{ID: product.ID, Name: product.Name, Platform: product.Platform, URL: product.URL},
+		Location:          prices.At.String(),
+		Seen:              quiet.Stamp(now.In(s.timeZone())),
+		Previous:          prices.Previous,
+		Current:           prices.Current,
+		Savings:           prices.Previous.Sub(prices.Current),
+		PreviousConverted: display(prices.Previous),
+		CurrentConverted:  display(prices.Current),
+		Target:            product.TargetPrice,
+		Links:             alertmsg.Links{Listing: product.URL, Page: s.pageURL("/products/" + product.ID)},
+	}
+}
+
+// PreviewAlert returns the data an alert of alertType about a product would
+// be rendered from, built as the scheduler builds it, as if the product's
+// latest price had just dropped, or on movement alerts moved, from the
+// price before.
+func (s *Scheduler) PreviewAlert(product database.Product, alertType string) (alertmsg.Data, error) {
+	if alertType == digest.AlertTarget && product.TargetPrice == nil {
+		return alertmsg.Data{}, ErrNoTarget
+	}
+	now := time.Now()
+	at, err := s.priceLocation(product)
+	if err != nil {
+		return alertmsg.Data{}, err
+	}
+	effective := product.AlertOn == database.AlertOnEffectivePrice
+	points, err := s.db.GetPricePoints(product.ID, at, time.Time{}, effective)
+	if err != nil {
+		return alertmsg.Data{}, err
+	}
+	if len(points) == 0 {
+		return alertmsg.Data{}, ErrNoHistory
+	}
+
+	prices := AlertPrices{At: at, Current: points[len(points)-1].Price}
+	prices.Previous = prices.Current
+	for i := len(points) - 2; i >= 0; i-- {
+		if !points[i].Price.Equal(prices.Current) {
+			prices.Previous = points[i].Price
+			break
+		}
+	}
+	if effective {
+		if listed, err := s.db.GetLatestPrice(product.ID, at); err == nil {
+			prices.Listed = &listed
+		}
+		for _, offer := range product.Offers {
+			prices.Offers = append(prices.Offers, offer.Text)
+		}
+	} else {
+		previousUnit, currentUnit := database.UnitPriceOf(product, prices.Previous), database.UnitPriceOf(product, prices.Current)
+		if previousUnit != nil && currentUnit != nil && currentUnit.Comparable(*previousUnit) {
+			prices.PreviousUnit, prices.CurrentUnit = previousUnit, currentUnit
+		}
+	}
+
+	switch alertType {
+	case digest.AlertIncrease, digest.AlertVolatile, digest.AlertNormal:
+		summary, _ := stats.Compute(points, now)
+		fired := movement.Alert{Type: alertType, ChangePercent: prices.Current.Sub(prices.Previous).PercentOf(prices.Previous)}
+		fired.Rule = fmt.Sprintf("%+.1f%% from %s", fired.ChangePercent, prices.Previous.Format())
+		switch alertType {
+		case digest.AlertVolatile:
+			closes := stats.DailyCloses(points, now.AddDate(0, 0, -(movement.UsualDays+movement.RecentDays)), now)
+			if len(closes) > movement.RecentDays+1 {
+				fired.Volatility = stats.Volatility(closes[len(closes)-movement.RecentDays-1:])
+				fired.UsualVolatility = stats.Volatility(closes[:len(closes)-movement.RecentDays])
+			}
+		case digest.AlertNormal:
+			if usual, ok := stats.WeightedMedian(points, now.AddDate(0, 0, -movement.UsualDays), now); ok {
+				fired.Usual = &usual
+			}
+		}
+		return s.movementAlertData(product, prices, fired, summary, now), nil
+	}
+
+	_, lowest, atLowest, err := s.lowestInPeriod(product, prices)
+	if err != nil {
+		return alertmsg.Data{}, err
+	}
+	data, _ := s.dropAlertData(product, prices, lowest, atLowest, alertType == digest.AlertTarget, now)
+	if alertType == digest.AlertGroup {
+		if product.GroupID == nil {
+			return data, ErrNotInGroup
+		}
+		group, err := s.db.GetGroup(*product.GroupID)
+		if err != nil {
+			return data, err
+		}
+		data.Type, data.Group = digest.AlertGroup, &alertmsg.Group{ID: group.ID, Name: group.Name}
+		data.Rule, data.Target, data.ReachedTarget = "new best price of "+group.Name, group.TargetPrice, false
+		data.Links.Page = s.pageURL("/groups/" + group.ID)
+	}
+	return data, nil
+}
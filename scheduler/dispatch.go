@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"price-watcher/database"
+	"price-watcher/outbox"
+	"price-watcher/quiet"
+)
+
+const (
+	// dispatchBatch is how many deliveries are claimed at a time.
+	dispatchBatch = 100
+	// dispatchLease is how long a claimed delivery is held back from other
+	// dispatchers; one neither sent nor failed by then is retried.
+	dispatchLease = 5 * time.Minute
+)
+
+// dispatch delivers the alerts due in the outbox every OUTBOX_POLL_INTERVAL,
+// and as soon as one is stored, until the scheduler stops.
+func (s *Scheduler) dispatch() {
+	defer s.dispatching.Done()
+
+	interval := s.config.OutboxPollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatchDue()
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// wakeDispatcher has the dispatcher look for due deliveries now.
+func (s *Scheduler) wakeDispatcher() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchDue delivers every delivery that is due.
+func (s *Scheduler) dispatchDue() {
+	for {
+		due, err := s.db.ClaimDeliveries(dispatchBatch, dispatchLease)
+		if err != nil {
+			log.Printf("Failed to claim alert deliveries: %v", err)
+			return
+		}
+		s.deliverAll(due)
+		if len(due) < dispatchBatch {
+			return
+		}
+	}
+}
+
+// deliverAll sends claimed deliveries, oldest first. Deliveries held during
+// quiet hours are collapsed into as few messages as possible per channel if
+// the quiet_collapse setting is on.
+func (s *Scheduler) deliverAll(due []database.Delivery) {
+	if len(due) == 0 {
+		return
+	}
+	channels := make(map[string]channel)
+	for _, ch := range s.channels() {
+		channels[ch.name] = ch
+	}
+	loc := s.timeZone()
+	collapse := s.quietCollapse()
+
+	collapsed := make(map[string][]database.Delivery)
+	var order []string
+	for _, d := range due {
+		ch, ok := channels[d.Channel]
+		if !ok {
+			s.deliveryFailed(d, fmt.Errorf("channel %s is not configured", d.Channel))
+			continue
+		}
+		if d.Quiet && collapse {
+			if _, ok := collapsed[d.Channel]; !ok {
+				order = append(order, d.Channel)
+			}
+			collapsed[d.Channel] = append(collapsed[d.Channel], d)
+			continue
+		}
+
+		message := d.Message
+		if d.Quiet {
+			message = quiet.Release(quiet.Held{Key: d.ProductID, Message: d.Message, At: d.CreatedAt.In(loc)})
+		}
+		if err := ch.alert(d.Subject, message, d.AlertID); err != nil {
+			s.deliveryFailed(d, err)
+			continue
+		}
+		s.deliveriesSent(d)
+	}
+
+	for _, name := range order {
+		deliveries := collapsed[name]
+		held := make([]quiet.Held, len(deliveries))
+		for i, d := range deliveries {
+			held[i] = quiet.Held{Key: d.ProductID, Message: d.Message, At: d.CreatedAt.In(loc)}
+		}
+		// Mark each message's deliveries sent as it goes, so a failure
+		// part way retries only those not sent yet.
+		sent := make([]bool, len(deliveries))
+		var err error
+		for _, message := range quiet.Collapse(held, channels[name].limit) {
+			if err = channels[name].alert("Alerts held during quiet hours", message.Text, ""); err != nil {
+				break
+			}
+			if len(message.Held) == 0 {
+				continue
+			}
+			covered := make([]database.Delivery, len(message.Held))
+			for j, i := range message.Held {
+				covered[j], sent[i] = deliveries[i], true
+			}
+			s.deliveriesSent(covered...)
+		}
+		if err != nil {
+			for i, d := range deliveries {
+				if !sent[i] {
+					s.deliveryFailed(d, err)
+				}
+			}
+		}
+	}
+}
+
+// deliveriesSent marks deliveries sent.
+func (s *Scheduler) deliveriesSent(deliveries ...database.Delivery) {
+	ids := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+		log.Printf("Alert about %s sent by %s", d.Product, d.Channel)
+	}
+	if err := s.db.MarkDeliveriesSent(ids...); err != nil {
+		log.Printf("Failed to mark alert deliveries sent: %v", err)
+	}
+}
+
+// deliveryFailed schedules a failed delivery's retry with backoff, or
+// dead-letters it once it is out of attempts.
+func (s *Scheduler) deliveryFailed(d database.Delivery, sendErr error) {
+	policy := outbox.Policy{MaxAttempts: s.config.OutboxMaxAttempts, Backoff: s.config.OutboxRetryBackoff}
+	wait, dead := policy.Retry(d.Attempts)
+	if dead {
+		log.Printf("Alert about %s dead-lettered by %s after %d attempts: %v", d.Product, d.Channel, d.Attempts, sendErr)
+	} else {
+		log.Printf("Failed to send alert about %s by %s (attempt %d), retrying in %s: %v", d.Product, d.Channel, d.Attempts, wait, sendErr)
+	}
+	if err := s.db.MarkDeliveryFailed(d.ID, sendErr.Error(), wait, dead); err != nil {
+		log.Printf("Failed to record failed alert delivery: %v", err)
+	}
+}
+
+// quietCollapse reports whether the quiet_collapse setting is on.
+func (s *Scheduler) quietCollapse() bool {
+	value, err := s.db.GetSetting(database.SettingQuietCollapse, "false")
+	if err != nil {
+		log.Printf("Failed to get %s setting: %v", database.SettingQuietCollapse, err)
+	}
+	collapse, _ := strconv.ParseBool(value)
+	return collapse
+}
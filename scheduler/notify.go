@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"price-watcher/alertmsg"
+	"price-watcher/database"
+	"price-watcher/digest"
+	"price-watcher/money"
+	"price-watcher/quiet"
+	"price-watcher/telegram"
+)
+
+// telegramMessageLimit is the most characters a Telegram message can have.
+const telegramMessageLimit = 4096
+
+// channel is a way alerts reach the user.
+type channel struct {
+	name string
+	// setting names the setting holding the channel's digest mode.
+	setting string
+	// limit is the most characters a message can have, 0 for no limit.
+	limit int
+	// alert sends an alert's message, with buttons to acknowledge, dismiss
+	// or buy on it where the channel has them, unless alertID is empty.
+	alert  func(subject, message, alertID string) error
+	digest func(d digest.Digest) error
+}
+
+// channels returns Telegram, which logs alerts when it is not configured,
+// and email if it is configured.
+func (s *Scheduler) channels() []channel {
+	channels := []channel{{
+		name:    "telegram",
+		setting: database.SettingDigestTelegram,
+		limit:   telegramMessageLimit,
+		alert: func(_, message, alertID string) error {
+			if alertID == "" {
+				return s.tgBot.SendMessage(message)
+			}
+			return s.tgBot.SendMessageWithButtons(message, alertButtons(alertID))
+		},
+		digest: func(d digest.Digest) error { return s.tgBot.SendMessage(d.Telegram()) },
+	}}
+	if s.mailer.IsEnabled() {
+		channels = append(channels, channel{
+			name:    "email",
+			setting: database.SettingDigestEmail,
+			alert:   func(subject, message, _ string) error { return s.mailer.Send(subject, message, "") },
+			digest:  func(d digest.Digest) error { return s.mailer.Send(d.Title(), d.Text(), d.HTML()) },
+		})
+	}
+	return channels
+}
+
+// alertButtons are the buttons under a Telegram alert, whose data is
+// "alert:<id>:<status>".
+func alertButtons(alertID string) []telegram.Button {
+	return []telegram.Button{
+		{Text: "👀 Seen", Data: "alert:" + alertID + ":" + database.AlertAcknowledged},
+		{Text: "🛒 Bought", Data: "alert:" + alertID + ":" + database.AlertBought},
+		{Text: "🙅 Dismiss", Data: "alert:" + alertID + ":" + database.AlertDismissed},
+	}
+}
+
+// alertButtonPressed sets the status of the alert whose button was pressed.
+func (s *Scheduler) alertButtonPressed(data string) (string, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != "alert" || !slices.Contains(database.AlertStatuses, parts[2]) {
+		return "", fmt.Errorf("unknown button %q", data)
+	}
+	alert, err := s.db.SetAlertStatus(parts[1], parts[2])
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Alert %s marked %s", alert.ID, alert.Status)
+	return "Marked " + alert.Status, nil
+}
+
+// channelMode returns how a channel delivers, instantly by default.
+func (s *Scheduler) channelMode(ch channel) string {
+	value, err := s.db.GetSetting(ch.setting, digest.ModeInstant)
+	if err != nil {
+		log.Printf("Failed to get %s setting: %v", ch.setting, err)
+		return digest.ModeInstant
+	}
+	mode, err := digest.ParseMode(value)
+	if err != nil {
+		log.Printf("Ignoring %s setting: %v", ch.setting, err)
+		return digest.ModeInstant
+	}
+	return mode
+}
+
+// urgent reports whether alerts of alertType skip digests.
+func (s *Scheduler) urgent(alertType string) bool {
+	value, err := s.db.GetSetting(database.SettingUrgentAlerts, digest.DefaultUrgent)
+	if err != nil {
+		log.Printf("Failed to get %s setting: %v", database.SettingUrgentAlerts, err)
+		value = digest.DefaultUrgent
+	}
+	types, err := digest.ParseUrgent(value)
+	if err != nil {
+		log.Printf("Ignoring %s setting: %v", database.SettingUrgentAlerts, err)
+		types, _ = digest.ParseUrgent(digest.DefaultUrgent)
+	}
+	return slices.Contains(types, alertType)
+}
+
+// timeZone returns the timezone of the timezone setting or else
+// TIMEZONE, in which quiet hours, digest schedules and message times are.
+func (s *Scheduler) timeZone() *time.Location {
+	loc, err := s.db.TimeZone(s.config.Timezone)
+	if err != nil {
+		log.Printf("Using the server's timezone: %v", err)
+	}
+	return loc
+}
+
+// quietHours returns the quiet hours setting, none if it is invalid.
+func (s *Scheduler) quietHours() quiet.Hours {
+	value, err := s.db.GetSetting(database.SettingQuietHours, "")
+	if err != nil {
+		log.Printf("Failed to get %s setting: %v", database.SettingQuietHours, err)
+		return quiet.Hours{}
+	}
+	hours, err := quiet.Parse(value)
+	if err != nil {
+		log.Printf("Ignoring %s setting: %v", database.SettingQuietHours, err)
+	}
+	return hours
+}
+
+// planDeliveries adds an alert's deliveries, rendered from templates for
+// each channel: on the channels delivering instantly, or on every channel
+// if the alert type is urgent, due now or, unless urgent, once the quiet
+// hours end. Channels in digest mode hold the other alerts for their digest
+// with the rule that fired as the detail; an alert no channel delivers is
+// recorded as held for the digest.
+func (s *Scheduler) planDeliveries(alert *database.OutboxAlert, templates alertmsg.Set, data alertmsg.Data, subject string) {
+	urgent := s.urgent(data.Type)
+	var delay time.Duration
+	if !urgent {
+		now := time.Now().In(s.timeZone())
+		delay = s.quietHours().Ends(now).Sub(now)
+	}
+
+	for _, ch := range s.channels() {
+		if !urgent && s.channelMode(ch) != digest.ModeInstant {
+			alert.Digest = data.Rule
+			continue
+		}
+		alert.Deliveries = append(alert.Deliveries, database.OutboxDelivery{
+			Channel: ch.name,
+			Subject: subject,
+			Message: s.renderAlert(templates, ch.name, data),
+			Delay:   delay,
+			Quiet:   delay > 0,
+		})
+	}
+	if len(alert.Deliveries) == 0 {
+		alert.SuppressedReason = "held for the digest"
+	}
+}
+
+// alertTemplates returns the alert templates: those stored, then those in
+// ALERT_TEMPLATES_DIR, then the defaults.
+func (s *Scheduler) alertTemplates() alertmsg.Set {
+	stored, err := s.db.GetAlertTemplates()
+	if err != nil {
+		log.Printf("Failed to get alert templates: %v", err)
+	}
+	files, err := alertmsg.ReadDir(s.config.AlertTemplatesDir)
+	if err != nil {
+		log.Printf("Failed to read alert templates: %v", err)
+	}
+	return alertmsg.New(stored, files)
+}
+
+// renderAlert renders an alert for a channel, or the message stored with
+// it if channel is "", logging a template that failed.
+func (s *Scheduler) renderAlert(templates alertmsg.Set, channel string, data alertmsg.Data) string {
+	message, err := templates.Render(channel, data)
+	if err != nil {
+		log.Printf("Using the default %s alert template: %v", data.Type, err)
+	}
+	return message
+}
+
+// pageURL returns the link to a page of the web UI, or "" unless
+// PUBLIC_URL is set.
+func (s *Scheduler) pageURL(path string) string {
+	if s.config.PublicURL == "" {
+		return ""
+	}
+	return s.config.PublicURL + path
+}
+
+// alertStored logs what becomes of an alert about name now it is stored,
+// and wakes the dispatcher if it has deliveries.
+func (s *Scheduler) alertStored(name string, alert database.OutboxAlert) {
+	change := fmt.Sprintf("%s → %s", alert.OldPrice.Format(), alert.NewPrice.Format())
+	switch {
+	case alert.SuppressedReason != "":
+		log.Printf("Alert for %s (%s) not sent: %s", name, change, alert.SuppressedReason)
+	case alert.Deliveries[0].Quiet:
+		log.Printf("Alert for %s (%s) queued until the quiet hours end", name, change)
+	default:
+		log.Printf("Alert for %s (%s) queued for delivery", name, change)
+		s.wakeDispatcher()
+	}
+}
+
+// recordEntry adds an entry for the digests, logging failures.
+func (s *Scheduler) recordEntry(kind, productID string, oldPrice, newPrice *money.Money, detail string) {
+	if err := s.db.AddDigestEntry(kind, productID, oldPrice, newPrice, detail); err != nil {
+		log.Printf("Failed to record %s for %s: %v", kind, productID, err)
+	}
+}
+
+// sendDigests sends the digest of the period of mode on every channel
+// delivering in that mode.
+func (s *Scheduler) sendDigests(mode string) {
+	now := time.Now().In(s.timeZone())
+	if mode == digest.ModeDaily {
+		if _, err := s.db.PruneDigestEntries(now.AddDate(0, 0, -digest.RetentionDays)); err != nil {
+			log.Printf("Failed to prune digest entries: %v", err)
+		}
+	}
+
+	var d *digest.Digest
+	for _, ch := range s.channels() {
+		if s.channelMode(ch) != mode {
+			continue
+		}
+		if d == nil {
+			entries, err := s.db.GetDigestEntries(now.Add(-digest.Period(mode)))
+			if err != nil {
+				log.Printf("Failed to get digest entries: %v", err)
+				return
+			}
+			built := digest.Build(entries, mode, now)
+			d = &built
+		}
+		if d.Empty() {
+			log.Printf("Nothing to report in the %s digest", mode)
+			return
+		}
+		if err := ch.digest(*d); err != nil {
+			log.Printf("Failed to send %s digest by %s: %v", mode, ch.name, err)
+			continue
+		}
+		log.Printf("Sent %s digest by %s", mode, ch.name)
+	}
+}
@@ -1,14 +1,30 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
+	"price-watcher/alertmsg"
 	"price-watcher/config"
 	"price-watcher/database"
+	"price-watcher/digest"
+	"price-watcher/discount"
+	"price-watcher/email"
+	"price-watcher/events"
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/movement"
+	"price-watcher/offers"
+	"price-watcher/packsize"
+	"price-watcher/quiet"
 	"price-watcher/scraper"
+	"price-watcher/stats"
 	"price-watcher/telegram"
+	"price-watcher/throttle"
 
 	"github.com/robfig/cron/v3"
 )
@@ -17,18 +33,28 @@ type Scheduler struct {
 	cron     *cron.Cron
 	db       *database.DB
 	tgBot    *telegram.Bot
+	mailer   *email.Sender
 	config   *config.Config
 	stopChan chan struct{}
 	wg       sync.WaitGroup
+	// scraping is held while a scrape runs so event scrapes do not
+	// overlap regular ones.
+	scraping sync.Mutex
+	// dispatching tracks the outbox dispatcher goroutine; wake signals it
+	// to look for due deliveries now.
+	dispatching sync.WaitGroup
+	wake        chan struct{}
 }
 
-func NewScheduler(db *database.DB, tgBot *telegram.Bot, cfg *config.Config) *Scheduler {
+func NewScheduler(db *database.DB, tgBot *telegram.Bot, mailer *email.Sender, cfg *config.Config) *Scheduler {
 	return &Scheduler{
 		cron:     cron.New(cron.WithSeconds()),
 		db:       db,
 		tgBot:    tgBot,
+		mailer:   mailer,
 		config:   cfg,
 		stopChan: make(chan struct{}),
+		wake:     make(chan struct{}, 1),
 	}
 }
 
@@ -38,23 +64,82 @@ func (s *Scheduler) Start() {
 	// Schedule price scraping every hour (or as configured)
 	s.cron.AddFunc(fmt.Sprintf("0 */%d * * * *", int(s.config.ScrapingInterval.Hours())), s.scrapeAllProducts)
 
+	// Scrape products on platforms with a running sale event more often
+	if s.config.EventScrapingInterval > 0 {
+		if _, err := s.cron.AddFunc(fmt.Sprintf("@every %s", s.config.EventScrapingInterval), s.scrapeEventProducts); err != nil {
+			log.Printf("Invalid EVENT_SCRAPING_INTERVAL %s: %v", s.config.EventScrapingInterval, err)
+		}
+	}
+
+	// Schedule price history compaction
+	if s.config.RawHistoryDays > 0 {
+		if _, err := s.cron.AddFunc(s.config.RetentionSchedule, s.compactPriceHistory); err != nil {
+			log.Printf("Invalid RETENTION_SCHEDULE %q: %v", s.config.RetentionSchedule, err)
+		}
+	}
+
+	// Send digests to channels in daily or weekly digest mode, on the
+	// user's clock
+	if err := s.addZoned(s.config.DigestDailySchedule, func() { s.sendDigests(digest.ModeDaily) }); err != nil {
+		log.Printf("Invalid DIGEST_DAILY_SCHEDULE %q: %v", s.config.DigestDailySchedule, err)
+	}
+	if err := s.addZoned(s.config.DigestWeeklySchedule, func() { s.sendDigests(digest.ModeWeekly) }); err != nil {
+		log.Printf("Invalid DIGEST_WEEKLY_SCHEDULE %q: %v", s.config.DigestWeeklySchedule, err)
+	}
+
 	// Start the cron scheduler
 	s.cron.Start()
 
+	// Deliver alerts from the outbox
+	s.dispatching.Add(1)
+	go s.dispatch()
+
+	// Record what became of alerts from the buttons under Telegram alerts
+	s.dispatching.Add(1)
+	go func() {
+		defer s.dispatching.Done()
+		s.tgBot.HandleButtons(s.stopChan, s.alertButtonPressed)
+	}()
+
 	// Run initial scraping
 	go s.scrapeAllProducts()
 }
 
+// zoned is a cron schedule on the clock of the timezone setting, looked up
+// each time the next run is worked out.
+type zoned struct {
+	schedule cron.Schedule
+	timeZone func() *time.Location
+}
+
+func (z zoned) Next(t time.Time) time.Time {
+	return z.schedule.Next(t.In(z.timeZone()))
+}
+
+// addZoned runs job on a cron spec (with seconds) in the user's timezone.
+func (s *Scheduler) addZoned(spec string, job func()) error {
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	schedule, err := parser.Parse(spec)
+	if err != nil {
+		return err
+	}
+	s.cron.Schedule(zoned{schedule: schedule, timeZone: s.timeZone}, cron.FuncJob(job))
+	return nil
+}
+
 func (s *Scheduler) Stop() {
 	log.Println("Stopping scheduler...")
 	close(s.stopChan)
 	s.cron.Stop()
 	s.wg.Wait()
+	s.dispatching.Wait()
 	log.Println("Scheduler stopped")
 }
 
 func (s *Scheduler) scrapeAllProducts() {
 	log.Println("Starting scheduled price scraping...")
+	s.scraping.Lock()
+	defer s.scraping.Unlock()
 
 	// Get all products from database
 	products, err := s.db.GetProducts()
@@ -68,6 +153,55 @@ func (s *Scheduler) scrapeAllProducts() {
 		return
 	}
 
+	if !s.scrapeProducts(products) {
+		return
+	}
+
+	log.Println("Price scraping completed")
+
+	s.recordBasketCosts()
+}
+
+// scrapeEventProducts scrapes the products on platforms with a sale event
+// running today, unless a scrape is already running.
+func (s *Scheduler) scrapeEventProducts() {
+	running, err := s.db.GetActiveEvents(time.Now())
+	if err != nil {
+		log.Printf("Failed to get sale events: %v", err)
+		return
+	}
+	if len(running) == 0 {
+		return
+	}
+	if !s.scraping.TryLock() {
+		return
+	}
+	defer s.scraping.Unlock()
+
+	products, err := s.db.GetProducts()
+	if err != nil {
+		log.Printf("Failed to get products: %v", err)
+		return
+	}
+	var onSale []database.Product
+	for _, product := range products {
+		if len(events.Active(running, product.Platform, time.Now())) > 0 {
+			onSale = append(onSale, product)
+		}
+	}
+	if len(onSale) == 0 {
+		return
+	}
+
+	log.Printf("Scraping %d products on sale (%s)...", len(onSale), running[0].Name)
+	if s.scrapeProducts(onSale) {
+		log.Println("Sale event scraping completed")
+	}
+}
+
+// scrapeProducts scrapes products with the worker pool, reporting false if
+// the scheduler stopped first.
+func (s *Scheduler) scrapeProducts(products []database.Product) bool {
 	// Create worker pool for concurrent scraping
 	workerCount := s.config.WorkerPoolSize
 	productChan := make(chan database.Product, len(products))
@@ -84,14 +218,34 @@ func (s *Scheduler) scrapeAllProducts() {
 		case productChan <- product:
 		case <-s.stopChan:
 			close(productChan)
-			return
+			return false
 		}
 	}
 
 	close(productChan)
 	s.wg.Wait()
+	return true
+}
 
-	log.Println("Price scraping completed")
+// recordBasketCosts stores today's cost of every basket at the prices just
+// scraped.
+func (s *Scheduler) recordBasketCosts() {
+	baskets, err := s.db.GetBaskets()
+	if err != nil {
+		log.Printf("Failed to get baskets: %v", err)
+		return
+	}
+
+	for _, basket := range baskets {
+		listed, cheapest, err := s.db.CostBasket(&basket, time.Now())
+		if err != nil {
+			log.Printf("Failed to price basket %s: %v", basket.Name, err)
+			continue
+		}
+		if err := s.db.RecordBasketCost(basket.ID, listed, cheapest); err != nil {
+			log.Printf("Failed to record cost of basket %s: %v", basket.Name, err)
+		}
+	}
 }
 
 func (s *Scheduler) priceScrapingWorker(productChan <-chan database.Product) {
@@ -108,132 +262,530 @@ func (s *Scheduler) priceScrapingWorker(productChan <-chan database.Product) {
 }
 
 func (s *Scheduler) scrapeProductPrice(product database.Product) {
+	if _, err := s.scrapeProduct(product); err != nil {
+		log.Printf("Failed to scrape price for %s: %v", product.URL, err)
+	}
+}
+
+// ScrapeResult is what a scrape of a product found.
+type ScrapeResult struct {
+	Product   string
+	Price     money.Money
+	UnitPrice *packsize.UnitPrice
+	// EffectivePrice is the price after the Applied offers, nil if they
+	// took nothing off.
+	EffectivePrice *money.Money
+	Offers         []offers.Offer
+	Applied        []offers.Offer
+	Location       location.Location
+}
+
+// scrapeProduct scrapes a product's price and stores it, with the alert it
+// raised, the digest entry for the change and the group's best price.
+func (s *Scheduler) scrapeProduct(product database.Product) (*ScrapeResult, error) {
 	log.Printf("Scraping price for product: %s (%s)", product.Name, product.Platform)
 
 	// Get appropriate scraper for the platform
 	factory := scraper.NewScraperFactory()
 	scraper, err := factory.GetScraper(product.URL)
 	if err != nil {
-		log.Printf("Failed to get scraper for %s: %v", product.URL, err)
-		return
+		return nil, err
+	}
+
+	// Scrape from the product's delivery location on shops that price by it.
+	at, err := s.priceLocation(product)
+	if err == nil {
+		err = scraper.SetLocation(at)
+	}
+	if err != nil {
+		s.RecordScrapeStatus(product, err)
+		return nil, fmt.Errorf("failed to set location: %w", err)
 	}
 
 	// Scrape current price
 	currentPrice, err := scraper.ScrapePrice(product.URL)
 	if err != nil {
-		log.Printf("Failed to scrape price for %s: %v", product.URL, err)
-		return
+		s.RecordScrapeStatus(product, err)
+		return nil, err
+	}
+	s.RecordScrapeStatus(product, nil)
+
+	// Keep the page's title for matching listings across platforms.
+	if title := scraper.Title(); title != "" && title != product.ScrapedTitle {
+		if err := s.db.SetScrapedTitle(product.ID, title); err != nil {
+			log.Printf("Failed to store title for %s: %v", product.ID, err)
+		}
 	}
 
-	// Check if we should send an alert
-	if err := s.checkAndSendAlert(product, currentPrice); err != nil {
-		log.Printf("Failed to check/send alert for %s: %v", product.ID, err)
+	// Take the pack size from the page unless one is already known.
+	if size, ok := scraper.PackSize(); ok && product.PackSize == nil {
+		if err := s.db.SetPackSize(product.ID, &size); err != nil {
+			log.Printf("Failed to store pack size for %s: %v", product.ID, err)
+		} else {
+			product.PackSize = &size
+		}
+	}
+
+	// Follow the shop if it now prices the product in another currency.
+	if currentPrice.Currency != product.Currency {
+		if err := s.db.SetProductCurrency(product.ID, currentPrice.Currency); err != nil {
+			log.Printf("Failed to update currency for %s: %v", product.ID, err)
+		}
+		product.Currency, product.TargetPrice = currentPrice.Currency, nil
+	}
+
+	// Work out what the product costs after its coupons and the bank
+	// offers for the cards held.
+	available := scraper.Offers(currentPrice.Currency)
+	if err := s.db.SetProductOffers(product.ID, available); err != nil {
+		log.Printf("Failed to store offers for %s: %v", product.ID, err)
+	}
+	effectivePrice, applied, err := s.db.EffectivePrice(currentPrice, available)
+	if err != nil {
+		log.Printf("Failed to apply offers for %s: %v", product.ID, err)
+	}
+
+	// Check if we should alert; grouped listings alert on drops of their
+	// group's best price once the new price is stored.
+	unitPrice := database.UnitPriceOf(product, currentPrice)
+	alert, err := s.checkAlert(product, at, currentPrice, unitPrice, effectivePrice, applied)
+	if err != nil {
+		log.Printf("Failed to check alert for %s: %v", product.ID, err)
 	}
 
 	// Calculate delta
-	var delta float64
-	previousPrice, err := s.db.GetLatestPrice(product.ID)
-	if err == nil && previousPrice != 0 {
-		delta = currentPrice - previousPrice
+	delta := money.New(0, currentPrice.Currency)
+	previousPrice, err := s.db.GetLatestPrice(product.ID, at)
+	if err == nil && !previousPrice.IsZero() && previousPrice.SameCurrency(currentPrice) {
+		delta = currentPrice.Sub(previousPrice)
+	}
+
+	// Add price to history, along with the change for the digests and the
+	// alert it raised, so both are recorded if and only if the price is
+	// stored
+	err = s.db.RecordScrapedPrice(product.ID, at, currentPrice, delta, unitPrice, effectivePrice, s.config.PriceStorageMode, alert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add price history: %w", err)
+	}
+	if alert != nil {
+		s.alertStored(product.Name, *alert)
+	}
+
+	log.Printf("Successfully scraped price for %s: %s", product.Name, currentPrice.Format())
+
+	if product.GroupID != nil {
+		if err := s.checkGroupAlert(*product.GroupID); err != nil {
+			log.Printf("Failed to check/send group alert for %s: %v", *product.GroupID, err)
+		}
+	}
+
+	return &ScrapeResult{
+		Product:        product.Name,
+		Price:          currentPrice,
+		UnitPrice:      unitPrice,
+		EffectivePrice: effectivePrice,
+		Offers:         available,
+		Applied:        applied,
+		Location:       at,
+	}, nil
+}
+
+// reachedTarget reports whether a price just reached target: it moved from
+// above the target to at or below it. A target in another currency is never
+// reached.
+func reachedTarget(target *money.Money, previous, current money.Money) bool {
+	return target != nil && target.SameCurrency(current) &&
+		current.Cmp(*target) <= 0 && previous.Cmp(*target) > 0
+}
+
+// priceLocation returns the location a product's prices are scraped and
+// recorded at: its delivery location on shops that price by location, and
+// the zero Location elsewhere.
+func (s *Scheduler) priceLocation(product database.Product) (location.Location, error) {
+	if !scraper.LocationAware(product.Platform) {
+		return location.Location{}, nil
 	}
+	return s.db.ProductLocation(product)
+}
 
-	// Add price to history
-	if err := s.db.AddPriceHistory(product.ID, currentPrice, delta, "INR"); err != nil {
-		log.Printf("Failed to add price history for %s: %v", product.ID, err)
+// compactPriceHistory rolls raw samples older than the raw retention window
+// into daily rollups and expires old rollups.
+func (s *Scheduler) compactPriceHistory() {
+	log.Println("Compacting price history...")
+
+	result, err := s.db.CompactPriceHistory(s.config.RawHistoryDays, s.config.RollupHistoryDays)
+	if err != nil {
+		log.Printf("Failed to compact price history: %v", err)
 		return
 	}
 
-	log.Printf("Successfully scraped price for %s: ₹%.2f", product.Name, currentPrice)
+	log.Printf("Price history compacted: %d rows rolled into %d daily rows, %d expired rollups deleted",
+		result.RowsDeleted, result.DaysRolledUp, result.RollupsDeleted)
 }
 
-func (s *Scheduler) checkAndSendAlert(product database.Product, currentPrice float64) error {
+// RecordScrapeStatus stores the outcome of a scrape on the product so the
+// product list can be filtered by stock and scrape health, and notes
+// failures and stock changes for the digests.
+func (s *Scheduler) RecordScrapeStatus(product database.Product, scrapeErr error) {
+	status, message, inStock := database.ScrapeStatusSuccess, "", true
+	switch {
+	case errors.Is(scrapeErr, scraper.ErrOutOfStock):
+		inStock = false
+	case scrapeErr != nil:
+		status, message, inStock = database.ScrapeStatusFailed, scrapeErr.Error(), product.InStock
+	}
+
+	if err := s.db.UpdateScrapeStatus(product.ID, status, message, inStock); err != nil {
+		log.Printf("Failed to record scrape status for %s: %v", product.ID, err)
+	}
+
+	// Note failures and stock changes for the digests
+	switch {
+	case status == database.ScrapeStatusFailed:
+		s.recordEntry(digest.KindScrapeFailed, product.ID, nil, nil, message)
+	case inStock && !product.InStock:
+		s.recordEntry(digest.KindBackInStock, product.ID, nil, nil, "")
+	case !inStock && product.InStock:
+		s.recordEntry(digest.KindOutOfStock, product.ID, nil, nil, "")
+	}
+}
+
+// checkAlert returns the alert to store along with a product's new price
+// when it reaches its lowest price in the configured period or its target
+// price, or makes one of the movements the product opted in to alerts on,
+// or nil if there is none, comparing only with prices seen at the same
+// location. Listings in a group only alert on movements, their drops
+// counting towards the group's best price. When the current and previous
+// prices both have comparable unit prices, the unit prices decide, so a
+// smaller pack at a lower price is not reported as a drop. Products
+// alerting on their effective price compare prices after offers instead,
+// effectivePrice being nil when the applied offers took nothing off.
+func (s *Scheduler) checkAlert(product database.Product, at location.Location, currentPrice money.Money, unitPrice *packsize.UnitPrice,
+	effectivePrice *money.Money, applied []offers.Offer) (*database.OutboxAlert, error) {
+	latestPrice := s.db.GetLatestPrice
+	var listedPrice *money.Money
+	var offerTexts []string
+	if product.AlertOn == database.AlertOnEffectivePrice {
+		latestPrice = s.db.GetLatestEffectivePrice
+		listed := currentPrice
+		listedPrice = &listed
+		for _, offer := range applied {
+			offerTexts = append(offerTexts, offer.Text)
+		}
+		// Unit prices are of listed prices, so they do not decide here.
+		if effectivePrice != nil {
+			currentPrice = *effectivePrice
+		}
+		unitPrice = nil
+	}
+
 	// Get the previous price
-	previousPrice, err := s.db.GetLatestPrice(product.ID)
+	previousPrice, err := latestPrice(product.ID, at)
 	if err != nil {
 		// If no previous price, this is the first scrape
-		return nil
+		return nil, nil
 	}
+	previousUnit, err := s.db.GetLatestUnitPrice(product.ID, at)
+	if err != nil {
+		return nil, err
+	}
+	byUnit := unitPrice != nil && previousUnit != nil && unitPrice.Comparable(*previousUnit)
 
-	// If prices are the same, no need to send alert
-	if currentPrice == previousPrice {
-		return nil
+	// If prices are the same, no need to send alert; prices in another
+	// currency cannot be compared.
+	if !currentPrice.SameCurrency(previousPrice) {
+		return nil, nil
+	}
+	if product.GroupID != nil {
+		return s.checkMovement(product, at, previousPrice, currentPrice)
+	}
+	if (byUnit && unitPrice.Price.Equal(previousUnit.Price)) || (!byUnit && currentPrice.Equal(previousPrice)) {
+		return nil, nil
+	}
+
+	prices := AlertPrices{At: at, Previous: previousPrice, Current: currentPrice, Listed: listedPrice, Offers: offerTexts}
+	if byUnit {
+		prices.PreviousUnit, prices.CurrentUnit = previousUnit, unitPrice
 	}
 
 	// Get the lowest price in the configured period
-	lowestPrice, err := s.db.GetLowestPriceInPeriod(product.ID, s.config.PriceHistoryDays)
+	isLowest, lowestText, atLowest, err := s.lowestInPeriod(product, prices)
 	if err != nil {
 		log.Printf("Failed to get lowest price for %s: %v", product.ID, err)
-		return err
+		return nil, err
 	}
 
+	reachedTarget := reachedTarget(product.TargetPrice, previousPrice, currentPrice)
+
 	// Check if current price is the lowest in the period
-	if lowestPrice == 0 || currentPrice <= lowestPrice {
-		// Send alert
-		message := fmt.Sprintf(
-			"🚨 PRICE DROP ALERT! 🚨\n\n"+
-				"Product: %s\n"+
-				"Platform: %s\n"+
-				"Previous Price: ₹%.2f\n"+
-				"Current Price: ₹%.2f\n"+
-				"Savings: ₹%.2f\n"+
-				"Lowest in %d days: %s\n\n"+
-				"🔗 %s",
-			product.Name,
-			product.Platform,
-			previousPrice,
-			currentPrice,
-			previousPrice-currentPrice,
-			s.config.PriceHistoryDays,
-			func() string {
-				if currentPrice == lowestPrice {
-					return "YES! 🎉"
-				}
-				return fmt.Sprintf("₹%.2f", lowestPrice)
-			}(),
-			product.URL,
-		)
-
-		// Send to Telegram
-		if err := s.tgBot.SendMessage(message); err != nil {
-			log.Printf("Failed to send Telegram alert: %v", err)
-			return err
-		}
-
-		// Store alert in database
-		if err := s.db.CreateAlert(product.ID, previousPrice, currentPrice, "INR", message); err != nil {
-			log.Printf("Failed to store alert: %v", err)
-		}
-
-		log.Printf("Alert sent for %s: Price dropped from ₹%.2f to ₹%.2f",
-			product.Name, previousPrice, currentPrice)
+	if isLowest || reachedTarget {
+		// Warn about drops that only undo a hike or do not beat the usual
+		// price, and optionally skip them unless they reach the target.
+		data, analysis := s.dropAlertData(product, prices, lowestText, atLowest, reachedTarget, time.Now())
+		suppressed := ""
+		if analysis.Suspicious && s.config.SuppressFakeDiscounts && !reachedTarget {
+			suppressed = "fake discount: " + strings.Join(analysis.Reasons, "; ")
+		}
+
+		// Render the alert from its templates
+		templates := s.alertTemplates()
+		message := s.renderAlert(templates, "", data)
+
+		// Hold back alerts too soon after, or too close to, the last one;
+		// suppressed alerts are still recorded.
+		if suppressed == "" {
+			if suppressed, err = s.throttleAlert(product, at, currentPrice); err != nil {
+				log.Printf("Failed to check recent alerts for %s: %v", product.ID, err)
+			}
+		}
+		alert := &database.OutboxAlert{Type: data.Type, ProductID: product.ID, OldPrice: previousPrice, NewPrice: currentPrice, Message: message}
+		if suppressed != "" {
+			alert.SuppressedReason = suppressed
+			return alert, nil
+		}
+
+		// Deliver it, or hold it for the digests of channels in digest
+		// mode unless it is urgent
+		s.planDeliveries(alert, templates, data, "Price drop: "+product.Name)
+		return alert, nil
 	}
 
-	return nil
+	return s.checkMovement(product, at, previousPrice, currentPrice)
 }
 
-// ManualScrape allows manual triggering of price scraping for a specific product
-func (s *Scheduler) ManualScrape(productID string) error {
-	// Get product details
-	products, err := s.db.GetProducts()
+// movementSubjects are the subjects of the movement alerts, by type.
+var movementSubjects = map[string]string{
+	digest.AlertIncrease: "Price increase: ",
+	digest.AlertVolatile: "Price volatility: ",
+	digest.AlertNormal:   "Price back to normal: ",
+}
+
+// checkMovement returns the alert about a product's price rising, moving
+// much more than usual or getting back to normal after a sale, for the
+// alerts the product opted in to, or nil if there is none.
+func (s *Scheduler) checkMovement(product database.Product, at location.Location, previousPrice, currentPrice money.Money) (*database.OutboxAlert, error) {
+	rules := movement.Rules{
+		Volatility:       product.AlertVolatility,
+		VolatilityFactor: s.config.VolatilityAlertFactor,
+		BackToNormal:     product.AlertBackToNormal,
+		SalePercent:      s.config.SaleDipPercent,
+	}
+	if product.AlertIncreasePercent != nil {
+		rules.IncreasePercent = *product.AlertIncreasePercent
+	}
+	if !rules.Any() {
+		return nil, nil
+	}
+
+	points, summary, ok, err := s.priceStats(product, at, currentPrice)
+	if err != nil || !ok {
+		return nil, err
+	}
+	now := time.Now()
+	fired, ok := rules.Check(points, previousPrice, currentPrice, now)
+	if !ok {
+		return nil, nil
+	}
+
+	data := s.movementAlertData(product, AlertPrices{At: at, Previous: previousPrice, Current: currentPrice}, fired, summary, now)
+	templates := s.alertTemplates()
+	alert := &database.OutboxAlert{Type: fired.Type, ProductID: product.ID, OldPrice: previousPrice, NewPrice: currentPrice,
+		Message: s.renderAlert(templates, "", data)}
+
+	// Only the cooldown applies, between alerts of the same type; a
+	// volatile week is alerted on once.
+	throttleRules := throttle.Rules{Cooldown: s.alertRules(product.AlertCooldownMinutes).Cooldown}
+	if week := movement.RecentDays * 24 * time.Hour; fired.Type == digest.AlertVolatile && throttleRules.Cooldown < week {
+		throttleRules.Cooldown = week
+	}
+	sent, err := s.db.GetSentAlertsOfType(product.ID, fired.Type, now.Add(-throttleRules.Window()))
 	if err != nil {
-		return fmt.Errorf("failed to get products: %w", err)
+		log.Printf("Failed to check recent alerts for %s: %v", product.ID, err)
+	}
+	if alert.SuppressedReason = throttleRules.Check(currentPrice, now, sent, nil); alert.SuppressedReason != "" {
+		return alert, nil
 	}
 
-	var targetProduct database.Product
-	found := false
-	for _, product := range products {
-		if product.ID == productID {
-			targetProduct = product
-			found = true
-			break
+	s.planDeliveries(alert, templates, data, movementSubjects[fired.Type]+product.Name)
+	return alert, nil
+}
+
+// alertRules returns the configured alert throttling rules, with a
+// product's own cooldown if cooldownMinutes is not nil.
+func (s *Scheduler) alertRules(cooldownMinutes *int) throttle.Rules {
+	rules := throttle.Rules{
+		Cooldown:    s.config.AlertCooldown,
+		DedupWindow: time.Duration(s.config.AlertDedupDays) * 24 * time.Hour,
+		Hysteresis:  s.config.AlertHysteresis,
+	}
+	if cooldownMinutes != nil {
+		rules.Cooldown = time.Duration(*cooldownMinutes) * time.Minute
+	}
+	return rules
+}
+
+// throttleAlert returns why an alert about a product's drop to price at a
+// location is suppressed, or "" if it is sent, from the alerts sent about
+// it and the prices seen since the last one.
+func (s *Scheduler) throttleAlert(product database.Product, at location.Location, price money.Money) (string, error) {
+	rules := s.alertRules(product.AlertCooldownMinutes)
+	now := time.Now()
+	sent, err := s.db.GetSentAlerts(product.ID, now.Add(-rules.Window()))
+	if err != nil || len(sent) == 0 {
+		return "", err
+	}
+	since, err := s.db.GetPricePoints(product.ID, at, sent[0].At, product.AlertOn == database.AlertOnEffectivePrice)
+	if err != nil {
+		return "", err
+	}
+	return rules.Check(price, now, sent, since), nil
+}
+
+// analyzeDrop judges a drop to price at a location against the product's
+// listed price history, or its effective price history if it alerts on
+// effective prices.
+func (s *Scheduler) analyzeDrop(product database.Product, at location.Location, price money.Money) (discount.Analysis, error) {
+	now := time.Now()
+	days := discount.Lookback(discount.DefaultWindows, s.config.FakeDiscountHikeDays)
+	history, err := s.db.GetPricePoints(product.ID, at, now.AddDate(0, 0, -days), product.AlertOn == database.AlertOnEffectivePrice)
+	if err != nil {
+		return discount.Analysis{}, err
+	}
+	return discount.Analyze(history, price, now, discount.DefaultWindows, s.config.FakeDiscountHikeDays), nil
+}
+
+// priceStats computes a product's price statistics at a location from its
+// whole history and price, the price just scraped, using effective prices
+// if it alerts on them. It returns the history the statistics are of.
+func (s *Scheduler) priceStats(product database.Product, at location.Location, price money.Money) ([]stats.Point, stats.Stats, bool, error) {
+	history, err := s.db.GetPricePoints(product.ID, at, time.Time{}, product.AlertOn == database.AlertOnEffectivePrice)
+	if err != nil {
+		return nil, stats.Stats{}, false, err
+	}
+	now := time.Now()
+	history = append(history, stats.Point{At: now, Price: price})
+	summary, ok := stats.Compute(history, now)
+	return history, summary, ok, nil
+}
+
+// ManualScrape scrapes a product now, through the same pipeline as the
+// scheduled scrapes, and returns what it found.
+func (s *Scheduler) ManualScrape(productID string) (*ScrapeResult, error) {
+	product, err := s.db.GetProduct(productID)
+	if err != nil {
+		return nil, err
+	}
+	return s.scrapeProduct(*product)
+}
+
+// displayConverter returns a function that renders a price in the
+// display_currency setting, such as "$12.34", or "" when no display
+// currency is set, it matches the price's currency, or no rate is known.
+func (s *Scheduler) displayConverter() func(money.Money) string {
+	none := func(money.Money) string { return "" }
+
+	currency, err := s.db.GetSetting(database.SettingDisplayCurrency, "")
+	if err != nil || currency == "" {
+		return none
+	}
+	rates, err := s.db.LoadRates()
+	if err != nil {
+		log.Printf("Failed to load exchange rates: %v", err)
+		return none
+	}
+
+	now := time.Now()
+	return func(m money.Money) string {
+		if m.Currency == currency {
+			return ""
+		}
+		converted, err := rates.Convert(m, currency, now)
+		if err != nil {
+			return ""
 		}
+		return converted.Format()
 	}
+}
 
-	if !found {
-		return fmt.Errorf("product not found: %s", productID)
+// checkGroupAlert compares the cheapest in-stock listing of a group with the
+// best price seen before and alerts when it dropped. Listings in other
+// currencies are compared at today's exchange rates.
+func (s *Scheduler) checkGroupAlert(groupID string) error {
+	group, err := s.db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+	listings, err := s.db.GetGroupListings(groupID)
+	if err != nil {
+		return err
+	}
+	rates, err := s.db.LoadRates()
+	if err != nil {
+		return err
 	}
 
-	// Scrape the product
-	s.scrapeProductPrice(targetProduct)
+	cheapest := database.CheapestListing(listings, group.Currency, rates, time.Now())
+	if cheapest < 0 {
+		return nil
+	}
+	best := listings[cheapest]
+	bestPrice := *best.DisplayPrice
+	if group.BestPrice != nil && bestPrice.Equal(*group.BestPrice) {
+		return nil
+	}
+
+	if group.BestPrice == nil || bestPrice.Cmp(*group.BestPrice) >= 0 {
+		// First best price or a rise: nothing to alert about.
+		_, err := s.db.UpdateGroupBestPrice(groupID, group.BestPrice, bestPrice)
+		return err
+	}
+	previousBest := *group.BestPrice
+
+	reachedTarget := reachedTarget(group.TargetPrice, previousBest, bestPrice)
+
+	data := alertmsg.Data{
+		Type:          digest.AlertGroup,
+		Rule:          "new best price of " + group.Name,
+		Product:       alertmsg.Product{ID: best.ID, Name: best.Name, Platform: best.Platform, URL: best.URL},
+		Group:         &alertmsg.Group{ID: group.ID, Name: group.Name},
+		Seen:          quiet.Stamp(time.Now().In(s.timeZone())),
+		Previous:      previousBest,
+		Current:       bestPrice,
+		Savings:       previousBest.Sub(bestPrice),
+		Target:        group.TargetPrice,
+		ReachedTarget: reachedTarget,
+		Links:         alertmsg.Links{Listing: best.URL, Page: s.pageURL("/groups/" + group.ID)},
+	}
+	if !best.CurrentPrice.SameCurrency(bestPrice) {
+		data.ListedPrice = best.CurrentPrice
+	}
+	if best.UnitPrice != nil {
+		data.CurrentUnit = best.UnitPrice.String()
+	}
+	templates := s.alertTemplates()
+	message := s.renderAlert(templates, "", data)
+
+	// Group best prices are not kept over time, so only the cooldown and
+	// deduplication apply to them.
+	rules := s.alertRules(nil)
+	rules.Hysteresis = 0
+	now := time.Now()
+	recent, err := s.db.GetSentGroupAlerts(groupID, now.Add(-rules.Window()))
+	if err != nil {
+		log.Printf("Failed to check recent alerts for group %s: %v", groupID, err)
+	}
+	groupAlert := database.OutboxAlert{Type: digest.AlertGroup, GroupID: &groupID, ProductID: best.ID, OldPrice: previousBest, NewPrice: bestPrice, Message: message,
+		SuppressedReason: rules.Check(bestPrice, now, recent, nil)}
+	if groupAlert.SuppressedReason == "" {
+		s.planDeliveries(&groupAlert, templates, data, "Group best price drop: "+group.Name)
+	}
+
+	// Record the new best price along with the alert; if another worker
+	// changed it first, that one alerts instead.
+	updated, err := s.db.UpdateGroupBestPriceWithAlert(groupID, group.BestPrice, bestPrice, groupAlert)
+	if err != nil || !updated {
+		return err
+	}
+	s.alertStored(group.Name, groupAlert)
 	return nil
 }
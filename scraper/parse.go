@@ -0,0 +1,164 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"price-watcher/money"
+)
+
+// currencySigns maps price prefixes and suffixes to currency codes. "$" and
+// "¥" are shared by several currencies; see signCurrency.
+var currencySigns = map[string]string{
+	"₹":   "INR",
+	"rs":  "INR",
+	"rs.": "INR",
+	"$":   "USD",
+	"us$": "USD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"¥":   "JPY",
+}
+
+// dollarCurrencies use "$" locally.
+var dollarCurrencies = map[string]bool{"USD": true, "CAD": true, "AUD": true, "NZD": true, "SGD": true, "HKD": true}
+
+// priceRe matches the first price in a text: an optional currency sign or
+// ISO code, a number with grouping and decimal separators, and an optional
+// trailing sign or code ("12,50 €", "12.50 EUR").
+var priceRe = regexp.MustCompile(
+	`(?i)(₹|€|£|¥|us\$|\$|\brs\.?|\b[a-z]{3}\b)?[\s\x{00a0}]*` +
+		`([0-9][0-9.,'\x{00a0}\x{202f}]*)` +
+		`(?:[\s\x{00a0}]*(₹|€|£|¥|\$|\b[a-z]{3}\b))?`)
+
+// ParsePrice reads the first price in text, such as "₹1,99,999", "$1,299.99",
+// "1.299,99 €" or "EUR 12,50". For ranges like "₹499 – ₹699" it returns the
+// lower, first price. The currency comes from a sign or ISO code next to the
+// number, falling back to defaultCurrency.
+func ParsePrice(text, defaultCurrency string) (money.Money, error) {
+	m := priceRe.FindStringSubmatch(text)
+	if m == nil {
+		return money.Money{}, fmt.Errorf("no price found in text: %s", text)
+	}
+
+	currency, ok := signCurrency(m[1], defaultCurrency)
+	if !ok {
+		// A word that is not a currency, e.g. "MRP 499".
+		currency = defaultCurrency
+	}
+	if (m[1] == "" || !ok) && m[3] != "" {
+		if suffix, ok := signCurrency(m[3], defaultCurrency); ok {
+			currency = suffix
+		}
+	}
+
+	amount, err := normalizeNumber(m[2], money.MinorDigits(currency))
+	if err != nil {
+		return money.Money{}, err
+	}
+	price, err := money.Parse(amount, currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("failed to parse price %q: %w", strings.TrimSpace(m[0]), err)
+	}
+	return price, nil
+}
+
+// signCurrency resolves a currency sign or code. An empty sign resolves to
+// defaultCurrency.
+func signCurrency(sign, defaultCurrency string) (string, bool) {
+	if sign == "" {
+		return defaultCurrency, true
+	}
+	lower := strings.ToLower(sign)
+	if code, ok := currencySigns[lower]; ok {
+		switch {
+		case code == "USD" && lower == "$" && dollarCurrencies[defaultCurrency]:
+			return defaultCurrency, true
+		case code == "JPY" && defaultCurrency == "CNY":
+			return defaultCurrency, true
+		}
+		return code, true
+	}
+	if code := strings.ToUpper(sign); knownCurrencies[code] {
+		return code, true
+	}
+	return "", false
+}
+
+// knownCurrencies are the ISO codes recognised next to a price in text.
+// Arbitrary three-letter words are too easily mistaken for codes.
+var knownCurrencies = map[string]bool{
+	"INR": true, "USD": true, "EUR": true, "GBP": true, "JPY": true, "CNY": true,
+	"CAD": true, "AUD": true, "NZD": true, "SGD": true, "HKD": true, "AED": true,
+	"CHF": true, "SEK": true, "NOK": true, "DKK": true, "KWD": true, "BHD": true,
+}
+
+// normalizeNumber turns a displayed number into a plain decimal. Grouping may
+// use commas (including Indian lakh/crore grouping), dots, apostrophes or
+// spaces; the decimal separator may be a dot or a comma.
+func normalizeNumber(s string, minorDigits int) (string, error) {
+	s = strings.TrimRight(s, ".,")
+	s = strings.NewReplacer("'", "", "\u00a0", "", "\u202f", "").Replace(s)
+
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	decimal := ""
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Whichever separator comes last is the decimal one: "1,299.99" or "1.299,99".
+		decimal = "."
+		if lastComma > lastDot {
+			decimal = ","
+		}
+	case lastComma >= 0:
+		// "12,50" is a decimal comma; "1,999" and "10,99,999" are grouping.
+		if strings.Count(s, ",") == 1 && len(s)-lastComma-1 <= 2 {
+			decimal = ","
+		}
+	case lastDot >= 0:
+		// "1.299" is grouping unless the currency has three decimals; "1.299.000" always is.
+		if strings.Count(s, ".") == 1 && (len(s)-lastDot-1 != 3 || minorDigits == 3) {
+			decimal = "."
+		}
+	}
+
+	whole, frac := s, ""
+	if decimal != "" {
+		i := strings.LastIndex(s, decimal)
+		whole, frac = s[:i], s[i+1:]
+	}
+	whole = strings.NewReplacer(",", "", ".", "").Replace(whole)
+	if whole == "" {
+		return "", fmt.Errorf("invalid price %q", s)
+	}
+	if frac == "" {
+		return whole, nil
+	}
+	return whole + "." + frac, nil
+}
+
+// currencyHintRe finds a currency declared in structured data, e.g.
+// "priceCurrency": "USD" in JSON-LD.
+var currencyHintRe = regexp.MustCompile(`"priceCurrency"\s*:\s*"([A-Za-z]{3})"`)
+
+// currencyTLDs maps country domains to their currency. Generic domains such
+// as .com say nothing about the currency.
+var currencyTLDs = map[string]string{
+	"in": "INR", "uk": "GBP", "jp": "JPY", "ca": "CAD", "au": "AUD", "sg": "SGD", "ae": "AED",
+	"de": "EUR", "fr": "EUR", "it": "EUR", "es": "EUR", "nl": "EUR", "ie": "EUR", "be": "EUR", "at": "EUR",
+}
+
+// CurrencyForURL guesses a product's currency from its shop's country domain,
+// e.g. EUR for amazon.de, defaulting to money.DefaultCurrency.
+func CurrencyForURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return money.DefaultCurrency
+	}
+	host := strings.ToLower(u.Hostname())
+	if code, ok := currencyTLDs[host[strings.LastIndex(host, ".")+1:]]; ok {
+		return code
+	}
+	return money.DefaultCurrency
+}
@@ -1,30 +1,247 @@
 package scraper
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
 
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/offers"
+	"price-watcher/packsize"
+
 	"github.com/gocolly/colly"
 )
 
+// ErrOutOfStock is returned by ScrapePrice when the page marks the product
+// as unavailable instead of showing a price.
+var ErrOutOfStock = errors.New("product is out of stock")
+
+// ErrLocationNeedsCoordinates is returned by SetLocation when a shop that
+// locates deliveries by map coordinates is given only a pincode.
+var ErrLocationNeedsCoordinates = errors.New("this shop needs the location's coordinates, not just a pincode")
+
 type Scraper interface {
-	ScrapePrice(url string) (float64, error)
+	ScrapePrice(url string) (money.Money, error)
 	GetPlatformName() string
+	// Title returns the product title found by the last ScrapePrice call,
+	// or "" if the page had none.
+	Title() string
+	// PackSize returns the pack size found by the last ScrapePrice call,
+	// for products sold by weight, volume or count.
+	PackSize() (packsize.Size, bool)
+	// Offers returns the coupons and bank offers found by the last
+	// ScrapePrice call, reading their amounts in currency.
+	Offers(currency string) []offers.Offer
+	// SetLocation sets the delivery location later scrapes are made from.
+	// Shops that do not price by location ignore it.
+	SetLocation(loc location.Location) error
 }
 
 type BaseScraper struct {
 	collector *colly.Collector
+	title     string
+	titleRank int
+	packSize  string
+	offers    []string
+	// sizeFromTitle falls back to a size in the title when the page has no
+	// pack size element, for shops whose titles name the pack.
+	sizeFromTitle bool
+	// locate sends the delivery location with each request, for shops
+	// whose prices and stock depend on it.
+	locate   func(r *colly.Request, loc location.Location)
+	location location.Location
 }
 
+// titleSelectors find a page's product title, best first: shop-specific
+// title elements, Open Graph, the main heading and the document title.
+var titleSelectors = []string{"#productTitle, span.VU-ZEz, span.B_NuCI", "meta[property='og:title']", "h1", "title"}
+
+// packSizeSelector finds the pack size element quick-commerce pages show
+// next to the price, such as "500 g" or "6 x 200 ml".
+const packSizeSelector = "[itemprop='weight'], [data-testid='pdp-product-quantity'], [data-testid='quantity']"
+
+// offerSelector finds coupons and bank offers: Amazon's coupon label and
+// bank offer cards, and Flipkart's available offers list.
+const offerSelector = "label[id^='couponText'], #itembox-InstantBankDiscount .a-truncate-full, li.kF1Ml8"
+
 func NewBaseScraper() *BaseScraper {
 	c := colly.NewCollector(
 		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
 		colly.AllowURLRevisit(),
 	)
 
-	return &BaseScraper{collector: c}
+	b := &BaseScraper{collector: c, titleRank: len(titleSelectors)}
+	c.OnRequest(func(r *colly.Request) {
+		b.title, b.titleRank, b.packSize, b.offers = "", len(titleSelectors), "", nil
+		if b.locate != nil && !b.location.IsZero() {
+			b.locate(r, b.location)
+		}
+	})
+	for rank, selector := range titleSelectors {
+		rank := rank
+		c.OnHTML(selector, func(e *colly.HTMLElement) {
+			text := e.Text
+			if e.Name == "meta" {
+				text = e.Attr("content")
+			}
+			if title := cleanTitle(text, rank > 0); title != "" && rank < b.titleRank {
+				b.title, b.titleRank = title, rank
+			}
+		})
+	}
+
+	c.OnHTML(packSizeSelector, func(e *colly.HTMLElement) {
+		text := e.Text
+		if e.Name == "meta" {
+			text = e.Attr("content")
+		}
+		if b.packSize == "" {
+			b.packSize = strings.TrimSpace(text)
+		}
+	})
+
+	c.OnHTML(offerSelector, func(e *colly.HTMLElement) {
+		b.offers = append(b.offers, e.Text)
+	})
+
+	return b
+}
+
+func (b *BaseScraper) Title() string {
+	return b.title
+}
+
+func (b *BaseScraper) PackSize() (packsize.Size, bool) {
+	if size, ok := packsize.Parse(b.packSize); ok {
+		return size, true
+	}
+	if b.sizeFromTitle {
+		return packsize.Parse(b.title)
+	}
+	return packsize.Size{}, false
+}
+
+func (b *BaseScraper) Offers(currency string) []offers.Offer {
+	return offers.ParseAll(b.offers, currency)
+}
+
+func (b *BaseScraper) SetLocation(loc location.Location) error {
+	if b.locate == nil {
+		return nil
+	}
+	if !loc.IsZero() && !loc.HasCoordinates() {
+		return fmt.Errorf("location %s: %w", loc, ErrLocationNeedsCoordinates)
+	}
+	b.location = loc
+	return nil
+}
+
+// newQuickCommerceScraper returns a scraper for a grocery shop, whose
+// titles name the pack size and whose prices depend on the delivery
+// location locate sends.
+func newQuickCommerceScraper(locate func(r *colly.Request, loc location.Location)) *BaseScraper {
+	b := NewBaseScraper()
+	b.sizeFromTitle = true
+	b.locate = locate
+	return b
+}
+
+// locationPlatforms are the platforms whose prices depend on the delivery
+// location.
+var locationPlatforms = map[string]bool{"blinkit": true, "zepto": true, "instamart": true}
+
+// LocationAware reports whether platform prices by delivery location, so
+// its price history is kept per location.
+func LocationAware(platform string) bool {
+	return locationPlatforms[platform]
+}
+
+// addCookies adds cookies to a request's Cookie header.
+func addCookies(r *colly.Request, cookies ...string) {
+	if existing := r.Headers.Get("Cookie"); existing != "" {
+		cookies = append([]string{existing}, cookies...)
+	}
+	r.Headers.Set("Cookie", strings.Join(cookies, "; "))
+}
+
+// locateBlinkit sets the coordinates Blinkit's site keeps in cookies and
+// sends with its API calls.
+func locateBlinkit(r *colly.Request, loc location.Location) {
+	lat, lng := loc.Coordinates()
+	addCookies(r, "gr_1_lat="+lat, "gr_1_lon="+lng)
+	r.Headers.Set("lat", lat)
+	r.Headers.Set("lon", lng)
+}
+
+// locateZepto sets the coordinates cookies Zepto picks a store by.
+func locateZepto(r *colly.Request, loc location.Location) {
+	lat, lng := loc.Coordinates()
+	addCookies(r, "latitude="+lat, "longitude="+lng)
+}
+
+// locateInstamart sets Swiggy's userLocation cookie, which holds the
+// delivery address as JSON.
+func locateInstamart(r *colly.Request, loc location.Location) {
+	userLocation, _ := json.Marshal(struct {
+		Lat     float64 `json:"lat"`
+		Lng     float64 `json:"lng"`
+		Address string  `json:"address"`
+	}{loc.Latitude, loc.Longitude, loc.Pincode})
+	addCookies(r, "userLocation="+url.QueryEscape(string(userLocation)))
+}
+
+// cleanTitle collapses whitespace and, for generic page titles, drops a
+// trailing site name such as " | Flipkart.com" or " : Amazon.in: Electronics".
+func cleanTitle(text string, generic bool) string {
+	title := strings.Join(strings.Fields(text), " ")
+	if generic {
+		for _, sep := range []string{" | ", " : "} {
+			if i := strings.Index(title, sep); i > 0 {
+				title = title[:i]
+			}
+		}
+	}
+	return title
+}
+
+// pageCurrency is the currency a page declares in its structured data.
+type pageCurrency struct {
+	code string
+}
+
+// watchCurrency records the currency declared by microdata, Open Graph
+// product tags or JSON-LD on the next visited page.
+func (b *BaseScraper) watchCurrency() *pageCurrency {
+	pc := &pageCurrency{}
+	set := func(code string) {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if pc.code == "" && money.IsCode(code) {
+			pc.code = code
+		}
+	}
+
+	b.collector.OnHTML("meta[itemprop='priceCurrency'], meta[property='product:price:currency'], meta[property='og:price:currency']", func(e *colly.HTMLElement) {
+		set(e.Attr("content"))
+	})
+	b.collector.OnHTML("script[type='application/ld+json']", func(e *colly.HTMLElement) {
+		if m := currencyHintRe.FindStringSubmatch(e.Text); m != nil {
+			set(m[1])
+		}
+	})
+
+	return pc
+}
+
+// orURL returns the declared currency, or the one guessed from url.
+func (pc *pageCurrency) orURL(url string) string {
+	if pc.code != "" {
+		return pc.code
+	}
+	return CurrencyForURL(url)
 }
 
 // Amazon scraper
@@ -40,30 +257,49 @@ func (a *AmazonScraper) GetPlatformName() string {
 	return "amazon"
 }
 
-func (a *AmazonScraper) ScrapePrice(url string) (float64, error) {
-	var price float64
+func (a *AmazonScraper) ScrapePrice(url string) (money.Money, error) {
+	var price money.Money
 	var err error
-	var productPrice string
+	var productPrice, symbol string
 	var priceFound bool
+	var outOfStock bool
+	currency := a.watchCurrency()
 
 	a.collector.OnHTML("#corePriceDisplay_desktop_feature_div .a-price-whole", func(e *colly.HTMLElement) {
 		// Avoid overwriting if multiple similar elements are found.
 		if !priceFound {
 			rawPrice := e.Text
 
-			// Use a regular expression to remove any non-digit characters (like commas).
+			// Use a regular expression to remove any non-digit characters
+			// (grouping separators, which differ between locales).
 			re := regexp.MustCompile(`[^\d]`)
 			productPrice = re.ReplaceAllString(rawPrice, "")
 			priceFound = true
 		}
 	})
+	a.collector.OnHTML("#corePriceDisplay_desktop_feature_div .a-price-symbol", func(e *colly.HTMLElement) {
+		if symbol == "" {
+			symbol = strings.TrimSpace(e.Text)
+		}
+	})
+	a.collector.OnHTML("#availability", func(e *colly.HTMLElement) {
+		text := strings.ToLower(e.Text)
+		if strings.Contains(text, "currently unavailable") || strings.Contains(text, "out of stock") {
+			outOfStock = true
+		}
+	})
 	if err := a.collector.Visit(url); err != nil {
-		return 0, fmt.Errorf("failed to visit Amazon URL: %w", err)
+		return money.Money{}, fmt.Errorf("failed to visit Amazon URL: %w", err)
+	}
+	if productPrice != "" {
+		price, err = ParsePrice(symbol+productPrice, currency.orURL(url))
 	}
-	price, err = strconv.ParseFloat(productPrice, 64)
 
-	if price == 0 {
-		return 0, fmt.Errorf("price not found on Amazon page")
+	if price.IsZero() && outOfStock {
+		return money.Money{}, ErrOutOfStock
+	}
+	if price.IsZero() {
+		return money.Money{}, fmt.Errorf("price not found on Amazon page")
 	}
 
 	return price, err
@@ -82,21 +318,35 @@ func (f *FlipkartScraper) GetPlatformName() string {
 	return "flipkart"
 }
 
-func (f *FlipkartScraper) ScrapePrice(url string) (float64, error) {
-	var price float64
+func (f *FlipkartScraper) ScrapePrice(url string) (money.Money, error) {
+	var price money.Money
 	var err error
+	var priceText string
+	var outOfStock bool
+	currency := f.watchCurrency()
 
 	f.collector.OnHTML("div.Nx9bqj.CxhGGd", func(e *colly.HTMLElement) {
-		priceText := strings.ReplaceAll(strings.TrimPrefix(e.Text, "₹"), ",", "")
-		price, err = strconv.ParseFloat(priceText, 64)
+		priceText = e.Text
+	})
+	f.collector.OnHTML("div._16FRp0", func(e *colly.HTMLElement) {
+		text := strings.ToLower(e.Text)
+		if strings.Contains(text, "sold out") || strings.Contains(text, "currently unavailable") {
+			outOfStock = true
+		}
 	})
 
 	if err := f.collector.Visit(url); err != nil {
-		return 0, fmt.Errorf("failed to visit Flipkart URL: %w", err)
+		return money.Money{}, fmt.Errorf("failed to visit Flipkart URL: %w", err)
+	}
+	if priceText != "" {
+		price, err = ParsePrice(priceText, currency.orURL(url))
 	}
 
-	if price == 0 {
-		return 0, fmt.Errorf("price not found on Flipkart page")
+	if outOfStock {
+		return money.Money{}, ErrOutOfStock
+	}
+	if price.IsZero() {
+		return money.Money{}, fmt.Errorf("price not found on Flipkart page")
 	}
 
 	return price, err
@@ -108,28 +358,32 @@ type BlinkitScraper struct {
 }
 
 func NewBlinkitScraper() *BlinkitScraper {
-	return &BlinkitScraper{BaseScraper: NewBaseScraper()}
+	return &BlinkitScraper{BaseScraper: newQuickCommerceScraper(locateBlinkit)}
 }
 
 func (b *BlinkitScraper) GetPlatformName() string {
 	return "blinkit"
 }
 
-func (b *BlinkitScraper) ScrapePrice(url string) (float64, error) {
-	var price float64
+func (b *BlinkitScraper) ScrapePrice(url string) (money.Money, error) {
+	var price money.Money
 	var err error
+	var priceText string
+	currency := b.watchCurrency()
 
 	b.collector.OnHTML("span[data-testid='price']", func(e *colly.HTMLElement) {
-		priceText := strings.ReplaceAll(strings.TrimPrefix(e.Text, "₹"), ",", "")
-		price, err = strconv.ParseFloat(priceText, 64)
+		priceText = e.Text
 	})
 
 	if err := b.collector.Visit(url); err != nil {
-		return 0, fmt.Errorf("failed to visit Blinkit URL: %w", err)
+		return money.Money{}, fmt.Errorf("failed to visit Blinkit URL: %w", err)
+	}
+	if priceText != "" {
+		price, err = ParsePrice(priceText, currency.orURL(url))
 	}
 
-	if price == 0 {
-		return 0, fmt.Errorf("price not found on Blinkit page")
+	if price.IsZero() {
+		return money.Money{}, fmt.Errorf("price not found on Blinkit page")
 	}
 
 	return price, err
@@ -141,28 +395,32 @@ type ZeptoScraper struct {
 }
 
 func NewZeptoScraper() *ZeptoScraper {
-	return &ZeptoScraper{BaseScraper: NewBaseScraper()}
+	return &ZeptoScraper{BaseScraper: newQuickCommerceScraper(locateZepto)}
 }
 
 func (z *ZeptoScraper) GetPlatformName() string {
 	return "zepto"
 }
 
-func (z *ZeptoScraper) ScrapePrice(url string) (float64, error) {
-	var price float64
+func (z *ZeptoScraper) ScrapePrice(url string) (money.Money, error) {
+	var price money.Money
 	var err error
+	var priceText string
+	currency := z.watchCurrency()
 
 	z.collector.OnHTML("span[data-testid='price']", func(e *colly.HTMLElement) {
-		priceText := strings.ReplaceAll(strings.TrimPrefix(e.Text, "₹"), ",", "")
-		price, err = strconv.ParseFloat(priceText, 64)
+		priceText = e.Text
 	})
 
 	if err := z.collector.Visit(url); err != nil {
-		return 0, fmt.Errorf("failed to visit Zepto URL: %w", err)
+		return money.Money{}, fmt.Errorf("failed to visit Zepto URL: %w", err)
+	}
+	if priceText != "" {
+		price, err = ParsePrice(priceText, currency.orURL(url))
 	}
 
-	if price == 0 {
-		return 0, fmt.Errorf("price not found on Zepto page")
+	if price.IsZero() {
+		return money.Money{}, fmt.Errorf("price not found on Zepto page")
 	}
 
 	return price, err
@@ -174,28 +432,32 @@ type InstamartScraper struct {
 }
 
 func NewInstamartScraper() *InstamartScraper {
-	return &InstamartScraper{BaseScraper: NewBaseScraper()}
+	return &InstamartScraper{BaseScraper: newQuickCommerceScraper(locateInstamart)}
 }
 
 func (i *InstamartScraper) GetPlatformName() string {
 	return "instamart"
 }
 
-func (i *InstamartScraper) ScrapePrice(url string) (float64, error) {
-	var price float64
+func (i *InstamartScraper) ScrapePrice(url string) (money.Money, error) {
+	var price money.Money
 	var err error
+	var priceText string
+	currency := i.watchCurrency()
 
 	i.collector.OnHTML("span[data-testid='price']", func(e *colly.HTMLElement) {
-		priceText := strings.ReplaceAll(strings.TrimPrefix(e.Text, "₹"), ",", "")
-		price, err = strconv.ParseFloat(priceText, 64)
+		priceText = e.Text
 	})
 
 	if err := i.collector.Visit(url); err != nil {
-		return 0, fmt.Errorf("failed to visit Instamart URL: %w", err)
+		return money.Money{}, fmt.Errorf("failed to visit Instamart URL: %w", err)
+	}
+	if priceText != "" {
+		price, err = ParsePrice(priceText, currency.orURL(url))
 	}
 
-	if price == 0 {
-		return 0, fmt.Errorf("price not found on Instamart page")
+	if price.IsZero() {
+		return money.Money{}, fmt.Errorf("price not found on Instamart page")
 	}
 
 	return price, err
@@ -214,21 +476,25 @@ func (d *DesidimeScraper) GetPlatformName() string {
 	return "desidime"
 }
 
-func (d *DesidimeScraper) ScrapePrice(url string) (float64, error) {
-	var price float64
+func (d *DesidimeScraper) ScrapePrice(url string) (money.Money, error) {
+	var price money.Money
 	var err error
+	var priceText string
+	currency := d.watchCurrency()
 
 	d.collector.OnHTML("span.deal-price", func(e *colly.HTMLElement) {
-		priceText := strings.ReplaceAll(strings.TrimPrefix(e.Text, "₹"), ",", "")
-		price, err = strconv.ParseFloat(priceText, 64)
+		priceText = e.Text
 	})
 
 	if err := d.collector.Visit(url); err != nil {
-		return 0, fmt.Errorf("failed to visit Desidime URL: %w", err)
+		return money.Money{}, fmt.Errorf("failed to visit Desidime URL: %w", err)
+	}
+	if priceText != "" {
+		price, err = ParsePrice(priceText, currency.orURL(url))
 	}
 
-	if price == 0 {
-		return 0, fmt.Errorf("price not found on Desidime page")
+	if price.IsZero() {
+		return money.Money{}, fmt.Errorf("price not found on Desidime page")
 	}
 
 	return price, err
@@ -262,21 +528,8 @@ func (sf *ScraperFactory) GetScraper(url string) (Scraper, error) {
 	}
 }
 
-// ExtractPriceFromText extracts price from text using regex
-func ExtractPriceFromText(text string) (float64, error) {
-	// Regex to find price patterns like ₹1,999 or 1999
-	re := regexp.MustCompile(`[₹]?([0-9,]+(?:\.[0-9]{2})?)`)
-	matches := re.FindStringSubmatch(text)
-
-	if len(matches) < 2 {
-		return 0, fmt.Errorf("no price found in text: %s", text)
-	}
-
-	priceStr := strings.ReplaceAll(matches[1], ",", "")
-	price, err := strconv.ParseFloat(priceStr, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse price: %w", err)
-	}
-
-	return price, nil
+// ExtractPriceFromText extracts the first price from text, reading prices
+// without a currency sign as rupees. See ParsePrice.
+func ExtractPriceFromText(text string) (money.Money, error) {
+	return ParsePrice(text, money.DefaultCurrency)
 }
@@ -1,62 +1,71 @@
 package scraper
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+
+	"price-watcher/location"
+	"price-watcher/offers"
 )
 
 func TestExtractPriceFromText(t *testing.T) {
 	tests := []struct {
 		name      string
 		input     string
-		wantPrice float64
+		wantPrice string
 		wantError bool
 	}{
 		{
 			name:      "Price with rupee symbol and comma",
 			input:     "₹1,999",
-			wantPrice: 1999,
+			wantPrice: "1999.00",
 			wantError: false,
 		},
 		{
 			name:      "Price without symbol",
 			input:     "1999",
-			wantPrice: 1999,
+			wantPrice: "1999.00",
 			wantError: false,
 		},
 		{
 			name:      "Price with decimals",
 			input:     "₹1,999.99",
-			wantPrice: 1999.99,
+			wantPrice: "1999.99",
 			wantError: false,
 		},
 		{
 			name:      "Price with multiple commas",
 			input:     "₹10,99,999",
-			wantPrice: 1099999,
+			wantPrice: "1099999.00",
 			wantError: false,
 		},
 		{
 			name:      "Simple integer price",
 			input:     "599",
-			wantPrice: 599,
+			wantPrice: "599.00",
 			wantError: false,
 		},
 		{
 			name:      "Price in sentence",
 			input:     "The price is ₹2,499 only",
-			wantPrice: 2499,
+			wantPrice: "2499.00",
 			wantError: false,
 		},
 		{
 			name:      "No price in text",
 			input:     "No price here",
-			wantPrice: 0,
+			wantPrice: "",
 			wantError: true,
 		},
 		{
 			name:      "Empty string",
 			input:     "",
-			wantPrice: 0,
+			wantPrice: "",
 			wantError: true,
 		},
 	}
@@ -77,7 +86,7 @@ func TestExtractPriceFromText(t *testing.T) {
 				return
 			}
 
-			if price != tt.wantPrice {
+			if price.String() != tt.wantPrice || price.Currency != "INR" {
 				t.Errorf("ExtractPriceFromText() = %v, want %v", price, tt.wantPrice)
 			}
 		})
@@ -183,3 +192,311 @@ func TestScraperFactory_GetScraper(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		defaultCurrency string
+		wantPrice       string
+		wantCurrency    string
+		wantError       bool
+	}{
+		{name: "Rupee lakh grouping", input: "₹1,49,999.00", defaultCurrency: "INR", wantPrice: "149999.00", wantCurrency: "INR"},
+		{name: "Rupee crore grouping", input: "₹1,00,00,000", defaultCurrency: "INR", wantPrice: "10000000.00", wantCurrency: "INR"},
+		{name: "Rs prefix", input: "Rs. 499", defaultCurrency: "USD", wantPrice: "499.00", wantCurrency: "INR"},
+		{name: "Dollar", input: "$1,299.99", defaultCurrency: "INR", wantPrice: "1299.99", wantCurrency: "USD"},
+		{name: "Dollar on a Canadian page", input: "$24.50", defaultCurrency: "CAD", wantPrice: "24.50", wantCurrency: "CAD"},
+		{name: "Pound", input: "£19.99", defaultCurrency: "INR", wantPrice: "19.99", wantCurrency: "GBP"},
+		{name: "European decimal comma", input: "1.299,99 €", defaultCurrency: "INR", wantPrice: "1299.99", wantCurrency: "EUR"},
+		{name: "Decimal comma only", input: "12,5 €", defaultCurrency: "INR", wantPrice: "12.50", wantCurrency: "EUR"},
+		{name: "Dot grouping", input: "€ 1.299", defaultCurrency: "INR", wantPrice: "1299.00", wantCurrency: "EUR"},
+		{name: "Non-breaking space grouping", input: "1\u00a0299,00 EUR", defaultCurrency: "INR", wantPrice: "1299.00", wantCurrency: "EUR"},
+		{name: "ISO code prefix", input: "USD 15", defaultCurrency: "INR", wantPrice: "15.00", wantCurrency: "USD"},
+		{name: "Range takes the lower price", input: "₹499 – ₹699", defaultCurrency: "INR", wantPrice: "499.00", wantCurrency: "INR"},
+		{name: "Label before the price", input: "MRP 799", defaultCurrency: "INR", wantPrice: "799.00", wantCurrency: "INR"},
+		{name: "Default currency", input: "2,499", defaultCurrency: "GBP", wantPrice: "2499.00", wantCurrency: "GBP"},
+		{name: "Yen has no decimals", input: "¥1,500", defaultCurrency: "INR", wantPrice: "1500", wantCurrency: "JPY"},
+		{name: "Trailing full stop", input: "Now only ₹2,499.", defaultCurrency: "INR", wantPrice: "2499.00", wantCurrency: "INR"},
+		{name: "No price", input: "Sold out", defaultCurrency: "INR", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, err := ParsePrice(tt.input, tt.defaultCurrency)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("ParsePrice(%q) expected error, got %v", tt.input, price)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePrice(%q) unexpected error: %v", tt.input, err)
+			}
+			if price.String() != tt.wantPrice || price.Currency != tt.wantCurrency {
+				t.Errorf("ParsePrice(%q) = %s %s, want %s %s", tt.input, price, price.Currency, tt.wantPrice, tt.wantCurrency)
+			}
+		})
+	}
+}
+
+func TestCurrencyForURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.amazon.in/dp/B0CHX1W1XY": "INR",
+		"https://www.amazon.de/dp/B0CHX1W1XY": "EUR",
+		"https://www.amazon.co.uk/dp/B0CHX":   "GBP",
+		"https://blinkit.com/prn/product/123": "INR",
+		"not a url":                           "INR",
+	}
+
+	for url, want := range tests {
+		if got := CurrencyForURL(url); got != want {
+			t.Errorf("CurrencyForURL(%q) = %s, want %s", url, got, want)
+		}
+	}
+}
+
+func TestScrapeTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		body string
+		want string
+	}{
+		{
+			name: "Shop title element wins",
+			head: `<title>Buy Amul Taaza Milk Online | Blinkit</title><meta property="og:title" content="Amul Taaza">`,
+			body: `<span id="productTitle">  Amul Taaza Toned Milk
+				500 ml </span><h1>Dairy</h1>`,
+			want: "Amul Taaza Toned Milk 500 ml",
+		},
+		{
+			name: "Open Graph before heading",
+			head: `<meta property="og:title" content="Apple iPhone 15 (128 GB) - Black : Amazon.in: Electronics">`,
+			body: `<h1>Deals</h1>`,
+			want: "Apple iPhone 15 (128 GB) - Black",
+		},
+		{
+			name: "Document title without site name",
+			head: `<title>Tata Salt 1 kg | Zepto</title>`,
+			want: "Tata Salt 1 kg",
+		},
+		{
+			name: "No title",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `<html><head>%s</head><body>%s<span data-testid="price">₹27</span></body></html>`, tt.head, tt.body)
+			}))
+			defer server.Close()
+
+			s := NewBlinkitScraper()
+			if _, err := s.ScrapePrice(server.URL); err != nil {
+				t.Fatalf("ScrapePrice() error = %v", err)
+			}
+			if got := s.Title(); got != tt.want {
+				t.Errorf("Title() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrapePackSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		body     string
+		want     string
+	}{
+		{
+			name:     "Pack size element",
+			platform: "blinkit",
+			body:     `<h1>Amul Butter</h1><span data-testid="pdp-product-quantity">500 g</span>`,
+			want:     "500 g",
+		},
+		{
+			name:     "Multipack element",
+			platform: "zepto",
+			body:     `<h1>Coca-Cola</h1><div data-testid="quantity">6 x 300 ml</div>`,
+			want:     "1.8 l",
+		},
+		{
+			name:     "Grocery title",
+			platform: "instamart",
+			body:     `<h1>Aashirvaad Atta 5 kg</h1>`,
+			want:     "5 kg",
+		},
+		{
+			name:     "Title ignored for other shops",
+			platform: "amazon",
+			body:     `<h1>Samsung Galaxy S23 5G</h1>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `<html><body>%s<span data-testid="price">₹27</span><div id="corePriceDisplay_desktop_feature_div"><span class="a-price-whole">27</span></div></body></html>`, tt.body)
+			}))
+			defer server.Close()
+
+			var s Scraper
+			switch tt.platform {
+			case "blinkit":
+				s = NewBlinkitScraper()
+			case "zepto":
+				s = NewZeptoScraper()
+			case "instamart":
+				s = NewInstamartScraper()
+			default:
+				s = NewAmazonScraper()
+			}
+			if _, err := s.ScrapePrice(server.URL); err != nil {
+				t.Fatalf("ScrapePrice() error = %v", err)
+			}
+			got := ""
+			if size, ok := s.PackSize(); ok {
+				got = size.String()
+			}
+			if got != tt.want {
+				t.Errorf("PackSize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrapeLocation(t *testing.T) {
+	loc, err := location.Parse("560001 12.9716,77.5946")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		scraper  Scraper
+		location location.Location
+		want     []string
+		wantErr  error
+	}{
+		{
+			name:     "Blinkit coordinates cookies",
+			scraper:  NewBlinkitScraper(),
+			location: loc,
+			want:     []string{"gr_1_lat=12.9716", "gr_1_lon=77.5946"},
+		},
+		{
+			name:     "Zepto coordinates cookies",
+			scraper:  NewZeptoScraper(),
+			location: loc,
+			want:     []string{"latitude=12.9716", "longitude=77.5946"},
+		},
+		{
+			name:     "Instamart address cookie",
+			scraper:  NewInstamartScraper(),
+			location: loc,
+			want:     []string{`userLocation=` + url.QueryEscape(`{"lat":12.9716,"lng":77.5946,"address":"560001"}`)},
+		},
+		{
+			name:     "Pincode alone is not enough",
+			scraper:  NewZeptoScraper(),
+			location: location.Location{Pincode: "560001"},
+			wantErr:  ErrLocationNeedsCoordinates,
+		},
+		{
+			name:     "Ignored by other shops",
+			scraper:  NewAmazonScraper(),
+			location: loc,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cookie string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				cookie = r.Header.Get("Cookie")
+				fmt.Fprint(w, `<html><body><span data-testid="price">₹27</span><div id="corePriceDisplay_desktop_feature_div"><span class="a-price-whole">27</span></div></body></html>`)
+			}))
+			defer server.Close()
+
+			err := tt.scraper.SetLocation(tt.location)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetLocation() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if _, err := tt.scraper.ScrapePrice(server.URL); err != nil {
+				t.Fatalf("ScrapePrice() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(cookie, want) {
+					t.Errorf("Cookie = %q, want it to contain %q", cookie, want)
+				}
+			}
+			if tt.want == nil && cookie != "" {
+				t.Errorf("Cookie = %q, want none", cookie)
+			}
+			if got, want := LocationAware(tt.scraper.GetPlatformName()), tt.want != nil; got != want {
+				t.Errorf("LocationAware(%q) = %v, want %v", tt.scraper.GetPlatformName(), got, want)
+			}
+		})
+	}
+}
+
+func TestScrapeOffers(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		body     string
+		want     []string
+	}{
+		{
+			name:     "Amazon coupon and bank offers",
+			platform: "amazon",
+			body: `<div id="corePriceDisplay_desktop_feature_div"><span class="a-price-whole">24,999</span></div>
+				<label id="couponTextpctch">Apply ₹500 coupon </label>
+				<div id="itembox-InstantBankDiscount"><span class="a-truncate-full">10% Instant Discount up to ₹1,500 on HDFC Bank Credit Card Transactions</span></div>`,
+			want: []string{offers.Coupon, offers.Bank},
+		},
+		{
+			name:     "Flipkart offer list",
+			platform: "flipkart",
+			body: `<div class="Nx9bqj CxhGGd">₹24,999</div><ul>
+				<li class="kF1Ml8"><span>Bank Offer</span><span>5% Unlimited Cashback on Flipkart Axis Bank Credit Card</span></li>
+				<li class="kF1Ml8"><span>Special Price</span><span>Get extra 10% off</span></li></ul>`,
+			want: []string{offers.Bank},
+		},
+		{
+			name:     "No offers",
+			platform: "amazon",
+			body:     `<div id="corePriceDisplay_desktop_feature_div"><span class="a-price-whole">24,999</span></div>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `<html><body>%s</body></html>`, tt.body)
+			}))
+			defer server.Close()
+
+			var s Scraper = NewAmazonScraper()
+			if tt.platform == "flipkart" {
+				s = NewFlipkartScraper()
+			}
+			if _, err := s.ScrapePrice(server.URL); err != nil {
+				t.Fatalf("ScrapePrice() error = %v", err)
+			}
+			var got []string
+			for _, offer := range s.Offers("INR") {
+				got = append(got, offer.Kind)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Offers() kinds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"price-watcher/database"
+	"price-watcher/digest"
+)
+
+// getAlerts handles GET /api/alerts, latest first, filtered as
+// parseAlertFilter reads the query.
+func (s *Server) getAlerts(c *gin.Context) {
+	filter, err := parseAlertFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alerts, err := s.db.ListAlerts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+// parseAlertFilter reads which alerts to list: of one product (?product=)
+// or group (?group=), raised ?from= and before ?to= (YYYY-MM-DD, a bare
+// ?to= date included, or RFC 3339), delivered on a ?channel=, with an
+// alert ?status= such as bought, of an alert ?type= such as increase, only
+// sent or only suppressed alerts (?suppressed=false or true), and up to
+// ?limit= alerts.
+func parseAlertFilter(c *gin.Context) (database.AlertFilter, error) {
+	filter := database.AlertFilter{
+		ProductID: c.Query("product"),
+		GroupID:   c.Query("group"),
+		Channel:   c.Query("channel"),
+		Status:    c.Query("status"),
+		Type:      c.Query("type"),
+	}
+	if filter.Status != "" && !slices.Contains(database.AlertStatuses, filter.Status) {
+		return filter, fmt.Errorf("invalid status %q: use one of %s", filter.Status, strings.Join(database.AlertStatuses, ", "))
+	}
+	if filter.Type != "" && !slices.Contains(digest.AlertTypes, filter.Type) {
+		return filter, fmt.Errorf("invalid type %q: use one of %s", filter.Type, strings.Join(digest.AlertTypes, ", "))
+	}
+	for _, bound := range []struct {
+		key    string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := c.Query(bound.key)
+		if v == "" {
+			continue
+		}
+		t, err := parseDate(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q: use YYYY-MM-DD or RFC 3339", bound.key, v)
+		}
+		if bound.key == "to" && len(v) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+		}
+		*bound.target = &t
+	}
+	if v := c.Query("suppressed"); v != "" {
+		suppressed, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid suppressed %q", v)
+		}
+		filter.Suppressed = &suppressed
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// updateAlert handles PATCH /api/alerts/:id, recording what became of an
+// alert with {"status": "acknowledged"}, "dismissed", "bought" or "new".
+func (s *Server) updateAlert(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !slices.Contains(database.AlertStatuses, req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status %q: use one of %s", req.Status, strings.Join(database.AlertStatuses, ", "))})
+		return
+	}
+
+	alert, err := s.db.SetAlertStatus(c.Param("id"), req.Status)
+	if err != nil {
+		if strings.Contains(err.Error(), "alert not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// getDigest handles GET /api/digest, previewing the ?mode=daily (default)
+// or weekly digest as it would be sent now: as JSON, or with ?format=text,
+// html (the email) or telegram as the message itself.
+func (s *Server) getDigest(c *gin.Context) {
+	mode, err := digest.ParseMode(c.DefaultQuery("mode", digest.ModeDaily))
+	if err == nil && mode == digest.ModeInstant {
+		err = fmt.Errorf("instant alerts have no digest")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().In(s.timeZone())
+	entries, err := s.db.GetDigestEntries(now.Add(-digest.Period(mode)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	d := digest.Build(entries, mode, now)
+
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.JSON(http.StatusOK, d)
+	case "text":
+		c.String(http.StatusOK, d.Text())
+	case "telegram":
+		c.String(http.StatusOK, d.Telegram())
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(d.HTML()))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format %q", format)})
+	}
+}
+
+// getDeliveries handles GET /api/deliveries, the alert deliveries on each
+// channel latest first, optionally only those with ?status=pending, sent or
+// dead, up to ?limit=.
+func (s *Server) getDeliveries(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", database.DeliveryPending, database.DeliverySent, database.DeliveryDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status %q", status)})
+		return
+	}
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", v)})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := s.db.ListDeliveries(status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// retryDelivery handles POST /api/deliveries/:id/retry, giving a
+// dead-lettered delivery a fresh set of attempts.
+func (s *Server) retryDelivery(c *gin.Context) {
+	if err := s.db.RetryDelivery(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "dead-lettered delivery not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead-lettered delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery will be retried"})
+}
+
+// alertsPage renders the alerts matching the filter in the query, as for
+// GET /api/alerts, with their delivery on each channel and buttons to
+// record what became of them, and the deliveries that were dead-lettered.
+func (s *Server) alertsPage(c *gin.Context) {
+	filter, err := parseAlertFilter(c)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+
+	alerts, err := s.db.ListAlerts(filter)
+	if err == nil {
+		var dead []database.Delivery
+		if dead, err = s.db.ListDeliveries(database.DeliveryDead, 0); err == nil {
+			var counts map[string]int
+			if counts, err = s.db.CountDeliveries(); err == nil {
+				var products []database.Product
+				if products, err = s.db.GetProducts(); err == nil {
+					names := make(map[string]string, len(products))
+					for _, p := range products {
+						names[p.ID] = p.Name
+					}
+					c.HTML(http.StatusOK, "alerts.html", gin.H{
+						"title":    "Price Watcher - Alerts",
+						"alerts":   alerts,
+						"names":    names,
+						"products": products,
+						"query":    c.Request.URL.Query(),
+						"statuses": database.AlertStatuses,
+						"types":    digest.AlertTypes,
+						"dead":     dead,
+						"counts":   counts,
+					})
+					return
+				}
+			}
+		}
+	}
+
+	c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		"error": "Failed to load alerts",
+	})
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"price-watcher/alertmsg"
+	"price-watcher/digest"
+	"price-watcher/scheduler"
+)
+
+// Sources of an alert template, from the highest precedence.
+const (
+	templateSourceDatabase = "database"
+	templateSourceFile     = "file"
+	templateSourceDefault  = "default"
+)
+
+// alertTemplate is an alert template as listed by GET /api/alert-templates.
+type alertTemplate struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Body   string `json:"body"`
+}
+
+// alertTemplates returns the stored alert templates and those in
+// ALERT_TEMPLATES_DIR.
+func (s *Server) alertTemplates() (stored, files map[string]string, err error) {
+	if stored, err = s.db.GetAlertTemplates(); err != nil {
+		return nil, nil, err
+	}
+	if files, err = alertmsg.ReadDir(s.config.AlertTemplatesDir); err != nil {
+		return nil, nil, err
+	}
+	return stored, files, nil
+}
+
+// getAlertTemplates handles GET /api/alert-templates, listing every alert
+// template defined, with where the one in use comes from.
+func (s *Server) getAlertTemplates(c *gin.Context) {
+	stored, files, err := s.alertTemplates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	templates := []alertTemplate{}
+	for _, alertType := range alertmsg.Types {
+		for _, channel := range append([]string{""}, alertmsg.Channels...) {
+			name := alertmsg.Name(alertType, channel)
+			for _, source := range []struct {
+				name      string
+				templates map[string]string
+			}{{templateSourceDatabase, stored}, {templateSourceFile, files}, {templateSourceDefault, alertmsg.Defaults}} {
+				if body, ok := source.templates[name]; ok {
+					templates = append(templates, alertTemplate{Name: name, Source: source.name, Body: body})
+					break
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// putAlertTemplate handles PUT /api/alert-templates/:name, storing the
+// template {"body": "..."} once it renders against example data.
+func (s *Server) putAlertTemplate(c *gin.Context) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	if err := alertmsg.Check(name, req.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.db.SaveAlertTemplate(name, req.Body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alertTemplate{Name: name, Source: templateSourceDatabase, Body: req.Body})
+}
+
+// deleteAlertTemplate handles DELETE /api/alert-templates/:name, going back
+// to the template from ALERT_TEMPLATES_DIR or the default.
+func (s *Server) deleteAlertTemplate(c *gin.Context) {
+	if err := s.db.DeleteAlertTemplate(c.Param("name")); err != nil {
+		if strings.Contains(err.Error(), "alert template not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert template deleted"})
+}
+
+// previewAlertTemplate handles POST /api/alert-templates/preview, rendering
+// the alert of {"type": "low"} (the default), or another alert type, about
+// {"product_id": "..."}'s latest price for a {"channel": ...} ("" for the
+// message stored with alerts), from the template in use or a draft
+// {"body": "..."}.
+func (s *Server) previewAlertTemplate(c *gin.Context) {
+	var req struct {
+		ProductID string `json:"product_id" binding:"required"`
+		Type      string `json:"type"`
+		Channel   string `json:"channel"`
+		Body      string `json:"body"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Type == "" {
+		req.Type = digest.AlertLow
+	}
+	if !slices.Contains(alertmsg.Types, req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid type %q: use one of %s", req.Type, strings.Join(alertmsg.Types, ", "))})
+		return
+	}
+	if req.Channel != "" && !slices.Contains(alertmsg.Channels, req.Channel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid channel %q: use one of %s", req.Channel, strings.Join(alertmsg.Channels, ", "))})
+		return
+	}
+
+	product, err := s.db.GetProduct(req.ProductID)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data, err := s.scheduler.PreviewAlert(*product, req.Type)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, scheduler.ErrNoHistory) || errors.Is(err, scheduler.ErrNotInGroup) || errors.Is(err, scheduler.ErrNoTarget) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, body := alertmsg.Name(req.Type, req.Channel), req.Body
+	if body == "" {
+		stored, files, err := s.alertTemplates()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		name, body = alertmsg.New(stored, files).Lookup(req.Type, req.Channel)
+	}
+	message, err := alertmsg.Render(name, body, req.Channel, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template": name,
+		"message":  message,
+		"data":     data,
+	})
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"price-watcher/database"
+	"price-watcher/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// basketNotFound writes the response for a basket lookup error.
+func basketNotFound(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "basket not found") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Basket not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// basketItemRequest names a product and how many packs of it a basket holds.
+type basketItemRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// quantity returns the requested quantity, 1 if none was given.
+func (r basketItemRequest) quantity() int {
+	if r.Quantity == 0 {
+		return 1
+	}
+	return r.Quantity
+}
+
+// basketReport is a basket priced now, with its cost history and inflation.
+type basketReport struct {
+	Basket    *database.Basket           `json:"basket"`
+	Cost      database.BasketCost        `json:"cost"`
+	Cheapest  database.BasketCost        `json:"cheapest"`
+	History   []database.BasketCostPoint `json:"history"`
+	Inflation []database.Inflation       `json:"inflation"`
+}
+
+// basketReport prices a basket and loads its cost history for the last
+// days days. The inflation index covers a year of history whatever days is.
+func (s *Server) basketReport(basket *database.Basket, days int) (*basketReport, error) {
+	now := time.Now()
+	listed, cheapest, err := s.db.CostBasket(basket, now)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := s.db.LoadRates()
+	if err != nil {
+		return nil, err
+	}
+
+	longest := days
+	for _, period := range database.InflationPeriods {
+		if period > longest {
+			longest = period
+		}
+	}
+	// Reach back far enough to find the cost at the start of each period.
+	history, err := s.db.GetBasketCosts(basket.ID, now.AddDate(0, 0, -longest-7), basket.Currency, rates)
+	if err != nil {
+		return nil, err
+	}
+
+	// Today's cost is the live one, recorded or not.
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if n := len(history); n > 0 && !history[n-1].Day.Before(today) {
+		history = history[:n-1]
+	}
+	history = append(history, database.BasketCostPoint{
+		Day:          today,
+		Cost:         listed.Total,
+		CheapestCost: cheapest.Total,
+		Items:        len(listed.Lines),
+		Priced:       len(listed.Lines) - listed.Missing,
+		ItemCosts:    database.ItemCosts(listed, cheapest),
+	})
+
+	report := &basketReport{
+		Basket:    basket,
+		Cost:      listed,
+		Cheapest:  cheapest,
+		Inflation: database.InflationIndex(history, database.InflationPeriods, basket.Cheapest),
+	}
+	since := today.AddDate(0, 0, -days)
+	for _, p := range history {
+		if !p.Day.Before(since) {
+			report.History = append(report.History, p)
+		}
+	}
+	return report, nil
+}
+
+// basketChart draws a basket's cost history, at the listed products and at
+// the cheapest listings.
+func basketChart(history []database.BasketCostPoint, width, height int) chart {
+	listed := chartSeries{Name: "Listed products"}
+	cheapest := chartSeries{Name: "Cheapest listings"}
+	for _, p := range history {
+		to := p.Day.AddDate(0, 0, 1)
+		listed.Points = append(listed.Points, chartPoint{From: p.Day, To: to, Price: p.Cost})
+		cheapest.Points = append(cheapest.Points, chartPoint{From: p.Day, To: to, Price: p.CheapestCost})
+	}
+	return buildChart([]chartSeries{listed, cheapest}, width, height)
+}
+
+func (s *Server) getBaskets(c *gin.Context) {
+	baskets, err := s.db.GetBaskets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, baskets)
+}
+
+func (s *Server) createBasket(c *gin.Context) {
+	var req struct {
+		Name     string              `json:"name" binding:"required"`
+		Currency string              `json:"currency"`
+		Cheapest bool                `json:"cheapest"`
+		Items    []basketItemRequest `json:"items"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Basket name cannot be empty"})
+		return
+	}
+	currency, _, err := productCurrency(req.Currency, s.defaultBasketCurrency(), nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the items first so a bad one does not leave an empty basket behind.
+	for _, item := range req.Items {
+		if item.quantity() < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be at least 1"})
+			return
+		}
+		if _, err := s.db.GetProduct(item.ProductID); err != nil {
+			if strings.Contains(err.Error(), "product not found") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	basket, err := s.db.CreateBasket(name, currency, req.Cheapest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, item := range req.Items {
+		if err := s.db.SetBasketItem(basket.ID, item.ProductID, item.quantity()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(req.Items) > 0 {
+		if basket, err = s.db.GetBasket(basket.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, basket)
+}
+
+// defaultBasketCurrency is the display_currency setting, or the default
+// currency when none is set.
+func (s *Server) defaultBasketCurrency() string {
+	currency, err := s.db.GetSetting(database.SettingDisplayCurrency, "")
+	if err != nil || currency == "" {
+		return money.DefaultCurrency
+	}
+	return currency
+}
+
+// getBasket returns a basket priced now, with its cost history for the last
+// days days and its inflation over 30, 90 and 365 days.
+func (s *Server) getBasket(c *gin.Context) {
+	days, err := s.historyDays(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	basket, err := s.db.GetBasket(c.Param("id"))
+	if err != nil {
+		basketNotFound(c, err)
+		return
+	}
+
+	report, err := s.basketReport(basket, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) updateBasket(c *gin.Context) {
+	var req struct {
+		Name     *string `json:"name"`
+		Currency *string `json:"currency"`
+		Cheapest *bool   `json:"cheapest"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := database.BasketUpdate{Cheapest: req.Cheapest}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Basket name cannot be empty"})
+			return
+		}
+		update.Name = &name
+	}
+	if req.Currency != nil {
+		currency, _, err := productCurrency(*req.Currency, "", nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.Currency = &currency
+	}
+
+	basket, err := s.db.UpdateBasket(c.Param("id"), update)
+	if err != nil {
+		basketNotFound(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, basket)
+}
+
+func (s *Server) deleteBasket(c *gin.Context) {
+	id := c.Param("id")
+	if err := s.db.DeleteBasket(id); err != nil {
+		basketNotFound(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Basket deleted successfully",
+		"id":      id,
+	})
+}
+
+// putBasketItem handles PUT /api/baskets/:id/items/:product_id with
+// {"quantity": n}, adding the product or changing its quantity.
+func (s *Server) putBasketItem(c *gin.Context) {
+	var req basketItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.quantity() < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be at least 1"})
+		return
+	}
+
+	basket, err := s.db.GetBasket(c.Param("id"))
+	if err != nil {
+		basketNotFound(c, err)
+		return
+	}
+	productID := c.Param("product_id")
+	if _, err := s.db.GetProduct(productID); err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.SetBasketItem(basket.ID, productID, req.quantity()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Basket item saved", "basket_id": basket.ID, "product_id": productID, "quantity": req.quantity()})
+}
+
+// deleteBasketItem handles DELETE /api/baskets/:id/items/:product_id.
+func (s *Server) deleteBasketItem(c *gin.Context) {
+	basketID, productID := c.Param("id"), c.Param("product_id")
+	if err := s.db.RemoveBasketItem(basketID, productID); err != nil {
+		if strings.Contains(err.Error(), "basket item not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in this basket"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product removed from basket", "basket_id": basketID, "product_id": productID})
+}
+
+func (s *Server) basketsPage(c *gin.Context) {
+	baskets, err := s.db.GetBaskets()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load baskets",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "baskets.html", gin.H{
+		"title":   "Price Watcher - Baskets",
+		"baskets": baskets,
+	})
+}
+
+func (s *Server) basketPage(c *gin.Context) {
+	basket, err := s.db.GetBasket(c.Param("id"))
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Failed to load basket"
+		if strings.Contains(err.Error(), "basket not found") {
+			status, message = http.StatusNotFound, "Basket not found"
+		}
+		c.HTML(status, "error.html", gin.H{"error": message})
+		return
+	}
+
+	days := s.config.PriceHistoryDays
+	if days < 90 {
+		days = 90
+	}
+	report, err := s.basketReport(basket, days)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to price basket",
+		})
+		return
+	}
+
+	// Products that can still be added.
+	products, err := s.db.GetProducts()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	inBasket := make(map[string]bool, len(report.Cost.Lines))
+	for _, line := range report.Cost.Lines {
+		inBasket[line.Product.ID] = true
+	}
+	candidates := []database.Product{}
+	for _, p := range products {
+		if !inBasket[p.ID] {
+			candidates = append(candidates, p)
+		}
+	}
+
+	current := report.Cost
+	if basket.Cheapest {
+		current = report.Cheapest
+	}
+
+	var platforms []string
+	for _, line := range current.Lines {
+		platforms = append(platforms, line.Product.Platform)
+		if line.Source != nil {
+			platforms = append(platforms, line.Source.Platform)
+		}
+	}
+	saleEvents, err := s.platformEvents(platforms...)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load sale events",
+		})
+		return
+	}
+	chart := basketChart(report.History, 720, 240)
+	chart.shadeEvents(saleEvents)
+
+	c.HTML(http.StatusOK, "basket.html", gin.H{
+		"title":      "Price Watcher - " + basket.Name,
+		"basket":     basket,
+		"report":     report,
+		"current":    current,
+		"chart":      chart,
+		"days":       days,
+		"candidates": candidates,
+	})
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"price-watcher/database"
+	"price-watcher/events"
+	"price-watcher/money"
+)
+
+// chartColors are used for the lines of a chart in turn.
+var chartColors = []string{"#4f46e5", "#f59e0b", "#10b981", "#ef4444", "#0ea5e9", "#a855f7", "#64748b"}
+
+// chartSeries is one product's price history in the chart's currency.
+type chartSeries struct {
+	Name   string
+	Points []chartPoint
+}
+
+type chartPoint struct {
+	From, To time.Time
+	Price    money.Money
+}
+
+// chartLine is a series laid out as an SVG polyline.
+type chartLine struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// chartBand is a shaded period of a chart, such as a sale event.
+type chartBand struct {
+	Name     string
+	X, Width float64
+}
+
+// chart is an SVG line chart of several price histories on shared axes.
+type chart struct {
+	Width, Height int
+	Lines         []chartLine
+	Bands         []chartBand
+	Low, High     money.Money
+	From, To      time.Time
+}
+
+// Empty reports whether there is nothing to draw.
+func (c chart) Empty() bool {
+	return len(c.Lines) == 0
+}
+
+// buildChart lays out series on a width x height canvas. Each price is drawn
+// as a flat segment from when it was first seen to when it was last seen.
+func buildChart(series []chartSeries, width, height int) chart {
+	c := chart{Width: width, Height: height}
+
+	first := true
+	for _, s := range series {
+		for _, p := range s.Points {
+			if first || p.Price.Cmp(c.Low) < 0 {
+				c.Low = p.Price
+			}
+			if first || p.Price.Cmp(c.High) > 0 {
+				c.High = p.Price
+			}
+			if first || p.From.Before(c.From) {
+				c.From = p.From
+			}
+			if first || p.To.After(c.To) {
+				c.To = p.To
+			}
+			first = false
+		}
+	}
+	if first {
+		return c
+	}
+
+	low, high := c.Low.Float(), c.High.Float()
+	x := c.x
+	y := func(m money.Money) float64 {
+		if high <= low {
+			return float64(height) / 2
+		}
+		// Leave a little room above and below the extremes.
+		return float64(height) * (0.95 - 0.9*(m.Float()-low)/(high-low))
+	}
+
+	for i, s := range series {
+		if len(s.Points) == 0 {
+			continue
+		}
+		var points []string
+		for _, p := range s.Points {
+			points = append(points,
+				fmt.Sprintf("%.1f,%.1f", x(p.From), y(p.Price)),
+				fmt.Sprintf("%.1f,%.1f", x(p.To), y(p.Price)))
+		}
+		c.Lines = append(c.Lines, chartLine{
+			Name:   s.Name,
+			Color:  chartColors[i%len(chartColors)],
+			Points: strings.Join(points, " "),
+		})
+	}
+
+	return c
+}
+
+// x returns the horizontal position of t.
+func (c chart) x(t time.Time) float64 {
+	span := c.To.Sub(c.From).Seconds()
+	if span <= 0 {
+		return float64(c.Width) / 2
+	}
+	return t.Sub(c.From).Seconds() / span * float64(c.Width)
+}
+
+// shadeEvents shades the days of the sale events within the chart's span.
+func (c *chart) shadeEvents(list []events.Event) {
+	if c.Empty() {
+		return
+	}
+	for _, e := range list {
+		from, to := e.Start, e.Until()
+		if !from.Before(c.To) || !to.After(c.From) {
+			continue
+		}
+		if from.Before(c.From) {
+			from = c.From
+		}
+		if to.After(c.To) {
+			to = c.To
+		}
+		c.Bands = append(c.Bands, chartBand{Name: e.String(), X: c.x(from), Width: c.x(to) - c.x(from)})
+	}
+}
+
+// convertHistory converts history to currency at the rate effective on each
+// point's day, dropping points no rate covers.
+func convertHistory(history []database.PricePoint, currency string, rates *money.Rates) []chartPoint {
+	var points []chartPoint
+	for _, p := range history {
+		price, err := rates.Convert(p.Price, currency, p.Timestamp)
+		if err != nil {
+			continue
+		}
+		points = append(points, chartPoint{From: p.Timestamp, To: p.LastSeen, Price: price})
+	}
+	return points
+}
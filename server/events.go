@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"price-watcher/events"
+)
+
+// getEvents handles GET /api/events, optionally only the events running
+// today (?active=true) or covering a platform (?platform=).
+func (s *Server) getEvents(c *gin.Context) {
+	list, err := s.db.GetEvents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	active := false
+	if v := c.Query("active"); v != "" {
+		if active, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid active %q", v)})
+			return
+		}
+	}
+	platform := strings.ToLower(strings.TrimSpace(c.Query("platform")))
+
+	filtered := []events.Event{}
+	for _, e := range list {
+		if (!active || e.Contains(time.Now())) && (platform == "" || e.AppliesTo(platform)) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	c.JSON(http.StatusOK, filtered)
+}
+
+// createEvent handles POST /api/events with one event as JSON, or several
+// as a JSON array or a CSV body with a name,platform,starts_on[,ends_on]
+// header. Several events are saved like the SALE_EVENTS_FILE, updating
+// events with the same name, platform and start day.
+func (s *Server) createEvent(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var e events.Event
+		if err := json.Unmarshal(trimmed, &e); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid event: %v", err)})
+			return
+		}
+		created, err := s.db.CreateEvent(e)
+		if err != nil {
+			if strings.Contains(err.Error(), "duplicate key") {
+				c.JSON(http.StatusConflict, gin.H{"error": "A sale event with this name, platform and start day already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+		return
+	}
+
+	var list []events.Event
+	if strings.Contains(c.ContentType(), "csv") || (len(trimmed) > 0 && trimmed[0] != '[') {
+		list, err = events.ReadCSV(bytes.NewReader(trimmed))
+	} else if err = json.Unmarshal(trimmed, &list); err != nil {
+		err = fmt.Errorf("invalid events: %w", err)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(list) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No events given"})
+		return
+	}
+
+	if err := s.db.SaveEvents(list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved": len(list), "events": list})
+}
+
+// updateEvent handles PATCH /api/events/:id; omitted fields keep their
+// values.
+func (s *Server) updateEvent(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Name     *string `json:"name"`
+		Platform *string `json:"platform"`
+		StartsOn *string `json:"starts_on"`
+		EndsOn   *string `json:"ends_on"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := s.db.GetEvent(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "sale event not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, platform := existing.Name, existing.Platform
+	startsOn, endsOn := existing.Start.Format("2006-01-02"), existing.End.Format("2006-01-02")
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Platform != nil {
+		platform = *req.Platform
+	}
+	if req.StartsOn != nil {
+		startsOn = *req.StartsOn
+	}
+	if req.EndsOn != nil {
+		endsOn = *req.EndsOn
+	}
+	e, err := events.New(name, platform, startsOn, endsOn)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.db.UpdateEvent(id, e)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "A sale event with this name, platform and start day already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func (s *Server) deleteEvent(c *gin.Context) {
+	if err := s.db.DeleteEvent(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "sale event not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sale event deleted"})
+}
+
+// getEventComparison handles GET /api/products/:id/events, comparing the
+// product's prices during sale events with its prices outside them.
+func (s *Server) getEventComparison(c *gin.Context) {
+	id := c.Param("id")
+
+	product, err := s.db.GetProduct(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	list, err := s.db.GetEvents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	at, points, _, ok, err := s.productStats(*product, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"location":   at,
+		"comparison": events.Compare(points, list, product.Platform, now),
+	})
+}
+
+func (s *Server) eventsPage(c *gin.Context) {
+	list, err := s.db.GetEvents()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load sale events",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "events.html", gin.H{
+		"title":  "Price Watcher - Sale Events",
+		"events": list,
+		"now":    time.Now(),
+	})
+}
+
+// platformEvents returns the sale events covering any of platforms.
+func (s *Server) platformEvents(platforms ...string) ([]events.Event, error) {
+	list, err := s.db.GetEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []events.Event{}
+	for _, e := range list {
+		for _, platform := range platforms {
+			if e.AppliesTo(platform) {
+				matching = append(matching, e)
+				break
+			}
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"price-watcher/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportWriter writes records of one dataset as CSV or NDJSON.
+type exportWriter interface {
+	Write(header []string, record []string, value interface{}) error
+	Flush() error
+}
+
+type csvExportWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvExportWriter) Write(header []string, record []string, _ interface{}) error {
+	if !e.wroteHeader {
+		if err := e.w.Write(header); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExportWriter) Write(_ []string, _ []string, value interface{}) error {
+	return e.enc.Encode(value)
+}
+
+func (e *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+func newExportWriter(format string, w io.Writer) (exportWriter, error) {
+	switch format {
+	case "csv":
+		return &csvExportWriter{w: csv.NewWriter(w)}, nil
+	case "ndjson", "json":
+		return &ndjsonExportWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q: use csv or ndjson", format)
+	}
+}
+
+var (
+	productExportHeader = []string{"id", "name", "url", "platform", "folder", "tags", "currency", "target_price", "created_at"}
+	historyExportHeader = []string{"id", "product_id", "price", "delta", "currency", "timestamp", "last_seen", "observations", "unit_price", "price_unit", "location", "effective_price"}
+	alertExportHeader   = []string{"id", "product_id", "group_id", "old_price", "new_price", "currency", "message", "sent_at", "status", "type"}
+	dailyExportHeader   = []string{"product_id", "day", "min", "max", "avg", "close", "samples", "currency", "location"}
+)
+
+// exportData handles GET /api/export?type=products|history|daily|alerts&format=csv|ndjson
+// with optional product_id, from and to (YYYY-MM-DD or RFC 3339) filters.
+func (s *Server) exportData(c *gin.Context) {
+	dataset := c.DefaultQuery("type", "products")
+	format := c.DefaultQuery("format", "csv")
+
+	filter, err := parseExportFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch dataset {
+	case "products", "history", "daily", "alerts":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported export type %q: use products, history, daily or alerts", dataset)})
+		return
+	}
+
+	w, err := newExportWriter(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	extension, contentType := "csv", "text/csv"
+	if format != "csv" {
+		extension, contentType = "ndjson", "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="price-watcher-%s-%s.%s"`,
+		dataset, time.Now().Format("20060102"), extension))
+	c.Status(http.StatusOK)
+
+	switch dataset {
+	case "products":
+		err = s.exportProducts(w, filter)
+	case "history":
+		err = s.db.ExportPriceHistory(filter, func(h database.PriceHistory) error {
+			unitPrice, priceUnit, effectivePrice := "", "", ""
+			if h.UnitPrice != nil {
+				unitPrice, priceUnit = h.UnitPrice.Price.String(), h.UnitPrice.Per
+			}
+			if h.EffectivePrice != nil {
+				effectivePrice = h.EffectivePrice.String()
+			}
+			return w.Write(historyExportHeader, []string{
+				h.ID, h.ProductID, h.Price.String(), h.Delta.String(), h.Currency, h.Timestamp.Format(time.RFC3339),
+				h.LastSeen.Format(time.RFC3339), strconv.Itoa(h.Observations), unitPrice, priceUnit, h.Location, effectivePrice,
+			}, h)
+		})
+	case "daily":
+		err = s.db.ExportDailyPrices(filter, func(d database.DailyPrice) error {
+			return w.Write(dailyExportHeader, []string{
+				d.ProductID, d.Day.Format("2006-01-02"), d.Min.String(), d.Max.String(), d.Avg.String(),
+				d.Close.String(), strconv.Itoa(d.Samples), d.Currency, d.Location,
+			}, d)
+		})
+	case "alerts":
+		err = s.db.ExportAlerts(filter, func(a database.Alert) error {
+			groupID := ""
+			if a.GroupID != nil {
+				groupID = *a.GroupID
+			}
+			return w.Write(alertExportHeader, []string{
+				a.ID, a.ProductID, groupID, a.OldPrice.String(), a.NewPrice.String(), a.Currency, a.Message, a.SentAt.Format(time.RFC3339),
+				a.Status, a.Type,
+			}, a)
+		})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		// Headers are already sent, so the best we can do is log and cut the stream short.
+		fmt.Printf("Export of %s failed: %v\n", dataset, err)
+	}
+}
+
+func (s *Server) exportProducts(w exportWriter, filter database.ExportFilter) error {
+	products, err := s.db.GetProducts()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if filter.ProductID != "" && p.ID != filter.ProductID {
+			continue
+		}
+		target := ""
+		if p.TargetPrice != nil {
+			target = p.TargetPrice.String()
+		}
+		record := []string{
+			p.ID, p.Name, p.URL, p.Platform, p.Folder, strings.Join(p.Tags, ";"), p.Currency, target, p.CreatedAt.Format(time.RFC3339),
+		}
+		if err := w.Write(productExportHeader, record, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseExportFilter(c *gin.Context) (database.ExportFilter, error) {
+	filter := database.ExportFilter{ProductID: c.Query("product_id")}
+
+	for _, bound := range []struct {
+		key    string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := c.Query(bound.key)
+		if v == "" {
+			continue
+		}
+		t, err := parseDate(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q: use YYYY-MM-DD or RFC 3339", bound.key, v)
+		}
+		// A bare "to" date includes the whole day.
+		if bound.key == "to" && len(v) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+		}
+		*bound.target = &t
+	}
+
+	return filter, nil
+}
+
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"price-watcher/database"
+	"price-watcher/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupNotFound writes the response for a group lookup error.
+func groupNotFound(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "group not found") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// groupOffers loads a group's listings with their prices converted to the
+// group's currency and returns the index of the cheapest in-stock listing.
+func (s *Server) groupOffers(group *database.ProductGroup) ([]database.Product, int, error) {
+	listings, err := s.db.GetGroupListings(group.ID)
+	if err != nil {
+		return nil, -1, err
+	}
+	rates, err := s.db.LoadRates()
+	if err != nil {
+		return nil, -1, err
+	}
+	return listings, database.CheapestListing(listings, group.Currency, rates, time.Now()), nil
+}
+
+// groupHistory returns each listing's price history since the given time in
+// the group's currency.
+func (s *Server) groupHistory(group *database.ProductGroup, listings []database.Product, since time.Time) ([]chartSeries, error) {
+	rates, err := s.db.LoadRates()
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]chartSeries, 0, len(listings))
+	for _, listing := range listings {
+		at, err := s.priceLocation(listing)
+		if err != nil {
+			return nil, err
+		}
+		history, err := s.db.GetPriceHistory(listing.ID, at, since)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, chartSeries{
+			Name:   fmt.Sprintf("%s (%s)", listing.Name, listing.Platform),
+			Points: convertHistory(history, group.Currency, rates),
+		})
+	}
+	return series, nil
+}
+
+func (s *Server) getGroups(c *gin.Context) {
+	groups, err := s.db.GetGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+func (s *Server) createGroup(c *gin.Context) {
+	var req struct {
+		Name        string       `json:"name" binding:"required"`
+		Currency    string       `json:"currency"`
+		TargetPrice *money.Money `json:"target_price"`
+		ProductIDs  []string     `json:"product_ids"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group name cannot be empty"})
+		return
+	}
+
+	// Check the listings first so a bad ID does not leave an empty group behind.
+	fallback := money.DefaultCurrency
+	for i, id := range req.ProductIDs {
+		product, err := s.db.GetProduct(id)
+		if err != nil {
+			if strings.Contains(err.Error(), "product not found") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if i == 0 {
+			fallback = product.Currency
+		}
+	}
+
+	currency, target, err := productCurrency(req.Currency, fallback, req.TargetPrice)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if target != nil && target.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target price must not be negative"})
+		return
+	}
+
+	group, err := s.db.CreateGroup(name, currency, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range req.ProductIDs {
+		if err := s.db.SetProductGroup(id, group.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(req.ProductIDs) > 0 {
+		if group, err = s.db.GetGroup(group.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// getGroup returns a group with its listings, each with its price in the
+// group's currency as display_price, and the cheapest in-stock listing.
+func (s *Server) getGroup(c *gin.Context) {
+	group, err := s.db.GetGroup(c.Param("id"))
+	if err != nil {
+		groupNotFound(c, err)
+		return
+	}
+
+	listings, cheapest, err := s.groupOffers(group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"group": group, "listings": listings}
+	if cheapest >= 0 {
+		response["cheapest_product_id"] = listings[cheapest].ID
+		response["cheapest_price"] = listings[cheapest].DisplayPrice
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) updateGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Name        *string      `json:"name"`
+		TargetPrice *money.Money `json:"target_price"`
+		Currency    *string      `json:"currency"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := database.GroupUpdate{Name: req.Name}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Group name cannot be empty"})
+			return
+		}
+		update.Name = &name
+	}
+	if req.TargetPrice != nil || req.Currency != nil {
+		existing, err := s.db.GetGroup(id)
+		if err != nil {
+			groupNotFound(c, err)
+			return
+		}
+		requested := ""
+		if req.Currency != nil {
+			requested = *req.Currency
+		}
+		currency, target, err := productCurrency(requested, existing.Currency, req.TargetPrice)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if target != nil && target.Amount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target price must not be negative"})
+			return
+		}
+		update.Currency, update.TargetPrice = &currency, target
+	}
+
+	group, err := s.db.UpdateGroup(id, update)
+	if err != nil {
+		groupNotFound(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (s *Server) deleteGroup(c *gin.Context) {
+	id := c.Param("id")
+	if err := s.db.DeleteGroup(id); err != nil {
+		groupNotFound(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Group deleted successfully",
+		"id":      id,
+	})
+}
+
+// addGroupProduct handles POST /api/groups/:id/products, moving a product
+// into the group (out of any group it was in).
+func (s *Server) addGroupProduct(c *gin.Context) {
+	var req struct {
+		ProductID string `json:"product_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := s.db.GetGroup(c.Param("id"))
+	if err != nil {
+		groupNotFound(c, err)
+		return
+	}
+	if err := s.db.SetProductGroup(req.ProductID, group.ID); err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product added to group", "group_id": group.ID, "product_id": req.ProductID})
+}
+
+// removeGroupProduct handles DELETE /api/groups/:id/products/:product_id.
+func (s *Server) removeGroupProduct(c *gin.Context) {
+	groupID, productID := c.Param("id"), c.Param("product_id")
+
+	product, err := s.db.GetProduct(productID)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if product.GroupID == nil || *product.GroupID != groupID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in this group"})
+		return
+	}
+
+	if err := s.db.SetProductGroup(productID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product removed from group", "group_id": groupID, "product_id": productID})
+}
+
+// getGroupHistory returns every listing's price history for the last days
+// days, converted to the group's currency where a rate is known.
+func (s *Server) getGroupHistory(c *gin.Context) {
+	days, err := s.historyDays(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := s.db.GetGroup(c.Param("id"))
+	if err != nil {
+		groupNotFound(c, err)
+		return
+	}
+	listings, err := s.db.GetGroupListings(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	series := make([]gin.H, 0, len(listings))
+	for _, listing := range listings {
+		at, err := s.priceLocation(listing)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		history, err := s.db.GetPriceHistory(listing.ID, at, since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		series = append(series, gin.H{
+			"product_id": listing.ID,
+			"name":       listing.Name,
+			"platform":   listing.Platform,
+			"location":   at,
+			"history":    history,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group_id": group.ID,
+		"currency": group.Currency,
+		"days":     days,
+		"listings": series,
+	})
+}
+
+func (s *Server) groupsPage(c *gin.Context) {
+	groups, err := s.db.GetGroups()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load groups",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "groups.html", gin.H{
+		"title":  "Price Watcher - Groups",
+		"groups": groups,
+	})
+}
+
+func (s *Server) groupPage(c *gin.Context) {
+	group, err := s.db.GetGroup(c.Param("id"))
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Failed to load group"
+		if strings.Contains(err.Error(), "group not found") {
+			status, message = http.StatusNotFound, "Group not found"
+		}
+		c.HTML(status, "error.html", gin.H{"error": message})
+		return
+	}
+
+	listings, cheapest, err := s.groupOffers(group)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load group listings",
+		})
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -s.config.PriceHistoryDays)
+	series, err := s.groupHistory(group, listings, since)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load price history",
+		})
+		return
+	}
+
+	// Listings that can still be added: those not in any group.
+	ungrouped, err := s.db.GetProducts()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	candidates := []database.Product{}
+	for _, p := range ungrouped {
+		if p.GroupID == nil {
+			candidates = append(candidates, p)
+		}
+	}
+
+	platforms := make([]string, len(listings))
+	for i, listing := range listings {
+		platforms[i] = listing.Platform
+	}
+	saleEvents, err := s.platformEvents(platforms...)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load sale events",
+		})
+		return
+	}
+	chart := buildChart(series, 720, 240)
+	chart.shadeEvents(saleEvents)
+
+	c.HTML(http.StatusOK, "group.html", gin.H{
+		"title":      "Price Watcher - " + group.Name,
+		"group":      group,
+		"listings":   listings,
+		"cheapest":   cheapest,
+		"chart":      chart,
+		"days":       s.config.PriceHistoryDays,
+		"candidates": candidates,
+	})
+}
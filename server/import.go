@@ -0,0 +1,336 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"price-watcher/database"
+	"price-watcher/money"
+	"price-watcher/scraper"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize caps the size of an uploaded import file.
+const maxImportSize = 10 << 20
+
+// Import row statuses reported by POST /api/import.
+const (
+	importCreated   = "created"
+	importDuplicate = "duplicate"
+	importInvalid   = "invalid"
+	importFailed    = "failed"
+	importValid     = "valid"
+)
+
+// importRow is one product to import. Only URL is required.
+type importRow struct {
+	URL         string       `json:"url"`
+	Name        string       `json:"name"`
+	TargetPrice *money.Money `json:"target_price"`
+	Tags        []string     `json:"tags"`
+	Folder      string       `json:"folder"`
+	Currency    string       `json:"currency"`
+
+	// parseError records a problem found while decoding the row.
+	parseError string
+}
+
+// importResult reports what happened to one input row. Row numbers are
+// 1-based and count data rows only.
+type importResult struct {
+	Row       int    `json:"row"`
+	URL       string `json:"url"`
+	Status    string `json:"status"`
+	ProductID string `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// importProducts handles POST /api/import. The body is CSV (with a header row
+// naming url, name, target_price, tags, folder and currency columns) or a JSON array /
+// NDJSON stream of objects with the same keys, sent raw or as a multipart
+// "file" upload. With dry_run=true rows are validated but nothing is created.
+func (s *Server) importProducts(c *gin.Context) {
+	body, format, err := readImportBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rows []importRow
+	switch format {
+	case "csv":
+		rows, err = parseImportCSV(body)
+	default:
+		rows, err = parseImportJSON(body)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	results := make([]importResult, 0, len(rows))
+	counts := make(map[string]int)
+	seen := make(map[string]int)
+
+	for i, row := range rows {
+		result := s.importRow(row, i+1, seen, dryRun)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": dryRun,
+		"total":   len(rows),
+		"summary": counts,
+		"rows":    results,
+	})
+}
+
+func (s *Server) importRow(row importRow, n int, seen map[string]int, dryRun bool) importResult {
+	result := importResult{Row: n, URL: row.URL}
+
+	platform, err := s.validateImportRow(&row)
+	if err != nil {
+		result.Status, result.Error = importInvalid, err.Error()
+		return result
+	}
+	result.URL = row.URL
+
+	if first, ok := seen[row.URL]; ok {
+		result.Status, result.Error = importDuplicate, fmt.Sprintf("same URL as row %d", first)
+		return result
+	}
+	seen[row.URL] = n
+
+	existing, err := s.db.FindProductByURL(row.URL)
+	if err != nil {
+		result.Status, result.Error = importFailed, err.Error()
+		return result
+	}
+	if existing != nil {
+		result.Status, result.ProductID, result.Error = importDuplicate, existing.ID, "product already tracked"
+		return result
+	}
+
+	if dryRun {
+		result.Status = importValid
+		return result
+	}
+
+	update := database.ProductUpdate{Folder: &row.Folder, Tags: row.Tags, TargetPrice: row.TargetPrice}
+	product, err := s.db.CreateProductWith(row.Name, row.URL, platform, row.Currency, update)
+	if err != nil {
+		result.Status, result.Error = importFailed, err.Error()
+		return result
+	}
+
+	result.Status, result.ProductID = importCreated, product.ID
+	return result
+}
+
+// validateImportRow normalises row in place and returns its platform.
+func (s *Server) validateImportRow(row *importRow) (string, error) {
+	row.URL = strings.TrimSpace(row.URL)
+	row.Name = strings.TrimSpace(row.Name)
+	row.Folder = strings.TrimSpace(row.Folder)
+
+	if row.parseError != "" {
+		return "", errors.New(row.parseError)
+	}
+	if row.URL == "" {
+		return "", fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(row.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid url")
+	}
+
+	platform := s.detectPlatform(row.URL)
+	if platform == "" {
+		return "", fmt.Errorf("unsupported platform")
+	}
+
+	currency, target, err := productCurrency(row.Currency, scraper.CurrencyForURL(row.URL), row.TargetPrice)
+	if err != nil {
+		return "", err
+	}
+	if target != nil && target.Amount < 0 {
+		return "", fmt.Errorf("target_price must not be negative")
+	}
+	row.Currency, row.TargetPrice = currency, target
+
+	if row.Name == "" {
+		row.Name = nameFromURL(u)
+	}
+	if len(row.Name) > 500 {
+		return "", fmt.Errorf("name is longer than 500 characters")
+	}
+
+	return platform, nil
+}
+
+// nameFromURL derives a readable placeholder name from the most descriptive
+// path segment, e.g. "Apple-iPhone-15-128GB" in an Amazon URL.
+func nameFromURL(u *url.URL) string {
+	best := ""
+	for _, segment := range strings.Split(u.Path, "/") {
+		if strings.Count(segment, "-") > strings.Count(best, "-") {
+			best = segment
+		}
+	}
+	if best == "" {
+		return u.Host
+	}
+	return strings.ReplaceAll(best, "-", " ")
+}
+
+// readImportBody returns the uploaded data and whether it is "csv" or "json".
+func readImportBody(c *gin.Context) ([]byte, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	format := c.Query("format")
+
+	var data []byte
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("missing file upload: %w", err)
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, "", err
+		}
+		if format == "" && strings.EqualFold(filepath.Ext(header.Filename), ".csv") {
+			format = "csv"
+		}
+	} else {
+		var err error
+		if data, err = io.ReadAll(c.Request.Body); err != nil {
+			return nil, "", fmt.Errorf("failed to read request body: %w", err)
+		}
+		if format == "" && strings.Contains(c.ContentType(), "csv") {
+			format = "csv"
+		}
+	}
+
+	if format == "" {
+		// Fall back to sniffing: JSON starts with an array or object.
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+			format = "json"
+		} else {
+			format = "csv"
+		}
+	}
+	if format != "csv" && format != "json" && format != "ndjson" {
+		return nil, "", fmt.Errorf("unsupported import format %q: use csv or json", format)
+	}
+
+	return data, format, nil
+}
+
+func parseImportCSV(data []byte) ([]importRow, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, fmt.Errorf("CSV header must include a url column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		row := importRow{
+			URL:      field(record, "url"),
+			Name:     field(record, "name"),
+			Folder:   field(record, "folder"),
+			Tags:     splitTags(field(record, "tags")),
+			Currency: field(record, "currency"),
+		}
+		if v := field(record, "target_price"); v != "" {
+			currency := row.Currency
+			if currency == "" {
+				currency = scraper.CurrencyForURL(row.URL)
+			}
+			// Keep unparseable rows so the report can flag them.
+			if target, err := money.Parse(v, currency); err != nil {
+				row.parseError = fmt.Sprintf("invalid target_price %q", v)
+			} else {
+				row.TargetPrice = &target
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func parseImportJSON(data []byte) ([]importRow, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var rows []importRow
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := dec.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return rows, nil
+	}
+
+	// NDJSON: one object per line.
+	for {
+		var row importRow
+		err := dec.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON on item %d: %w", len(rows)+1, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// splitTags splits a CSV tags cell on ";" or "|".
+func splitTags(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ';' || r == '|' })
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"price-watcher/database"
+	"price-watcher/matcher"
+
+	"github.com/gin-gonic/gin"
+)
+
+// matchSuggestion is a matcher suggestion with both listings' details.
+type matchSuggestion struct {
+	A       database.Product `json:"a"`
+	B       database.Product `json:"b"`
+	Score   float64          `json:"score"`
+	Reasons []string         `json:"reasons"`
+}
+
+// matchTitle is the title a product is matched on: the one scraped from its
+// page, or its name until it has been scraped.
+func matchTitle(p database.Product) string {
+	if p.ScrapedTitle != "" {
+		return p.ScrapedTitle
+	}
+	return p.Name
+}
+
+// suggestMatches proposes pairs of products on different platforms that
+// look like the same item, leaving out dismissed pairs.
+func (s *Server) suggestMatches(minScore float64) ([]matchSuggestion, error) {
+	products, err := s.db.GetProducts()
+	if err != nil {
+		return nil, err
+	}
+	dismissed, err := s.db.DismissedMatches()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]database.Product, len(products))
+	items := make([]matcher.Item, 0, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+		item := matcher.Item{ID: p.ID, Platform: p.Platform, Title: matchTitle(p)}
+		if p.GroupID != nil {
+			item.GroupID = *p.GroupID
+		}
+		items = append(items, item)
+	}
+
+	skip := func(a, b matcher.Item) bool { return dismissed(a.ID, b.ID) }
+	suggestions := []matchSuggestion{}
+	for _, m := range matcher.Suggest(items, minScore, skip) {
+		suggestions = append(suggestions, matchSuggestion{A: byID[m.A.ID], B: byID[m.B.ID], Score: m.Score, Reasons: m.Reasons})
+	}
+	return suggestions, nil
+}
+
+// parseMinScore reads the min_score query parameter, a confidence between 0 and 1.
+func parseMinScore(c *gin.Context) (float64, error) {
+	v := c.Query("min_score")
+	if v == "" {
+		return matcher.DefaultMinScore, nil
+	}
+	score, err := strconv.ParseFloat(v, 64)
+	if err != nil || score < 0 || score > 1 {
+		return 0, fmt.Errorf("invalid min_score %q: must be between 0 and 1", v)
+	}
+	return score, nil
+}
+
+// getMatches handles GET /api/matches?min_score=0.5.
+func (s *Server) getMatches(c *gin.Context) {
+	minScore, err := parseMinScore(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	suggestions, err := s.suggestMatches(minScore)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"min_score": minScore, "suggestions": suggestions})
+}
+
+// matchPairRequest names the two products of a suggestion.
+type matchPairRequest struct {
+	ProductIDs []string `json:"product_ids" binding:"required"`
+	Name       string   `json:"name"`
+}
+
+// bindMatchPair reads a matchPairRequest and loads both products, writing
+// the error response itself when that fails.
+func (s *Server) bindMatchPair(c *gin.Context) (*matchPairRequest, []*database.Product, bool) {
+	var req matchPairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	if len(req.ProductIDs) != 2 || req.ProductIDs[0] == req.ProductIDs[1] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_ids must name two different products"})
+		return nil, nil, false
+	}
+
+	products := make([]*database.Product, 0, 2)
+	for _, id := range req.ProductIDs {
+		product, err := s.db.GetProduct(id)
+		if err != nil {
+			if strings.Contains(err.Error(), "product not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return nil, nil, false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, nil, false
+		}
+		products = append(products, product)
+	}
+	return &req, products, true
+}
+
+// confirmMatch handles POST /api/matches/confirm: the two products join the
+// group one of them is already in, or a new group named after the first.
+func (s *Server) confirmMatch(c *gin.Context) {
+	req, products, ok := s.bindMatchPair(c)
+	if !ok {
+		return
+	}
+	a, b := products[0], products[1]
+
+	var groupID, name string
+	switch {
+	case a.GroupID != nil && b.GroupID != nil && *a.GroupID != *b.GroupID:
+		c.JSON(http.StatusConflict, gin.H{"error": "Products are already in different groups"})
+		return
+	case a.GroupID != nil:
+		groupID = *a.GroupID
+	case b.GroupID != nil:
+		groupID = *b.GroupID
+	default:
+		name = strings.TrimSpace(req.Name)
+		if name == "" {
+			name = a.Name
+		}
+	}
+
+	group, err := s.db.GroupProducts(groupID, name, a.Currency, []string{a.ID, b.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// dismissMatch handles POST /api/matches/dismiss so a pair is not suggested again.
+func (s *Server) dismissMatch(c *gin.Context) {
+	_, products, ok := s.bindMatchPair(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db.DismissMatch(products[0].ID, products[1].ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Match dismissed"})
+}
+
+func (s *Server) matchesPage(c *gin.Context) {
+	minScore, err := parseMinScore(c)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	suggestions, err := s.suggestMatches(minScore)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load match suggestions",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "matches.html", gin.H{
+		"title":       "Price Watcher - Match Suggestions",
+		"suggestions": suggestions,
+		"minScore":    minScore,
+	})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"price-watcher/database"
+	"price-watcher/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getRates handles GET /api/rates.
+func (s *Server) getRates(c *gin.Context) {
+	rates, err := s.db.GetExchangeRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+// putRates handles POST /api/rates with one rate or an array of rates as
+// JSON, or a CSV body with a base,quote,rate[,effective_date] header.
+func (s *Server) putRates(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rates, err := parseRates(body, c.ContentType())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No rates given"})
+		return
+	}
+
+	if err := s.db.SaveExchangeRates(rates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved": len(rates), "rates": rates})
+}
+
+// deleteRate handles DELETE /api/rates/:base/:quote/:date.
+func (s *Server) deleteRate(c *gin.Context) {
+	day, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date: use YYYY-MM-DD"})
+		return
+	}
+
+	base, quote := strings.ToUpper(c.Param("base")), strings.ToUpper(c.Param("quote"))
+	if err := s.db.DeleteExchangeRate(base, quote, day); err != nil {
+		if strings.Contains(err.Error(), "exchange rate not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
+
+func parseRates(body []byte, contentType string) ([]money.ExchangeRate, error) {
+	trimmed := bytes.TrimSpace(body)
+	if strings.Contains(contentType, "csv") || (len(trimmed) > 0 && trimmed[0] != '{' && trimmed[0] != '[') {
+		return money.ReadRatesCSV(bytes.NewReader(trimmed))
+	}
+
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var rate money.ExchangeRate
+		if err := json.Unmarshal(trimmed, &rate); err != nil {
+			return nil, fmt.Errorf("invalid rate: %w", err)
+		}
+		return []money.ExchangeRate{rate}, nil
+	}
+
+	var rates []money.ExchangeRate
+	if err := json.Unmarshal(trimmed, &rates); err != nil {
+		return nil, fmt.Errorf("invalid rates: %w", err)
+	}
+	return rates, nil
+}
+
+// displayCurrency returns the currency requested with ?currency= or else the
+// display_currency setting; "" means prices are shown as scraped.
+func (s *Server) displayCurrency(c *gin.Context) (string, error) {
+	if currency := strings.ToUpper(strings.TrimSpace(c.Query("currency"))); currency != "" {
+		if !money.IsCode(currency) {
+			return "", fmt.Errorf("invalid currency %q", c.Query("currency"))
+		}
+		return currency, nil
+	}
+	return s.db.GetSetting(database.SettingDisplayCurrency, "")
+}
+
+// convertForDisplay sets DisplayPrice on every product whose current price
+// can be converted to currency with today's rates, and returns their total
+// and the number of priced products that could not be converted.
+func (s *Server) convertForDisplay(products []database.Product, currency string) (money.Money, int, error) {
+	total := money.New(0, currency)
+	rates, err := s.db.LoadRates()
+	if err != nil {
+		return total, 0, err
+	}
+
+	missing := 0
+	now := time.Now()
+	for i := range products {
+		p := &products[i]
+		if p.CurrentPrice == nil {
+			continue
+		}
+		converted, err := rates.Convert(*p.CurrentPrice, currency, now)
+		if err != nil {
+			missing++
+			continue
+		}
+		p.DisplayPrice = &converted
+		total = total.Add(converted)
+	}
+
+	return total, missing, nil
+}
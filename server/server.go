@@ -3,40 +3,85 @@ package server
 import (
 	"context"
 	"fmt"
+	"html/template"
+	"maps"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"price-watcher/config"
 	"price-watcher/database"
+	"price-watcher/digest"
+	"price-watcher/discount"
+	"price-watcher/location"
+	"price-watcher/money"
+	"price-watcher/offers"
+	"price-watcher/packsize"
+	"price-watcher/quiet"
+	"price-watcher/scheduler"
 	"price-watcher/scraper"
 
 	"github.com/gin-gonic/gin"
 )
 
+// platforms lists the platform names detectPlatform can return.
+var platforms = []string{"amazon", "flipkart", "blinkit", "zepto", "instamart", "desidime"}
+
 type Server struct {
 	router *gin.Engine
 	db     *database.DB
 	config *config.Config
-	server *http.Server
+	// scheduler runs manual scrapes through the same pipeline as
+	// scheduled ones.
+	scheduler *scheduler.Scheduler
+	server    *http.Server
+	// zone caches the timezone times are shown in; see loadTimeZone.
+	zone atomic.Pointer[time.Location]
 }
 
-func NewServer(db *database.DB, cfg *config.Config) *Server {
+func NewServer(db *database.DB, cfg *config.Config, sched *scheduler.Scheduler) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
 	server := &Server{
-		router: router,
-		db:     db,
-		config: cfg,
+		router:    router,
+		db:        db,
+		scheduler: sched,
+		config:    cfg,
 	}
 
+	server.loadTimeZone()
 	server.setupRoutes()
 	return server
 }
 
+// loadTimeZone caches the timezone of the timezone setting or else
+// TIMEZONE.
+func (s *Server) loadTimeZone() {
+	loc, err := s.db.TimeZone(s.config.Timezone)
+	if err != nil {
+		fmt.Printf("Using the server's timezone: %v\n", err)
+	}
+	s.zone.Store(loc)
+}
+
+// timeZone returns the timezone times are shown in.
+func (s *Server) timeZone() *time.Location {
+	if loc := s.zone.Load(); loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
 func (s *Server) setupRoutes() {
 	// Serve static files
 	s.router.Static("/static", "./static")
+	funcs := maps.Clone(templateFuncs)
+	funcs["local"] = func(t time.Time) time.Time { return t.In(s.timeZone()) }
+	s.router.SetFuncMap(funcs)
 	s.router.LoadHTMLGlob("templates/*")
 
 	// API routes
@@ -44,13 +89,66 @@ func (s *Server) setupRoutes() {
 	{
 		api.POST("/products", s.createProduct)
 		api.GET("/products", s.getProducts)
+		api.PATCH("/products/:id", s.updateProduct)
 		api.DELETE("/products/:id", s.deleteProduct)
 		api.POST("/products/:id/scrape", s.manualScrape)
+		api.GET("/products/:id/history", s.getPriceHistory)
+		api.GET("/products/:id/discount", s.getDiscountAnalysis)
+		api.GET("/products/:id/stats", s.getPriceStats)
+		api.GET("/products/:id/deal", s.getDeal)
+		api.GET("/products/:id/events", s.getEventComparison)
+		api.GET("/alerts", s.getAlerts)
+		api.PATCH("/alerts/:id", s.updateAlert)
+		api.GET("/deliveries", s.getDeliveries)
+		api.POST("/deliveries/:id/retry", s.retryDelivery)
+		api.GET("/digest", s.getDigest)
+		api.GET("/alert-templates", s.getAlertTemplates)
+		api.POST("/alert-templates/preview", s.previewAlertTemplate)
+		api.PUT("/alert-templates/:name", s.putAlertTemplate)
+		api.DELETE("/alert-templates/:name", s.deleteAlertTemplate)
+		api.GET("/export", s.exportData)
+		api.POST("/import", s.importProducts)
+		api.GET("/settings", s.getSettings)
+		api.PUT("/settings/:key", s.putSetting)
+		api.DELETE("/settings/:key", s.deleteSetting)
+		api.GET("/rates", s.getRates)
+		api.POST("/rates", s.putRates)
+		api.DELETE("/rates/:base/:quote/:date", s.deleteRate)
+		api.GET("/groups", s.getGroups)
+		api.POST("/groups", s.createGroup)
+		api.GET("/groups/:id", s.getGroup)
+		api.PATCH("/groups/:id", s.updateGroup)
+		api.DELETE("/groups/:id", s.deleteGroup)
+		api.POST("/groups/:id/products", s.addGroupProduct)
+		api.DELETE("/groups/:id/products/:product_id", s.removeGroupProduct)
+		api.GET("/groups/:id/history", s.getGroupHistory)
+		api.GET("/baskets", s.getBaskets)
+		api.POST("/baskets", s.createBasket)
+		api.GET("/baskets/:id", s.getBasket)
+		api.PATCH("/baskets/:id", s.updateBasket)
+		api.DELETE("/baskets/:id", s.deleteBasket)
+		api.PUT("/baskets/:id/items/:product_id", s.putBasketItem)
+		api.DELETE("/baskets/:id/items/:product_id", s.deleteBasketItem)
+		api.GET("/events", s.getEvents)
+		api.POST("/events", s.createEvent)
+		api.PATCH("/events/:id", s.updateEvent)
+		api.DELETE("/events/:id", s.deleteEvent)
+		api.GET("/matches", s.getMatches)
+		api.POST("/matches/confirm", s.confirmMatch)
+		api.POST("/matches/dismiss", s.dismissMatch)
 	}
 
 	// Web routes
 	s.router.GET("/", s.indexPage)
 	s.router.GET("/products", s.productsPage)
+	s.router.GET("/products/:id", s.productPage)
+	s.router.GET("/groups", s.groupsPage)
+	s.router.GET("/groups/:id", s.groupPage)
+	s.router.GET("/baskets", s.basketsPage)
+	s.router.GET("/baskets/:id", s.basketPage)
+	s.router.GET("/matches", s.matchesPage)
+	s.router.GET("/events", s.eventsPage)
+	s.router.GET("/alerts", s.alertsPage)
 }
 
 func (s *Server) Start() error {
@@ -75,7 +173,15 @@ func (s *Server) indexPage(c *gin.Context) {
 }
 
 func (s *Server) productsPage(c *gin.Context) {
-	products, err := s.db.GetProducts()
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	page, err := s.db.ListProducts(filter)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
 			"error": "Failed to load products",
@@ -83,22 +189,71 @@ func (s *Server) productsPage(c *gin.Context) {
 		return
 	}
 
-	c.HTML(http.StatusOK, "products.html", gin.H{
-		"title":    "Price Watcher - Products",
-		"products": products,
-	})
+	data := gin.H{
+		"title":      "Price Watcher - Products",
+		"products":   page.Products,
+		"page":       page,
+		"query":      c.Request.URL.Query(),
+		"prevURL":    pageURL(c.Request.URL, page.Page-1, page.TotalPages()),
+		"nextURL":    pageURL(c.Request.URL, page.Page+1, page.TotalPages()),
+		"totalPages": page.TotalPages(),
+		"platforms":  platforms,
+	}
+
+	currency, err := s.displayCurrency(c)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if currency != "" {
+		total, unconverted, err := s.convertForDisplay(page.Products, currency)
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"error": "Failed to load exchange rates",
+			})
+			return
+		}
+		data["displayCurrency"], data["displayTotal"], data["unconverted"] = currency, &total, unconverted
+	}
+
+	c.HTML(http.StatusOK, "products.html", data)
 }
 
 func (s *Server) createProduct(c *gin.Context) {
 	var req struct {
-		Name string `json:"name" binding:"required"`
-		URL  string `json:"url" binding:"required"`
+		Name        string       `json:"name" binding:"required"`
+		URL         string       `json:"url" binding:"required"`
+		Folder      string       `json:"folder"`
+		Tags        []string     `json:"tags"`
+		TargetPrice *money.Money `json:"target_price"`
+		Currency    string       `json:"currency"`
+		Location    string       `json:"location"`
+		AlertOn     string       `json:"alert_on"`
+		// AlertCooldownMinutes overrides ALERT_COOLDOWN for the product.
+		AlertCooldownMinutes *int `json:"alert_cooldown_minutes"`
+		// AlertIncreasePercent, AlertVolatility and AlertBackToNormal opt
+		// in to the alerts on the price rising, being volatile or getting
+		// back to normal after a sale.
+		AlertIncreasePercent *float64 `json:"alert_increase_percent"`
+		AlertVolatility      bool     `json:"alert_volatility"`
+		AlertBackToNormal    bool     `json:"alert_back_to_normal"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	currency, target, err := productCurrency(req.Currency, scraper.CurrencyForURL(req.URL), req.TargetPrice)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if target != nil && target.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target price must not be negative"})
+		return
+	}
 
 	// Determine platform from URL
 	platform := s.detectPlatform(req.URL)
@@ -106,9 +261,34 @@ func (s *Server) createProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported platform"})
 		return
 	}
+	loc, err := productLocation(platform, req.Location)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var alertOn *string
+	if req.AlertOn != "" {
+		if alertOn, err = productAlertOn(req.AlertOn); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	// Create product
-	product, err := s.db.CreateProduct(req.Name, req.URL, platform)
+	if req.AlertCooldownMinutes != nil && *req.AlertCooldownMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alert cooldown must not be negative"})
+		return
+	}
+	if req.AlertIncreasePercent != nil && *req.AlertIncreasePercent < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alert increase percent must not be negative"})
+		return
+	}
+
+	// Create the product with its settings in one go
+	folder := strings.TrimSpace(req.Folder)
+	update := database.ProductUpdate{Folder: &folder, Tags: req.Tags, TargetPrice: target, Location: &loc, AlertOn: alertOn,
+		AlertCooldownMinutes: req.AlertCooldownMinutes, AlertIncreasePercent: req.AlertIncreasePercent,
+		AlertVolatility: &req.AlertVolatility, AlertBackToNormal: &req.AlertBackToNormal}
+	product, err := s.db.CreateProductWith(req.Name, req.URL, platform, currency, update)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -118,13 +298,271 @@ func (s *Server) createProduct(c *gin.Context) {
 }
 
 func (s *Server) getProducts(c *gin.Context) {
-	products, err := s.db.GetProducts()
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency, err := s.displayCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := s.db.ListProducts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if currency != "" {
+		if _, _, err := s.convertForDisplay(page.Products, currency); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (s *Server) updateProduct(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Name        *string      `json:"name"`
+		Folder      *string      `json:"folder"`
+		Tags        *[]string    `json:"tags"`
+		TargetPrice *money.Money `json:"target_price"`
+		Currency    *string      `json:"currency"`
+		// PackSize is e.g. "500 g" or "6 pcs"; "" clears it.
+		PackSize *string `json:"pack_size"`
+		// Location is e.g. "560001 12.9716,77.5946"; "" clears it.
+		Location *string `json:"location"`
+		// AlertOn is "price" or "effective_price".
+		AlertOn *string `json:"alert_on"`
+		// AlertCooldownMinutes overrides ALERT_COOLDOWN for the product; a
+		// negative value goes back to it.
+		AlertCooldownMinutes *int `json:"alert_cooldown_minutes"`
+		// AlertIncreasePercent opts in to alerts on rises of at least this
+		// percentage; 0 opts out.
+		AlertIncreasePercent *float64 `json:"alert_increase_percent"`
+		AlertVolatility      *bool    `json:"alert_volatility"`
+		AlertBackToNormal    *bool    `json:"alert_back_to_normal"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := database.ProductUpdate{Name: req.Name, Folder: req.Folder, AlertCooldownMinutes: req.AlertCooldownMinutes,
+		AlertIncreasePercent: req.AlertIncreasePercent, AlertVolatility: req.AlertVolatility, AlertBackToNormal: req.AlertBackToNormal}
+	if req.PackSize != nil {
+		size := packsize.Size{}
+		if strings.TrimSpace(*req.PackSize) != "" {
+			var err error
+			if size, err = packsize.ParseSize(*req.PackSize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if !size.Priced() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Pack size must be a weight, volume or piece count"})
+				return
+			}
+		}
+		update.PackSize = &size
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product name cannot be empty"})
+		return
+	}
+	if req.AlertIncreasePercent != nil && *req.AlertIncreasePercent < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alert increase percent must not be negative"})
+		return
+	}
+	if req.AlertOn != nil {
+		alertOn, err := productAlertOn(*req.AlertOn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.AlertOn = alertOn
+	}
+	var existing *database.Product
+	if req.TargetPrice != nil || req.Currency != nil || req.Location != nil {
+		var err error
+		existing, err = s.db.GetProduct(id)
+		if err != nil {
+			if strings.Contains(err.Error(), "product not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Location != nil {
+		loc, err := productLocation(existing.Platform, *req.Location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.Location = &loc
+	}
+	if req.TargetPrice != nil || req.Currency != nil {
+		requested := ""
+		if req.Currency != nil {
+			requested = *req.Currency
+		}
+		currency, target, err := productCurrency(requested, existing.Currency, req.TargetPrice)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if target != nil && target.Amount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target price must not be negative"})
+			return
+		}
+		update.Currency, update.TargetPrice = &currency, target
+	}
+	if req.Folder != nil {
+		folder := strings.TrimSpace(*req.Folder)
+		update.Folder = &folder
+	}
+	if req.Tags != nil {
+		update.Tags = *req.Tags
+		if update.Tags == nil {
+			update.Tags = []string{}
+		}
+	}
+
+	product, err := s.db.UpdateProduct(id, update)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// getPriceHistory returns a product's price history for the last days days
+// (default PRICE_HISTORY_DAYS), mixing raw samples and daily rollups. Prices
+// seen at different delivery locations are kept apart: the history is the
+// one at the product's current location unless ?location= names another
+// ("" for the shop's default), and locations lists every one with history.
+func (s *Server) getPriceHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	days, err := s.historyDays(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := s.db.GetProduct(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var at location.Location
+	if value, ok := c.GetQuery("location"); ok {
+		at, err = location.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if at, err = s.priceLocation(*product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	history, err := s.db.GetPriceHistory(id, at, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	locations, err := s.db.GetPriceLocations(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"days":       days,
+		"location":   at,
+		"locations":  locations,
+		"history":    history,
+	})
+}
+
+// getDiscountAnalysis judges a product's latest price at its location the
+// way drop alerts do: whether it beats the 30, 60 and 90-day median prices
+// and whether it only undoes a recent hike.
+func (s *Server) getDiscountAnalysis(c *gin.Context) {
+	id := c.Param("id")
+
+	product, err := s.db.GetProduct(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	at, err := s.priceLocation(*product)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	now := time.Now()
+	days := discount.Lookback(discount.DefaultWindows, s.config.FakeDiscountHikeDays)
+	history, err := s.db.GetPricePoints(id, at, now.AddDate(0, 0, -days), product.AlertOn == database.AlertOnEffectivePrice)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(history) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No price history"})
+		return
+	}
+
+	latest := history[len(history)-1]
+	analysis := discount.Analyze(history[:len(history)-1], latest.Price, latest.At, discount.DefaultWindows, s.config.FakeDiscountHikeDays)
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"location":   at,
+		"since":      latest.At,
+		"analysis":   analysis,
+		"summary":    analysis.Summary(now),
+	})
+}
+
+// historyDays reads the days query parameter of history endpoints,
+// defaulting to PRICE_HISTORY_DAYS.
+func (s *Server) historyDays(c *gin.Context) (int, error) {
+	v := c.Query("days")
+	if v == "" {
+		return s.config.PriceHistoryDays, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("invalid days %q", v)
+	}
+	return days, nil
 }
 
 func (s *Server) deleteProduct(c *gin.Context) {
@@ -159,60 +597,139 @@ func (s *Server) manualScrape(c *gin.Context) {
 		return
 	}
 
-	// Get product details
-	products, err := s.db.GetProducts()
+	result, err := s.scheduler.ManualScrape(id)
 	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var targetProduct database.Product
-	found := false
-	for _, product := range products {
-		if product.ID == id {
-			targetProduct = product
-			found = true
-			break
-		}
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Price scraped successfully",
+		"price":           result.Price,
+		"unit_price":      result.UnitPrice,
+		"effective_price": result.EffectivePrice,
+		"offers":          result.Offers,
+		"applied_offers":  result.Applied,
+		"location":        result.Location,
+		"product":         result.Product,
+	})
+}
 
-	if !found {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+func (s *Server) getSettings(c *gin.Context) {
+	settings, err := s.db.GetSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Scrape price
-	factory := scraper.NewScraperFactory()
-	scraper, err := factory.GetScraper(targetProduct.URL)
-	if err != nil {
+	c.JSON(http.StatusOK, settings)
+}
+
+func (s *Server) putSetting(c *gin.Context) {
+	var req struct {
+		Value string `json:"value"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	price, err := scraper.ScrapePrice(targetProduct.URL)
-	if err != nil {
+	key := c.Param("key")
+	if key == database.SettingDisplayCurrency {
+		req.Value = strings.ToUpper(strings.TrimSpace(req.Value))
+		if !money.IsCode(req.Value) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "display_currency must be an ISO 4217 code such as USD"})
+			return
+		}
+	}
+	if key == database.SettingLocation {
+		loc, err := location.Parse(req.Value)
+		if err == nil && !loc.IsZero() && !loc.HasCoordinates() {
+			err = fmt.Errorf("location %s: %w", loc, scraper.ErrLocationNeedsCoordinates)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Value = loc.String()
+	}
+	if key == database.SettingCards {
+		cards, err := offers.ParseCards(req.Value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Value = offers.FormatCards(cards)
+	}
+	if key == database.SettingDigestTelegram || key == database.SettingDigestEmail {
+		mode, err := digest.ParseMode(req.Value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Value = mode
+	}
+	if key == database.SettingUrgentAlerts {
+		types, err := digest.ParseUrgent(req.Value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Value = strings.Join(types, ",")
+		if req.Value == "" {
+			req.Value = "none"
+		}
+	}
+	if key == database.SettingTimezone {
+		req.Value = strings.TrimSpace(req.Value)
+		if _, err := time.LoadLocation(req.Value); err != nil || req.Value == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timezone must be an IANA name such as Asia/Kolkata, not %q", req.Value)})
+			return
+		}
+	}
+	if key == database.SettingQuietHours {
+		hours, err := quiet.Parse(req.Value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Value = hours.String()
+	}
+	if key == database.SettingQuietCollapse {
+		collapse, err := strconv.ParseBool(strings.TrimSpace(req.Value))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quiet_collapse must be true or false"})
+			return
+		}
+		req.Value = strconv.FormatBool(collapse)
+	}
+	if err := s.db.SetSetting(key, req.Value); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Calculate delta
-	var delta float64
-	previousPrice, err := s.db.GetLatestPrice(targetProduct.ID)
-	if err == nil && previousPrice != 0 {
-		delta = price - previousPrice
+	if key == database.SettingTimezone {
+		s.loadTimeZone()
 	}
 
-	// Add to price history
-	if err := s.db.AddPriceHistory(targetProduct.ID, price, delta, "INR"); err != nil {
+	c.JSON(http.StatusOK, gin.H{"key": key, "value": req.Value})
+}
+
+func (s *Server) deleteSetting(c *gin.Context) {
+	key := c.Param("key")
+	if err := s.db.DeleteSetting(key); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if key == database.SettingTimezone {
+		s.loadTimeZone()
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Price scraped successfully",
-		"price":   price,
-		"product": targetProduct.Name,
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "Setting deleted", "key": key})
 }
 
 func (s *Server) detectPlatform(url string) string {
@@ -235,3 +752,172 @@ func (s *Server) detectPlatform(url string) string {
 		return ""
 	}
 }
+
+// productCurrency resolves the currency of a new or edited product and reads
+// the optional target price in it. A requested currency wins, then one given
+// with the target price, then fallback.
+func productCurrency(requested, fallback string, target *money.Money) (string, *money.Money, error) {
+	currency := strings.ToUpper(strings.TrimSpace(requested))
+	if currency == "" && target != nil {
+		currency = target.Currency
+	}
+	if currency == "" {
+		currency = fallback
+	}
+	if !money.IsCode(currency) {
+		return "", nil, fmt.Errorf("invalid currency %q: use an ISO 4217 code such as INR", currency)
+	}
+	if target == nil {
+		return currency, nil, nil
+	}
+
+	inCurrency, err := target.In(currency)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid target_price: %w", err)
+	}
+	return currency, &inCurrency, nil
+}
+
+// productLocation reads the delivery location given for a product on
+// platform; "" means the location setting. Only shops that price by
+// location take one, and they need its coordinates.
+func productLocation(platform, value string) (location.Location, error) {
+	loc, err := location.Parse(value)
+	if err != nil || loc.IsZero() {
+		return loc, err
+	}
+	if !scraper.LocationAware(platform) {
+		return location.Location{}, fmt.Errorf("%s prices do not depend on location", platform)
+	}
+	if !loc.HasCoordinates() {
+		return location.Location{}, fmt.Errorf("location %s: %w", loc, scraper.ErrLocationNeedsCoordinates)
+	}
+	return loc, nil
+}
+
+// productAlertOn reads which price a product's alerts compare.
+func productAlertOn(value string) (*string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case database.AlertOnPrice, database.AlertOnEffectivePrice:
+		return &value, nil
+	}
+	return nil, fmt.Errorf("invalid alert_on %q: must be %s or %s", value, database.AlertOnPrice, database.AlertOnEffectivePrice)
+}
+
+// priceLocation returns the location a product's prices are scraped and
+// recorded at: its delivery location on shops that price by location, and
+// the zero Location elsewhere.
+func (s *Server) priceLocation(product database.Product) (location.Location, error) {
+	if !scraper.LocationAware(product.Platform) {
+		return location.Location{}, nil
+	}
+	return s.db.ProductLocation(product)
+}
+
+// parseProductFilter reads the product list query parameters shared by the
+// products page and GET /api/products.
+func parseProductFilter(c *gin.Context) (database.ProductFilter, error) {
+	filter := database.ProductFilter{
+		Search:       c.Query("q"),
+		Platform:     c.Query("platform"),
+		Tag:          c.Query("tag"),
+		Folder:       c.Query("folder"),
+		Group:        c.Query("group"),
+		Basket:       c.Query("basket"),
+		ScrapeStatus: c.Query("status"),
+		Sort:         c.DefaultQuery("sort", database.SortCreated),
+	}
+
+	// Newest, most recently changed and biggest drops first unless asked otherwise.
+	switch filter.Sort {
+	case database.SortCreated, database.SortChanged:
+		filter.Descending = true
+	}
+	switch c.Query("order") {
+	case "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	case "":
+	default:
+		return filter, fmt.Errorf("invalid order %q: must be asc or desc", c.Query("order"))
+	}
+
+	// Price bounds are in the currency asked for, the default otherwise.
+	if v := c.Query("currency"); v != "" {
+		filter.Currency = strings.ToUpper(strings.TrimSpace(v))
+		if !money.IsCode(filter.Currency) {
+			return filter, fmt.Errorf("invalid currency %q: use an ISO 4217 code such as INR", v)
+		}
+	}
+	var err error
+	if filter.MinPrice, err = queryMoney(c, "min_price", filter.Currency); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = queryMoney(c, "max_price", filter.Currency); err != nil {
+		return filter, err
+	}
+
+	if v := c.Query("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid in_stock %q", v)
+		}
+		filter.InStock = &inStock
+	}
+
+	if v := c.Query("page"); v != "" {
+		if filter.Page, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("invalid page %q", v)
+		}
+	}
+	if v := c.Query("page_size"); v != "" {
+		if filter.PageSize, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("invalid page_size %q", v)
+		}
+	}
+
+	return filter, nil
+}
+
+// queryMoney reads an amount in currency, the default currency if "".
+func queryMoney(c *gin.Context, key, currency string) (*money.Money, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	m, err := money.Parse(v, currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return &m, nil
+}
+
+// pageURL returns u with its page parameter set, or "" when page is out of range.
+func pageURL(u *url.URL, page, totalPages int) string {
+	if page < 1 || page > totalPages {
+		return ""
+	}
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	return u.Path + "?" + query.Encode()
+}
+
+var templateFuncs = template.FuncMap{
+	"price": func(p *money.Money) string {
+		if p == nil {
+			return "—"
+		}
+		return p.Format()
+	},
+	"score": func(score float64) string {
+		return fmt.Sprintf("%.0f%%", score*100)
+	},
+	"percent": func(p *float64) string {
+		if p == nil {
+			return ""
+		}
+		return fmt.Sprintf("%+.1f%%", *p)
+	},
+}
@@ -1,7 +1,16 @@
 package server
 
 import (
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
+
+	"price-watcher/database"
+	"price-watcher/digest"
+	"price-watcher/money"
+
+	"github.com/gin-gonic/gin"
 )
 
 func TestDetectPlatform(t *testing.T) {
@@ -79,3 +88,452 @@ func TestDetectPlatform(t *testing.T) {
 		})
 	}
 }
+
+
+func TestParseProductFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantError bool
+		check     func(t *testing.T, f database.ProductFilter)
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			check: func(t *testing.T, f database.ProductFilter) {
+				if f.Sort != database.SortCreated || !f.Descending {
+					t.Errorf("sort = %q desc=%v, want created desc", f.Sort, f.Descending)
+				}
+			},
+		},
+		{
+			name:  "All filters",
+			query: "q=phone&platform=amazon&tag=gift&min_price=100&max_price=200.5&in_stock=false&status=failed&sort=price&order=desc&page=3&page_size=50",
+			check: func(t *testing.T, f database.ProductFilter) {
+				if f.Search != "phone" || f.Platform != "amazon" || f.Tag != "gift" || f.ScrapeStatus != "failed" {
+					t.Errorf("unexpected text filters: %+v", f)
+				}
+				if f.MinPrice == nil || f.MinPrice.String() != "100.00" || f.MaxPrice == nil || f.MaxPrice.String() != "200.50" {
+					t.Errorf("unexpected price range: %v-%v", f.MinPrice, f.MaxPrice)
+				}
+				if f.Currency != "" || f.MinPrice.Currency != money.DefaultCurrency {
+					t.Errorf("price range currency = %q, want the default", f.MinPrice.Currency)
+				}
+				if f.InStock == nil || *f.InStock {
+					t.Errorf("in_stock = %v, want false", f.InStock)
+				}
+				if f.Sort != database.SortPrice || !f.Descending || f.Page != 3 || f.PageSize != 50 {
+					t.Errorf("unexpected sort/pagination: %+v", f)
+				}
+			},
+		},
+		{
+			name:  "Drop sorts biggest drop first",
+			query: "sort=drop",
+			check: func(t *testing.T, f database.ProductFilter) {
+				if f.Descending {
+					t.Errorf("drop sort should default to ascending change percent")
+				}
+			},
+		},
+		{
+			name:  "Price range in a currency",
+			query: "currency=usd&max_price=100",
+			check: func(t *testing.T, f database.ProductFilter) {
+				if f.Currency != "USD" || f.MaxPrice == nil || f.MaxPrice.Currency != "USD" {
+					t.Errorf("currency = %q, max_price = %v, want USD", f.Currency, f.MaxPrice)
+				}
+			},
+		},
+		{name: "Invalid price", query: "min_price=cheap", wantError: true},
+		{name: "Invalid currency", query: "currency=dollars", wantError: true},
+		{name: "Invalid stock", query: "in_stock=maybe", wantError: true},
+		{name: "Invalid order", query: "order=sideways", wantError: true},
+		{name: "Invalid page", query: "page=two", wantError: true},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/products?"+tt.query, nil)
+
+			filter, err := parseProductFilter(c)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("parseProductFilter() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProductFilter() unexpected error: %v", err)
+			}
+			tt.check(t, filter)
+		})
+	}
+}
+
+func TestParseImportCSV(t *testing.T) {
+	data := []byte("URL,name,target_price,tags\n" +
+		"https://www.amazon.in/dp/B0TEST,Phone,999.50,phones;gift\n" +
+		"https://www.flipkart.com/x,,cheap,\n")
+
+	rows, err := parseImportCSV(data)
+	if err != nil {
+		t.Fatalf("parseImportCSV() unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("parseImportCSV() returned %d rows, want 2", len(rows))
+	}
+
+	if rows[0].Name != "Phone" || rows[0].TargetPrice == nil || rows[0].TargetPrice.String() != "999.50" {
+		t.Errorf("row 1 = %+v, want name Phone and target 999.50", rows[0])
+	}
+	if len(rows[0].Tags) != 2 || rows[0].Tags[1] != "gift" {
+		t.Errorf("row 1 tags = %v, want [phones gift]", rows[0].Tags)
+	}
+	if rows[1].parseError == "" {
+		t.Errorf("row 2 should record an invalid target_price")
+	}
+
+	if _, err := parseImportCSV([]byte("name\nPhone\n")); err == nil {
+		t.Errorf("parseImportCSV() expected error for missing url column")
+	}
+}
+
+func TestParseImportJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantRows int
+		wantErr  bool
+	}{
+		{
+			name:     "Array",
+			input:    `[{"url": "https://www.amazon.in/a", "tags": ["x"]}, {"url": "https://www.amazon.in/b", "target_price": 10}]`,
+			wantRows: 2,
+		},
+		{
+			name:     "NDJSON",
+			input:    "{\"url\": \"https://www.amazon.in/a\"}\n{\"url\": \"https://www.amazon.in/b\"}\n",
+			wantRows: 2,
+		},
+		{
+			name:    "Malformed",
+			input:   `[{"url": }]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseImportJSON([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseImportJSON() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImportJSON() unexpected error: %v", err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("parseImportJSON() returned %d rows, want %d", len(rows), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestValidateImportRow(t *testing.T) {
+	negative := money.New(-500, "INR")
+	tests := []struct {
+		name     string
+		row      importRow
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "Name derived from URL",
+			row:      importRow{URL: " https://www.amazon.in/Apple-iPhone-15-128GB/dp/B0CHX1W1XY "},
+			wantName: "Apple iPhone 15 128GB",
+		},
+		{name: "Missing URL", row: importRow{Name: "x"}, wantErr: true},
+		{name: "Not a URL", row: importRow{URL: "amazon"}, wantErr: true},
+		{name: "Unsupported platform", row: importRow{URL: "https://www.myntra.com/p/1"}, wantErr: true},
+		{name: "Negative target", row: importRow{URL: "https://www.amazon.in/dp/1", TargetPrice: &negative}, wantErr: true},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := tt.row
+			_, err := s.validateImportRow(&row)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("validateImportRow() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateImportRow() unexpected error: %v", err)
+			}
+			if row.Name != tt.wantName {
+				t.Errorf("validateImportRow() name = %q, want %q", row.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	u, _ := url.Parse("/products?sort=price&page=2")
+
+	if got := pageURL(u, 3, 3); got != "/products?page=3&sort=price" {
+		t.Errorf("pageURL() = %q", got)
+	}
+	if got := pageURL(u, 4, 3); got != "" {
+		t.Errorf("pageURL() past the last page = %q, want empty", got)
+	}
+}
+
+func TestProductCurrency(t *testing.T) {
+	bare := money.Money{Amount: 1999}
+	usd := money.New(1999, "USD")
+
+	tests := []struct {
+		name         string
+		requested    string
+		fallback     string
+		target       *money.Money
+		wantCurrency string
+		wantTarget   string
+		wantErr      bool
+	}{
+		{name: "Fallback", fallback: "EUR", wantCurrency: "EUR"},
+		{name: "Requested wins", requested: "usd", fallback: "INR", wantCurrency: "USD"},
+		{name: "Bare target takes product currency", fallback: "GBP", target: &bare, wantCurrency: "GBP", wantTarget: "19.99"},
+		{name: "Target currency used when none requested", fallback: "INR", target: &usd, wantCurrency: "USD", wantTarget: "19.99"},
+		{name: "Target in another currency", requested: "INR", fallback: "INR", target: &usd, wantErr: true},
+		{name: "Invalid code", requested: "rupees", fallback: "INR", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currency, target, err := productCurrency(tt.requested, tt.fallback, tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("productCurrency() expected error, got %s", currency)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("productCurrency() unexpected error: %v", err)
+			}
+			if currency != tt.wantCurrency {
+				t.Errorf("productCurrency() currency = %s, want %s", currency, tt.wantCurrency)
+			}
+			if (target == nil) != (tt.wantTarget == "") ||
+				(target != nil && (target.String() != tt.wantTarget || target.Currency != currency)) {
+				t.Errorf("productCurrency() target = %v, want %s %s", target, tt.wantTarget, currency)
+			}
+		})
+	}
+}
+
+func TestProductLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		value    string
+		want     string
+		wantErr  bool
+	}{
+		{name: "Empty uses the setting", platform: "amazon", value: ""},
+		{name: "Coordinates", platform: "blinkit", value: "560001 12.9716,77.5946", want: "560001 12.9716,77.5946"},
+		{name: "Pincode without coordinates", platform: "zepto", value: "560001", wantErr: true},
+		{name: "Shop that ignores location", platform: "amazon", value: "12.9716,77.5946", wantErr: true},
+		{name: "Invalid", platform: "instamart", value: "Bangalore", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := productLocation(tt.platform, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("productLocation() expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("productLocation() unexpected error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("productLocation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductAlertOn(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "price", want: "price"},
+		{value: " Effective_Price ", want: "effective_price"},
+		{value: "", wantErr: true},
+		{value: "unit_price", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := productAlertOn(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("productAlertOn(%q) expected error, got %s", tt.value, *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("productAlertOn(%q) unexpected error: %v", tt.value, err)
+			}
+			if *got != tt.want {
+				t.Errorf("productAlertOn(%q) = %q, want %q", tt.value, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantCount   int
+		wantErr     bool
+	}{
+		{name: "Single JSON rate", body: `{"base":"usd","quote":"INR","rate":"83.12","effective_date":"2024-06-01"}`, wantCount: 1},
+		{name: "JSON array with numeric rate", body: `[{"base":"USD","quote":"INR","rate":83.12},{"base":"EUR","quote":"INR","rate":"90"}]`, wantCount: 2},
+		{name: "CSV body", body: "base,quote,rate\nUSD,INR,83.12\n", contentType: "text/csv", wantCount: 1},
+		{name: "CSV without content type", body: "base,quote,rate\nUSD,INR,83.12\n", wantCount: 1},
+		{name: "Invalid pair", body: `{"base":"USD","quote":"usd","rate":"1"}`, wantErr: true},
+		{name: "Negative rate", body: `[{"base":"USD","quote":"INR","rate":"-1"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := parseRates([]byte(tt.body), tt.contentType)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseRates() expected error, got %v", rates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRates() unexpected error: %v", err)
+			}
+			if len(rates) != tt.wantCount {
+				t.Errorf("parseRates() returned %d rates, want %d", len(rates), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestBuildChart(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	series := []chartSeries{
+		{Name: "amazon", Points: []chartPoint{
+			{From: start, To: start.Add(24 * time.Hour), Price: money.New(20000, "INR")},
+		}},
+		{Name: "empty"},
+		{Name: "flipkart", Points: []chartPoint{
+			{From: start.Add(24 * time.Hour), To: start.Add(48 * time.Hour), Price: money.New(10000, "INR")},
+		}},
+	}
+
+	c := buildChart(series, 100, 100)
+	if len(c.Lines) != 2 {
+		t.Fatalf("buildChart() drew %d lines, want 2", len(c.Lines))
+	}
+	if c.Lines[0].Points != "0.0,5.0 50.0,5.0" || c.Lines[1].Points != "50.0,95.0 100.0,95.0" {
+		t.Errorf("buildChart() points = %q, %q", c.Lines[0].Points, c.Lines[1].Points)
+	}
+	if c.Lines[0].Color == c.Lines[1].Color {
+		t.Errorf("buildChart() lines share color %s", c.Lines[0].Color)
+	}
+	if !c.Low.Equal(money.New(10000, "INR")) || !c.High.Equal(money.New(20000, "INR")) {
+		t.Errorf("buildChart() range = %s - %s, want 100 - 200", c.Low, c.High)
+	}
+
+	if !buildChart(nil, 100, 100).Empty() {
+		t.Errorf("buildChart(nil) should be empty")
+	}
+}
+
+func TestParseAlertFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantError bool
+		check     func(t *testing.T, f database.AlertFilter)
+	}{
+		{
+			name:  "All filters",
+			query: "product=p1&channel=telegram&status=bought&from=2024-10-01&to=2024-10-07&suppressed=false&limit=20",
+			check: func(t *testing.T, f database.AlertFilter) {
+				if f.ProductID != "p1" || f.Channel != "telegram" || f.Status != database.AlertBought || f.Limit != 20 {
+					t.Errorf("unexpected filters: %+v", f)
+				}
+				if f.From == nil || !f.From.Equal(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)) ||
+					f.To == nil || !f.To.Equal(time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("unexpected range: %v-%v, want the whole of Oct 1-7", f.From, f.To)
+				}
+				if f.Suppressed == nil || *f.Suppressed {
+					t.Errorf("suppressed = %v, want false", f.Suppressed)
+				}
+			},
+		},
+		{
+			name:  "RFC 3339 end",
+			query: "to=2024-10-07T12:00:00Z",
+			check: func(t *testing.T, f database.AlertFilter) {
+				if f.To == nil || !f.To.Equal(time.Date(2024, 10, 7, 12, 0, 0, 0, time.UTC)) {
+					t.Errorf("to = %v, want 2024-10-07T12:00:00Z", f.To)
+				}
+			},
+		},
+		{
+			name:  "Alert type",
+			query: "type=increase",
+			check: func(t *testing.T, f database.AlertFilter) {
+				if f.Type != digest.AlertIncrease {
+					t.Errorf("type = %q, want increase", f.Type)
+				}
+			},
+		},
+		{name: "Invalid status", query: "status=read", wantError: true},
+		{name: "Invalid type", query: "type=rise", wantError: true},
+		{name: "Invalid date", query: "from=yesterday", wantError: true},
+		{name: "Invalid limit", query: "limit=0", wantError: true},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/alerts?"+tt.query, nil)
+
+			filter, err := parseAlertFilter(c)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("parseAlertFilter() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAlertFilter() unexpected error: %v", err)
+			}
+			tt.check(t, filter)
+		})
+	}
+}
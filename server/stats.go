@@ -0,0 +1,199 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"price-watcher/database"
+	"price-watcher/deal"
+	"price-watcher/events"
+	"price-watcher/location"
+	"price-watcher/stats"
+)
+
+// productStats computes the price statistics of a product at its price
+// location from its whole history, using effective prices if it alerts on
+// them. It reports false if the product has no price history.
+func (s *Server) productStats(product database.Product, now time.Time) (location.Location, []stats.Point, stats.Stats, bool, error) {
+	at, err := s.priceLocation(product)
+	if err != nil {
+		return location.Location{}, nil, stats.Stats{}, false, err
+	}
+	points, err := s.db.GetPricePoints(product.ID, at, time.Time{}, product.AlertOn == database.AlertOnEffectivePrice)
+	if err != nil {
+		return at, nil, stats.Stats{}, false, err
+	}
+	summary, ok := stats.Compute(points, now)
+	return at, points, summary, ok, nil
+}
+
+func (s *Server) getPriceStats(c *gin.Context) {
+	id := c.Param("id")
+
+	product, err := s.db.GetProduct(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	at, _, summary, ok, err := s.productStats(*product, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"location":   at,
+		"stats":      summary,
+	})
+}
+
+func (s *Server) getDeal(c *gin.Context) {
+	id := c.Param("id")
+
+	days := s.config.ForecastDays
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid days %q", v)})
+			return
+		}
+		days = n
+	}
+
+	product, err := s.db.GetProduct(id)
+	if err != nil {
+		if strings.Contains(err.Error(), "product not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	at, points, summary, ok, err := s.productStats(*product, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No price history"})
+		return
+	}
+
+	verdict := deal.Evaluate(points, summary, now, days)
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"location":   at,
+		"price":      summary.Current,
+		"deal":       verdict,
+		"summary":    verdict.Summary(),
+	})
+}
+
+func (s *Server) productPage(c *gin.Context) {
+	product, err := s.db.GetProduct(c.Param("id"))
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Failed to load product"
+		if strings.Contains(err.Error(), "product not found") {
+			status, message = http.StatusNotFound, "Product not found"
+		}
+		c.HTML(status, "error.html", gin.H{"error": message})
+		return
+	}
+
+	now := time.Now()
+	at, points, summary, ok, err := s.productStats(*product, now)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load price history",
+		})
+		return
+	}
+	saleEvents, err := s.platformEvents(product.Platform)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load sale events",
+		})
+		return
+	}
+
+	alerts, err := s.db.ListAlerts(database.AlertFilter{ProductID: product.ID, Limit: 10})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load alerts",
+		})
+		return
+	}
+
+	data := gin.H{
+		"title":    "Price Watcher - " + product.Name,
+		"alerts":   alerts,
+		"product":  product,
+		"location": at,
+		"days":     stats.VolatilityDays,
+	}
+	if ok {
+		since := now.AddDate(0, 0, -stats.VolatilityDays)
+		series := []chartSeries{{Name: "Price", Points: statsChartPoints(points, since, now)}}
+		for _, ma := range summary.MovingAverages {
+			series = append(series, chartSeries{
+				Name:   fmt.Sprintf("%d-day average", ma.Days),
+				Points: statsChartPoints(ma.Points, since, now),
+			})
+		}
+		verdict := deal.Evaluate(points, summary, now, s.config.ForecastDays)
+		if verdict.Forecast != nil {
+			last := verdict.Forecast.Expected[len(verdict.Forecast.Expected)-1].At.AddDate(0, 0, 1)
+			series = append(series, chartSeries{
+				Name:   "Forecast",
+				Points: statsChartPoints(verdict.Forecast.Expected, now, last),
+			})
+		}
+		chart := buildChart(series, 720, 240)
+		chart.shadeEvents(saleEvents)
+		data["stats"] = summary
+		data["deal"] = verdict
+		data["chart"] = chart
+		data["events"] = events.Compare(points, saleEvents, product.Platform, now)
+		if summary.RangePosition != nil {
+			data["position"] = fmt.Sprintf("%.0f%%", *summary.RangePosition)
+		}
+	}
+	c.HTML(http.StatusOK, "product.html", data)
+}
+
+// statsChartPoints lays out points between from and to for buildChart, each
+// price holding until the next point.
+func statsChartPoints(points []stats.Point, from, to time.Time) []chartPoint {
+	var result []chartPoint
+	for i, p := range points {
+		end := to
+		if i+1 < len(points) {
+			end = points[i+1].At
+		}
+		start := p.At
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(start) {
+			result = append(result, chartPoint{From: start, To: end, Price: p.Price})
+		}
+	}
+	return result
+}
@@ -50,8 +50,30 @@ if (productForm) {
         
         const productData = {
             name: formData.get('name'),
-            url: formData.get('url')
+            url: formData.get('url'),
+            folder: formData.get('folder') || '',
+            tags: (formData.get('tags') || '').split(',').map(t => t.trim()).filter(t => t)
         };
+        if (formData.get('target_price')) {
+            productData.target_price = formData.get('target_price');
+        }
+        if (formData.get('location')) {
+            productData.location = formData.get('location').trim();
+        }
+        if (formData.get('alert_on')) {
+            productData.alert_on = formData.get('alert_on');
+        }
+        if (formData.get('alert_cooldown_minutes')) {
+            productData.alert_cooldown_minutes = parseInt(formData.get('alert_cooldown_minutes'), 10);
+        }
+        if (formData.get('alert_increase_percent')) {
+            productData.alert_increase_percent = parseFloat(formData.get('alert_increase_percent'));
+        }
+        productData.alert_volatility = formData.get('alert_volatility') === 'on';
+        productData.alert_back_to_normal = formData.get('alert_back_to_normal') === 'on';
+        if (formData.get('currency')) {
+            productData.currency = formData.get('currency').trim().toUpperCase();
+        }
         
         // Validate URL
         if (!isValidUrl(productData.url)) {
@@ -112,7 +134,7 @@ async function scrapeProduct(productId) {
         const result = await response.json();
         
         if (response.ok) {
-            showNotification(`Price scraped successfully! Current price: ₹${result.price}`, 'success');
+            showNotification(`Price scraped successfully! Current price: ${result.price.amount} ${result.price.currency}`, 'success');
         } else {
             showNotification(result.error || 'Failed to scrape price', 'error');
         }
@@ -155,6 +177,475 @@ async function deleteProduct(productId) {
     }
 }
 
+// Create a product group
+const groupForm = document.getElementById('groupForm');
+if (groupForm) {
+    groupForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        const submitBtn = this.querySelector('button[type="submit"]');
+        const formData = new FormData(this);
+
+        const groupData = { name: formData.get('name') };
+        if (formData.get('currency')) {
+            groupData.currency = formData.get('currency').trim().toUpperCase();
+        }
+        if (formData.get('target_price')) {
+            groupData.target_price = formData.get('target_price');
+        }
+
+        setButtonLoading(submitBtn, true);
+
+        try {
+            const response = await fetch('/api/groups', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(groupData)
+            });
+
+            const result = await response.json();
+
+            if (response.ok) {
+                window.location.href = `/groups/${result.id}`;
+            } else {
+                showNotification(result.error || 'Failed to create group', 'error');
+            }
+        } catch (error) {
+            console.error('Error:', error);
+            showNotification('Network error. Please try again.', 'error');
+        } finally {
+            setButtonLoading(submitBtn, false);
+        }
+    });
+}
+
+// Add a listing to a group
+const groupAddForm = document.getElementById('groupAddForm');
+if (groupAddForm) {
+    groupAddForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        const submitBtn = this.querySelector('button[type="submit"]');
+        const productId = new FormData(this).get('product_id');
+
+        setButtonLoading(submitBtn, true);
+
+        try {
+            const response = await fetch(`/api/groups/${this.dataset.group}/products`, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ product_id: productId })
+            });
+
+            if (response.ok) {
+                window.location.reload();
+            } else {
+                const result = await response.json();
+                showNotification(result.error || 'Failed to add listing', 'error');
+            }
+        } catch (error) {
+            console.error('Error:', error);
+            showNotification('Network error. Please try again.', 'error');
+        } finally {
+            setButtonLoading(submitBtn, false);
+        }
+    });
+}
+
+// Remove a listing from its group
+async function removeFromGroup(groupId, productId) {
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/groups/${groupId}/products/${productId}`, {
+            method: 'DELETE'
+        });
+
+        if (response.ok) {
+            window.location.reload();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to remove listing', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Delete a group; its listings stay tracked
+async function deleteGroup(groupId) {
+    if (!confirm('Delete this group? Its listings will stay tracked.')) {
+        return;
+    }
+
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/groups/${groupId}`, {
+            method: 'DELETE'
+        });
+
+        if (response.ok) {
+            showNotification('Group deleted', 'success');
+            button.closest('.product-card').remove();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to delete group', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Add a sale event
+const eventForm = document.getElementById('eventForm');
+if (eventForm) {
+    eventForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        const submitBtn = this.querySelector('button[type="submit"]');
+        const formData = new FormData(this);
+
+        const eventData = {
+            name: formData.get('name'),
+            platform: (formData.get('platform') || '').trim().toLowerCase(),
+            starts_on: formData.get('starts_on'),
+            ends_on: formData.get('ends_on') || formData.get('starts_on')
+        };
+
+        setButtonLoading(submitBtn, true);
+
+        try {
+            const response = await fetch('/api/events', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(eventData)
+            });
+
+            if (response.ok) {
+                window.location.reload();
+            } else {
+                const result = await response.json();
+                showNotification(result.error || 'Failed to add event', 'error');
+            }
+        } catch (error) {
+            console.error('Error:', error);
+            showNotification('Network error. Please try again.', 'error');
+        } finally {
+            setButtonLoading(submitBtn, false);
+        }
+    });
+}
+
+// Delete a sale event
+async function deleteEvent(eventId) {
+    if (!confirm('Delete this sale event?')) {
+        return;
+    }
+
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/events/${eventId}`, {
+            method: 'DELETE'
+        });
+
+        if (response.ok) {
+            showNotification('Sale event deleted', 'success');
+            button.closest('.product-card').remove();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to delete event', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Record what became of an alert
+async function setAlertStatus(alertId, status) {
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/alerts/${alertId}`, {
+            method: 'PATCH',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ status })
+        });
+
+        const result = await response.json();
+        if (response.ok) {
+            showNotification(`Alert marked ${result.status}`, 'success');
+            button.closest('tr').querySelector('.alert-status').textContent = result.status;
+        } else {
+            showNotification(result.error || 'Failed to update alert', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Retry a dead-lettered alert delivery
+async function retryDelivery(deliveryId) {
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/deliveries/${deliveryId}/retry`, {
+            method: 'POST'
+        });
+
+        if (response.ok) {
+            showNotification('Delivery will be retried', 'success');
+            button.closest('.product-card').remove();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to retry delivery', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Create a basket
+const basketForm = document.getElementById('basketForm');
+if (basketForm) {
+    basketForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        const submitBtn = this.querySelector('button[type="submit"]');
+        const formData = new FormData(this);
+
+        const basketData = { name: formData.get('name'), cheapest: formData.get('cheapest') === 'on' };
+        if (formData.get('currency')) {
+            basketData.currency = formData.get('currency').trim().toUpperCase();
+        }
+
+        setButtonLoading(submitBtn, true);
+
+        try {
+            const response = await fetch('/api/baskets', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(basketData)
+            });
+
+            const result = await response.json();
+
+            if (response.ok) {
+                window.location.href = `/baskets/${result.id}`;
+            } else {
+                showNotification(result.error || 'Failed to create basket', 'error');
+            }
+        } catch (error) {
+            console.error('Error:', error);
+            showNotification('Network error. Please try again.', 'error');
+        } finally {
+            setButtonLoading(submitBtn, false);
+        }
+    });
+}
+
+// Switch a basket between its listed products and the cheapest platforms
+const basketModeForm = document.getElementById('basketModeForm');
+if (basketModeForm) {
+    basketModeForm.addEventListener('change', async function(e) {
+        try {
+            const response = await fetch(`/api/baskets/${this.dataset.basket}`, {
+                method: 'PATCH',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ cheapest: e.target.checked })
+            });
+
+            if (response.ok) {
+                window.location.reload();
+            } else {
+                const result = await response.json();
+                showNotification(result.error || 'Failed to update basket', 'error');
+            }
+        } catch (error) {
+            console.error('Error:', error);
+            showNotification('Network error. Please try again.', 'error');
+        }
+    });
+}
+
+// Add a product to a basket
+const basketAddForm = document.getElementById('basketAddForm');
+if (basketAddForm) {
+    basketAddForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        const submitBtn = this.querySelector('button[type="submit"]');
+        const formData = new FormData(this);
+
+        setButtonLoading(submitBtn, true);
+
+        try {
+            const response = await fetch(`/api/baskets/${this.dataset.basket}/items/${formData.get('product_id')}`, {
+                method: 'PUT',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ quantity: parseInt(formData.get('quantity'), 10) || 1 })
+            });
+
+            if (response.ok) {
+                window.location.reload();
+            } else {
+                const result = await response.json();
+                showNotification(result.error || 'Failed to add product', 'error');
+            }
+        } catch (error) {
+            console.error('Error:', error);
+            showNotification('Network error. Please try again.', 'error');
+        } finally {
+            setButtonLoading(submitBtn, false);
+        }
+    });
+}
+
+// Change how many packs of a product a basket holds
+async function setBasketQuantity(basketId, productId, quantity) {
+    try {
+        const response = await fetch(`/api/baskets/${basketId}/items/${productId}`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ quantity: parseInt(quantity, 10) })
+        });
+
+        if (response.ok) {
+            window.location.reload();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to update quantity', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    }
+}
+
+// Remove a product from a basket
+async function removeFromBasket(basketId, productId) {
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/baskets/${basketId}/items/${productId}`, {
+            method: 'DELETE'
+        });
+
+        if (response.ok) {
+            window.location.reload();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to remove product', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Delete a basket; its products stay tracked
+async function deleteBasket(basketId) {
+    if (!confirm('Delete this basket? Its products will stay tracked.')) {
+        return;
+    }
+
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/baskets/${basketId}`, {
+            method: 'DELETE'
+        });
+
+        if (response.ok) {
+            showNotification('Basket deleted', 'success');
+            button.closest('.product-card').remove();
+        } else {
+            const result = await response.json();
+            showNotification(result.error || 'Failed to delete basket', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
+// Confirm or dismiss a match suggestion
+async function reviewMatch(action, productA, productB) {
+    const button = event.target;
+    setButtonLoading(button, true);
+
+    try {
+        const response = await fetch(`/api/matches/${action}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ product_ids: [productA, productB] })
+        });
+
+        const result = await response.json();
+
+        if (response.ok) {
+            if (action === 'confirm') {
+                window.location.href = `/groups/${result.id}`;
+                return;
+            }
+            showNotification('Suggestion dismissed', 'success');
+            button.closest('.product-card').remove();
+        } else {
+            showNotification(result.error || 'Failed to review match', 'error');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        showNotification('Network error. Please try again.', 'error');
+    } finally {
+        setButtonLoading(button, false);
+    }
+}
+
 // Refresh all products
 const refreshBtn = document.getElementById('refreshBtn');
 if (refreshBtn) {
@@ -0,0 +1,346 @@
+// Package stats summarises a product's price history: its all-time low and
+// high, averages and medians over recent periods, volatility, moving
+// averages, how often the price changes and where the current price sits in
+// its historical range.
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"price-watcher/money"
+)
+
+// DefaultWindows are the periods, in days, averages and medians are
+// computed over.
+var DefaultWindows = []int{7, 30, 90}
+
+// MovingAverageDays are the lengths of the moving averages computed.
+var MovingAverageDays = []int{7, 30}
+
+// VolatilityDays is the period volatility is measured over.
+const VolatilityDays = 90
+
+// Point is a price seen at a time; it holds until the next point.
+type Point struct {
+	At    time.Time   `json:"at"`
+	Price money.Money `json:"price"`
+}
+
+// Extreme is a lowest or highest price and the latest time it was seen.
+type Extreme struct {
+	Price money.Money `json:"price"`
+	At    time.Time   `json:"at"`
+}
+
+// Window holds the time-weighted average and median and the low and high
+// of the last Days days.
+type Window struct {
+	Days    int         `json:"days"`
+	Average money.Money `json:"average"`
+	Median  money.Money `json:"median"`
+	Low     money.Money `json:"low"`
+	High    money.Money `json:"high"`
+}
+
+// MovingAverage is the Days-day simple moving average of daily closing
+// prices: its latest value and one point per day.
+type MovingAverage struct {
+	Days    int         `json:"days"`
+	Current money.Money `json:"current"`
+	Points  []Point     `json:"points"`
+}
+
+// Trends reported by Stats.Trend.
+const (
+	TrendRising  = "rising"
+	TrendFalling = "falling"
+	TrendFlat    = "flat"
+)
+
+// Stats summarises a price history.
+type Stats struct {
+	Current money.Money `json:"current"`
+	Since   time.Time   `json:"since"`
+	Low     Extreme     `json:"all_time_low"`
+	High    Extreme     `json:"all_time_high"`
+	Windows []Window    `json:"windows"`
+	// Volatility is the standard deviation of day-to-day price changes
+	// over the last VolatilityDays days, in percent.
+	Volatility     float64         `json:"volatility"`
+	MovingAverages []MovingAverage `json:"moving_averages"`
+	// Changes counts the times the price changed.
+	Changes int `json:"changes"`
+	// RangePosition is where Current sits between the all-time low (0)
+	// and high (100), or nil if the price never changed.
+	RangePosition *float64 `json:"range_position,omitempty"`
+	// Trend compares the shortest moving average with the longest, or is
+	// "" if either is missing.
+	Trend string `json:"trend,omitempty"`
+}
+
+// Compute summarises points, oldest first, whose last point is the current
+// price, as of now. Points in another currency than the current price are
+// ignored. It reports false if there are no points.
+func Compute(points []Point, now time.Time) (Stats, bool) {
+	if len(points) == 0 {
+		return Stats{}, false
+	}
+	current := points[len(points)-1].Price
+	var history []Point
+	for _, p := range points {
+		if p.Price.SameCurrency(current) {
+			history = append(history, p)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].At.Before(history[j].At) })
+
+	s := Stats{
+		Current:        current,
+		Since:          history[0].At,
+		Low:            Extreme{history[0].Price, history[0].At},
+		High:           Extreme{history[0].Price, history[0].At},
+		Windows:        []Window{},
+		MovingAverages: []MovingAverage{},
+	}
+	for i, p := range history {
+		if p.Price.Cmp(s.Low.Price) <= 0 {
+			s.Low = Extreme{p.Price, p.At}
+		}
+		if p.Price.Cmp(s.High.Price) >= 0 {
+			s.High = Extreme{p.Price, p.At}
+		}
+		if i > 0 && !p.Price.Equal(history[i-1].Price) {
+			s.Changes++
+		}
+	}
+	if spread := s.High.Price.Sub(s.Low.Price); spread.Amount > 0 {
+		position := float64(current.Sub(s.Low.Price).Amount) * 100 / float64(spread.Amount)
+		s.RangePosition = &position
+	}
+
+	for _, days := range DefaultWindows {
+		if w, ok := window(history, days, now); ok {
+			s.Windows = append(s.Windows, w)
+		}
+	}
+
+	longest := VolatilityDays
+	for _, days := range MovingAverageDays {
+		if days+VolatilityDays > longest {
+			longest = days + VolatilityDays
+		}
+	}
+	closes := DailyCloses(history, now.AddDate(0, 0, -longest), now)
+	s.Volatility = Volatility(tail(closes, VolatilityDays+1))
+	for _, days := range MovingAverageDays {
+		if ma, ok := movingAverage(closes, days, VolatilityDays); ok {
+			s.MovingAverages = append(s.MovingAverages, ma)
+		}
+	}
+	if n := len(s.MovingAverages); n > 1 && len(s.MovingAverages[0].Points) > 0 && s.MovingAverages[0].Days < s.MovingAverages[n-1].Days {
+		short, long := s.MovingAverages[0].Current, s.MovingAverages[n-1].Current
+		switch change := short.Sub(long).PercentOf(long); {
+		case change > 1:
+			s.Trend = TrendRising
+		case change < -1:
+			s.Trend = TrendFalling
+		default:
+			s.Trend = TrendFlat
+		}
+	}
+
+	return s, true
+}
+
+// span is a price and how long it held.
+type span struct {
+	price money.Money
+	held  time.Duration
+}
+
+// spans returns how long each price held between from and to.
+func spans(points []Point, from, to time.Time) ([]span, time.Duration) {
+	var result []span
+	var total time.Duration
+	for i, p := range points {
+		end := to
+		if i+1 < len(points) {
+			end = points[i+1].At
+		}
+		start := p.At
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if held := end.Sub(start); held > 0 {
+			result = append(result, span{p.Price, held})
+			total += held
+		}
+	}
+	return result, total
+}
+
+// WeightedMedian returns the median of the prices held between from and
+// to, weighting each by how long it held. points must be oldest first.
+func WeightedMedian(points []Point, from, to time.Time) (money.Money, bool) {
+	held, total := spans(points, from, to)
+	if len(held) == 0 {
+		return money.Money{}, false
+	}
+
+	sort.SliceStable(held, func(i, j int) bool { return held[i].price.Cmp(held[j].price) < 0 })
+	var seen time.Duration
+	for _, s := range held {
+		seen += s.held
+		if seen*2 >= total {
+			return s.price, true
+		}
+	}
+	return held[len(held)-1].price, true
+}
+
+// PercentAbove returns the share of the time between from and to, in
+// percent, that the price was above price. points must be oldest first.
+func PercentAbove(points []Point, price money.Money, from, to time.Time) (float64, bool) {
+	held, total := spans(points, from, to)
+	if total <= 0 {
+		return 0, false
+	}
+
+	var above time.Duration
+	for _, s := range held {
+		if s.price.Cmp(price) > 0 {
+			above += s.held
+		}
+	}
+	return float64(above) * 100 / float64(total), true
+}
+
+// window computes the Window of the last days days.
+func window(points []Point, days int, now time.Time) (Window, bool) {
+	from := now.AddDate(0, 0, -days)
+	held, total := spans(points, from, now)
+	if len(held) == 0 {
+		return Window{}, false
+	}
+
+	w := Window{Days: days, Low: held[0].price, High: held[0].price}
+	var sum float64
+	for _, s := range held {
+		sum += float64(s.price.Amount) * s.held.Seconds()
+		if s.price.Cmp(w.Low) < 0 {
+			w.Low = s.price
+		}
+		if s.price.Cmp(w.High) > 0 {
+			w.High = s.price
+		}
+	}
+	w.Average = money.New(int64(math.Round(sum/total.Seconds())), held[0].price.Currency)
+	w.Median, _ = WeightedMedian(points, from, now)
+	return w, true
+}
+
+// DailyCloses returns the price in effect at the end of each day from from
+// to now, the last day closing at now. Days before the first point are
+// skipped. points must be oldest first.
+func DailyCloses(points []Point, from, now time.Time) []Point {
+	var closes []Point
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, now.Location())
+	i := -1
+	for !day.After(now) {
+		end := day.AddDate(0, 0, 1)
+		if end.After(now) {
+			end = now
+		}
+		for i+1 < len(points) && !points[i+1].At.After(end) {
+			i++
+		}
+		if i >= 0 {
+			closes = append(closes, Point{At: day, Price: points[i].Price})
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return closes
+}
+
+// tail returns the last n points.
+func tail(points []Point, n int) []Point {
+	if len(points) > n {
+		return points[len(points)-n:]
+	}
+	return points
+}
+
+// Volatility returns the standard deviation of the percentage changes
+// between consecutive closes.
+func Volatility(closes []Point) float64 {
+	var changes []float64
+	for i := 1; i < len(closes); i++ {
+		if previous := closes[i-1].Price; previous.Amount != 0 {
+			changes = append(changes, closes[i].Price.Sub(previous).PercentOf(previous))
+		}
+	}
+	if len(changes) == 0 {
+		return 0
+	}
+
+	var mean float64
+	for _, c := range changes {
+		mean += c
+	}
+	mean /= float64(len(changes))
+	var variance float64
+	for _, c := range changes {
+		variance += (c - mean) * (c - mean)
+	}
+	return math.Sqrt(variance / float64(len(changes)))
+}
+
+// movingAverage returns the days-day moving average of closes for each of
+// the last keep days that has a full window before it.
+func movingAverage(closes []Point, days, keep int) (MovingAverage, bool) {
+	if days <= 0 || len(closes) < days {
+		return MovingAverage{}, false
+	}
+
+	ma := MovingAverage{Days: days}
+	var sum int64
+	for i, c := range closes {
+		sum += c.Price.Amount
+		if i >= days {
+			sum -= closes[i-days].Price.Amount
+		}
+		if i >= days-1 && i >= len(closes)-keep {
+			average := money.New(int64(math.Round(float64(sum)/float64(days))), c.Price.Currency)
+			ma.Points = append(ma.Points, Point{At: c.At, Price: average})
+		}
+	}
+	ma.Current = ma.Points[len(ma.Points)-1].Price
+	return ma, true
+}
+
+// Summary describes the stats in one line for alerts, e.g. "📊 30-day
+// average ₹1049.00 · all-time low ₹899.00 · 12% of its all-time range ·
+// trend falling".
+func (s Stats) Summary() string {
+	summary := "📊"
+	for _, w := range s.Windows {
+		if w.Days == 30 || w.Days == s.Windows[len(s.Windows)-1].Days {
+			summary += fmt.Sprintf(" %d-day average %s ·", w.Days, w.Average.Format())
+			break
+		}
+	}
+	summary += fmt.Sprintf(" all-time low %s", s.Low.Price.Format())
+	if s.RangePosition != nil {
+		summary += fmt.Sprintf(" · %.0f%% of its all-time range", *s.RangePosition)
+	}
+	if s.Trend != "" {
+		summary += " · trend " + s.Trend
+	}
+	return summary
+}
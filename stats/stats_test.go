@@ -0,0 +1,140 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"price-watcher/money"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+func TestWeightedMedian(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	points := []Point{{daysAgo(30), inr(100)}, {daysAgo(20), inr(300)}, {daysAgo(18), inr(200)}}
+	got, ok := WeightedMedian(points, daysAgo(30), now)
+	if !ok || !got.Equal(inr(200)) {
+		t.Errorf("WeightedMedian() = %s, %v, want ₹200", got, ok)
+	}
+	if _, ok := WeightedMedian(points, now, now.Add(time.Hour)); !ok {
+		t.Error("WeightedMedian() after the last point = false, want the last price")
+	}
+	if _, ok := WeightedMedian(nil, daysAgo(30), now); ok {
+		t.Error("WeightedMedian() with no points = true, want false")
+	}
+}
+
+func TestPercentAbove(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	points := []Point{{daysAgo(40), inr(100)}, {daysAgo(30), inr(300)}, {daysAgo(10), inr(200)}}
+	tests := []struct {
+		price int64
+		want  float64
+	}{{50, 100}, {100, 75}, {200, 50}, {300, 0}}
+	for _, tt := range tests {
+		got, ok := PercentAbove(points, inr(tt.price), daysAgo(40), now)
+		if !ok || math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("PercentAbove(₹%d) = %v, %v, want %v", tt.price, got, ok, tt.want)
+		}
+	}
+	if _, ok := PercentAbove(nil, inr(100), daysAgo(40), now); ok {
+		t.Error("PercentAbove() with no points = true, want false")
+	}
+}
+
+func TestCompute(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	tests := []struct {
+		name       string
+		points     []Point
+		low, high  int64
+		changes    int
+		position   float64 // -1 for none
+		average30  int64   // 0 if the 30-day window is missing
+		trend      string
+		volatility bool
+	}{
+		{
+			name:   "Single price",
+			points: []Point{{daysAgo(200), inr(999)}},
+			low:    999, high: 999, position: -1, average30: 999, trend: TrendFlat,
+		},
+		{
+			name:   "Recent drop",
+			points: []Point{{daysAgo(200), inr(1200)}, {daysAgo(100), inr(1000)}, {daysAgo(3), inr(800)}},
+			low:    800, high: 1200, changes: 2, position: 0, average30: 980, trend: TrendFalling, volatility: true,
+		},
+		{
+			name:   "Recent rise",
+			points: []Point{{daysAgo(200), inr(800)}, {daysAgo(3), inr(1000)}, {daysAgo(1), inr(900)}},
+			low:    800, high: 1000, changes: 2, position: 50, trend: TrendRising, volatility: true,
+		},
+		{
+			name:   "Short history",
+			points: []Point{{daysAgo(2), inr(500)}},
+			low:    500, high: 500, position: -1, average30: 500,
+		},
+		{
+			name:   "Other currencies ignored",
+			points: []Point{{daysAgo(200), money.New(100, "USD")}, {daysAgo(200), inr(999)}},
+			low:    999, high: 999, position: -1, average30: 999, trend: TrendFlat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := Compute(tt.points, now)
+			if !ok {
+				t.Fatal("Compute() = false, want stats")
+			}
+			if !s.Low.Price.Equal(inr(tt.low)) || !s.High.Price.Equal(inr(tt.high)) {
+				t.Errorf("Compute() low/high = %s/%s, want ₹%d/₹%d", s.Low.Price, s.High.Price, tt.low, tt.high)
+			}
+			if s.Changes != tt.changes {
+				t.Errorf("Compute() changes = %d, want %d", s.Changes, tt.changes)
+			}
+			switch {
+			case tt.position < 0 && s.RangePosition != nil:
+				t.Errorf("Compute() range position = %v, want none", *s.RangePosition)
+			case tt.position >= 0 && (s.RangePosition == nil || math.Abs(*s.RangePosition-tt.position) > 0.01):
+				t.Errorf("Compute() range position = %v, want %v", s.RangePosition, tt.position)
+			}
+			if tt.average30 != 0 {
+				found := false
+				for _, w := range s.Windows {
+					if w.Days == 30 {
+						found = true
+						if !w.Average.Equal(inr(tt.average30)) {
+							t.Errorf("Compute() 30-day average = %s, want ₹%d", w.Average, tt.average30)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("Compute() windows = %+v, want a 30-day window", s.Windows)
+				}
+			}
+			if s.Trend != tt.trend {
+				t.Errorf("Compute() trend = %q, want %q", s.Trend, tt.trend)
+			}
+			if (s.Volatility > 0) != tt.volatility {
+				t.Errorf("Compute() volatility = %v, want nonzero %v", s.Volatility, tt.volatility)
+			}
+			if summary := s.Summary(); summary == "" {
+				t.Error("Summary() is empty")
+			}
+		})
+	}
+
+	if _, ok := Compute(nil, now); ok {
+		t.Error("Compute(nil) = true, want false")
+	}
+}
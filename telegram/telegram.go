@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -35,6 +36,18 @@ func NewBot(token, chatID string) (*Bot, error) {
 }
 
 func (b *Bot) SendMessage(message string) error {
+	return b.SendMessageWithButtons(message, nil)
+}
+
+// Button is an inline button under a message; pressing it passes Data to
+// the handler given to HandleButtons.
+type Button struct {
+	Text string
+	Data string
+}
+
+// SendMessageWithButtons sends a message with a row of inline buttons.
+func (b *Bot) SendMessageWithButtons(message string, buttons []Button) error {
 	if !b.enabled {
 		log.Printf("TELEGRAM ALERT (not sent - bot disabled): %s", message)
 		return nil
@@ -48,6 +61,13 @@ func (b *Bot) SendMessage(message string) error {
 	msg := tgbotapi.NewMessage(chatID, message)
 	msg.ParseMode = "HTML"
 	msg.DisableWebPagePreview = false
+	if len(buttons) > 0 {
+		row := make([]tgbotapi.InlineKeyboardButton, len(buttons))
+		for i, button := range buttons {
+			row[i] = tgbotapi.NewInlineKeyboardButtonData(button.Text, button.Data)
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	}
 
 	if _, err := b.bot.Send(msg); err != nil {
 		return fmt.Errorf("failed to send Telegram message: %w", err)
@@ -57,19 +77,70 @@ func (b *Bot) SendMessage(message string) error {
 	return nil
 }
 
-func (b *Bot) SendPriceAlert(productName, platform string, oldPrice, newPrice float64, url string) error {
-	message := fmt.Sprintf(
-		"🚨 <b>PRICE DROP ALERT!</b> 🚨\n\n"+
-			"📦 <b>Product:</b> %s\n"+
-			"🏪 <b>Platform:</b> %s\n"+
-			"💰 <b>Previous Price:</b> ₹%.2f\n"+
-			"💸 <b>Current Price:</b> ₹%.2f\n"+
-			"💵 <b>Savings:</b> ₹%.2f\n\n"+
-			"🔗 <a href=\"%s\">View Product</a>",
-		productName, platform, oldPrice, newPrice, oldPrice-newPrice, url,
-	)
-
-	return b.SendMessage(message)
+// pressedMark is put before the text of the button last pressed.
+const pressedMark = "✅ "
+
+// HandleButtons passes the data of the buttons pressed in the configured
+// chat to handle until stop is closed. What handle returns is shown to the
+// user, and the button is marked as the one pressed.
+func (b *Bot) HandleButtons(stop <-chan struct{}, handle func(data string) (string, error)) {
+	if !b.enabled {
+		return
+	}
+
+	config := tgbotapi.NewUpdate(0)
+	config.Timeout = 30
+	config.AllowedUpdates = []string{"callback_query"}
+	updates := b.bot.GetUpdatesChan(config)
+	defer b.bot.StopReceivingUpdates()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if update.CallbackQuery != nil {
+				b.pressed(update.CallbackQuery, handle)
+			}
+		}
+	}
+}
+
+func (b *Bot) pressed(query *tgbotapi.CallbackQuery, handle func(data string) (string, error)) {
+	if query.Message == nil || strconv.FormatInt(query.Message.Chat.ID, 10) != b.chatID {
+		log.Printf("Ignoring Telegram button pressed outside the configured chat")
+		b.bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	reply, err := handle(query.Data)
+	if err != nil {
+		log.Printf("Failed to handle Telegram button %q: %v", query.Data, err)
+		reply = "Something went wrong, please try again"
+	}
+	if _, err := b.bot.Request(tgbotapi.NewCallback(query.ID, reply)); err != nil {
+		log.Printf("Failed to answer Telegram button: %v", err)
+	}
+	if err != nil || query.Message.ReplyMarkup == nil {
+		return
+	}
+
+	markup := *query.Message.ReplyMarkup
+	for _, row := range markup.InlineKeyboard {
+		for i, button := range row {
+			row[i].Text = strings.TrimPrefix(button.Text, pressedMark)
+			if button.CallbackData != nil && *button.CallbackData == query.Data {
+				row[i].Text = pressedMark + row[i].Text
+			}
+		}
+	}
+	edit := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, markup)
+	if _, err := b.bot.Request(edit); err != nil {
+		log.Printf("Failed to mark pressed Telegram button: %v", err)
+	}
 }
 
 func (b *Bot) IsEnabled() bool {
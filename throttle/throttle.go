@@ -0,0 +1,112 @@
+// Package throttle decides whether a price drop alert is sent or
+// suppressed, so a price flapping between two values does not alert on
+// every drop. An alert is suppressed within a cooldown after the last one,
+// when a price as low was already alerted on recently, and, with
+// hysteresis, until the price has risen clear of the last alerted price or
+// dropped well below it.
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+// Rules configure which alerts are suppressed; zero values turn a rule off.
+type Rules struct {
+	// Cooldown is the least time between two alerts.
+	Cooldown time.Duration
+	// DedupWindow is how long an alerted price suppresses alerts about the
+	// same or a higher price.
+	DedupWindow time.Duration
+	// Hysteresis is how far, in percent, the price must rise above the last
+	// alerted price, or drop below it, before another alert.
+	Hysteresis float64
+}
+
+// Window returns how far back sent alerts matter to the rules.
+func (r Rules) Window() time.Duration {
+	window := r.Cooldown
+	if r.DedupWindow > window {
+		window = r.DedupWindow
+	}
+	if r.Hysteresis > 0 {
+		// The last alert re-arms hysteresis however old it is; a month is
+		// long enough for the price to have moved on.
+		if month := 30 * 24 * time.Hour; month > window {
+			window = month
+		}
+	}
+	return window
+}
+
+// Sent is an alert sent earlier.
+type Sent struct {
+	At    time.Time   `json:"at"`
+	Price money.Money `json:"price"`
+}
+
+// Check returns why an alert about a drop to price at now is suppressed,
+// or "" if it is sent. sent are the alerts sent within Window, latest
+// first, and since the prices seen after the latest of them, oldest first.
+// Alerts and prices in another currency are ignored.
+func (r Rules) Check(price money.Money, now time.Time, sent []Sent, since []stats.Point) string {
+	var last *Sent
+	for i := range sent {
+		if sent[i].Price.SameCurrency(price) {
+			last = &sent[i]
+			break
+		}
+	}
+	if last == nil {
+		return ""
+	}
+
+	if elapsed := now.Sub(last.At); r.Cooldown > 0 && elapsed < r.Cooldown {
+		return fmt.Sprintf("cooldown: last alert %s ago, cooldown %s", round(elapsed), round(r.Cooldown))
+	}
+
+	if r.DedupWindow > 0 {
+		for _, s := range sent {
+			if s.Price.SameCurrency(price) && now.Sub(s.At) < r.DedupWindow && price.Cmp(s.Price) >= 0 {
+				return fmt.Sprintf("duplicate: %s was alerted on %s ago", s.Price.Format(), round(now.Sub(s.At)))
+			}
+		}
+	}
+
+	if r.Hysteresis > 0 {
+		rearm := money.New(int64(math.Round(float64(last.Price.Amount)*(1+r.Hysteresis/100))), price.Currency)
+		further := money.New(int64(math.Round(float64(last.Price.Amount)*(1-r.Hysteresis/100))), price.Currency)
+		if price.Cmp(further) > 0 {
+			rose := false
+			for _, p := range since {
+				if p.At.After(last.At) && p.Price.SameCurrency(price) && p.Price.Cmp(rearm) >= 0 {
+					rose = true
+					break
+				}
+			}
+			if !rose {
+				return fmt.Sprintf("hysteresis: the price has not risen %.4g%% above %s since the last alert", r.Hysteresis, last.Price.Format())
+			}
+		}
+	}
+
+	return ""
+}
+
+// round shortens d for messages, e.g. "2h15m0s" to "2h15m" and "6h0m0s" to
+// "6h".
+func round(d time.Duration) string {
+	s := d.Round(time.Minute).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
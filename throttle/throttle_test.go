@@ -0,0 +1,71 @@
+package throttle
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"price-watcher/money"
+	"price-watcher/stats"
+)
+
+func inr(rupees int64) money.Money {
+	return money.New(rupees*100, "INR")
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+	rules := Rules{Cooldown: 6 * time.Hour, DedupWindow: 7 * 24 * time.Hour, Hysteresis: 2}
+	alertedAt := now.Add(-24 * time.Hour)
+	sent := []Sent{{At: alertedAt, Price: inr(999)}}
+	rose := []stats.Point{{At: alertedAt.Add(time.Hour), Price: inr(1049)}}
+
+	tests := []struct {
+		name  string
+		rules Rules
+		price money.Money
+		sent  []Sent
+		since []stats.Point
+		want  string
+	}{
+		{"first alert", rules, inr(999), nil, nil, ""},
+		{"within cooldown", rules, inr(900), []Sent{{At: now.Add(-2 * time.Hour), Price: inr(999)}}, nil, "cooldown: last alert 2h ago, cooldown 6h"},
+		{"flapping back to the alerted price", rules, inr(999), sent, rose, "duplicate"},
+		{"higher than an alerted price", rules, inr(1010), sent, rose, "duplicate"},
+		{"alerted price outside the dedup window", rules, inr(999), []Sent{{At: now.AddDate(0, 0, -8), Price: inr(999)}},
+			[]stats.Point{{At: now.AddDate(0, 0, -7), Price: inr(1049)}}, ""},
+		{"small drop without a rise", rules, inr(990), sent, nil, "hysteresis"},
+		{"small rise does not re-arm", rules, inr(990), sent, []stats.Point{{At: alertedAt.Add(time.Hour), Price: inr(1010)}}, "hysteresis"},
+		{"rise before the alert does not re-arm", rules, inr(990), sent, []stats.Point{{At: alertedAt.Add(-time.Hour), Price: inr(1049)}}, "hysteresis"},
+		{"drop after a rise", rules, inr(990), sent, rose, ""},
+		{"large further drop", rules, inr(970), sent, nil, ""},
+		{"rules off", Rules{}, inr(999), sent, nil, ""},
+		{"other currency", rules, money.New(1199, "USD"), sent, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rules.Check(tt.price, now, tt.sent, tt.since)
+			if (tt.want == "") != (got == "") || !strings.HasPrefix(got, tt.want) {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		want  time.Duration
+	}{
+		{Rules{}, 0},
+		{Rules{Cooldown: 6 * time.Hour}, 6 * time.Hour},
+		{Rules{Cooldown: 6 * time.Hour, DedupWindow: 48 * time.Hour}, 48 * time.Hour},
+		{Rules{Cooldown: time.Hour, Hysteresis: 2}, 30 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.Window(); got != tt.want {
+			t.Errorf("%+v.Window() = %s, want %s", tt.rules, got, tt.want)
+		}
+	}
+}